@@ -12,8 +12,6 @@ import (
 	"google.golang.org/protobuf/types/known/emptypb"
 )
 
-var log = apputil.InitLogging()
-
 // ExampleService just contains a field for demonstation purposes
 type ExampleService struct {
 	exampleapi.UnimplementedExampleServiceServer
@@ -22,7 +20,7 @@ type ExampleService struct {
 
 // Print is just a demo
 func (service *ExampleService) Print(ctx context.Context, inp *exampleapi.PrintInput) (*emptypb.Empty, error) {
-	log.Infof("Printing [%v]", inp.Text)
+	apputil.FromContext(ctx).Infof("Printing [%v]", inp.Text)
 	var err error
 	return &emptypb.Empty{}, serviceutil.AsGrpcError(err, "Failed to print [%v]", inp.Text)
 }
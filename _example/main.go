@@ -7,10 +7,10 @@ import (
 	"example/internal/exampleapiimpl"
 
 	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/apputil/logbridge"
 	"github.com/science-computing/service-common-golang/serviceutil"
 
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
-	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 )
@@ -24,13 +24,30 @@ const grpcPublishPortConfigKey = "grpcPublishPort"
 var log = apputil.InitLogging()
 
 func main() {
-	// parse command line flags. Do this even if you dont use flags here,
-	// to initialize flags used by other packages, e.g. serviceutil
-	pflag.Parse()
-
-	//init config with mandatory parameters
-	apputil.InitConfig(projectName, serviceName, []string{myConfigKey})
+	// log panics as crash report and run exit hooks
+	defer apputil.HandlePanics()
+
+	// route standard library and grpc logging through apputil
+	logbridge.Redirect()
+
+	// document the config keys of the service for the config schema subcommand
+	apputil.RegisterConfigKeys(serviceName,
+		apputil.ConfigKey{Key: myConfigKey, Type: "string", Description: "example setting"},
+		apputil.ConfigKey{Key: grpcPublishPortConfigKey, Type: "string", Default: "8090", Description: "port of the gRPC server"},
+	)
+
+	// parse command line flags (including flags used by other packages),
+	// init config with mandatory parameters and run the subcommand, serve by default
+	app := &apputil.App{
+		ProjectName:  projectName,
+		ServiceName:  serviceName,
+		RequiredKeys: []string{myConfigKey},
+		Serve:        serve,
+	}
+	app.Run()
+}
 
+func serve() error {
 	var server exampleapi.ExampleServiceServer
 	myConfig := viper.GetString(myConfigKey)
 
@@ -57,4 +74,5 @@ func main() {
 
 	//wait forever
 	service.WaitGroup.Wait()
+	return nil
 }
@@ -0,0 +1,175 @@
+package amqputil
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// defaults of AdaptiveOptions
+const (
+	DefaultAdaptInterval   = 10 * time.Second
+	DefaultTargetDrainTime = 30 * time.Second
+)
+
+var poolWorkers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "amqp_pool_workers",
+	Help: "The number of workers of adaptive consume pools by queue",
+}, []string{"queue"})
+
+// AdaptiveOptions configures an adaptive ConsumePool
+type AdaptiveOptions struct {
+	MinWorkers int
+	MaxWorkers int
+	// TargetDrainTime is the time the workers should need for the backlog,
+	// estimated from the queue depth and the average handling time, default
+	// DefaultTargetDrainTime. Workers are added if it takes longer and removed
+	// if it takes less than a quarter of it or the queue is empty.
+	TargetDrainTime time.Duration
+	// Interval the number of workers is adapted in, default DefaultAdaptInterval
+	Interval time.Duration
+}
+
+// AdaptiveConsumePool works like ConsumePool, but grows and shrinks the
+// number of workers between MinWorkers and MaxWorkers of adaptive according
+// to the queue depth and the handling time of messages
+func (helper *AmqpConnectionHelper) AdaptiveConsumePool(ctx context.Context, consumerId, queueName string, adaptive AdaptiveOptions, options ConsumerOptions, handler Handler) (*ConsumePool, error) {
+	if adaptive.MinWorkers < 1 || adaptive.MaxWorkers < adaptive.MinWorkers {
+		return nil, errors.Errorf("Invalid number of AMQP consumer workers [%d-%d]", adaptive.MinWorkers, adaptive.MaxWorkers)
+	}
+	if adaptive.TargetDrainTime <= 0 {
+		adaptive.TargetDrainTime = DefaultTargetDrainTime
+	}
+	if adaptive.Interval <= 0 {
+		adaptive.Interval = DefaultAdaptInterval
+	}
+	newContext := func(worker int) (*AmqpContext, error) {
+		amqpContext, err := helper.NewAmqpContext(fmt.Sprintf("%s-%d", consumerId, worker))
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot open AMQP connection for consumer worker %d of queue [%v]", worker, queueName)
+		}
+		amqpContext.SetConsumerOptions(queueName, options)
+		return amqpContext, nil
+	}
+
+	pool := newConsumePool(ctx, queueName, handler, adaptive.MaxWorkers)
+	for i := 0; i < adaptive.MinWorkers; i++ {
+		amqpContext, err := newContext(i)
+		if err != nil {
+			pool.Stop()
+			close(pool.errors)
+			return nil, err
+		}
+		pool.startWorker(amqpContext)
+	}
+	pool.wg.Add(1)
+	go pool.adapt(adaptive, newContext)
+	go func() {
+		pool.wg.Wait()
+		close(pool.errors)
+	}()
+	return pool, nil
+}
+
+// adapt adjusts the number of workers every interval until the pool is stopped
+func (pool *ConsumePool) adapt(adaptive AdaptiveOptions, newContext func(worker int) (*AmqpContext, error)) {
+	defer pool.wg.Done()
+	ticker := time.NewTicker(adaptive.Interval)
+	defer ticker.Stop()
+	for {
+		poolWorkers.WithLabelValues(pool.queueName).Set(float64(pool.size()))
+		select {
+		case <-pool.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pool.mutex.Lock()
+		// drop workers which stopped with an error
+		running := pool.workers[:0]
+		for _, worker := range pool.workers {
+			select {
+			case <-worker.done:
+				worker.amqpContext.Close()
+			default:
+				running = append(running, worker)
+			}
+		}
+		pool.workers = running
+		workers := len(pool.workers)
+		var monitor *AmqpContext
+		if workers > 0 {
+			monitor = pool.workers[0].amqpContext
+		}
+		var latency time.Duration
+		if pool.handled > 0 {
+			latency = pool.handling / time.Duration(pool.handled)
+		}
+		pool.handled, pool.handling = 0, 0
+		nextWorker := pool.nextWorker
+		pool.mutex.Unlock()
+
+		desired := adaptive.MinWorkers
+		if monitor != nil {
+			stats, err := monitor.QueueStats(pool.queueName)
+			if err != nil {
+				log.Warnf("Cannot adapt AMQP consumer workers of queue [%v]: %v", pool.queueName, err)
+				continue
+			}
+			desired = desiredWorkers(workers, stats.Messages, latency, adaptive)
+		}
+		if desired != workers {
+			log.Infof("Adapting AMQP consumer workers of queue [%v] from %d to %d", pool.queueName, workers, desired)
+		}
+		for ; workers < desired; workers++ {
+			amqpContext, err := newContext(nextWorker)
+			if err != nil {
+				log.Warnf("Cannot add AMQP consumer worker: %v", err)
+				break
+			}
+			pool.startWorker(amqpContext)
+			nextWorker++
+		}
+		for ; workers > desired; workers-- {
+			pool.stopWorker()
+		}
+	}
+}
+
+// desiredWorkers estimates the number of workers draining depth messages
+// within the target drain time, given the average handling time latency
+func desiredWorkers(workers, depth int, latency time.Duration, adaptive AdaptiveOptions) int {
+	desired := workers
+	switch {
+	case depth == 0:
+		desired = workers - 1
+	case latency == 0:
+		// no message was handled, so the workers are busy or just started
+		desired = workers + 1
+	default:
+		drainTime := time.Duration(depth) * latency / time.Duration(workers)
+		if drainTime > adaptive.TargetDrainTime {
+			desired = int((time.Duration(depth)*latency + adaptive.TargetDrainTime - 1) / adaptive.TargetDrainTime)
+		} else if drainTime < adaptive.TargetDrainTime/4 {
+			desired = workers - 1
+		}
+	}
+	if desired < adaptive.MinWorkers {
+		return adaptive.MinWorkers
+	}
+	if desired > adaptive.MaxWorkers {
+		return adaptive.MaxWorkers
+	}
+	return desired
+}
+
+// size returns the number of workers
+func (pool *ConsumePool) size() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return len(pool.workers)
+}
@@ -0,0 +1,41 @@
+// Package amqptest starts disposable RabbitMQ brokers in Docker containers
+// for tests of AMQP code
+package amqptest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/rabbitmq"
+)
+
+// DefaultImage is the RabbitMQ image started by Start
+const DefaultImage = "rabbitmq:3.13-alpine"
+
+// Start starts a RabbitMQ broker of DefaultImage, see StartImage
+func Start(t *testing.T) *amqputil.AmqpConnectionHelper {
+	return StartImage(t, DefaultImage)
+}
+
+// StartImage starts a RabbitMQ broker of image and returns a helper connecting
+// to it once it accepts connections. The broker is removed when the test
+// finishes. The test is skipped if Docker is not available.
+func StartImage(t *testing.T, image string) *amqputil.AmqpConnectionHelper {
+	t.Helper()
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	ctx := context.Background()
+	container, err := rabbitmq.Run(ctx, image)
+	testcontainers.CleanupContainer(t, container)
+	if err != nil {
+		t.Fatalf("cannot start RabbitMQ container: %v", err)
+	}
+	url, err := container.AmqpURL(ctx)
+	if err != nil {
+		t.Fatalf("cannot get URL of RabbitMQ container: %v", err)
+	}
+	return &amqputil.AmqpConnectionHelper{AmqpConnectionURL: url}
+}
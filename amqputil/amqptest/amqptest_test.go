@@ -0,0 +1,23 @@
+package amqptest
+
+import (
+	"testing"
+)
+
+func TestStart(t *testing.T) {
+	helper := Start(t)
+
+	amqpContext := helper.GetAmqpContext("test1")
+	if amqpContext == nil {
+		t.Fatal("Couldn't connect to messaging server")
+	}
+	defer amqpContext.Close()
+
+	if err := amqpContext.PublishMessage("amqptest", "message"); err != nil {
+		t.Fatal(err)
+	}
+	var message string
+	if _, err := amqpContext.ReceiveMessage("amqptest", &message); err != nil || message != "message" {
+		t.Errorf("expected published message, got %v [%v]", message, err)
+	}
+}
@@ -2,7 +2,12 @@
 package amqputil
 
 import (
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	neturl "net/url"
+	"reflect"
+	"strings"
+	"sync"
 	"time"
 
 	"google.golang.org/protobuf/encoding/protojson"
@@ -10,20 +15,39 @@ import (
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/retryutil"
 
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
-var log = apputil.InitLogging()
+// DefaultReconnectTimeout limits how long a context tries to reconnect after the connection was lost
+const DefaultReconnectTimeout = 5 * time.Minute
+
+var (
+	log = apputil.Named("amqputil")
+
+	reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "amqp_reconnects_total",
+		Help: "The total number of reconnections after the AMQP connection or channel was lost by result",
+	}, []string{"result"})
+)
 
 type AmqpAccessor interface {
-	PublishMessage(queueName string, message interface{}) error
+	PublishMessage(queueName string, message interface{}, options ...QueueOptions) error
+	PublishMessageCtx(ctx context.Context, queueName string, message interface{}, options ...QueueOptions) error
 	ReceiveMessage(queueName string, message interface{}) (delivery *amqp.Delivery, err error)
+	ReceiveMessageCtx(ctx context.Context, queueName string, message interface{}) (delivery *amqp.Delivery, err error)
 	Channel() ChannelAccessor
+	Ping(ctx context.Context) error
 	Close() error
 	Reset() error
+	// Deprecated: use the errors returned by the methods
 	LastError() error
+	// Deprecated: use the errors returned by the methods
 	SetLastError(err error)
+	// Deprecated: use the errors returned by the methods
 	ResetError()
 }
 
@@ -42,278 +66,818 @@ type ChannelAccessor interface {
 	QueueInspect(name string) (amqp.Queue, error)
 }
 
+// ContextChannelAccessor is implemented by channels supporting cancellation of publishing, like *amqp.Channel
+type ContextChannelAccessor interface {
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// ConfirmChannelAccessor is implemented by channels supporting publisher confirms, like *amqp.Channel
+type ConfirmChannelAccessor interface {
+	Confirm(noWait bool) error
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error)
+}
+
+// PassiveChannelAccessor is implemented by channels able to check exchanges, like *amqp.Channel
+type PassiveChannelAccessor interface {
+	ExchangeDeclarePassive(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+}
+
+// TopologyChannelAccessor is implemented by channels able to declare exchanges and bindings, like *amqp.Channel
+type TopologyChannelAccessor interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+}
+
+// ExchangeBindChannelAccessor is implemented by channels able to bind exchanges to exchanges, like *amqp.Channel
+type ExchangeBindChannelAccessor interface {
+	ExchangeBind(destination, key, source string, noWait bool, args amqp.Table) error
+}
+
 // AmqpConnectionHelper helps to get a connection AMQP
 type AmqpConnectionHelper struct {
 	AmqpConnectionURL string
+	// FailoverURLs of further nodes of a cluster are tried in order if
+	// AmqpConnectionURL is not reachable, on connect and on reconnect
+	FailoverURLs []string
+	// TLSConfig is used for amqps:// URLs, default is created from the
+	// amqp.tls.* config keys or verifies the broker with the system CAs
+	TLSConfig *tls.Config
+	// ConsumerOptions are the defaults for consuming queues, see
+	// AmqpContext.SetConsumerOptions for settings per queue
+	ConsumerOptions ConsumerOptions
+	// BlockedTimeout is the time publishing waits while the broker blocks the
+	// connection before it fails with ErrBrokerBlocked. It fails immediately
+	// for 0 and waits until the context of publishing is done if negative.
+	BlockedTimeout time.Duration
+	// ConnectionName is shown by the broker, e.g. in the management UI,
+	// default is the amqp.connection.name config or the service name
+	ConnectionName string
+	// Vhost overrides the virtual host of the connection URLs
+	Vhost string
+	// ClientProperties are further properties of the connections shown by the broker
+	ClientProperties amqp.Table
+	// Heartbeat is the heartbeat interval of the connections, default the
+	// amqp.heartbeat config or 10s
+	Heartbeat time.Duration
+	// DialTimeout limits establishing TCP connections, default the
+	// amqp.dialtimeout config or 30s
+	DialTimeout time.Duration
+	// KeepAlive is the TCP keep-alive interval, default the amqp.keepalive
+	// config or 15s, negative disables keep-alives
+	KeepAlive time.Duration
+	// ChannelMax limits the channels per connection, default the
+	// amqp.channelmax config or the limit of the broker
+	ChannelMax uint16
+	// ReconnectTimeout limits how long contexts try to reconnect after the
+	// connection or channel was lost, default DefaultReconnectTimeout,
+	// negative disables reconnection
+	ReconnectTimeout time.Duration
+
+	// urlLock guards AmqpConnectionURL against concurrent SetConnectionURL calls
+	urlLock sync.RWMutex
+}
+
+// SetConnectionURL replaces the connection URL, e.g. after credentials were
+// rotated. Contexts obtained afterwards use the new URL.
+func (helper *AmqpConnectionHelper) SetConnectionURL(url string) {
+	helper.urlLock.Lock()
+	defer helper.urlLock.Unlock()
+	helper.AmqpConnectionURL = url
+}
+
+// ConnectionURL returns the connection URL
+func (helper *AmqpConnectionHelper) ConnectionURL() string {
+	helper.urlLock.RLock()
+	defer helper.urlLock.RUnlock()
+	return helper.AmqpConnectionURL
 }
 
 // AmqpContext simplifies amqp interaction by providing a context with
-// a persistent connection and a channel to simplify message publishing
+// a persistent connection and a channel to simplify message publishing.
+// It is safe for concurrent use, but operations on the channel are serialized.
 type AmqpContext struct {
+	// mutex guards all fields against concurrent use
+	mutex   sync.Mutex
 	err     error
 	channel ChannelAccessor
 
 	connection        *amqp.Connection
+	channelClosed     chan *amqp.Error
+	helper            *AmqpConnectionHelper
 	amqpConnectionURL string
+	reconnectTimeout  time.Duration
+	blockedTimeout    time.Duration
+	flow              flowControl
 	consumerId        string
 	queues            map[string]amqp.Queue
+	queueOptions      map[string]QueueOptions
+	exchanges         map[string]string
+	bindings          []binding
+	exchangeBindings  []binding
 	deliveryChannels  map[string]<-chan amqp.Delivery
+	consumerOptions   map[string]ConsumerOptions
+
+	defaultConsumerOptions ConsumerOptions
+	codecs                 map[string]Codec
+	retryTopologies        map[string]*RetryTopology
+	claimStore             ClaimStore
+	claimThreshold         int
+	middleware             []Middleware
+	validations            map[string]validation
+	publishMiddleware      []PublishMiddleware
+	drain                  drainState
+	reconnecting           reconnectState
+	closed                 bool
+	hooks                  lifecycleHooks
+	returnHandlers         returnHandlers
+	publishCodec           Codec
+	confirming             bool
 }
 
 // ErrNoMessages indicates, that no message were found in a queue
 var ErrNoMessage = errors.Errorf("No message found in queue")
 
-// GetAmqpContext creates an AmqpContext for the given amqpConnectionURL
-// or returns an already existing AmqpContext for the amqpConnectionURL
-// the consumerId identifies the consumer on the channel
+// binding of a queue or exchange to an exchange declared by BindQueue or BindExchange
+type binding struct {
+	destination string
+	routingKey  string
+	exchange    string
+	args        amqp.Table
+}
+
+// ErrConnectionLost is returned if the connection was lost and reconnection is disabled or timed out
+var ErrConnectionLost = errors.New("AMQP connection lost")
+
+// ErrClosed is returned by the operations of a context after Close
+var ErrClosed = errors.New("AMQP context closed")
+
+// GetAmqpContext works like NewAmqpContext, but only logs the error and
+// returns nil if the connection cannot be opened
 func (helper *AmqpConnectionHelper) GetAmqpContext(consumerId string) (amqpContext *AmqpContext) {
-	log.Debugf("Get AmqpContext for URL [%v] and id [%s]", helper.AmqpConnectionURL, consumerId)
-	amqpContext = &AmqpContext{}
-	amqpContext.amqpConnectionURL = helper.AmqpConnectionURL
+	amqpContext, err := helper.NewAmqpContext(consumerId)
+	if err != nil {
+		return nil
+	}
+	return amqpContext
+}
+
+// NewAmqpContext creates an AmqpContext for the connection URL of the helper,
+// the consumerId identifies the consumer on the channel.
+// If the connection or channel is lost, e.g. due to a broker restart, the
+// context reconnects with backoff on its next use and declares its queues and
+// consumers again, so a waiting ReceiveMessage keeps waiting.
+func (helper *AmqpConnectionHelper) NewAmqpContext(consumerId string) (*AmqpContext, error) {
+	url := helper.ConnectionURL()
+	log.Debugf("Get AmqpContext for URL [%v] and id [%s]", url, consumerId)
+	amqpContext := &AmqpContext{helper: helper}
+	amqpContext.amqpConnectionURL = url
 	amqpContext.consumerId = consumerId
-	log.Debugf("Opening AMQP connection to [%v]", helper.AmqpConnectionURL)
+	amqpContext.reconnectTimeout = helper.ReconnectTimeout
+	amqpContext.blockedTimeout = helper.BlockedTimeout
+	amqpContext.defaultConsumerOptions = helper.ConsumerOptions
+	if amqpContext.reconnectTimeout == 0 {
+		amqpContext.reconnectTimeout = DefaultReconnectTimeout
+	}
+	log.Debugf("Opening AMQP connection to [%v]", url)
 	// create connection
-	if amqpContext.connection, amqpContext.err = amqp.Dial(helper.AmqpConnectionURL); amqpContext.err != nil {
-		log.Warnf("Cannot open AMPQ connection to '%s', Reason: %s ", helper.AmqpConnectionURL, amqpContext.err.Error())
-		return nil
+	connection, err := helper.dialAny(context.Background(), url)
+	if err != nil {
+		log.Warnf("Cannot open AMPQ connection to '%s', Reason: %s ", redact(url), err.Error())
+		return nil, err
 	}
+	amqpContext.connection = connection
+	amqpContext.watchConnection()
 
 	// create channel
-	amqpContext.Reset()
+	if err := amqpContext.reset(); err != nil {
+		connection.Close()
+		return nil, err
+	}
 
-	return amqpContext
+	return amqpContext, nil
+}
+
+// dialAny opens a connection to url or, if it fails, to the first reachable FailoverURLs
+func (helper *AmqpConnectionHelper) dialAny(ctx context.Context, url string) (*amqp.Connection, error) {
+	connection, err := helper.dial(ctx, url)
+	for _, failoverURL := range helper.FailoverURLs {
+		if err == nil {
+			break
+		}
+		log.Warnf("Cannot connect to AMQP broker, failing over to [%v]: %v", redact(failoverURL), err)
+		connection, err = helper.dial(ctx, failoverURL)
+	}
+	return connection, err
+}
+
+// redact hides the password of url
+func redact(rawURL string) string {
+	parsed, err := neturl.Parse(rawURL)
+	if err != nil {
+		return "invalid URL"
+	}
+	return parsed.Redacted()
+}
+
+// HealthCheck opens and closes a connection to verify the broker is reachable, e.g. as healthutil.Check
+func (helper *AmqpConnectionHelper) HealthCheck(ctx context.Context) error {
+	connection, err := helper.dialAny(ctx, helper.ConnectionURL())
+	if err != nil {
+		return errors.Wrap(err, "Cannot open AMQP connection")
+	}
+	return connection.Close()
 }
 
 func (amqpContext *AmqpContext) Channel() ChannelAccessor {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
 	return amqpContext.channel
 }
 
-// Reset resets the channel and queues - asumes that
+// Ping verifies that the connection is open and the channel responds by
+// passively declaring the amq.direct exchange, which every broker provides.
+// It does not reconnect and can be used as healthutil.Check.
+func (amqpContext *AmqpContext) Ping(ctx context.Context) error {
+	amqpContext.mutex.Lock()
+	connection, accessor, closed := amqpContext.connection, amqpContext.channel, amqpContext.closed
+	amqpContext.mutex.Unlock()
+	if closed {
+		return ErrClosed
+	}
+	if connection != nil && connection.IsClosed() {
+		return ErrConnectionLost
+	}
+	if accessor == nil {
+		return errors.New("AMQP channel is not open")
+	}
+	channel, ok := accessor.(PassiveChannelAccessor)
+	if !ok {
+		return nil
+	}
+	result := make(chan error, 1)
+	go func() {
+		result <- channel.ExchangeDeclarePassive("amq.direct", amqp.ExchangeDirect, true, false, false, false, nil)
+	}()
+	select {
+	case err := <-result:
+		if err != nil {
+			return errors.Wrap(err, "AMQP channel does not respond")
+		}
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "AMQP channel does not respond")
+	}
+}
+
+// Reset resets the channel and queues and reopens the connection if it was
+// lost. It returns ErrClosed after Close.
 func (amqpContext *AmqpContext) Reset() error {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	if amqpContext.closed {
+		return ErrClosed
+	}
+	return amqpContext.reset()
+}
+
+func (amqpContext *AmqpContext) reset() error {
 	if amqpContext.connection == nil || amqpContext.connection.IsClosed() {
+		// pick up a connection URL with rotated credentials
+		if amqpContext.helper != nil {
+			amqpContext.amqpConnectionURL = amqpContext.helper.ConnectionURL()
+		}
 		log.Debugf("Reopening connection to %s: ", amqpContext.amqpConnectionURL)
-		if amqpContext.connection, amqpContext.err = amqp.Dial(amqpContext.amqpConnectionURL); amqpContext.err != nil {
+		if amqpContext.connection, amqpContext.err = amqpContext.dial(); amqpContext.err != nil {
 			log.Warnf("Cannot open AMPQ context, Reason: %s ", amqpContext.err.Error())
 			return amqpContext.err
 		}
+		amqpContext.watchConnection()
+		amqpContext.connected()
 	}
 	if amqpContext.channel != nil {
 		amqpContext.channel.Close()
 	}
 	// create channel
-	if amqpContext.channel, amqpContext.err = amqpContext.connection.Channel(); amqpContext.err != nil {
+	channel, err := amqpContext.connection.Channel()
+	if err != nil {
+		amqpContext.err = err
 		log.Warnf("Cannot open AMPQ channel, Reason: %s ", amqpContext.err.Error())
 		return amqpContext.err
 	}
-
-	if amqpContext.channel == nil {
-		log.Error("Channel is nil this should not happen")
-	}
+	amqpContext.channel = channel
+	amqpContext.channelClosed = channel.NotifyClose(make(chan *amqp.Error, 1))
+	go amqpContext.notifyReturns(channel.NotifyReturn(make(chan amqp.Return, 1)))
+	amqpContext.err = nil
 
 	amqpContext.queues = make(map[string]amqp.Queue)
+	amqpContext.queueOptions = make(map[string]QueueOptions)
+	amqpContext.exchanges = make(map[string]string)
+	amqpContext.bindings = nil
+	amqpContext.exchangeBindings = nil
 	amqpContext.deliveryChannels = make(map[string]<-chan amqp.Delivery)
+	amqpContext.confirming = false
 	return amqpContext.err
 }
 
-func (amqpContext *AmqpContext) EnsureQueueExists(queueName string) error {
-	// get queue from internal map or create new one
-	_, ok := amqpContext.queues[queueName]
-	if !ok {
-		var args = make(amqp.Table)
-		// args["x-queue-mode"] = "lazy"
-		amqpContext.queues[queueName], amqpContext.err =
-			amqpContext.channel.QueueDeclare(queueName, false, false, false, false, args)
-		if amqpContext.err != nil {
-			amqpContext.err = errors.Wrapf(amqpContext.err, "Cannot declare AMQP queue [%v]", queueName)
+// dial opens a connection to the URL of the context
+func (amqpContext *AmqpContext) dial() (*amqp.Connection, error) {
+	if amqpContext.helper == nil {
+		return amqp.Dial(amqpContext.amqpConnectionURL)
+	}
+	return amqpContext.helper.dialAny(context.Background(), amqpContext.amqpConnectionURL)
+}
+
+// broken returns true if the connection or channel was closed, e.g. by a broker restart
+func (amqpContext *AmqpContext) broken() bool {
+	if amqpContext.connection == nil {
+		return false
+	}
+	if amqpContext.connection.IsClosed() {
+		return true
+	}
+	select {
+	case err, ok := <-amqpContext.channelClosed:
+		if ok && err != nil {
+			log.Warnf("AMQP channel of consumerId [%v] was closed: %v", amqpContext.consumerId, err)
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// EnsureExchangeExists declares a durable exchange of the given type, i.e.
+// amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout,
+// amqp.ExchangeHeaders or a plugin type starting with x-
+func (amqpContext *AmqpContext) EnsureExchangeExists(exchange, exchangeType string) error {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return err
+	}
+	defer amqpContext.mutex.Unlock()
+	return amqpContext.ensureExchangeExists(exchange, exchangeType)
+}
+
+func (amqpContext *AmqpContext) ensureExchangeExists(exchange, exchangeType string) error {
+	if declaredType, ok := amqpContext.exchanges[exchange]; ok {
+		if declaredType != exchangeType {
+			amqpContext.err = errors.Errorf("AMQP exchange [%v] was declared as [%v], not [%v]", exchange, declaredType, exchangeType)
 			return amqpContext.err
 		}
+		return nil
 	}
+	switch exchangeType {
+	case amqp.ExchangeDirect, amqp.ExchangeTopic, amqp.ExchangeFanout, amqp.ExchangeHeaders:
+	default:
+		if !strings.HasPrefix(exchangeType, "x-") {
+			amqpContext.err = errors.Errorf("Unknown AMQP exchange type [%v]", exchangeType)
+			return amqpContext.err
+		}
+	}
+	channel, ok := amqpContext.channel.(TopologyChannelAccessor)
+	if !ok {
+		amqpContext.err = errors.New("AMQP channel cannot declare exchanges")
+		return amqpContext.err
+	}
+	if err := channel.ExchangeDeclare(exchange, exchangeType, true, false, false, false, nil); err != nil {
+		amqpContext.err = errors.Wrapf(err, "Cannot declare AMQP exchange [%v]", exchange)
+		return amqpContext.err
+	}
+	amqpContext.exchanges[exchange] = exchangeType
 	return nil
 }
 
-// PublishMessage sends given message as application/json to queue with given name.
-// If the queue does not exist, it is created.
-// Errors go to AmqpContext.Err
-func (amqpContext *AmqpContext) PublishMessage(queueName string, message interface{}) error {
-	log.Debugf("Publising message [%v] to queue [%v]", message, queueName)
+// BindQueue binds the queue, which is declared if missing, to exchange for
+// messages with routingKey, which may contain wildcards for topic exchanges.
+// args are the match arguments of headers exchanges, e.g. x-match.
+func (amqpContext *AmqpContext) BindQueue(queueName, routingKey, exchange string, args amqp.Table) error {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return err
+	}
+	defer amqpContext.mutex.Unlock()
+	return amqpContext.bindQueue(queueName, routingKey, exchange, args)
+}
 
-	// get queue from internal map or create new one
-	amqpContext.err = amqpContext.EnsureQueueExists(queueName)
-	if amqpContext.err != nil {
+func (amqpContext *AmqpContext) bindQueue(queueName, routingKey, exchange string, args amqp.Table) error {
+	if err := amqpContext.ensureQueueExists(queueName); err != nil {
+		return err
+	}
+	channel, ok := amqpContext.channel.(TopologyChannelAccessor)
+	if !ok {
+		amqpContext.err = errors.New("AMQP channel cannot bind queues")
+		return amqpContext.err
+	}
+	if err := channel.QueueBind(queueName, routingKey, exchange, false, args); err != nil {
+		amqpContext.err = errors.Wrapf(err, "Cannot bind AMQP queue [%v] to exchange [%v] with routing key [%v]", queueName, exchange, routingKey)
 		return amqpContext.err
 	}
+	declared := binding{destination: queueName, routingKey: routingKey, exchange: exchange, args: args}
+	for _, existing := range amqpContext.bindings {
+		if reflect.DeepEqual(existing, declared) {
+			return nil
+		}
+	}
+	amqpContext.bindings = append(amqpContext.bindings, declared)
+	return nil
+}
 
-	body, err := json.Marshal(message)
-	if err != nil {
-		amqpContext.err = errors.Wrapf(err, "Failed to marshall AMQP message [%v]", message)
+// BindExchange binds the exchange destination to the exchange source for
+// messages with routingKey or, for headers exchanges, matching args, see
+// HeadersMatch. Both exchanges must have been declared with
+// EnsureExchangeExists, e.g. to aggregate several exchanges into one.
+func (amqpContext *AmqpContext) BindExchange(destination, routingKey, source string, args amqp.Table) error {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return err
+	}
+	defer amqpContext.mutex.Unlock()
+	return amqpContext.bindExchange(destination, routingKey, source, args)
+}
+
+func (amqpContext *AmqpContext) bindExchange(destination, routingKey, source string, args amqp.Table) error {
+	for _, exchange := range []string{destination, source} {
+		if _, ok := amqpContext.exchanges[exchange]; !ok {
+			amqpContext.err = errors.Errorf("AMQP exchange [%v] was not declared", exchange)
+			return amqpContext.err
+		}
+	}
+	channel, ok := amqpContext.channel.(ExchangeBindChannelAccessor)
+	if !ok {
+		amqpContext.err = errors.New("AMQP channel cannot bind exchanges")
+		return amqpContext.err
+	}
+	if err := channel.ExchangeBind(destination, routingKey, source, false, args); err != nil {
+		amqpContext.err = errors.Wrapf(err, "Cannot bind AMQP exchange [%v] to exchange [%v] with routing key [%v]", destination, source, routingKey)
 		return amqpContext.err
 	}
+	declared := binding{destination: destination, routingKey: routingKey, exchange: source, args: args}
+	for _, existing := range amqpContext.exchangeBindings {
+		if reflect.DeepEqual(existing, declared) {
+			return nil
+		}
+	}
+	amqpContext.exchangeBindings = append(amqpContext.exchangeBindings, declared)
+	return nil
+}
 
-	log.Debugf("Publishing message [%v] to AMQP", string(body))
-	publishing := amqp.Publishing{ContentType: "application/json", Body: body}
+// HeadersMatch returns the binding arguments for headers exchanges matching
+// messages with all or, unless all, any of the given header values
+func HeadersMatch(all bool, headers map[string]interface{}) amqp.Table {
+	args := amqp.Table{"x-match": "any"}
+	if all {
+		args["x-match"] = "all"
+	}
+	for name, value := range headers {
+		args[name] = value
+	}
+	return args
+}
+
+// PublishMessage sends given message as application/json, or encoded by the
+// codec registered for publishing, to queue with given name.
+// If the queue does not exist, it is created with the given options.
+func (amqpContext *AmqpContext) PublishMessage(queueName string, message interface{}, options ...QueueOptions) error {
+	return amqpContext.PublishMessageCtx(context.Background(), queueName, message, options...)
+}
+
+// PublishMessageCtx works like PublishMessage, but stops reconnecting and
+// publishing when ctx is done
+func (amqpContext *AmqpContext) PublishMessageCtx(ctx context.Context, queueName string, message interface{}, options ...QueueOptions) error {
+	log.Debugf("Publising message [%v] to queue [%v]", message, queueName)
+	if err := amqpContext.lock(ctx); err != nil {
+		return err
+	}
+	// get queue from internal map or create new one
+	err := amqpContext.ensureQueueExists(queueName, options...)
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return err
+	}
 	// publish to default exchange ""
-	if err = amqpContext.channel.Publish("", queueName, false, false, publishing); err != nil {
-		amqpContext.err = errors.Wrapf(err, "Failed to publish AMQP message [%v]", message)
-		return amqpContext.err
+	return amqpContext.publish(ctx, "", queueName, message, PublishOptions{})
+}
+
+// PublishToExchange sends given message like PublishMessage to exchange with
+// routingKey. The exchange is declared with exchangeType if missing, see
+// EnsureExchangeExists.
+func (amqpContext *AmqpContext) PublishToExchange(exchange, exchangeType, routingKey string, message interface{}) error {
+	log.Debugf("Publising message [%v] to exchange [%v] with routing key [%v]", message, exchange, routingKey)
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return err
 	}
-	return amqpContext.err
+	err := amqpContext.ensureExchangeExists(exchange, exchangeType)
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return amqpContext.publish(context.Background(), exchange, routingKey, message, PublishOptions{})
 }
 
-func (amqpContext *AmqpContext) registerConsumer(queueName string) {
-	var deliveryChan <-chan amqp.Delivery
-	retries := 0
-	amqpContext.err = amqpContext.channel.Qos(
-		1,     // prefetch count
-		0,     // prefetch size
-		false, // global
-	)
-	for amqpContext.err != nil && retries < 10 {
-		retries++
-		log.Warnf("Queue %s ist not available, retrying in 3s: %v", queueName, amqpContext.err)
-		time.Sleep(3 * time.Second)
-		amqpContext.Reset()
-		if amqpContext.err != nil {
-			continue
-		}
-		amqpContext.err = amqpContext.channel.Qos(
-			1,     // prefetch count
-			0,     // prefetch size
-			false, // global
-		)
+// publish encodes and publishes message, the context must not be locked
+func (amqpContext *AmqpContext) publish(ctx context.Context, exchange, routingKey string, message interface{}, options PublishOptions) error {
+	amqpContext.mutex.Lock()
+	codec := amqpContext.encoder()
+	amqpContext.mutex.Unlock()
+	body, err := codec.Marshal(message)
+	if err != nil {
+		return amqpContext.setErr(errors.Wrapf(err, "Failed to marshall AMQP message [%v]", message))
 	}
-	if amqpContext.err != nil {
-		amqpContext.err = errors.Wrapf(amqpContext.err, "Failed to set Qos on queue [%v] for consumerId [%v]", queueName, amqpContext.consumerId)
-		return
+	if options.ContentType == "" {
+		options.ContentType = codec.ContentType()
 	}
+	return amqpContext.publishBody(ctx, exchange, routingKey, body, options)
+}
 
-	log.Debugf("Registering consumer [%v] on queue [%v]", amqpContext.consumerId, queueName)
-	retries = 0
-	for {
-		deliveryChan, amqpContext.err = amqpContext.channel.Consume(queueName, amqpContext.consumerId, false, false, false, false, nil)
-		if amqpContext.err != nil {
-			// if queue was not found, retry
-			if notFoundError, ok := amqpContext.err.(*amqp.Error); ok && notFoundError.Code == 404 && retries < 10 {
-				log.Debugf("Consumer %v did not find queue [%v]. Retrying", amqpContext.consumerId, queueName)
-				// necessary as Consume() leads to a "channel not open" error after first timed out attempt
-				amqpContext.Reset()
-				retries++
-				time.Sleep(3 * time.Second)
-			} else {
-				// if there was another error
-				amqpContext.err = errors.Wrapf(amqpContext.err, "Cannot consume AMQP queue [%v] for consumerId [%v]", queueName, amqpContext.consumerId)
-				return
-			}
-		} else {
-			amqpContext.err = nil
-			break
+// publishBody publishes the encoded message body. The context must not be
+// locked, it is only locked to publish on the channel, not while publishing
+// waits for a blocked connection or stores a claim check.
+func (amqpContext *AmqpContext) publishBody(ctx context.Context, exchange, routingKey string, body []byte, options PublishOptions) error {
+	log.Debugf("Publishing message [%v] to AMQP", string(body))
+	publish := amqpContext.publisher(func(ctx context.Context, exchange, routingKey string, publishing amqp.Publishing) error {
+		if err := amqpContext.flow.wait(ctx, amqpContext.blockedTimeout); err != nil {
+			return err
+		}
+		err := compress(&publishing, options.Compression)
+		if err == nil {
+			err = amqpContext.checkIn(ctx, &publishing)
+		}
+		if err != nil {
+			return err
+		}
+		if err := amqpContext.lock(ctx); err != nil {
+			return err
+		}
+		defer amqpContext.mutex.Unlock()
+		if channel, ok := amqpContext.channel.(ContextChannelAccessor); ok {
+			err = channel.PublishWithContext(ctx, exchange, routingKey, options.Mandatory, false, publishing)
+		} else if err = ctx.Err(); err == nil {
+			err = amqpContext.channel.Publish(exchange, routingKey, options.Mandatory, false, publishing)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "Failed to publish AMQP message to [%v]", routingKey)
 		}
+		return nil
+	})
+	if err := publish(ctx, exchange, routingKey, options.publishing(body)); err != nil {
+		return amqpContext.setErr(err)
 	}
-	amqpContext.deliveryChannels[queueName] = deliveryChan
+	return nil
 }
 
-// ReceiveMessage gets next message from queue with given queue name
-func (amqpContext *AmqpContext) ReceiveMessage(queueName string, message interface{}) (delivery *amqp.Delivery, err error) {
-	log.Debugf("Receiving message from queue [%v] for consumerId [%v)", queueName, amqpContext.consumerId)
+// PublishConfirmed publishes to the given exchange and waits until the broker
+// confirmed the message. The channel is put into confirm mode on first use.
+// The context is not locked while publishing waits for the confirmation.
+func (amqpContext *AmqpContext) PublishConfirmed(ctx context.Context, exchange, routingKey string, publishing amqp.Publishing) error {
+	if publishing.MessageId == "" {
+		publishing.MessageId = apputil.GenerateGUID()
+	}
+	log.Debugf("Publishing confirmed message to exchange [%v] with routing key [%v]", exchange, routingKey)
+	publish := amqpContext.publisher(func(ctx context.Context, exchange, routingKey string, publishing amqp.Publishing) error {
+		if err := amqpContext.flow.wait(ctx, amqpContext.blockedTimeout); err != nil {
+			return err
+		}
+		if err := amqpContext.checkIn(ctx, &publishing); err != nil {
+			return err
+		}
+		confirmation, err := amqpContext.publishDeferred(ctx, exchange, routingKey, publishing)
+		if err != nil {
+			return err
+		}
+		acked, err := confirmation.WaitContext(ctx)
+		if err != nil {
+			return errors.Wrapf(err, "No confirmation for AMQP message to [%v]", routingKey)
+		}
+		if !acked {
+			return errors.Errorf("AMQP message to [%v] was rejected by the broker", routingKey)
+		}
+		return nil
+	})
+	if err := publish(ctx, exchange, routingKey, publishing); err != nil {
+		return amqpContext.setErr(err)
+	}
+	return nil
+}
 
-	// get delivery from internal map or create new one
-	deliveryChan := amqpContext.deliveryChannels[queueName]
-	if deliveryChan == nil {
-		amqpContext.registerConsumer(queueName)
-		if amqpContext.err != nil {
-			log.Errorf("Unable to register consumer %v", amqpContext.err)
-			return nil, amqpContext.err
+// publishDeferred publishes on the channel, which is put into confirm mode on
+// first use, and returns the pending confirmation
+func (amqpContext *AmqpContext) publishDeferred(ctx context.Context, exchange, routingKey string, publishing amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	if err := amqpContext.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer amqpContext.mutex.Unlock()
+	channel, ok := amqpContext.channel.(ConfirmChannelAccessor)
+	if !ok {
+		return nil, errors.New("AMQP channel does not support publisher confirms")
+	}
+	if !amqpContext.confirming {
+		if err := channel.Confirm(false); err != nil {
+			return nil, errors.Wrap(err, "Cannot put AMQP channel into confirm mode")
 		}
-		deliveryChan = amqpContext.deliveryChannels[queueName]
+		amqpContext.confirming = true
+	}
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(ctx, exchange, routingKey, false, false, publishing)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to publish AMQP message to [%v]", routingKey)
 	}
+	return confirmation, nil
+}
 
-	var retDelivery amqp.Delivery
-	var ok bool
+// registerRetryPolicy retries registering a consumer while the queue is unavailable
+var registerRetryPolicy = retryutil.Policy{MaxAttempts: 11, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
 
-	// return false after timeout or non-ok channel read
-	select {
-	case <-time.After(10 * time.Second):
-		amqpContext.err = ErrNoMessage
-		log.Debugf("No message delivered for consumerId [%v].", amqpContext.consumerId)
-		// stop consuming
-		amqpContext.channel.Cancel(amqpContext.consumerId, false)
-		return nil, amqpContext.err
-	case retDelivery, ok = <-deliveryChan:
-		if ok && (retDelivery.Body == nil || len(retDelivery.Body) == 0) {
-			amqpContext.err = errors.New("Failed to get delivery from delivery chan. Body is empty. ConsumerId [" + amqpContext.consumerId + "]")
-			return nil, amqpContext.err
-		} else if !ok {
-			// chan is closed -> remove consumer
-			log.Debugf("Chan is closed for consumerId [%v]. ", amqpContext.consumerId)
-			amqpContext.channel.Cancel(amqpContext.consumerId, false)
-
-			/*err := amqpContext.registerConsumer(queueName)
-			if err != nil {
-				log.Errorf("Unable to register consumer %v", err)
-			}*/
+// consume sets the prefetch count and starts consuming queueName without retries
+func (amqpContext *AmqpContext) consume(queueName string) error {
+	if err := amqpContext.qos(queueName); err != nil {
+		return errors.Wrapf(err, "Failed to set Qos on queue [%v] for consumerId [%v]", queueName, amqpContext.consumerId)
+	}
+	deliveryChan, err := amqpContext.channel.Consume(queueName, amqpContext.consumerId, false, false, false, false, nil)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot consume AMQP queue [%v] for consumerId [%v]", queueName, amqpContext.consumerId)
+	}
+	amqpContext.deliveryChannels[queueName] = deliveryChan
+	return nil
+}
 
-			return nil, amqpContext.err
-		}
+// ReceiveMessage gets next message from queue with given queue name. It
+// returns ErrNoMessage if no message arrives within the receive timeout of the
+// queue, see ConsumerOptions.
+func (amqpContext *AmqpContext) ReceiveMessage(queueName string, message interface{}) (delivery *amqp.Delivery, err error) {
+	ctx, cancel := amqpContext.receiveContext(queueName)
+	defer cancel()
+	delivery, err = amqpContext.ReceiveMessageCtx(ctx, queueName, message)
+	return delivery, amqpContext.noMessage(err)
+}
+
+// ReceiveMessageCtx gets next message from queue with given queue name. It
+// waits until ctx is done and returns its error if no message arrived.
+func (amqpContext *AmqpContext) ReceiveMessageCtx(ctx context.Context, queueName string, message interface{}) (delivery *amqp.Delivery, err error) {
+	if delivery, err = amqpContext.receive(ctx, queueName); err != nil {
+		return nil, err
 	}
+	// unmarshal delivery
+	err = amqpContext.decode(delivery, message)
+	return delivery, amqpContext.setErr(err)
+}
+
+// ReceiveProtoMessage gets next protobuf message from queue with given queue
+// name, which is decoded according to its content type, see
+// PublishProtoMessage. It returns ErrNoMessage if no message arrives within
+// the receive timeout of the queue, see ConsumerOptions.
+func (amqpContext *AmqpContext) ReceiveProtoMessage(queueName string, message proto.Message) (delivery *amqp.Delivery, err error) {
+	ctx, cancel := amqpContext.receiveContext(queueName)
+	defer cancel()
+	delivery, err = amqpContext.ReceiveProtoMessageCtx(ctx, queueName, message)
+	return delivery, amqpContext.noMessage(err)
+}
 
+// ReceiveProtoMessageCtx works like ReceiveMessageCtx for protobuf messages
+func (amqpContext *AmqpContext) ReceiveProtoMessageCtx(ctx context.Context, queueName string, message proto.Message) (delivery *amqp.Delivery, err error) {
+	if delivery, err = amqpContext.receive(ctx, queueName); err != nil {
+		return nil, err
+	}
 	// unmarshal delivery
-	amqpContext.err = json.Unmarshal(retDelivery.Body, message)
+	if delivery.ContentType == ContentTypeProtobuf {
+		err = proto.Unmarshal(delivery.Body, message)
+	} else {
+		err = protojson.Unmarshal(delivery.Body, message)
+	}
+	return delivery, amqpContext.setErr(err)
+}
 
-	return &retDelivery, amqpContext.err
+// noMessage maps the timeout of the receive timeout to ErrNoMessage
+func (amqpContext *AmqpContext) noMessage(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return amqpContext.setErr(ErrNoMessage)
+	}
+	return err
 }
 
-// ReceiveMessage gets next message from queue with given queue name
-func (amqpContext *AmqpContext) ReceiveProtoMessage(queueName string, message proto.Message) (delivery *amqp.Delivery, err error) {
+// setErr sets the error returned by LastError and returns it
+func (amqpContext *AmqpContext) setErr(err error) error {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.err = err
+	return err
+}
+
+// receive waits for the next delivery from queue until ctx is done. If the
+// connection is lost meanwhile, it reconnects and keeps waiting. The context is
+// only locked while consuming is set up, so other goroutines can publish while
+// it waits. The consumer stays registered when ctx is done, so deliveries
+// prefetched meanwhile are returned by the next receive instead of staying
+// unacknowledged on the channel.
+func (amqpContext *AmqpContext) receive(ctx context.Context, queueName string) (*amqp.Delivery, error) {
 	log.Debugf("Receiving message from queue [%v] for consumerId [%v)", queueName, amqpContext.consumerId)
 
-	// get delivery from internal map or create new one
-	deliveryChan := amqpContext.deliveryChannels[queueName]
-	if deliveryChan == nil {
-		amqpContext.registerConsumer(queueName)
-		if amqpContext.err != nil {
-			log.Errorf("Unable to register consumer %v", amqpContext.err)
-			return nil, amqpContext.err
+	for {
+		deliveryChan, err := amqpContext.deliveryChan(ctx, queueName)
+		if err != nil {
+			return nil, err
 		}
-		deliveryChan = amqpContext.deliveryChannels[queueName]
-	}
-
-	var retDelivery amqp.Delivery
-	var ok bool
 
-	// return false after timeout or non-ok channel read
-	select {
-	case <-time.After(10 * time.Second):
-		amqpContext.err = ErrNoMessage
-		log.Debugf("No message delivered for consumerId [%v].", amqpContext.consumerId)
-		// stop consuming
-		amqpContext.channel.Cancel(amqpContext.consumerId, false)
-		return nil, amqpContext.err
-	case retDelivery, ok = <-deliveryChan:
-		if ok && (retDelivery.Body == nil || len(retDelivery.Body) == 0) {
-			amqpContext.err = errors.New("Failed to get delivery from delivery chan. Body is empty. ConsumerId [" + amqpContext.consumerId + "]")
-			return nil, amqpContext.err
-		} else if !ok {
-			// chan is closed -> remove consumer
-			log.Debugf("Chan is closed for consumerId [%v]. ", amqpContext.consumerId)
-			amqpContext.channel.Cancel(amqpContext.consumerId, false)
-
-			/*err := amqpContext.registerConsumer(queueName)
+		// return after ctx is done or non-ok channel read
+		select {
+		case <-ctx.Done():
+			log.Debugf("No message delivered for consumerId [%v].", amqpContext.consumerId)
+			return nil, amqpContext.setErr(ctx.Err())
+		case delivery, ok := <-deliveryChan:
+			if !ok {
+				// chan is closed, i.e. the consumer was canceled or the connection
+				// was lost -> register the consumer again, after reconnecting if necessary
+				log.Debugf("Chan is closed for consumerId [%v]. ", amqpContext.consumerId)
+				amqpContext.mutex.Lock()
+				if amqpContext.deliveryChannels[queueName] == deliveryChan {
+					delete(amqpContext.deliveryChannels, queueName)
+				}
+				amqpContext.mutex.Unlock()
+				continue
+			}
+			valid, err := amqpContext.process(ctx, queueName, &delivery)
 			if err != nil {
-				log.Errorf("Unable to register consumer %v", err)
-			}*/
-
-			return nil, amqpContext.err
+				return nil, err
+			} else if !valid {
+				continue
+			}
+			return &delivery, nil
 		}
 	}
+}
 
-	// unmarshal delivery
-	amqpContext.err = protojson.Unmarshal(retDelivery.Body, message)
+// deliveryChan returns the chan of deliveries from queueName, after
+// reconnecting and registering the consumer if necessary. Registering is
+// retried while the queue is not found, e.g. until its publisher declared it.
+func (amqpContext *AmqpContext) deliveryChan(ctx context.Context, queueName string) (<-chan amqp.Delivery, error) {
+	policy := registerRetryPolicy
+	policy.Name = "registering consumer"
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		log.Warnf("Queue %s is not available, retrying in %v: %v", queueName, delay, err)
+	}
+	deliveryChan, err := retryutil.DoValue(ctx, func(ctx context.Context) (<-chan amqp.Delivery, error) {
+		// a failed registration closed the channel, which is reopened here
+		if err := amqpContext.lock(ctx); err != nil {
+			return nil, retryutil.Permanent(err)
+		}
+		defer amqpContext.mutex.Unlock()
+		if deliveryChan := amqpContext.deliveryChannels[queueName]; deliveryChan != nil {
+			return deliveryChan, nil
+		}
+		log.Debugf("Registering consumer [%v] on queue [%v]", amqpContext.consumerId, queueName)
+		if err := amqpContext.consume(queueName); err != nil {
+			var amqpError *amqp.Error
+			if errors.As(err, &amqpError) && amqpError.Code == amqp.NotFound {
+				return nil, err
+			}
+			return nil, retryutil.Permanent(err)
+		}
+		return amqpContext.deliveryChannels[queueName], nil
+	}, policy)
+	if err != nil {
+		log.Errorf("Unable to register consumer %v", err)
+		return nil, amqpContext.setErr(err)
+	}
+	return deliveryChan, nil
+}
 
-	return &retDelivery, amqpContext.err
+// process restores and validates a received delivery. It returns false if
+// the delivery was rejected because it is empty, cannot be restored or is
+// invalid, so a single bad message does not stop consuming.
+func (amqpContext *AmqpContext) process(ctx context.Context, queueName string, delivery *amqp.Delivery) (bool, error) {
+	var err error
+	if len(delivery.Body) == 0 {
+		err = errors.New("Failed to get delivery from delivery chan. Body is empty. ConsumerId [" + amqpContext.consumerId + "]")
+	} else if err = amqpContext.checkOut(ctx, delivery); err == nil {
+		err = decompress(delivery)
+	}
+	if err != nil {
+		wrapped := newDelivery(queueName, *delivery)
+		if ctx.Err() != nil {
+			// loading a claim check was interrupted, the message is fine
+			wrapped.NackRequeue()
+			return false, amqpContext.setErr(ctx.Err())
+		}
+		log.Warnf("Rejecting AMQP message [%v] from queue [%v]: %v", delivery.MessageId, queueName, err)
+		amqpContext.setErr(err)
+		if err := wrapped.NackDiscard(); err != nil {
+			log.Warnf("Cannot reject AMQP message: %v", err)
+		}
+		return false, nil
+	}
+	valid, err := amqpContext.valid(ctx, queueName, delivery)
+	if err != nil {
+		amqpContext.setErr(err)
+	}
+	return valid, err
 }
 
-// Close closes the amqp connection
+// Close closes the amqp connection. Operations of the context fail with
+// ErrClosed afterwards, they do not reconnect.
 func (amqpContext *AmqpContext) Close() error {
 	log.Info("Closing AMQP connection and channel")
+	amqpContext.reconnecting.stop()
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	if amqpContext.closed {
+		return nil
+	}
+	amqpContext.closed = true
 	if amqpContext.channel != nil {
 		amqpContext.channel.Close()
 	}
@@ -326,14 +890,25 @@ func (amqpContext *AmqpContext) Close() error {
 	}
 }
 
+// LastError returns the error of the last failed operation of any goroutine.
+//
+// Deprecated: use the errors returned by the methods
 func (amqpContext *AmqpContext) LastError() error {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
 	return amqpContext.err
 }
 
+// ResetError clears the error returned by LastError.
+//
+// Deprecated: use the errors returned by the methods
 func (amqpContext *AmqpContext) ResetError() {
-	amqpContext.err = nil
+	amqpContext.setErr(nil)
 }
 
+// SetLastError sets the error returned by LastError.
+//
+// Deprecated: use the errors returned by the methods
 func (amqpContext *AmqpContext) SetLastError(err error) {
-	amqpContext.err = err
+	amqpContext.setErr(err)
 }
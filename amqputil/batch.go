@@ -0,0 +1,50 @@
+package amqputil
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ReceiveMessages gets up to max messages from queue with given queue name,
+// e.g. to store them in one transaction. It waits for the first message like
+// ReceiveMessage and collects further messages for at most window. The
+// prefetch count of the queue should be at least max, see ConsumerOptions.
+// Messages prefetched after the window are returned by the next receive.
+// The caller decodes the deliveries with Decode and settles them.
+func (amqpContext *AmqpContext) ReceiveMessages(queueName string, max int, window time.Duration) ([]*Delivery, error) {
+	ctx, cancel := amqpContext.receiveContext(queueName)
+	defer cancel()
+	deliveries, err := amqpContext.ReceiveMessagesCtx(ctx, queueName, max, window)
+	return deliveries, amqpContext.noMessage(err)
+}
+
+// ReceiveMessagesCtx works like ReceiveMessages, but waits for the first
+// message until ctx is done
+func (amqpContext *AmqpContext) ReceiveMessagesCtx(ctx context.Context, queueName string, max int, window time.Duration) ([]*Delivery, error) {
+	if max < 1 {
+		return nil, amqpContext.setErr(errors.Errorf("Invalid number of AMQP messages [%d]", max))
+	}
+	received, err := amqpContext.receive(ctx, queueName)
+	if err != nil {
+		return nil, err
+	}
+	first := newDelivery(queueName, *received)
+	deliveries := []*Delivery{&first}
+
+	windowCtx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+	for len(deliveries) < max {
+		received, err := amqpContext.receive(windowCtx, queueName)
+		if err != nil {
+			if windowCtx.Err() != nil {
+				break
+			}
+			return deliveries, err
+		}
+		delivery := newDelivery(queueName, *received)
+		deliveries = append(deliveries, &delivery)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,95 @@
+package amqputil
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+// ClaimCheckHeader holds the store key of a message body moved to a blob store
+const ClaimCheckHeader = "x-claim-check"
+
+// DefaultClaimCheckThreshold is the body size above which messages are stored by SetClaimCheck
+const DefaultClaimCheckThreshold = 1 << 20
+
+// claimCheckPrefix prefixes the keys of stored message bodies
+const claimCheckPrefix = "amqp-claim-check/"
+
+// ClaimStore stores message bodies for SetClaimCheck, e.g. a blobutil.Store
+type ClaimStore interface {
+	Put(ctx context.Context, key string, reader io.Reader, size int64, options ClaimPutOptions) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ClaimPutOptions are the options of ClaimStore.Put, the same type as blobutil.PutOptions
+type ClaimPutOptions = struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+// SetClaimCheck stores the bodies of published messages larger than threshold
+// bytes, default DefaultClaimCheckThreshold, in store and sends only a
+// reference, which is resolved transparently on receive. Publishers and
+// consumers must use the same store. Stored bodies are not deleted, as
+// messages may be redelivered, so the store should expire them, e.g. by a
+// lifecycle rule for the prefix amqp-claim-check/.
+func (amqpContext *AmqpContext) SetClaimCheck(store ClaimStore, threshold int) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	if threshold <= 0 {
+		threshold = DefaultClaimCheckThreshold
+	}
+	amqpContext.claimStore = store
+	amqpContext.claimThreshold = threshold
+}
+
+// checkIn moves a large body of publishing to the claim check store
+func (amqpContext *AmqpContext) checkIn(ctx context.Context, publishing *amqp.Publishing) error {
+	amqpContext.mutex.Lock()
+	store, threshold := amqpContext.claimStore, amqpContext.claimThreshold
+	amqpContext.mutex.Unlock()
+	if store == nil || len(publishing.Body) <= threshold {
+		return nil
+	}
+	key := claimCheckPrefix + apputil.GenerateGUID()
+	err := store.Put(ctx, key, bytes.NewReader(publishing.Body), int64(len(publishing.Body)), ClaimPutOptions{ContentType: publishing.ContentType})
+	if err != nil {
+		return errors.Wrapf(err, "Cannot store AMQP message body of %d bytes", len(publishing.Body))
+	}
+	headers := make(amqp.Table, len(publishing.Headers)+1)
+	for name, value := range publishing.Headers {
+		headers[name] = value
+	}
+	headers[ClaimCheckHeader] = key
+	publishing.Headers = headers
+	publishing.Body = []byte(key)
+	return nil
+}
+
+// checkOut replaces the reference in the body of delivery by the stored body
+func (amqpContext *AmqpContext) checkOut(ctx context.Context, delivery *amqp.Delivery) error {
+	key, ok := delivery.Headers[ClaimCheckHeader].(string)
+	if !ok {
+		return nil
+	}
+	amqpContext.mutex.Lock()
+	store := amqpContext.claimStore
+	amqpContext.mutex.Unlock()
+	if store == nil {
+		return errors.Errorf("AMQP message body was stored as [%v], but no claim check store is set", key)
+	}
+	reader, err := store.Get(ctx, key)
+	if err != nil {
+		return errors.Wrapf(err, "Cannot load AMQP message body [%v]", key)
+	}
+	defer reader.Close()
+	if delivery.Body, err = io.ReadAll(reader); err != nil {
+		return errors.Wrapf(err, "Cannot load AMQP message body [%v]", key)
+	}
+	return nil
+}
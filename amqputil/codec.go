@@ -0,0 +1,129 @@
+package amqputil
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// ContentTypeGob is the content type of GobCodec
+const ContentTypeGob = "application/x-gob"
+
+// Codec encodes message bodies of a content type, see AmqpContext.RegisterCodec
+type Codec interface {
+	ContentType() string
+	Marshal(message interface{}) ([]byte, error)
+	Unmarshal(body []byte, message interface{}) error
+}
+
+// JSONCodec encodes messages with encoding/json, it is the default codec
+type JSONCodec struct{}
+
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (JSONCodec) Marshal(message interface{}) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+func (JSONCodec) Unmarshal(body []byte, message interface{}) error {
+	return json.Unmarshal(body, message)
+}
+
+// ProtobufCodec encodes proto.Message messages in the binary wire format
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) ContentType() string {
+	return ContentTypeProtobuf
+}
+
+func (ProtobufCodec) Marshal(message interface{}) ([]byte, error) {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return nil, errors.Errorf("Message of type %T is no protobuf message", message)
+	}
+	return proto.Marshal(protoMessage)
+}
+
+func (ProtobufCodec) Unmarshal(body []byte, message interface{}) error {
+	protoMessage, ok := message.(proto.Message)
+	if !ok {
+		return errors.Errorf("Message of type %T is no protobuf message", message)
+	}
+	return proto.Unmarshal(body, protoMessage)
+}
+
+// GobCodec encodes messages with encoding/gob
+type GobCodec struct{}
+
+func (GobCodec) ContentType() string {
+	return ContentTypeGob
+}
+
+func (GobCodec) Marshal(message interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	err := gob.NewEncoder(&buffer).Encode(message)
+	return buffer.Bytes(), err
+}
+
+func (GobCodec) Unmarshal(body []byte, message interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(body)).Decode(message)
+}
+
+// codecs known to every context
+var defaultCodecs = map[string]Codec{
+	ContentTypeJSON:     JSONCodec{},
+	ContentTypeProtobuf: ProtobufCodec{},
+	ContentTypeGob:      GobCodec{},
+}
+
+// RegisterCodec makes codec available for received messages of its content
+// type. With publish, the codec also encodes messages published by
+// PublishMessage, PublishToExchange and their variants instead of JSON.
+func (amqpContext *AmqpContext) RegisterCodec(codec Codec, publish bool) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	if amqpContext.codecs == nil {
+		amqpContext.codecs = make(map[string]Codec)
+	}
+	amqpContext.codecs[codec.ContentType()] = codec
+	if publish {
+		amqpContext.publishCodec = codec
+	}
+}
+
+// codec returns the codec for contentType, received messages without known
+// content type are decoded as JSON
+func (amqpContext *AmqpContext) codec(contentType string) Codec {
+	if codec, ok := amqpContext.codecs[contentType]; ok {
+		return codec
+	}
+	if codec, ok := defaultCodecs[contentType]; ok {
+		return codec
+	}
+	return JSONCodec{}
+}
+
+// encoder returns the codec for published messages
+func (amqpContext *AmqpContext) encoder() Codec {
+	if amqpContext.publishCodec == nil {
+		return JSONCodec{}
+	}
+	return amqpContext.publishCodec
+}
+
+// decode unmarshals the body of delivery according to its content type
+func (amqpContext *AmqpContext) decode(delivery *amqp.Delivery, message interface{}) error {
+	amqpContext.mutex.Lock()
+	codec := amqpContext.codec(delivery.ContentType)
+	amqpContext.mutex.Unlock()
+	if err := codec.Unmarshal(delivery.Body, message); err != nil {
+		return errors.Wrapf(err, "Cannot decode AMQP message of content type [%v]", codec.ContentType())
+	}
+	return nil
+}
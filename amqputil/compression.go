@@ -0,0 +1,68 @@
+package amqputil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// content encodings of compressed message bodies, see PublishOptions.Compression
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress compresses the body of publishing with compression
+func compress(publishing *amqp.Publishing, compression string) error {
+	switch compression {
+	case "":
+		return nil
+	case CompressionGzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(publishing.Body); err != nil {
+			return errors.Wrap(err, "Cannot compress AMQP message body")
+		}
+		if err := writer.Close(); err != nil {
+			return errors.Wrap(err, "Cannot compress AMQP message body")
+		}
+		publishing.Body = buffer.Bytes()
+	case CompressionZstd:
+		publishing.Body = zstdEncoder.EncodeAll(publishing.Body, nil)
+	default:
+		return errors.Errorf("Unknown AMQP message compression [%v]", compression)
+	}
+	publishing.ContentEncoding = compression
+	return nil
+}
+
+// decompress decompresses the body of delivery according to its content
+// encoding, bodies with other encodings are left unchanged
+func decompress(delivery *amqp.Delivery) error {
+	var err error
+	switch delivery.ContentEncoding {
+	case CompressionGzip:
+		var reader *gzip.Reader
+		if reader, err = gzip.NewReader(bytes.NewReader(delivery.Body)); err == nil {
+			delivery.Body, err = io.ReadAll(reader)
+		}
+	case CompressionZstd:
+		delivery.Body, err = zstdDecoder.DecodeAll(delivery.Body, nil)
+	default:
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Cannot decompress AMQP message body with [%v]", delivery.ContentEncoding)
+	}
+	delivery.ContentEncoding = ""
+	return nil
+}
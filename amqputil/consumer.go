@@ -0,0 +1,263 @@
+package amqputil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WaitForever as receive timeout lets ReceiveMessage wait until a message arrives
+const WaitForever time.Duration = -1
+
+// defaults of ConsumerOptions
+const (
+	DefaultReceiveTimeout = 10 * time.Second
+	DefaultPrefetchCount  = 1
+)
+
+// ConsumerOptions configures consuming a queue. Zero values select the
+// defaults of the AmqpConnectionHelper the context was created by.
+type ConsumerOptions struct {
+	// ReceiveTimeout is the time ReceiveMessage waits for a message before
+	// returning ErrNoMessage, WaitForever disables the timeout
+	ReceiveTimeout time.Duration
+	// PrefetchCount is the number of unacknowledged messages delivered to the
+	// consumer in advance, higher counts increase the throughput
+	PrefetchCount int
+	// PrefetchSize limits the bytes delivered in advance, 0 is unlimited
+	PrefetchSize int
+	// GlobalQos applies the prefetch limits to all consumers of the channel
+	// instead of each consumer if true, nil selects the default
+	GlobalQos *bool
+	// MaxRedeliveries lets ConsumeLoop park messages redelivered more often
+	// instead of handling them, see Delivery.RetryCount. Brokers only count
+	// requeued messages of quorum queues. 0 disables parking.
+	MaxRedeliveries int
+	// ParkingQueue receives parked messages, default <queue>.parking
+	ParkingQueue string
+	// OnPark is called for each parked message, e.g. to emit an audit event
+	OnPark func(delivery *Delivery)
+}
+
+// withDefaults returns options with zero values replaced by the values of defaults
+func (options ConsumerOptions) withDefaults(defaults ConsumerOptions) ConsumerOptions {
+	if options.ReceiveTimeout == 0 {
+		options.ReceiveTimeout = defaults.ReceiveTimeout
+	}
+	if options.PrefetchCount == 0 {
+		options.PrefetchCount = defaults.PrefetchCount
+	}
+	if options.PrefetchSize == 0 {
+		options.PrefetchSize = defaults.PrefetchSize
+	}
+	if options.GlobalQos == nil {
+		options.GlobalQos = defaults.GlobalQos
+	}
+	if options.MaxRedeliveries == 0 {
+		options.MaxRedeliveries = defaults.MaxRedeliveries
+	}
+	if options.ParkingQueue == "" {
+		options.ParkingQueue = defaults.ParkingQueue
+	}
+	if options.OnPark == nil {
+		options.OnPark = defaults.OnPark
+	}
+	return options
+}
+
+// SetConsumerOptions overrides the consumer settings of the context for
+// queueName. They apply when the consumer of the queue is registered next,
+// i.e. on the next ReceiveMessage if the queue was not consumed before.
+func (amqpContext *AmqpContext) SetConsumerOptions(queueName string, options ConsumerOptions) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.setConsumerOptions(queueName, options)
+}
+
+func (amqpContext *AmqpContext) setConsumerOptions(queueName string, options ConsumerOptions) {
+	if amqpContext.consumerOptions == nil {
+		amqpContext.consumerOptions = make(map[string]ConsumerOptions)
+	}
+	amqpContext.consumerOptions[queueName] = options
+}
+
+// SetQos sets the prefetch limits of the consumer of queueName, see
+// ConsumerOptions. They apply when the consumer of the queue is registered next.
+func (amqpContext *AmqpContext) SetQos(queueName string, prefetchCount, prefetchSize int, global bool) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	options := amqpContext.consumerOptions[queueName]
+	options.PrefetchCount = prefetchCount
+	options.PrefetchSize = prefetchSize
+	options.GlobalQos = &global
+	amqpContext.setConsumerOptions(queueName, options)
+}
+
+// qos sets the prefetch limits of queueName on the channel
+func (amqpContext *AmqpContext) qos(queueName string) error {
+	options := amqpContext.options(queueName)
+	return amqpContext.channel.Qos(options.PrefetchCount, options.PrefetchSize, options.GlobalQos != nil && *options.GlobalQos)
+}
+
+// options returns the consumer settings for queueName
+func (amqpContext *AmqpContext) options(queueName string) ConsumerOptions {
+	defaults := amqpContext.defaultConsumerOptions.withDefaults(ConsumerOptions{
+		ReceiveTimeout: DefaultReceiveTimeout,
+		PrefetchCount:  DefaultPrefetchCount,
+	})
+	return amqpContext.consumerOptions[queueName].withDefaults(defaults)
+}
+
+// receiveContext returns a context done after the receive timeout of queueName
+func (amqpContext *AmqpContext) receiveContext(queueName string) (context.Context, context.CancelFunc) {
+	amqpContext.mutex.Lock()
+	timeout := amqpContext.options(queueName).ReceiveTimeout
+	amqpContext.mutex.Unlock()
+	if timeout < 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// ConsumeLoop consumes queueName until ctx is done or the context is drained
+// and calls handler for each message. Given options replace the consumer
+// settings of the queue, see SetConsumerOptions. Unless the handler settled it, the
+// message is acknowledged if the handler succeeds and rejected and requeued if
+// it returns an error or panics. Poison messages exceeding MaxRedeliveries of
+// the options are parked without calling the handler. Lost connections are
+// re-established, see GetAmqpContext. It returns nil after ctx is done or the
+// error that stopped consuming.
+func (amqpContext *AmqpContext) ConsumeLoop(ctx context.Context, queueName string, handler Handler, options ...ConsumerOptions) error {
+	if len(options) > 0 {
+		amqpContext.SetConsumerOptions(queueName, options[0])
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if !amqpContext.drain.start() {
+		return nil
+	}
+	defer amqpContext.drain.done()
+	go func() {
+		select {
+		case <-amqpContext.drain.draining():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	handler = amqpContext.handler(handler)
+	log.Infof("Starting consume loop on queue [%v] for consumerId [%v]", queueName, amqpContext.consumerId)
+	for {
+		delivery, err := amqpContext.receive(ctx, queueName)
+		if ctx.Err() != nil {
+			log.Infof("Stopped consume loop on queue [%v] for consumerId [%v]", queueName, amqpContext.consumerId)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		wrapped := newDelivery(queueName, *delivery)
+		if parked, err := amqpContext.parkPoison(ctx, &wrapped); err != nil {
+			log.Warnf("Cannot park poison message from queue [%v]: %v", queueName, err)
+			if err := wrapped.NackRequeue(); err != nil && err != ErrAlreadySettled {
+				log.Warnf("Cannot requeue message: %v", err)
+			}
+			continue
+		} else if parked {
+			continue
+		}
+		if err := handle(handler, wrapped); err != nil {
+			log.Warnf("Handling message from queue [%v] failed, requeuing it: %v", queueName, err)
+			if err := wrapped.NackRequeue(); err != nil && err != ErrAlreadySettled {
+				log.Warnf("Cannot requeue message: %v", err)
+			}
+			continue
+		}
+		if err := wrapped.Ack(); err != nil && err != ErrAlreadySettled {
+			log.Warnf("Cannot acknowledge message: %v", err)
+		}
+	}
+}
+
+// handle calls handler and turns a panic into an error
+func handle(handler Handler, delivery Delivery) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(delivery)
+}
+
+// drainState tracks the running consume loops of a context
+type drainState struct {
+	lock    sync.Mutex
+	drained chan struct{}
+	loops   sync.WaitGroup
+}
+
+// start registers a consume loop, it returns false if the context is drained
+func (state *drainState) start() bool {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	select {
+	case <-state.channel():
+		return false
+	default:
+		state.loops.Add(1)
+		return true
+	}
+}
+
+func (state *drainState) done() {
+	state.loops.Done()
+}
+
+// draining returns a chan closed when draining starts
+func (state *drainState) draining() <-chan struct{} {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.channel()
+}
+
+func (state *drainState) channel() chan struct{} {
+	if state.drained == nil {
+		state.drained = make(chan struct{})
+	}
+	return state.drained
+}
+
+// Drain stops the consume loops of the context after their current message,
+// waits up to timeout for them and closes the context. Unacknowledged
+// prefetched messages are requeued by the broker. It returns an error if the
+// loops did not stop in time. Messages received by ReceiveMessage are not
+// tracked and must be settled before.
+func (amqpContext *AmqpContext) Drain(timeout time.Duration) error {
+	amqpContext.drain.lock.Lock()
+	select {
+	case <-amqpContext.drain.channel():
+	default:
+		close(amqpContext.drain.drained)
+	}
+	amqpContext.drain.lock.Unlock()
+
+	log.Infof("Draining AMQP consumers of consumerId [%v]", amqpContext.consumerId)
+	stopped := make(chan struct{})
+	go func() {
+		amqpContext.drain.loops.Wait()
+		close(stopped)
+	}()
+	var err error
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		err = errors.Errorf("AMQP consumers of consumerId [%v] did not stop within %v", amqpContext.consumerId, timeout)
+	}
+	if closeErr := amqpContext.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
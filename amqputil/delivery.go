@@ -0,0 +1,159 @@
+package amqputil
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var deliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "amqp_deliveries_total",
+	Help: "The total number of settled AMQP deliveries by queue and result",
+}, []string{"queue", "result"})
+
+// ErrAlreadySettled is returned when a delivery is acknowledged or rejected twice
+var ErrAlreadySettled = errors.New("AMQP delivery was already acknowledged or rejected")
+
+// Delivery wraps a received message and settles it exactly once with Ack,
+// NackRequeue or NackDiscard
+type Delivery struct {
+	amqp.Delivery
+	queueName string
+	state     *deliveryState
+}
+
+type deliveryState struct {
+	sync.Mutex
+	settled bool
+}
+
+func newDelivery(queueName string, delivery amqp.Delivery) Delivery {
+	return Delivery{Delivery: delivery, queueName: queueName, state: &deliveryState{}}
+}
+
+// Queue returns the name of the queue the message was received from
+func (delivery Delivery) Queue() string {
+	return delivery.queueName
+}
+
+// Ack acknowledges the message, i.e. removes it from the queue
+func (delivery Delivery) Ack() error {
+	return delivery.settle("acked", func() error {
+		return delivery.Delivery.Ack(false)
+	})
+}
+
+// NackRequeue rejects the message and puts it back into the queue
+func (delivery Delivery) NackRequeue() error {
+	return delivery.settle("requeued", func() error {
+		return delivery.Delivery.Nack(false, true)
+	})
+}
+
+// NackDiscard rejects the message, which is dropped or dead lettered if the
+// queue has a dead letter exchange, see QueueOptions
+func (delivery Delivery) NackDiscard() error {
+	return delivery.settle("discarded", func() error {
+		return delivery.Delivery.Nack(false, false)
+	})
+}
+
+// Settled returns true if the message was acknowledged or rejected
+func (delivery Delivery) Settled() bool {
+	delivery.state.Lock()
+	defer delivery.state.Unlock()
+	return delivery.state.settled
+}
+
+func (delivery Delivery) settle(result string, settle func() error) error {
+	delivery.state.Lock()
+	defer delivery.state.Unlock()
+	if delivery.state.settled {
+		return ErrAlreadySettled
+	}
+	if err := settle(); err != nil {
+		deliveries.WithLabelValues(delivery.queueName, "error").Inc()
+		return errors.Wrapf(err, "Cannot settle AMQP message from queue [%v] as %s", delivery.queueName, result)
+	}
+	delivery.state.settled = true
+	deliveries.WithLabelValues(delivery.queueName, result).Inc()
+	return nil
+}
+
+// Header returns the value of the AMQP header name
+func (delivery Delivery) Header(name string) (interface{}, bool) {
+	value, ok := delivery.Headers[name]
+	return value, ok
+}
+
+// Redelivered returns true if the message was delivered before, e.g. because
+// it was requeued or the consumer lost its connection before acknowledging it
+func (delivery Delivery) Redelivered() bool {
+	return delivery.Delivery.Redelivered
+}
+
+// RetryCount returns how often the message was delivered before. It is exact
+// for queues with QueueOptions.MaxRetries or a RetryTopology and for messages
+// dead lettered back into the queue, otherwise it is 1 for redelivered messages.
+func (delivery Delivery) RetryCount() int {
+	if count, ok := toInt(delivery.Headers[RetryCountHeader]); ok {
+		return count
+	}
+	if count, ok := toInt(delivery.Headers["x-delivery-count"]); ok {
+		return count
+	}
+	retries := 0
+	if deaths, ok := delivery.Headers["x-death"].([]interface{}); ok {
+		for _, death := range deaths {
+			if table, ok := death.(amqp.Table); ok && table["queue"] == delivery.queueName {
+				if count, ok := toInt(table["count"]); ok {
+					retries += count
+				}
+			}
+		}
+	}
+	if retries == 0 && delivery.Delivery.Redelivered {
+		return 1
+	}
+	return retries
+}
+
+// toInt converts the integer types of AMQP header values
+func toInt(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case int:
+		return v, true
+	case int16:
+		return int(v), true
+	case int32:
+		return int(v), true
+	case int64:
+		return int(v), true
+	default:
+		return 0, false
+	}
+}
+
+// ReceiveDelivery works like ReceiveMessageCtx, but returns a Delivery which
+// the caller settles with Ack, NackRequeue or NackDiscard
+func (amqpContext *AmqpContext) ReceiveDelivery(ctx context.Context, queueName string, message interface{}) (*Delivery, error) {
+	received, err := amqpContext.receive(ctx, queueName)
+	if err != nil {
+		return nil, err
+	}
+	delivery := newDelivery(queueName, *received)
+	if err := amqpContext.decode(received, message); err != nil {
+		return &delivery, amqpContext.setErr(errors.Wrapf(err, "Cannot unmarshal AMQP message from queue [%v]", queueName))
+	}
+	return &delivery, nil
+}
+
+// Decode unmarshals the body of delivery according to its content type, see
+// RegisterCodec
+func (amqpContext *AmqpContext) Decode(delivery *Delivery, message interface{}) error {
+	return amqpContext.decode(&delivery.Delivery, message)
+}
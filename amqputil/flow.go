@@ -0,0 +1,85 @@
+package amqputil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrBrokerBlocked is returned by publishing while the broker blocks the
+// connection, e.g. due to a memory or disk alarm, see AmqpConnectionHelper.BlockedTimeout
+var ErrBrokerBlocked = errors.New("AMQP broker blocked publishing")
+
+// flowControl tracks connection.blocked notifications of the broker
+type flowControl struct {
+	mutex     sync.Mutex
+	reason    string
+	unblocked chan struct{} // nil if not blocked, closed on unblocking
+}
+
+// watch tracks the notifications until the connection is closed
+func (flow *flowControl) watch(notifications <-chan amqp.Blocking) {
+	for blocking := range notifications {
+		if blocking.Active {
+			log.Warnf("AMQP broker blocked publishing: %s", blocking.Reason)
+			flow.block(blocking.Reason)
+		} else {
+			log.Infof("AMQP broker unblocked publishing")
+			flow.unblock()
+		}
+	}
+	flow.unblock()
+}
+
+func (flow *flowControl) block(reason string) {
+	flow.mutex.Lock()
+	defer flow.mutex.Unlock()
+	flow.reason = reason
+	if flow.unblocked == nil {
+		flow.unblocked = make(chan struct{})
+	}
+}
+
+func (flow *flowControl) unblock() {
+	flow.mutex.Lock()
+	defer flow.mutex.Unlock()
+	if flow.unblocked != nil {
+		close(flow.unblocked)
+		flow.unblocked = nil
+	}
+}
+
+// wait returns ErrBrokerBlocked if the connection stays blocked for timeout,
+// immediately for 0 and until ctx is done for negative timeouts
+func (flow *flowControl) wait(ctx context.Context, timeout time.Duration) error {
+	flow.mutex.Lock()
+	unblocked, reason := flow.unblocked, flow.reason
+	flow.mutex.Unlock()
+	if unblocked == nil {
+		return nil
+	}
+	if timeout == 0 {
+		return errors.Wrapf(ErrBrokerBlocked, "reason [%s]", reason)
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	select {
+	case <-unblocked:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrapf(ErrBrokerBlocked, "reason [%s]", reason)
+	}
+}
+
+// watchConnection tracks flow control and closing of a newly opened connection
+func (amqpContext *AmqpContext) watchConnection() {
+	amqpContext.flow.unblock()
+	go amqpContext.flow.watch(amqpContext.connection.NotifyBlocked(make(chan amqp.Blocking, 1)))
+	go amqpContext.notifyClose(amqpContext.connection.NotifyClose(make(chan *amqp.Error, 1)))
+}
@@ -0,0 +1,69 @@
+package amqputil
+
+import (
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// lifecycleHooks are called when the connection of a context cycles
+type lifecycleHooks struct {
+	connect   []func()
+	reconnect []func()
+	close     []func(err error)
+}
+
+// OnConnect registers hook to be called whenever the context opened a new
+// connection, e.g. to re-prime caches. It is called while the context is
+// locked, so it must not use the context.
+func (amqpContext *AmqpContext) OnConnect(hook func()) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.hooks.connect = append(amqpContext.hooks.connect, hook)
+}
+
+// OnReconnect registers hook to be called after the context reconnected and
+// declared its queues, exchanges and consumers again. It is called while the
+// context is locked, so it must not use the context.
+func (amqpContext *AmqpContext) OnReconnect(hook func()) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.hooks.reconnect = append(amqpContext.hooks.reconnect, hook)
+}
+
+// OnClose registers hook to be called in a separate goroutine when a
+// connection of the context is closed, with nil for Close or the reason if
+// the connection was lost.
+func (amqpContext *AmqpContext) OnClose(hook func(err error)) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.hooks.close = append(amqpContext.hooks.close, hook)
+}
+
+// connected calls the connect hooks, the mutex must be held
+func (amqpContext *AmqpContext) connected() {
+	for _, hook := range amqpContext.hooks.connect {
+		hook()
+	}
+}
+
+// reconnected calls the reconnect hooks, the mutex must be held
+func (amqpContext *AmqpContext) reconnected() {
+	for _, hook := range amqpContext.hooks.reconnect {
+		hook()
+	}
+}
+
+// notifyClose calls the close hooks once closed delivers the reason or is
+// closed, which happens for Close
+func (amqpContext *AmqpContext) notifyClose(closed <-chan *amqp.Error) {
+	reason := <-closed
+	var err error
+	if reason != nil {
+		err = reason
+	}
+	amqpContext.mutex.Lock()
+	hooks := amqpContext.hooks.close
+	amqpContext.mutex.Unlock()
+	for _, hook := range hooks {
+		hook(err)
+	}
+}
@@ -0,0 +1,56 @@
+package amqputil
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Handler handles a message of ConsumeLoop
+type Handler func(Delivery) error
+
+// Middleware wraps the handlers of ConsumeLoop, e.g. for logging or tracing
+type Middleware func(next Handler) Handler
+
+// PublishFunc sends a publishing to the broker
+type PublishFunc func(ctx context.Context, exchange, routingKey string, publishing amqp.Publishing) error
+
+// PublishMiddleware wraps publishing, e.g. to set tracing headers. It sees the
+// publishing before compression and claim checks.
+type PublishMiddleware func(next PublishFunc) PublishFunc
+
+// Use adds middleware around the handlers of ConsumeLoop, the
+// first middleware is the outermost
+func (amqpContext *AmqpContext) Use(middleware ...Middleware) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.middleware = append(amqpContext.middleware, middleware...)
+}
+
+// UsePublish adds middleware around publishing of all Publish methods, the
+// first middleware is the outermost
+func (amqpContext *AmqpContext) UsePublish(middleware ...PublishMiddleware) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	amqpContext.publishMiddleware = append(amqpContext.publishMiddleware, middleware...)
+}
+
+// handler wraps handler with the middleware
+func (amqpContext *AmqpContext) handler(handler Handler) Handler {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	for i := len(amqpContext.middleware) - 1; i >= 0; i-- {
+		handler = amqpContext.middleware[i](handler)
+	}
+	return handler
+}
+
+// publisher wraps publish with the publish middleware
+func (amqpContext *AmqpContext) publisher(publish PublishFunc) PublishFunc {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	for i := len(amqpContext.publishMiddleware) - 1; i >= 0; i-- {
+		publish = amqpContext.publishMiddleware[i](publish)
+	}
+	return publish
+}
@@ -0,0 +1,114 @@
+package amqputil
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultMonitorInterval is the interval QueueMonitor collects queue stats in
+const DefaultMonitorInterval = 15 * time.Second
+
+var (
+	queueMessages = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "amqp_queue_messages",
+		Help: "The number of messages ready for delivery by queue",
+	}, []string{"queue"})
+	queueConsumers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "amqp_queue_consumers",
+		Help: "The number of consumers by queue",
+	}, []string{"queue"})
+)
+
+// QueueStats are the counts of a queue reported by the broker
+type QueueStats struct {
+	Messages  int // messages ready for delivery
+	Consumers int
+}
+
+// QueueStats inspects queueName without declaring it. Inspecting a missing
+// queue fails and closes the channel, which is reopened on next use.
+func (amqpContext *AmqpContext) QueueStats(queueName string) (QueueStats, error) {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return QueueStats{}, err
+	}
+	defer amqpContext.mutex.Unlock()
+	queue, err := amqpContext.channel.QueueInspect(queueName)
+	if err != nil {
+		return QueueStats{}, errors.Wrapf(err, "Cannot inspect AMQP queue [%v]", queueName)
+	}
+	return QueueStats{Messages: queue.Messages, Consumers: queue.Consumers}, nil
+}
+
+// QueueMonitor exports the stats of queues as the gauges amqp_queue_messages
+// and amqp_queue_consumers, e.g. for scaling workers by backlog
+type QueueMonitor struct {
+	amqpContext *AmqpContext
+	interval    time.Duration
+	queues      []string
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewQueueMonitor creates a QueueMonitor collecting the stats of queues via
+// amqpContext every interval, default DefaultMonitorInterval
+func NewQueueMonitor(amqpContext *AmqpContext, interval time.Duration, queues ...string) *QueueMonitor {
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	return &QueueMonitor{amqpContext: amqpContext, interval: interval, queues: queues}
+}
+
+// Collect updates the gauges of all queues once. Queues which cannot be
+// inspected keep their last values and their errors are returned.
+func (monitor *QueueMonitor) Collect() error {
+	var failed error
+	for _, queueName := range monitor.queues {
+		stats, err := monitor.amqpContext.QueueStats(queueName)
+		if err != nil {
+			failed = err
+			continue
+		}
+		queueMessages.WithLabelValues(queueName).Set(float64(stats.Messages))
+		queueConsumers.WithLabelValues(queueName).Set(float64(stats.Consumers))
+	}
+	return failed
+}
+
+// Start starts collecting in the background
+func (monitor *QueueMonitor) Start() {
+	if monitor.done != nil {
+		return
+	}
+	monitor.done = make(chan struct{})
+	monitor.stopped = make(chan struct{})
+	go func() {
+		defer close(monitor.stopped)
+		ticker := time.NewTicker(monitor.interval)
+		defer ticker.Stop()
+		for {
+			if err := monitor.Collect(); err != nil {
+				log.Warnf("Failed to collect AMQP queue stats: %v", err)
+			}
+			select {
+			case <-monitor.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops collecting
+func (monitor *QueueMonitor) Stop() {
+	if monitor.done == nil {
+		return
+	}
+	close(monitor.done)
+	<-monitor.stopped
+	monitor.done = nil
+}
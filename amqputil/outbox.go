@@ -0,0 +1,306 @@
+package amqputil
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+)
+
+// OutboxTable stores messages of an Outbox until they are published
+const OutboxTable = "amqp_outbox"
+
+// OutboxFailedTable stores messages of an Outbox which could not be published
+const OutboxFailedTable = "amqp_outbox_failed"
+
+const (
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxBatchSize    = 100
+	defaultOutboxMaxAttempts  = 5
+)
+
+var failedOutboxMessages = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "amqp_outbox_failed_messages_total",
+	Help: "The total number of outbox messages moved to the failed table",
+})
+
+var outboxMigration = `CREATE TABLE IF NOT EXISTS ` + OutboxTable + ` (
+    id             BIGSERIAL PRIMARY KEY,
+    exchange       TEXT NOT NULL,
+    routing_key    TEXT NOT NULL,
+    message_id     TEXT NOT NULL,
+    content_type   TEXT NOT NULL,
+    correlation_id TEXT NOT NULL DEFAULT '',
+    reply_to       TEXT NOT NULL DEFAULT '',
+    headers        JSONB,
+    payload        BYTEA NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT now(),
+    attempts       INT NOT NULL DEFAULT 0
+)`
+
+var outboxAttemptsMigration = `ALTER TABLE ` + OutboxTable + ` ADD COLUMN IF NOT EXISTS attempts INT NOT NULL DEFAULT 0`
+
+var outboxFailedMigration = `CREATE TABLE IF NOT EXISTS ` + OutboxFailedTable + ` (
+    id             BIGINT PRIMARY KEY,
+    exchange       TEXT NOT NULL,
+    routing_key    TEXT NOT NULL,
+    message_id     TEXT NOT NULL,
+    content_type   TEXT NOT NULL,
+    correlation_id TEXT NOT NULL DEFAULT '',
+    reply_to       TEXT NOT NULL DEFAULT '',
+    headers        JSONB,
+    payload        BYTEA NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL,
+    attempts       INT NOT NULL,
+    error          TEXT NOT NULL,
+    failed_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// MigrateOutbox creates the outbox tables if they do not exist
+func MigrateOutbox(helper *dbutil.DbConnectionHelper) error {
+	dbContext := helper.GetDbContext(nil, true)
+	dbContext.Execute(outboxMigration)
+	dbContext.Execute(outboxAttemptsMigration)
+	dbContext.Execute(outboxFailedMigration)
+	err := dbContext.LastError()
+	dbContext.Close()
+	if err != nil {
+		return errors.Wrap(err, "AMQP outbox migration failed")
+	}
+	return nil
+}
+
+// OutboxOptions configures an Outbox. Zero values select the defaults.
+type OutboxOptions struct {
+	PollInterval time.Duration // interval the outbox table is checked in, default 1s
+	BatchSize    int           // messages published per poll, default 100
+	MaxAttempts  int           // failed publish attempts before a message is moved to amqp_outbox_failed, default 5
+}
+
+// Outbox stores messages in the amqp_outbox table within the transaction of
+// the caller, so they are published if and only if the transaction commits. A
+// relay publishes stored messages in order with publisher confirms and deletes
+// them afterwards, i.e. messages are published at least once. Messages which
+// cannot be published are moved to the amqp_outbox_failed table after
+// MaxAttempts, so they do not block the messages stored after them.
+type Outbox struct {
+	db          func() (*sql.DB, error)
+	amqpContext *AmqpContext
+	options     OutboxOptions
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewOutbox creates an Outbox storing messages in the DB of helper and relaying
+// them via amqpContext, which must not be used elsewhere while relaying
+func NewOutbox(helper *dbutil.DbConnectionHelper, amqpContext *AmqpContext, options OutboxOptions) *Outbox {
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultOutboxPollInterval
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultOutboxBatchSize
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultOutboxMaxAttempts
+	}
+	return &Outbox{db: helper.DB, amqpContext: amqpContext, options: options}
+}
+
+// Add stores message, encoded by the publishing codec of the AmqpContext, in
+// the outbox using dbContext, which should have been created with a
+// transaction. Messages for a queue are added with the default exchange "" and
+// the queue name as routing key. Header values must be JSON compatible.
+func (outbox *Outbox) Add(dbContext dbutil.DbAccessor, exchange, routingKey string, message interface{}, options PublishOptions) error {
+	outbox.amqpContext.mutex.Lock()
+	codec := outbox.amqpContext.encoder()
+	outbox.amqpContext.mutex.Unlock()
+	body, err := codec.Marshal(message)
+	if err != nil {
+		return errors.Wrapf(err, "Failed to marshall AMQP message [%v]", message)
+	}
+	if options.ContentType == "" {
+		options.ContentType = codec.ContentType()
+	}
+	if options.MessageId == "" {
+		options.MessageId = apputil.GenerateGUID()
+	}
+	var headers []byte
+	if len(options.Headers) > 0 {
+		if headers, err = json.Marshal(options.Headers); err != nil {
+			return errors.Wrap(err, "Failed to marshall AMQP message headers")
+		}
+	}
+	return dbContext.Execute(fmt.Sprintf("INSERT INTO %s (exchange, routing_key, message_id, content_type, correlation_id, reply_to, headers, payload) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)", OutboxTable),
+		exchange, routingKey, options.MessageId, options.ContentType, options.CorrelationId, options.ReplyTo, headers, body)
+}
+
+// Start starts relaying stored messages in the background
+func (outbox *Outbox) Start() {
+	if outbox.done != nil {
+		return
+	}
+	outbox.done = make(chan struct{})
+	outbox.stopped = make(chan struct{})
+	go func() {
+		defer close(outbox.stopped)
+		ticker := time.NewTicker(outbox.options.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-outbox.done:
+				return
+			case <-ticker.C:
+			}
+			// relay until the outbox is drained
+			for {
+				relayed, err := outbox.Relay(context.Background())
+				if err != nil {
+					log.Errorf("Failed to relay outbox messages: %v", err)
+				}
+				if err != nil || relayed < outbox.options.BatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops relaying after the current batch
+func (outbox *Outbox) Stop() {
+	if outbox.done == nil {
+		return
+	}
+	close(outbox.done)
+	<-outbox.stopped
+	outbox.done = nil
+}
+
+// outboxMessage is a row of the outbox table
+type outboxMessage struct {
+	id                     int64
+	exchange, routingKey   string
+	messageId, contentType string
+	correlationId, replyTo string
+	headers, payload       []byte
+	created                time.Time
+	attempts               int
+}
+
+// publishing returns the persistent AMQP publishing of the stored message
+func (message outboxMessage) publishing() (amqp.Publishing, error) {
+	var headers amqp.Table
+	if len(message.headers) > 0 {
+		if err := json.Unmarshal(message.headers, &headers); err != nil {
+			return amqp.Publishing{}, errors.Wrapf(err, "Invalid headers of outbox message [%v]", message.messageId)
+		}
+	}
+	publishing := PublishOptions{
+		Headers:       headers,
+		ContentType:   message.contentType,
+		CorrelationId: message.correlationId,
+		ReplyTo:       message.replyTo,
+		MessageId:     message.messageId,
+	}.publishing(message.payload)
+	publishing.DeliveryMode = amqp.Persistent
+	publishing.Timestamp = message.created.UTC()
+	return publishing, nil
+}
+
+// Relay publishes a batch of stored messages and returns the number of
+// published messages. Rows are locked, so several replicas can relay
+// concurrently. Relaying stops at the first message which cannot be published
+// to keep the order, unless the message failed MaxAttempts times or is invalid.
+// Then it is moved to the amqp_outbox_failed table and relaying goes on.
+func (outbox *Outbox) Relay(ctx context.Context) (int, error) {
+	db, err := outbox.db()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, exchange, routing_key, message_id, content_type, correlation_id, reply_to, headers, payload, created_at, attempts FROM %s ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED", OutboxTable),
+		outbox.options.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var messages []outboxMessage
+	for rows.Next() {
+		var message outboxMessage
+		if err := rows.Scan(&message.id, &message.exchange, &message.routingKey, &message.messageId, &message.contentType,
+			&message.correlationId, &message.replyTo, &message.headers, &message.payload, &message.created, &message.attempts); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		messages = append(messages, message)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	relayed := 0
+	var publishErr error
+	for _, message := range messages {
+		publishing, err := message.publishing()
+		if err == nil {
+			err = outbox.amqpContext.PublishConfirmed(ctx, message.exchange, message.routingKey, publishing)
+			if err != nil && (ctx.Err() != nil || errors.Is(err, ErrConnectionLost) || errors.Is(err, ErrClosed)) {
+				// the broker is unavailable, not the message
+				publishErr = err
+				break
+			}
+			if err != nil && message.attempts+1 < outbox.options.MaxAttempts {
+				if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE %s SET attempts = attempts + 1 WHERE id = $1", OutboxTable), message.id); err != nil {
+					return 0, err
+				}
+				publishErr = err
+				break
+			}
+		}
+		if err != nil {
+			log.Errorf("Moving outbox message [%v] to %s after %d attempts: %v", message.messageId, OutboxFailedTable, message.attempts+1, err)
+			if err := outbox.fail(ctx, tx, message, err); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", OutboxTable), message.id); err != nil {
+			return 0, err
+		}
+		relayed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if relayed > 0 {
+		log.Debugf("Relayed %d outbox messages", relayed)
+	}
+	return relayed, publishErr
+}
+
+// fail moves message to the failed table
+func (outbox *Outbox) fail(ctx context.Context, tx *sql.Tx, message outboxMessage, cause error) error {
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (id, exchange, routing_key, message_id, content_type, correlation_id, reply_to, headers, payload, created_at, attempts, error) "+
+		"SELECT id, exchange, routing_key, message_id, content_type, correlation_id, reply_to, headers, payload, created_at, attempts + 1, $2 FROM %s WHERE id = $1", OutboxFailedTable, OutboxTable),
+		message.id, cause.Error()); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", OutboxTable), message.id); err != nil {
+		return err
+	}
+	failedOutboxMessages.Inc()
+	return nil
+}
@@ -0,0 +1,105 @@
+package amqputil
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// headers of parked messages with their original routing
+const (
+	OriginalExchangeHeader   = "x-original-exchange"
+	OriginalRoutingKeyHeader = "x-original-routing-key"
+	OriginalQueueHeader      = "x-original-queue"
+)
+
+var parkedMessages = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "amqp_parked_messages_total",
+	Help: "The total number of poison messages parked by ConsumeLoop by queue",
+}, []string{"queue"})
+
+// parkPoison moves delivery to the parking queue and acknowledges it if it
+// was redelivered more often than MaxRedeliveries of its queue
+func (amqpContext *AmqpContext) parkPoison(ctx context.Context, delivery *Delivery) (bool, error) {
+	if err := amqpContext.lock(ctx); err != nil {
+		return false, err
+	}
+	options := amqpContext.options(delivery.Queue())
+	if options.MaxRedeliveries <= 0 || delivery.RetryCount() <= options.MaxRedeliveries {
+		amqpContext.mutex.Unlock()
+		return false, nil
+	}
+	parkingQueue := options.ParkingQueue
+	if parkingQueue == "" {
+		parkingQueue = delivery.Queue() + parkingQueueSuffix
+	}
+	log.Warnf("Parking poison message [%v] from queue [%v] in [%v] after %d redeliveries", delivery.MessageId, delivery.Queue(), parkingQueue, delivery.RetryCount())
+
+	headers := make(amqp.Table, len(delivery.Headers)+3)
+	for name, value := range delivery.Headers {
+		headers[name] = value
+	}
+	headers[OriginalExchangeHeader] = delivery.Exchange
+	headers[OriginalRoutingKeyHeader] = delivery.RoutingKey
+	headers[OriginalQueueHeader] = delivery.Queue()
+	publishOptions := PublishOptions{
+		Headers:       headers,
+		Priority:      delivery.Priority,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		ReplyTo:       delivery.ReplyTo,
+		MessageId:     delivery.MessageId,
+	}
+	// the parking queue of a RetryTopology may have been declared already with
+	// other arguments, declaring it again would fail with PRECONDITION_FAILED
+	_, declared := amqpContext.queueOptions[parkingQueue]
+	var err error
+	if !declared {
+		declared, err = amqpContext.queueDeclared(parkingQueue)
+	}
+	if err == nil && !declared {
+		err = amqpContext.ensureQueueExists(parkingQueue, QueueOptions{Durable: true})
+	}
+	amqpContext.mutex.Unlock()
+	if err == nil {
+		err = amqpContext.publishBody(ctx, "", parkingQueue, delivery.Body, publishOptions)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := delivery.Ack(); err != nil {
+		return false, err
+	}
+	parkedMessages.WithLabelValues(delivery.Queue()).Inc()
+	if options.OnPark != nil {
+		options.OnPark(delivery)
+	}
+	return true, nil
+}
+
+// queueDeclared checks passively whether queueName exists on the broker. The
+// check uses a channel of its own if connected, because the broker closes the
+// channel of a passive declaration of a missing queue.
+func (amqpContext *AmqpContext) queueDeclared(queueName string) (bool, error) {
+	channel := amqpContext.channel
+	if amqpContext.connection != nil {
+		inspecting, err := amqpContext.connection.Channel()
+		if err != nil {
+			return false, errors.Wrapf(err, "Cannot open AMQP channel to inspect queue [%v]", queueName)
+		}
+		defer inspecting.Close()
+		channel = inspecting
+	}
+	_, err := channel.QueueInspect(queueName)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrapf(err, "Cannot inspect AMQP queue [%v]", queueName)
+	}
+	return true, nil
+}
@@ -0,0 +1,179 @@
+package amqputil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConsumeError is reported by a ConsumePool if a handler failed or a worker stopped
+type ConsumeError struct {
+	Worker int
+	// Delivery is the failed message, nil if the worker stopped
+	Delivery *Delivery
+	Err      error
+}
+
+func (err *ConsumeError) Error() string {
+	if err.Delivery == nil {
+		return fmt.Sprintf("AMQP consumer worker %d stopped: %v", err.Worker, err.Err)
+	}
+	return fmt.Sprintf("AMQP consumer worker %d failed to handle message: %v", err.Worker, err.Err)
+}
+
+func (err *ConsumeError) Unwrap() error {
+	return err.Err
+}
+
+// ConsumePool consumes a queue with several workers, see
+// AmqpConnectionHelper.ConsumePool and AdaptiveConsumePool
+type ConsumePool struct {
+	ctx       context.Context
+	queueName string
+	handler   Handler
+	errors    chan error
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+	stopOnce  sync.Once
+
+	// mutex guards the workers and the handling statistics
+	mutex      sync.Mutex
+	workers    []*poolWorker
+	nextWorker int
+	handled    int
+	handling   time.Duration
+}
+
+// poolWorker runs a ConsumeLoop with its own context
+type poolWorker struct {
+	id          int
+	amqpContext *AmqpContext
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+// ConsumePool starts workers goroutines consuming queueName with ConsumeLoop
+// until ctx is done or Stop is called. Each worker uses its own connection
+// and channel with the prefetch count of options, so handlers run in parallel.
+// Handler errors are reported by Errors.
+func (helper *AmqpConnectionHelper) ConsumePool(ctx context.Context, consumerId, queueName string, workers int, options ConsumerOptions, handler Handler) (*ConsumePool, error) {
+	if workers < 1 {
+		return nil, errors.Errorf("Invalid number of AMQP consumer workers [%d]", workers)
+	}
+	contexts := make([]*AmqpContext, 0, workers)
+	for i := 0; i < workers; i++ {
+		amqpContext, err := helper.NewAmqpContext(fmt.Sprintf("%s-%d", consumerId, i))
+		if err != nil {
+			for _, started := range contexts {
+				started.Close()
+			}
+			return nil, errors.Wrapf(err, "Cannot open AMQP connection for consumer worker %d of queue [%v]", i, queueName)
+		}
+		amqpContext.SetConsumerOptions(queueName, options)
+		contexts = append(contexts, amqpContext)
+	}
+	return startConsumePool(ctx, contexts, queueName, handler), nil
+}
+
+// startConsumePool runs a ConsumeLoop for each context
+func startConsumePool(ctx context.Context, contexts []*AmqpContext, queueName string, handler Handler) *ConsumePool {
+	pool := newConsumePool(ctx, queueName, handler, len(contexts))
+	for _, amqpContext := range contexts {
+		pool.startWorker(amqpContext)
+	}
+	go func() {
+		pool.wg.Wait()
+		close(pool.errors)
+	}()
+	return pool
+}
+
+// newConsumePool creates a ConsumePool without workers
+func newConsumePool(ctx context.Context, queueName string, handler Handler, maxWorkers int) *ConsumePool {
+	ctx, cancel := context.WithCancel(ctx)
+	return &ConsumePool{ctx: ctx, queueName: queueName, handler: handler, errors: make(chan error, 2*maxWorkers), cancel: cancel}
+}
+
+// startWorker runs a ConsumeLoop with amqpContext
+func (pool *ConsumePool) startWorker(amqpContext *AmqpContext) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	ctx, cancel := context.WithCancel(pool.ctx)
+	worker := &poolWorker{id: pool.nextWorker, amqpContext: amqpContext, cancel: cancel, done: make(chan struct{})}
+	pool.nextWorker++
+	pool.workers = append(pool.workers, worker)
+	pool.wg.Add(1)
+	go func() {
+		defer pool.wg.Done()
+		defer close(worker.done)
+		err := amqpContext.ConsumeLoop(ctx, pool.queueName, func(delivery Delivery) error {
+			start := time.Now()
+			err := pool.handler(delivery)
+			pool.observe(time.Since(start))
+			if err != nil {
+				pool.report(&ConsumeError{Worker: worker.id, Delivery: &delivery, Err: err})
+			}
+			return err
+		})
+		if err != nil {
+			log.Errorf("AMQP consumer worker %d of queue [%v] stopped: %v", worker.id, pool.queueName, err)
+			pool.report(&ConsumeError{Worker: worker.id, Err: err})
+		}
+	}()
+}
+
+// stopWorker stops the last worker after its current message and closes its context
+func (pool *ConsumePool) stopWorker() {
+	pool.mutex.Lock()
+	if len(pool.workers) == 0 {
+		pool.mutex.Unlock()
+		return
+	}
+	worker := pool.workers[len(pool.workers)-1]
+	pool.workers = pool.workers[:len(pool.workers)-1]
+	pool.mutex.Unlock()
+	worker.cancel()
+	<-worker.done
+	worker.amqpContext.Close()
+}
+
+// observe records the time a handler took
+func (pool *ConsumePool) observe(duration time.Duration) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.handled++
+	pool.handling += duration
+}
+
+// report passes err to Errors, it is dropped if nobody reads them
+func (pool *ConsumePool) report(err error) {
+	select {
+	case pool.errors <- err:
+	default:
+	}
+}
+
+// Errors returns the *ConsumeError of failed handlers and stopped workers. The
+// chan is closed after all workers stopped. Errors are dropped if the chan is
+// not read.
+func (pool *ConsumePool) Errors() <-chan error {
+	return pool.errors
+}
+
+// Stop stops the workers after their current message and closes their
+// connections. Prefetched messages which were not handled are requeued.
+func (pool *ConsumePool) Stop() {
+	pool.stopOnce.Do(func() {
+		pool.cancel()
+		pool.wg.Wait()
+		poolWorkers.DeleteLabelValues(pool.queueName)
+		pool.mutex.Lock()
+		defer pool.mutex.Unlock()
+		for _, worker := range pool.workers {
+			worker.amqpContext.Close()
+		}
+	})
+}
@@ -0,0 +1,136 @@
+package amqputil
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/science-computing/service-common-golang/apputil"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// content types of published protobuf messages
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// PublishOptions sets AMQP properties of published messages
+type PublishOptions struct {
+	Headers amqp.Table
+	// Priority of the message on queues with x-max-priority, 0-9
+	Priority uint8
+	// TTL drops the message if it is not consumed within this time, 0 keeps it
+	TTL time.Duration
+	// ContentType of the encoded body, default the content type of the codec
+	ContentType string
+	// CorrelationId relates the message to a request, see Reply
+	CorrelationId string
+	// ReplyTo is the queue replies are expected in
+	ReplyTo string
+	// MessageId identifies the message, default a generated GUID
+	MessageId string
+	// Compression of the body, CompressionGzip or CompressionZstd, which is
+	// set as content encoding and reverted on receive
+	Compression string
+	// Mandatory returns the message if it cannot be routed to a queue, see OnReturn
+	Mandatory bool
+}
+
+// publishing returns the AMQP publishing of body with the options
+func (options PublishOptions) publishing(body []byte) amqp.Publishing {
+	publishing := amqp.Publishing{
+		ContentType:   options.ContentType,
+		Headers:       options.Headers,
+		Priority:      options.Priority,
+		CorrelationId: options.CorrelationId,
+		ReplyTo:       options.ReplyTo,
+		MessageId:     options.MessageId,
+		Body:          body,
+	}
+	if publishing.ContentType == "" {
+		publishing.ContentType = ContentTypeJSON
+	}
+	if publishing.MessageId == "" {
+		publishing.MessageId = apputil.GenerateGUID()
+	}
+	if options.TTL > 0 {
+		publishing.Expiration = strconv.FormatInt(options.TTL.Milliseconds(), 10)
+	}
+	return publishing
+}
+
+// PublishMessageWithOptions works like PublishMessageCtx and sets the AMQP
+// properties of publishOptions on the message
+func (amqpContext *AmqpContext) PublishMessageWithOptions(ctx context.Context, queueName string, message interface{}, publishOptions PublishOptions, options ...QueueOptions) error {
+	if err := amqpContext.lock(ctx); err != nil {
+		return err
+	}
+	err := amqpContext.ensureQueueExists(queueName, options...)
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return amqpContext.publish(ctx, "", queueName, message, publishOptions)
+}
+
+// PublishToExchangeWithOptions works like PublishToExchange and sets the AMQP
+// properties of publishOptions on the message
+func (amqpContext *AmqpContext) PublishToExchangeWithOptions(ctx context.Context, exchange, exchangeType, routingKey string, message interface{}, publishOptions PublishOptions) error {
+	if err := amqpContext.lock(ctx); err != nil {
+		return err
+	}
+	err := amqpContext.ensureExchangeExists(exchange, exchangeType)
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return amqpContext.publish(ctx, exchange, routingKey, message, publishOptions)
+}
+
+// PublishProtoMessage sends message to queue with given name encoded with
+// contentType, i.e. binary for ContentTypeProtobuf or protojson for
+// ContentTypeJSON. If the queue does not exist, it is created with the given
+// options.
+func (amqpContext *AmqpContext) PublishProtoMessage(queueName string, message proto.Message, contentType string, options ...QueueOptions) error {
+	var body []byte
+	var err error
+	switch contentType {
+	case ContentTypeProtobuf:
+		body, err = proto.Marshal(message)
+	case ContentTypeJSON:
+		body, err = protojson.Marshal(message)
+	default:
+		return amqpContext.setErr(errors.Errorf("Unsupported content type [%v] for protobuf message", contentType))
+	}
+	if err != nil {
+		return amqpContext.setErr(errors.Wrapf(err, "Failed to marshall AMQP message [%v]", message))
+	}
+
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return err
+	}
+	err = amqpContext.ensureQueueExists(queueName, options...)
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return amqpContext.publishBody(context.Background(), "", queueName, body, PublishOptions{ContentType: contentType})
+}
+
+// Reply sends message to the ReplyTo queue of request with the correlation id
+// of request or, if it has none, its message id as CorrelationId
+func (amqpContext *AmqpContext) Reply(ctx context.Context, request *Delivery, message interface{}) error {
+	if request.ReplyTo == "" {
+		return amqpContext.setErr(errors.Errorf("AMQP message [%v] from queue [%v] has no reply-to queue", request.MessageId, request.Queue()))
+	}
+	correlationId := request.CorrelationId
+	if correlationId == "" {
+		correlationId = request.MessageId
+	}
+	// the reply queue is declared by the requester
+	return amqpContext.publish(ctx, "", request.ReplyTo, message, PublishOptions{CorrelationId: correlationId})
+}
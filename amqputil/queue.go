@@ -0,0 +1,147 @@
+package amqputil
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// suffixes of the names of dead letter exchanges and queues declared by DeclareDeadLetterQueue
+const (
+	deadLetterExchangeSuffix = ".dlx"
+	deadLetterQueueSuffix    = ".dlq"
+)
+
+// behaviours of queues exceeding QueueOptions.MaxLength
+const (
+	OverflowDropHead         = "drop-head"
+	OverflowRejectPublish    = "reject-publish"
+	OverflowRejectPublishDLX = "reject-publish-dlx"
+)
+
+// QueueOptions configures queues declared by EnsureQueueExists. The zero
+// value declares a transient classic queue, as before.
+type QueueOptions struct {
+	Durable bool
+	// DeadLetterExchange receives rejected and expired messages, see DeclareDeadLetterQueue
+	DeadLetterExchange string
+	// DeadLetterRoutingKey defaults to the original routing key. Without
+	// DeadLetterExchange, messages are dead lettered to the queue of this name.
+	DeadLetterRoutingKey string
+	// MessageTTL expires messages which were not consumed within this time
+	MessageTTL time.Duration
+	// MaxRetries dead letters messages after they were requeued this many times.
+	// RabbitMQ only counts deliveries of quorum queues, so the queue is declared
+	// as durable quorum queue if set.
+	MaxRetries int
+	// Lazy declares a classic queue in lazy mode, which keeps messages on disk
+	Lazy bool
+	// MaxLength limits the number of ready messages, see Overflow
+	MaxLength int
+	// Overflow is the behaviour if MaxLength is reached, i.e. OverflowDropHead
+	// (the default of the broker), OverflowRejectPublish or OverflowRejectPublishDLX
+	Overflow string
+	// Args are further arguments of the queue declaration, e.g. x-max-length-bytes.
+	// They override the arguments derived from the other options.
+	Args amqp.Table
+}
+
+func (options QueueOptions) args() amqp.Table {
+	args := make(amqp.Table)
+	if options.DeadLetterExchange != "" || options.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-exchange"] = options.DeadLetterExchange
+		if options.DeadLetterRoutingKey != "" {
+			args["x-dead-letter-routing-key"] = options.DeadLetterRoutingKey
+		}
+	}
+	if options.MessageTTL > 0 {
+		args["x-message-ttl"] = options.MessageTTL.Milliseconds()
+	}
+	if options.MaxRetries > 0 {
+		args["x-queue-type"] = "quorum"
+		args["x-delivery-limit"] = options.MaxRetries
+	}
+	if options.Lazy {
+		args["x-queue-mode"] = "lazy"
+	}
+	if options.MaxLength > 0 {
+		args["x-max-length"] = options.MaxLength
+	}
+	if options.Overflow != "" {
+		args["x-overflow"] = options.Overflow
+	}
+	for name, value := range options.Args {
+		args[name] = value
+	}
+	return args
+}
+
+func (options QueueOptions) durable() bool {
+	return options.Durable || options.MaxRetries > 0
+}
+
+// EnsureQueueExists declares the queue with the given options unless it was
+// declared by the context before. Declaring a known queue with different
+// options fails, without options any declaration is accepted.
+func (amqpContext *AmqpContext) EnsureQueueExists(queueName string, options ...QueueOptions) error {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return err
+	}
+	defer amqpContext.mutex.Unlock()
+	return amqpContext.ensureQueueExists(queueName, options...)
+}
+
+func (amqpContext *AmqpContext) ensureQueueExists(queueName string, options ...QueueOptions) error {
+	var queueOptions QueueOptions
+	if len(options) > 0 {
+		queueOptions = options[0]
+	}
+	if declared, ok := amqpContext.queueOptions[queueName]; ok {
+		if len(options) > 0 && !reflect.DeepEqual(declared, queueOptions) {
+			amqpContext.err = errors.Errorf("AMQP queue [%v] was declared with other options", queueName)
+			return amqpContext.err
+		}
+		return nil
+	}
+
+	queue, err := amqpContext.channel.QueueDeclare(queueName, queueOptions.durable(), false, false, false, queueOptions.args())
+	if err != nil {
+		amqpContext.err = errors.Wrapf(err, "Cannot declare AMQP queue [%v]", queueName)
+		return amqpContext.err
+	}
+	amqpContext.queues[queueName] = queue
+	amqpContext.queueOptions[queueName] = queueOptions
+	return nil
+}
+
+// DeclareDeadLetterQueue declares the direct exchange <queue>.dlx and the queue
+// <queue>.dlq bound to it and returns options with the dead letter settings
+// for declaring queueName, e.g.
+//
+//	options, err := amqpContext.DeclareDeadLetterQueue("orders", amqputil.QueueOptions{Durable: true, MaxRetries: 5})
+//	err = amqpContext.EnsureQueueExists("orders", options)
+//
+// The dead letter queue is durable if options are.
+func (amqpContext *AmqpContext) DeclareDeadLetterQueue(queueName string, options QueueOptions) (QueueOptions, error) {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return options, err
+	}
+	defer amqpContext.mutex.Unlock()
+	deadLetterExchange := queueName + deadLetterExchangeSuffix
+	deadLetterQueue := queueName + deadLetterQueueSuffix
+	if err := amqpContext.ensureExchangeExists(deadLetterExchange, amqp.ExchangeDirect); err != nil {
+		return options, err
+	}
+	if err := amqpContext.ensureQueueExists(deadLetterQueue, QueueOptions{Durable: options.durable()}); err != nil {
+		return options, err
+	}
+	if err := amqpContext.bindQueue(deadLetterQueue, deadLetterQueue, deadLetterExchange, nil); err != nil {
+		return options, err
+	}
+	options.DeadLetterExchange = deadLetterExchange
+	options.DeadLetterRoutingKey = deadLetterQueue
+	return options, nil
+}
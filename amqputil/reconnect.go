@@ -0,0 +1,259 @@
+package amqputil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/science-computing/service-common-golang/retryutil"
+)
+
+// reconnectState runs one reconnection of a context at a time, which the
+// operations of all goroutines wait for
+type reconnectState struct {
+	mutex   sync.Mutex
+	current *reconnection
+	cancel  context.CancelFunc
+}
+
+// reconnection is a running reconnection, err is set when done is closed
+type reconnection struct {
+	done chan struct{}
+	err  error
+}
+
+// start runs redial in the background unless a reconnection is running
+func (state *reconnectState) start(redial func(ctx context.Context) error) *reconnection {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.current != nil {
+		return state.current
+	}
+	current := &reconnection{done: make(chan struct{})}
+	state.current = current
+	var ctx context.Context
+	ctx, state.cancel = context.WithCancel(context.Background())
+	go func() {
+		current.err = redial(ctx)
+		state.mutex.Lock()
+		state.current = nil
+		state.cancel()
+		state.mutex.Unlock()
+		close(current.done)
+	}()
+	return current
+}
+
+// stop cancels a running reconnection
+func (state *reconnectState) stop() {
+	state.mutex.Lock()
+	defer state.mutex.Unlock()
+	if state.current != nil {
+		state.cancel()
+	}
+}
+
+// lock locks the context after reconnecting it if the connection or channel
+// was lost. The context is not locked while it reconnects. It returns
+// ErrClosed after Close.
+func (amqpContext *AmqpContext) lock(ctx context.Context) error {
+	for {
+		amqpContext.mutex.Lock()
+		if amqpContext.closed {
+			amqpContext.mutex.Unlock()
+			return ErrClosed
+		}
+		if !amqpContext.broken() {
+			return nil
+		}
+		amqpContext.mutex.Unlock()
+		if err := amqpContext.reconnect(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect waits until a broken connection and channel were reopened with
+// backoff and the known queues and consumers were declared again, or until
+// ctx is done. The reconnection goes on for other goroutines if ctx is done.
+func (amqpContext *AmqpContext) reconnect(ctx context.Context) error {
+	if amqpContext.reconnectTimeout < 0 {
+		return amqpContext.setErr(ErrConnectionLost)
+	}
+	current := amqpContext.reconnecting.start(amqpContext.redial)
+	select {
+	case <-current.done:
+		return current.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// redial restores the connection with backoff within the reconnect timeout
+func (amqpContext *AmqpContext) redial(ctx context.Context) error {
+	log.Warnf("AMQP connection of consumerId [%v] lost, reconnecting", amqpContext.consumerId)
+	policy := retryutil.Policy{
+		Name:           "reconnecting AMQP",
+		MaxAttempts:    -1,
+		MaxElapsed:     amqpContext.reconnectTimeout,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			log.Warnf("Reconnecting AMQP failed, retrying in %v: %v", delay, err)
+		},
+	}
+	var queues, consumers int
+	err := retryutil.Do(ctx, func(context.Context) (err error) {
+		queues, consumers, err = amqpContext.restore()
+		return err
+	}, policy)
+	if errors.Is(err, ErrClosed) || ctx.Err() != nil {
+		return ErrClosed
+	}
+	if err != nil {
+		reconnects.WithLabelValues("error").Inc()
+		return amqpContext.setErr(errors.Wrapf(ErrConnectionLost, "reconnecting failed: %v", err))
+	}
+	reconnects.WithLabelValues("success").Inc()
+	log.Infof("Reconnected AMQP for consumerId [%v] with %d queues and %d consumers", amqpContext.consumerId, queues, consumers)
+	return nil
+}
+
+// restore opens a channel, on a new connection if the connection was closed,
+// declares the queues, exchanges, bindings and consumers of the context on it
+// and swaps it in. The context is only locked to copy its topology and to swap.
+func (amqpContext *AmqpContext) restore() (int, int, error) {
+	amqpContext.mutex.Lock()
+	if amqpContext.closed {
+		amqpContext.mutex.Unlock()
+		return 0, 0, retryutil.Permanent(ErrClosed)
+	}
+	// restored declares the topology without touching the context
+	restored := &AmqpContext{
+		helper:                 amqpContext.helper,
+		amqpConnectionURL:      amqpContext.amqpConnectionURL,
+		connection:             amqpContext.connection,
+		consumerId:             amqpContext.consumerId,
+		queues:                 make(map[string]amqp.Queue),
+		queueOptions:           make(map[string]QueueOptions),
+		exchanges:              make(map[string]string),
+		deliveryChannels:       make(map[string]<-chan amqp.Delivery),
+		consumerOptions:        make(map[string]ConsumerOptions, len(amqpContext.consumerOptions)),
+		defaultConsumerOptions: amqpContext.defaultConsumerOptions,
+	}
+	for queueName, options := range amqpContext.consumerOptions {
+		restored.consumerOptions[queueName] = options
+	}
+	queues := make(map[string]QueueOptions, len(amqpContext.queueOptions))
+	for queueName, options := range amqpContext.queueOptions {
+		queues[queueName] = options
+	}
+	exchanges := make(map[string]string, len(amqpContext.exchanges))
+	for exchange, exchangeType := range amqpContext.exchanges {
+		exchanges[exchange] = exchangeType
+	}
+	bindings := amqpContext.bindings
+	exchangeBindings := amqpContext.exchangeBindings
+	consumers := make([]string, 0, len(amqpContext.deliveryChannels))
+	for queueName := range amqpContext.deliveryChannels {
+		consumers = append(consumers, queueName)
+	}
+	amqpContext.mutex.Unlock()
+
+	reopened := restored.connection == nil || restored.connection.IsClosed()
+	if reopened {
+		// pick up a connection URL with rotated credentials
+		if restored.helper != nil {
+			restored.amqpConnectionURL = restored.helper.ConnectionURL()
+		}
+		connection, err := restored.dial()
+		if err != nil {
+			return 0, 0, err
+		}
+		restored.connection = connection
+	}
+	channel, err := restored.declare(queues, exchanges, bindings, exchangeBindings, consumers)
+	if err != nil {
+		if reopened {
+			restored.connection.Close()
+		}
+		return 0, 0, err
+	}
+
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	if amqpContext.closed {
+		channel.Close()
+		if reopened {
+			restored.connection.Close()
+		}
+		return 0, 0, retryutil.Permanent(ErrClosed)
+	}
+	if amqpContext.channel != nil {
+		amqpContext.channel.Close()
+	}
+	amqpContext.connection = restored.connection
+	amqpContext.amqpConnectionURL = restored.amqpConnectionURL
+	amqpContext.channel = channel
+	amqpContext.channelClosed = channel.NotifyClose(make(chan *amqp.Error, 1))
+	go amqpContext.notifyReturns(channel.NotifyReturn(make(chan amqp.Return, 1)))
+	amqpContext.queues = restored.queues
+	amqpContext.queueOptions = restored.queueOptions
+	amqpContext.exchanges = restored.exchanges
+	amqpContext.bindings = restored.bindings
+	amqpContext.exchangeBindings = restored.exchangeBindings
+	amqpContext.deliveryChannels = restored.deliveryChannels
+	amqpContext.confirming = false
+	amqpContext.err = nil
+	if reopened {
+		amqpContext.watchConnection()
+		amqpContext.connected()
+	}
+	amqpContext.reconnected()
+	return len(queues), len(consumers), nil
+}
+
+// declare opens a channel on the connection of a context which is not shared
+// yet and declares the given topology and consumers on it
+func (amqpContext *AmqpContext) declare(queues map[string]QueueOptions, exchanges map[string]string, bindings, exchangeBindings []binding, consumers []string) (*amqp.Channel, error) {
+	channel, err := amqpContext.connection.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "Cannot open AMQP channel")
+	}
+	amqpContext.channel = channel
+	err = func() error {
+		for exchange, exchangeType := range exchanges {
+			if err := amqpContext.ensureExchangeExists(exchange, exchangeType); err != nil {
+				return err
+			}
+		}
+		for queueName, options := range queues {
+			if err := amqpContext.ensureQueueExists(queueName, options); err != nil {
+				return err
+			}
+		}
+		for _, binding := range exchangeBindings {
+			if err := amqpContext.bindExchange(binding.destination, binding.routingKey, binding.exchange, binding.args); err != nil {
+				return err
+			}
+		}
+		for _, binding := range bindings {
+			if err := amqpContext.bindQueue(binding.destination, binding.routingKey, binding.exchange, binding.args); err != nil {
+				return err
+			}
+		}
+		for _, queueName := range consumers {
+			if err := amqpContext.consume(queueName); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+	return channel, nil
+}
@@ -0,0 +1,107 @@
+package amqputil
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// RetryCountHeader counts the retries of messages rejected by RejectWithRetry
+const RetryCountHeader = "x-retry-count"
+
+// suffixes of the names of queues declared by DeclareRetryTopology
+const (
+	retryQueueSuffix   = ".retry"
+	parkingQueueSuffix = ".parking"
+)
+
+// RetryTopology is declared by DeclareRetryTopology
+type RetryTopology struct {
+	Queue string
+	// RetryQueue holds rejected messages for Delay before they return to Queue
+	RetryQueue string
+	// ParkingQueue keeps messages rejected more than MaxRetries times for
+	// manual inspection
+	ParkingQueue string
+	Delay        time.Duration
+	MaxRetries   int
+}
+
+// DeclareRetryTopology declares queueName with options, the retry queue
+// <queue>.retry and the parking queue <queue>.parking. Messages rejected by
+// RejectWithRetry wait delay in the retry queue before they are dead lettered
+// back into queueName, after maxRetries retries they are parked. The retry and
+// parking queues are durable if options are.
+func (amqpContext *AmqpContext) DeclareRetryTopology(queueName string, delay time.Duration, maxRetries int, options QueueOptions) (*RetryTopology, error) {
+	if err := amqpContext.lock(context.Background()); err != nil {
+		return nil, err
+	}
+	defer amqpContext.mutex.Unlock()
+	if delay <= 0 || maxRetries < 0 {
+		amqpContext.err = errors.Errorf("Invalid retry delay [%v] or retries [%d] for AMQP queue [%v]", delay, maxRetries, queueName)
+		return nil, amqpContext.err
+	}
+	topology := &RetryTopology{
+		Queue:        queueName,
+		RetryQueue:   queueName + retryQueueSuffix,
+		ParkingQueue: queueName + parkingQueueSuffix,
+		Delay:        delay,
+		MaxRetries:   maxRetries,
+	}
+	if err := amqpContext.ensureQueueExists(queueName, options); err != nil {
+		return nil, err
+	}
+	retryOptions := QueueOptions{Durable: options.durable(), MessageTTL: delay, DeadLetterRoutingKey: queueName}
+	if err := amqpContext.ensureQueueExists(topology.RetryQueue, retryOptions); err != nil {
+		return nil, err
+	}
+	if err := amqpContext.ensureQueueExists(topology.ParkingQueue, QueueOptions{Durable: options.durable()}); err != nil {
+		return nil, err
+	}
+	if amqpContext.retryTopologies == nil {
+		amqpContext.retryTopologies = make(map[string]*RetryTopology)
+	}
+	amqpContext.retryTopologies[queueName] = topology
+	return topology, nil
+}
+
+// RejectWithRetry acknowledges delivery from a queue with a RetryTopology and
+// publishes it again with incremented x-retry-count header to the retry queue,
+// or to the parking queue if the retries are exhausted.
+func (amqpContext *AmqpContext) RejectWithRetry(delivery Delivery) error {
+	amqpContext.mutex.Lock()
+	topology, ok := amqpContext.retryTopologies[delivery.Queue()]
+	amqpContext.mutex.Unlock()
+	if !ok {
+		return amqpContext.setErr(errors.Errorf("No retry topology declared for AMQP queue [%v]", delivery.Queue()))
+	}
+	retries := 0
+	if count, ok := toInt(delivery.Headers[RetryCountHeader]); ok {
+		retries = count
+	}
+	target := topology.RetryQueue
+	if retries >= topology.MaxRetries {
+		log.Warnf("Parking message from queue [%v] after %d retries", topology.Queue, retries)
+		target = topology.ParkingQueue
+	}
+
+	headers := make(amqp.Table, len(delivery.Headers)+1)
+	for name, value := range delivery.Headers {
+		headers[name] = value
+	}
+	headers[RetryCountHeader] = int64(retries + 1)
+	options := PublishOptions{
+		Headers:       headers,
+		Priority:      delivery.Priority,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		ReplyTo:       delivery.ReplyTo,
+		MessageId:     delivery.MessageId,
+	}
+	if err := amqpContext.publishBody(context.Background(), "", target, delivery.Body, options); err != nil {
+		return err
+	}
+	return delivery.Ack()
+}
@@ -0,0 +1,58 @@
+package amqputil
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var returned = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "amqp_returned_total",
+	Help: "The total number of mandatory AMQP messages returned as unroutable by exchange",
+}, []string{"exchange"})
+
+// ReturnHandler is called for a message published with
+// PublishOptions.Mandatory which the broker could not route to any queue
+type ReturnHandler func(returned amqp.Return)
+
+// returnHandlers are guarded by their own lock, as returns are delivered
+// while publishing may hold the context locked
+type returnHandlers struct {
+	mutex    sync.Mutex
+	handlers []ReturnHandler
+}
+
+func (returns *returnHandlers) add(handler ReturnHandler) {
+	returns.mutex.Lock()
+	defer returns.mutex.Unlock()
+	returns.handlers = append(returns.handlers, handler)
+}
+
+func (returns *returnHandlers) get() []ReturnHandler {
+	returns.mutex.Lock()
+	defer returns.mutex.Unlock()
+	return returns.handlers
+}
+
+// OnReturn registers handler for unroutable messages. Handlers are called
+// in a separate goroutine, unroutable messages without handler are logged.
+func (amqpContext *AmqpContext) OnReturn(handler ReturnHandler) {
+	amqpContext.returnHandlers.add(handler)
+}
+
+// notifyReturns calls the return handlers for messages returned on a channel
+// until the channel is closed
+func (amqpContext *AmqpContext) notifyReturns(returns <-chan amqp.Return) {
+	for message := range returns {
+		returned.WithLabelValues(message.Exchange).Inc()
+		handlers := amqpContext.returnHandlers.get()
+		if len(handlers) == 0 {
+			log.Warnf("AMQP message [%v] to exchange [%v] with routing key [%v] was returned: %v", message.MessageId, message.Exchange, message.RoutingKey, message.ReplyText)
+		}
+		for _, handler := range handlers {
+			handler(message)
+		}
+	}
+}
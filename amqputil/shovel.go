@@ -0,0 +1,129 @@
+package amqputil
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultShovelIdleTimeout is the time Shovel waits for further messages
+const DefaultShovelIdleTimeout = time.Second
+
+// ShovelOptions configures Shovel
+type ShovelOptions struct {
+	// Rate limits the moved messages per second, unlimited if 0
+	Rate int
+	// Max limits the number of moved messages, all if 0
+	Max int
+	// IdleTimeout stops shoveling if no message arrives within this time,
+	// default DefaultShovelIdleTimeout
+	IdleTimeout time.Duration
+	// ResetRetryCount removes the x-retry-count header, e.g. to replay
+	// messages from the parking queue of a RetryTopology
+	ResetRetryCount bool
+}
+
+// Shovel moves the messages of source to the queue destination, e.g. to
+// replay parked messages after an incident. Each message is acknowledged after
+// it was published with its properties. It returns the number of moved
+// messages once source is empty, Max messages were moved or ctx is done.
+func (amqpContext *AmqpContext) Shovel(ctx context.Context, source, destination string, options ShovelOptions) (int, error) {
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultShovelIdleTimeout
+	}
+	var ticker *time.Ticker
+	if options.Rate > 0 {
+		ticker = time.NewTicker(time.Second / time.Duration(options.Rate))
+		defer ticker.Stop()
+	}
+
+	log.Infof("Shoveling messages from queue [%v] to [%v]", source, destination)
+	moved := 0
+	for options.Max <= 0 || moved < options.Max {
+		if ticker != nil && moved > 0 {
+			select {
+			case <-ctx.Done():
+				amqpContext.cancelConsumer(source)
+				return moved, nil
+			case <-ticker.C:
+			}
+		}
+		receiveCtx, cancel := context.WithTimeout(ctx, options.IdleTimeout)
+		delivery, err := amqpContext.receive(receiveCtx, source)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) || ctx.Err() != nil {
+				// source is empty or ctx is done
+				break
+			}
+			return moved, err
+		}
+		if err := amqpContext.republish(ctx, destination, delivery, options.ResetRetryCount); err != nil {
+			delivery.Nack(false, true)
+			return moved, err
+		}
+		if err := delivery.Ack(false); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	amqpContext.cancelConsumer(source)
+	log.Infof("Shoveled %d messages from queue [%v] to [%v]", moved, source, destination)
+	return moved, nil
+}
+
+// republish publishes delivery with its properties to queueName
+func (amqpContext *AmqpContext) republish(ctx context.Context, queueName string, delivery *amqp.Delivery, resetRetryCount bool) error {
+	if err := amqpContext.lock(ctx); err != nil {
+		return err
+	}
+	err := amqpContext.ensureQueueExists(queueName)
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	headers := delivery.Headers
+	if resetRetryCount {
+		headers = make(amqp.Table, len(delivery.Headers))
+		for name, value := range delivery.Headers {
+			if name != RetryCountHeader {
+				headers[name] = value
+			}
+		}
+	}
+	options := PublishOptions{
+		Headers:       headers,
+		Priority:      delivery.Priority,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		ReplyTo:       delivery.ReplyTo,
+		MessageId:     delivery.MessageId,
+	}
+	return amqpContext.publishBody(ctx, "", queueName, delivery.Body, options)
+}
+
+// cancelConsumer stops consuming queueName and requeues the prefetched
+// messages, which basic.cancel leaves unacknowledged on the channel, so they
+// are delivered to other consumers
+func (amqpContext *AmqpContext) cancelConsumer(queueName string) {
+	amqpContext.mutex.Lock()
+	deliveryChan, ok := amqpContext.deliveryChannels[queueName]
+	if ok {
+		if err := amqpContext.channel.Cancel(amqpContext.consumerId, false); err != nil {
+			log.Warnf("Cannot cancel consumer of AMQP queue [%v]: %v", queueName, err)
+		}
+		delete(amqpContext.deliveryChannels, queueName)
+	}
+	amqpContext.mutex.Unlock()
+	if !ok {
+		return
+	}
+	// the chan is closed after the buffered deliveries or if the channel was closed
+	for delivery := range deliveryChan {
+		if err := delivery.Nack(false, true); err != nil {
+			log.Warnf("Cannot requeue AMQP message from queue [%v]: %v", queueName, err)
+		}
+	}
+}
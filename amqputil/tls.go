@@ -0,0 +1,173 @@
+package amqputil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"os"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/spf13/viper"
+)
+
+// config keys of the TLS settings for amqps:// connections
+const (
+	tlsCAFileConfigKey             = "amqp.tls.cafile"
+	tlsCertFileConfigKey           = "amqp.tls.certfile"
+	tlsKeyFileConfigKey            = "amqp.tls.keyfile"
+	tlsInsecureSkipVerifyConfigKey = "amqp.tls.insecureskipverify"
+)
+
+// config keys of the connection settings
+const (
+	connectionNameConfigKey   = "amqp.connection.name"
+	vhostConfigKey            = "amqp.vhost"
+	clientPropertiesConfigKey = "amqp.clientproperties"
+	heartbeatConfigKey        = "amqp.heartbeat"
+	dialTimeoutConfigKey      = "amqp.dialtimeout"
+	keepAliveConfigKey        = "amqp.keepalive"
+	channelMaxConfigKey       = "amqp.channelmax"
+)
+
+// default heartbeat interval and dial timeout
+const (
+	defaultHeartbeat   = 10 * time.Second
+	defaultDialTimeout = 30 * time.Second
+)
+
+func init() {
+	apputil.RegisterConfigKeys("amqputil",
+		apputil.ConfigKey{Key: tlsCAFileConfigKey, Type: "string", Description: "PEM file with the CAs verifying amqps:// brokers, default are the system CAs"},
+		apputil.ConfigKey{Key: tlsCertFileConfigKey, Type: "string", Description: "PEM file with the client certificate for amqps:// brokers"},
+		apputil.ConfigKey{Key: tlsKeyFileConfigKey, Type: "string", Description: "PEM file with the key of the client certificate"},
+		apputil.ConfigKey{Key: tlsInsecureSkipVerifyConfigKey, Type: "bool", Default: "false", Description: "skips verifying the broker certificate, for tests only"},
+		apputil.ConfigKey{Key: connectionNameConfigKey, Type: "string", Description: "name of the connections shown by the broker, default is the service name"},
+		apputil.ConfigKey{Key: vhostConfigKey, Type: "string", Description: "virtual host of the connections, default is the vhost of the URL"},
+		apputil.ConfigKey{Key: clientPropertiesConfigKey, Type: "map", Description: "further client properties of the connections shown by the broker"},
+		apputil.ConfigKey{Key: heartbeatConfigKey, Type: "duration", Default: defaultHeartbeat.String(), Description: "heartbeat interval of the connections, less than 1s uses the interval of the broker"},
+		apputil.ConfigKey{Key: dialTimeoutConfigKey, Type: "duration", Default: defaultDialTimeout.String(), Description: "timeout of establishing TCP connections"},
+		apputil.ConfigKey{Key: keepAliveConfigKey, Type: "duration", Description: "TCP keep-alive interval, default 15s, negative disables keep-alives"},
+		apputil.ConfigKey{Key: channelMaxConfigKey, Type: "int", Description: "maximum number of channels per connection, default is the limit of the broker"},
+	)
+}
+
+// NewTLSConfig creates a TLS config for amqps:// connections verifying the
+// broker with the CAs in caFile (default system CAs) and presenting the client
+// certificate in certFile and keyFile if set
+func NewTLSConfig(caFile, certFile, keyFile string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: insecureSkipVerify}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot read AMQP CA file [%v]", caFile)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("No certificates in AMQP CA file [%v]", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Cannot load AMQP client certificate [%v]", certFile)
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	if insecureSkipVerify {
+		log.Warnf("AMQP broker certificates are not verified")
+	}
+	return config, nil
+}
+
+// tlsConfig returns AmqpConnectionHelper.TLSConfig or, if amqp.tls.* keys are
+// configured, a config created from them. The files are read on each call,
+// so reconnections pick up renewed certificates.
+func (helper *AmqpConnectionHelper) tlsConfig() (*tls.Config, error) {
+	if helper.TLSConfig != nil {
+		return helper.TLSConfig, nil
+	}
+	if !viper.IsSet(tlsCAFileConfigKey) && !viper.IsSet(tlsCertFileConfigKey) && !viper.IsSet(tlsInsecureSkipVerifyConfigKey) {
+		return nil, nil
+	}
+	return NewTLSConfig(viper.GetString(tlsCAFileConfigKey), viper.GetString(tlsCertFileConfigKey),
+		viper.GetString(tlsKeyFileConfigKey), viper.GetBool(tlsInsecureSkipVerifyConfigKey))
+}
+
+// dial opens a connection to url, using TLS for amqps:// URLs. ctx limits
+// establishing the TCP connection.
+func (helper *AmqpConnectionHelper) dial(ctx context.Context, url string) (*amqp.Connection, error) {
+	tlsConfig, err := helper.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{
+		Timeout:   duration(helper.DialTimeout, dialTimeoutConfigKey, defaultDialTimeout),
+		KeepAlive: duration(helper.KeepAlive, keepAliveConfigKey, 0),
+	}
+	return amqp.DialConfig(url, amqp.Config{
+		Heartbeat:       duration(helper.Heartbeat, heartbeatConfigKey, defaultHeartbeat),
+		ChannelMax:      helper.channelMax(),
+		Locale:          "en_US",
+		Vhost:           helper.vhost(),
+		Properties:      helper.clientProperties(),
+		TLSClientConfig: tlsConfig,
+		Dial: func(network, address string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+	})
+}
+
+// duration returns value if set, else the duration configured for key or defaultValue
+func duration(value time.Duration, key string, defaultValue time.Duration) time.Duration {
+	if value != 0 {
+		return value
+	}
+	if viper.IsSet(key) {
+		return viper.GetDuration(key)
+	}
+	return defaultValue
+}
+
+// channelMax returns AmqpConnectionHelper.ChannelMax or the configured maximum
+func (helper *AmqpConnectionHelper) channelMax() uint16 {
+	if helper.ChannelMax != 0 {
+		return helper.ChannelMax
+	}
+	return uint16(viper.GetUint(channelMaxConfigKey))
+}
+
+// vhost returns AmqpConnectionHelper.Vhost or the configured vhost
+func (helper *AmqpConnectionHelper) vhost() string {
+	if helper.Vhost != "" {
+		return helper.Vhost
+	}
+	return viper.GetString(vhostConfigKey)
+}
+
+// clientProperties returns the configured client properties, overridden by
+// AmqpConnectionHelper.ClientProperties, with the connection name
+func (helper *AmqpConnectionHelper) clientProperties() amqp.Table {
+	properties := amqp.Table{}
+	for name, value := range viper.GetStringMapString(clientPropertiesConfigKey) {
+		properties[name] = value
+	}
+	for name, value := range helper.ClientProperties {
+		properties[name] = value
+	}
+	name := helper.ConnectionName
+	if name == "" {
+		name = viper.GetString(connectionNameConfigKey)
+	}
+	if name == "" {
+		name = apputil.GetServiceName()
+	}
+	if name != "" {
+		properties.SetClientConnectionName(name)
+	}
+	return properties
+}
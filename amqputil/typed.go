@@ -0,0 +1,19 @@
+package amqputil
+
+import (
+	"context"
+)
+
+// Publish sends message to queueName like PublishMessageCtx, with the
+// message type checked at compile time
+func Publish[T any](ctx context.Context, amqpContext *AmqpContext, queueName string, message T, options ...QueueOptions) error {
+	return amqpContext.PublishMessageCtx(ctx, queueName, message, options...)
+}
+
+// Receive gets the next message from queueName like ReceiveDelivery and
+// decodes it into a T. The caller settles the returned Delivery.
+func Receive[T any](ctx context.Context, amqpContext *AmqpContext, queueName string) (T, *Delivery, error) {
+	var message T
+	delivery, err := amqpContext.ReceiveDelivery(ctx, queueName, &message)
+	return message, delivery, err
+}
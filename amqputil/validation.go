@@ -0,0 +1,102 @@
+package amqputil
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// ValidationErrorHeader describes why a message was moved to a reject queue
+const ValidationErrorHeader = "x-validation-error"
+
+// MessageValidator checks the body of a received message, e.g. against a JSON
+// schema, and returns an error if it is invalid
+type MessageValidator func(delivery *amqp.Delivery) error
+
+// validation of the messages of a queue
+type validation struct {
+	validator   MessageValidator
+	rejectQueue string
+}
+
+// SetValidator validates the messages received from queueName before they
+// are decoded. Invalid messages are not returned, but published with an
+// x-validation-error header to the durable rejectQueue or, if it is empty,
+// rejected without requeue, i.e. dead lettered if configured.
+func (amqpContext *AmqpContext) SetValidator(queueName string, validator MessageValidator, rejectQueue string) {
+	amqpContext.mutex.Lock()
+	defer amqpContext.mutex.Unlock()
+	if amqpContext.validations == nil {
+		amqpContext.validations = make(map[string]validation)
+	}
+	amqpContext.validations[queueName] = validation{validator: validator, rejectQueue: rejectQueue}
+}
+
+// ProtoValidator accepts messages which are a valid binary or protojson
+// encoding of descriptor without unknown fields, see PublishProtoMessage
+func ProtoValidator(descriptor protoreflect.MessageDescriptor) MessageValidator {
+	return func(delivery *amqp.Delivery) error {
+		message := dynamicpb.NewMessage(descriptor)
+		if delivery.ContentType == ContentTypeProtobuf {
+			if err := proto.Unmarshal(delivery.Body, message); err != nil {
+				return err
+			}
+			if len(message.GetUnknown()) > 0 {
+				return errors.Errorf("message has fields unknown to %s", descriptor.FullName())
+			}
+			return nil
+		}
+		return protojson.Unmarshal(delivery.Body, message)
+	}
+}
+
+// valid validates delivery and rejects it if it is invalid
+func (amqpContext *AmqpContext) valid(ctx context.Context, queueName string, delivery *amqp.Delivery) (bool, error) {
+	amqpContext.mutex.Lock()
+	validation, ok := amqpContext.validations[queueName]
+	amqpContext.mutex.Unlock()
+	if !ok {
+		return true, nil
+	}
+	invalid := validation.validator(delivery)
+	if invalid == nil {
+		return true, nil
+	}
+
+	wrapped := newDelivery(queueName, *delivery)
+	if validation.rejectQueue == "" {
+		log.Warnf("Rejecting invalid message from queue [%v]: %v", queueName, invalid)
+		return false, wrapped.NackDiscard()
+	}
+	log.Warnf("Moving invalid message from queue [%v] to [%v]: %v", queueName, validation.rejectQueue, invalid)
+	if err := amqpContext.lock(ctx); err != nil {
+		return false, err
+	}
+	err := amqpContext.ensureQueueExists(validation.rejectQueue, QueueOptions{Durable: true})
+	amqpContext.mutex.Unlock()
+	if err != nil {
+		return false, err
+	}
+	headers := make(amqp.Table, len(delivery.Headers)+1)
+	for name, value := range delivery.Headers {
+		headers[name] = value
+	}
+	headers[ValidationErrorHeader] = fmt.Sprint(invalid)
+	options := PublishOptions{
+		Headers:       headers,
+		ContentType:   delivery.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		ReplyTo:       delivery.ReplyTo,
+		MessageId:     delivery.MessageId,
+	}
+	if err := amqpContext.publishBody(ctx, "", validation.rejectQueue, delivery.Body, options); err != nil {
+		return false, err
+	}
+	return false, wrapped.Ack()
+}
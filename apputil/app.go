@@ -0,0 +1,90 @@
+package apputil
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// App provides the standard command line of a service:
+//
+//	<service> [flags] [serve|version|config validate|config schema [yaml]|migrate]
+//
+// serve is the default subcommand. All subcommands except version and config
+// schema init the configuration before handing control to the service.
+// config schema prints the keys registered with RegisterConfigKeys.
+type App struct {
+	ProjectName  string
+	ServiceName  string
+	RequiredKeys []string     // passed to InitConfig
+	Serve        func() error // runs the service
+	Migrate      func() error // optional, migrates e.g. the database schema
+	Usage        func()       // optional, prints additional usage information
+}
+
+// Run parses the command line, runs the given subcommand and exits with code 1
+// (via Exit, i.e. after running the exit hooks) if it fails
+func (app *App) Run() {
+	if err := app.RunArgs(os.Args[1:]); err != nil {
+		Named(app.ServiceName).Errorf("%s failed: %v", app.ServiceName, err)
+		Exit(1)
+	}
+}
+
+// RunArgs runs the subcommand given by args, which may include flags
+func (app *App) RunArgs(args []string) error {
+	pflag.Usage = app.printUsage
+	if err := pflag.CommandLine.Parse(args); err != nil {
+		return err
+	}
+
+	subcommand := strings.Join(pflag.Args(), " ")
+	switch subcommand {
+	case "", "serve":
+		if err := app.initConfig(); err != nil {
+			return err
+		}
+		return app.Serve()
+	case "version":
+		fmt.Printf("%s %s\n", app.ServiceName, GetVersion())
+		return nil
+	case "config validate":
+		if err := app.initConfig(); err != nil {
+			return err
+		}
+		fmt.Println("Configuration is valid")
+		return nil
+	case "config schema", "config schema markdown":
+		return WriteConfigReference(os.Stdout, "markdown")
+	case "config schema yaml":
+		return WriteConfigReference(os.Stdout, "yaml")
+	case "migrate":
+		if app.Migrate == nil {
+			return fmt.Errorf("%s does not support migrate", app.ServiceName)
+		}
+		if err := app.initConfig(); err != nil {
+			return err
+		}
+		return app.Migrate()
+	case "help":
+		app.printUsage()
+		return nil
+	default:
+		app.printUsage()
+		return fmt.Errorf("unknown subcommand [%s]", subcommand)
+	}
+}
+
+func (app *App) initConfig() error {
+	return InitConfigE(app.ProjectName, app.ServiceName, app.RequiredKeys)
+}
+
+func (app *App) printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [flags] [serve|version|config validate|config schema [yaml]|migrate]\n\nFlags:\n", app.ServiceName)
+	pflag.PrintDefaults()
+	if app.Usage != nil {
+		app.Usage()
+	}
+}
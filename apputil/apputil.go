@@ -2,30 +2,57 @@
 package apputil
 
 import (
+	"crypto/rand"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"runtime/debug"
 	"strings"
-
-	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+	"sync"
 
 	"github.com/apex/log"
 	"github.com/google/uuid"
+	"github.com/oklog/ulid/v2"
 	jww "github.com/spf13/jwalterweatherman"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
 const debugLogLevelConfigKey = "debug"
+const componentLogLevelsConfigKey = "log.levels"
+const maskKeysConfigKey = "log.mask.keys"
+const maskPatternsConfigKey = "log.mask.patterns"
+const logColorConfigKey = "log.color"
+const logOutputConfigKey = "log.output"
+const logDedupConfigKey = "log.dedup"
+const logAsyncBufferSizeConfigKey = "log.async.buffersize"
+const logAsyncPolicyConfigKey = "log.async.policy"
 
 var (
-	logger                 *log.Entry
+	logger                 = log.WithFields(log.Fields{})
 	explicitConfigFilename string
-	upperProjectName       string
-	upperServiceName       string
+	configProfile          string
+	configFragmentDir      string
+
+	// guards the settings used by InitLogging
+	settingsLock     sync.Mutex
+	upperProjectName string
+	upperServiceName string
+	appServiceName   string
+	logOutput        string
+	logColor         *bool
+
+	// Version of the service, can be set with
+	// -ldflags "-X github.com/science-computing/service-common-golang/apputil.Version=1.2.3"
+	Version string
 )
 
 func init() {
 	pflag.StringVar(&explicitConfigFilename, "config", "", "the configfile to use")
+	pflag.StringVar(&configFragmentDir, "confd", "", "directory with additional config files to merge, default <service>.d next to the configfile")
+	pflag.StringVar(&configProfile, "profile", "", "the config profile to merge, e.g. prod merges <service>.prod.yaml")
 }
 
 // SetExplicitConfigFile overrides the heuristics to identify the config file
@@ -37,10 +64,21 @@ func SetExplicitConfigFile(name string) {
 // requiredKeys are checked for presence to ensure default configuration values
 // if not found the service exits
 func InitConfig(projectName string, serviceName string, requiredKeys []string) {
+	if err := InitConfigE(projectName, serviceName, requiredKeys); err != nil {
+		logger.Fatal(err.Error())
+	}
+}
+
+// InitConfigE works like InitConfig, but returns an error instead of exiting
+// if the configuration cannot be read or is invalid
+func InitConfigE(projectName string, serviceName string, requiredKeys []string) error {
+	settingsLock.Lock()
+	appServiceName = serviceName
 	upperProjectName = strings.ReplaceAll(strings.ToUpper(projectName), "-", "_")
 	upperServiceName = strings.ReplaceAll(strings.ToUpper(serviceName), "-", "_")
-	if logger == nil {
-		logger = InitLogging()
+	settingsLock.Unlock()
+	if outputHandler.Load() == nil {
+		InitLogging()
 	}
 	logger.Debug("Init configuration")
 	if explicitConfigFilename == "" {
@@ -50,12 +88,12 @@ func InitConfig(projectName string, serviceName string, requiredKeys []string) {
 	if explicitConfigFilename != "" {
 		f, err := os.Open(explicitConfigFilename)
 		if err != nil {
-			logger.Fatalf("Configfile %s could not be read: %v", explicitConfigFilename, err)
+			return fmt.Errorf("Configfile %s could not be read: %w", explicitConfigFilename, err)
 		}
 		defer f.Close()
 		err = viper.ReadConfig(f)
 		if err != nil {
-			logger.Fatalf("Configfile %s could not be read: %v", explicitConfigFilename, err)
+			return fmt.Errorf("Configfile %s could not be read: %w", explicitConfigFilename, err)
 		}
 		logger.Infof("Successfully read configuration from [%v]", explicitConfigFilename)
 	} else {
@@ -70,11 +108,38 @@ func InitConfig(projectName string, serviceName string, requiredKeys []string) {
 		viper.SetConfigName(serviceName)
 		err := viper.ReadInConfig()
 		if err != nil {
-			logger.Fatalf("Configuration could not be read: %s", err)
+			return fmt.Errorf("Configuration could not be read: %w", err)
 		}
 		logger.Debugf("Successfully read configuration from [%v]", viper.GetViper().ConfigFileUsed())
 	}
 
+	configFile := explicitConfigFilename
+	if configFile == "" {
+		configFile = viper.ConfigFileUsed()
+	}
+
+	// merge config fragments, e.g. exampleservice.d/db.yaml
+	if configFragmentDir == "" {
+		configFragmentDir = os.Getenv(fmt.Sprintf("%s_%s_CONFD", upperProjectName, upperServiceName))
+	}
+	fragmentDir := configFragmentDir
+	if fragmentDir == "" {
+		fragmentDir = strings.TrimSuffix(configFile, filepath.Ext(configFile)) + ".d"
+	}
+	if err := mergeConfigDir(fragmentDir, configFragmentDir != ""); err != nil {
+		return err
+	}
+
+	// merge profile overlay, e.g. exampleservice.prod.yaml
+	if configProfile == "" {
+		configProfile = os.Getenv(fmt.Sprintf("%s_PROFILE", upperProjectName))
+	}
+	if configProfile != "" {
+		if err := mergeProfileConfig(configFile, configProfile); err != nil {
+			return err
+		}
+	}
+
 	// overwrite config file config values with ENV values if present
 	viper.SetEnvPrefix(fmt.Sprintf("%s_%s", strings.ToUpper(projectName), strings.ToUpper(serviceName)))
 	// tells viper to check for the env var everytime Get() is called
@@ -84,49 +149,166 @@ func InitConfig(projectName string, serviceName string, requiredKeys []string) {
 	// check values
 	for _, key := range requiredKeys {
 		if !viper.IsSet(key) {
-			logger.Fatalf("No config key [%s] in config file or [%s] in ENV", key, strings.ToUpper(serviceName)+"_"+strings.ToUpper(key))
+			return fmt.Errorf("No config key [%s] in config file or [%s] in ENV", key, strings.ToUpper(serviceName)+"_"+strings.ToUpper(key))
 		}
 	}
 
+	// warn about keys no package consumes, e.g. typos
+	for _, key := range UnknownConfigKeys(requiredKeys...) {
+		logger.Warnf("Unknown config key [%s], see the config schema subcommand for known keys", key)
+	}
+
 	// check if debug log is enabled via config file or ENV
 	if viper.GetBool(debugLogLevelConfigKey) {
 		//set Viper internal log level to output everything
 		jww.SetLogThreshold(jww.LevelTrace)
 		jww.SetStdoutThreshold(jww.LevelTrace)
-		log.SetLevel(log.DebugLevel)
+		SetLevel(log.DebugLevel)
 	}
 
+	// reinit logging if output or color auto detection are overridden
+	if viper.IsSet(logColorConfigKey) || viper.IsSet(logOutputConfigKey) {
+		settingsLock.Lock()
+		if viper.IsSet(logColorConfigKey) {
+			color := viper.GetBool(logColorConfigKey)
+			logColor = &color
+		}
+		logOutput = viper.GetString(logOutputConfigKey)
+		settingsLock.Unlock()
+		InitLoggingWithLevel(GetLevel())
+	}
+
+	// set levels of named loggers
+	componentLevels := make(map[string]log.Level)
+	for component, levelName := range viper.GetStringMapString(componentLogLevelsConfigKey) {
+		level, err := log.ParseLevel(levelName)
+		if err != nil {
+			return fmt.Errorf("Invalid log level [%s] for component [%s] in [%s]", levelName, component, componentLogLevelsConfigKey)
+		}
+		componentLevels[component] = level
+	}
+	for component, level := range componentLevels {
+		SetComponentLevel(component, level)
+	}
+
+	// write log entries in the background
+	if viper.IsSet(logAsyncBufferSizeConfigKey) {
+		policy := BlockOnOverflow
+		switch viper.GetString(logAsyncPolicyConfigKey) {
+		case "", "block":
+		case "dropOldest":
+			policy = DropOldestOnOverflow
+		default:
+			return fmt.Errorf("Invalid policy [%s] in [%s], expected block or dropOldest", viper.GetString(logAsyncPolicyConfigKey), logAsyncPolicyConfigKey)
+		}
+		SetAsyncLogging(viper.GetInt(logAsyncBufferSizeConfigKey), policy)
+	}
+
+	// collapse repeated log entries
+	if viper.IsSet(logDedupConfigKey) {
+		SetDeduplication(viper.GetBool(logDedupConfigKey))
+	}
+
+	// mask configured sensitive values in log entries
+	var maskPatterns []*regexp.Regexp
+	for _, expr := range viper.GetStringSlice(maskPatternsConfigKey) {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("Invalid pattern [%s] in [%s]: %w", expr, maskPatternsConfigKey, err)
+		}
+		maskPatterns = append(maskPatterns, pattern)
+	}
+	AddMasking(viper.GetStringSlice(maskKeysConfigKey), maskPatterns)
+
 	// print config
-	for key, value := range viper.AllSettings() {
-		logger.Debugf("Configuration setting [%s=%v]", key, value)
+	// (as fields, so values of sensitive keys get masked)
+	for _, key := range viper.AllKeys() {
+		logger.WithField(key, viper.Get(key)).Debug("Configuration setting")
 	}
+	return nil
+}
+
+// mergeConfigDir merges all YAML files in dir into the configuration in
+// lexical order, i.e. later files override earlier ones. Hidden files are
+// skipped, e.g. the ..data link of a mounted k8s ConfigMap.
+// A missing dir is only an error if required.
+func mergeConfigDir(dir string, required bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if !required && os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("Config directory %s could not be read: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		extension := filepath.Ext(name)
+		if entry.IsDir() || strings.HasPrefix(name, ".") || (extension != ".yaml" && extension != ".yml") {
+			continue
+		}
+		fragmentFile := filepath.Join(dir, name)
+		if err := mergeConfigFile(fragmentFile); err != nil {
+			return err
+		}
+		logger.Infof("Successfully merged configuration from [%v]", fragmentFile)
+	}
+	return nil
+}
+
+func mergeConfigFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("Configfile %s could not be read: %w", name, err)
+	}
+	defer f.Close()
+	if err = viper.MergeConfig(f); err != nil {
+		return fmt.Errorf("Configfile %s could not be read: %w", name, err)
+	}
+	return nil
+}
+
+// mergeProfileConfig merges the overlay <name>.<profile>.yaml next to the
+// given config file <name>.yaml into the configuration
+func mergeProfileConfig(configFile string, profile string) error {
+	extension := filepath.Ext(configFile)
+	overlayFile := strings.TrimSuffix(configFile, extension) + "." + profile + extension
+	if _, err := os.Stat(overlayFile); err != nil {
+		logger.Warnf("No configuration overlay for profile [%s]: %v", profile, err)
+		return nil
+	}
+	if err := mergeConfigFile(overlayFile); err != nil {
+		return err
+	}
+	logger.Infof("Successfully merged configuration for profile [%s] from [%v]", profile, overlayFile)
+	return nil
 }
 
 // InitLogging inits apex/log as log
 func InitLoggingWithLevel(level log.Level) *log.Entry {
-	if logger == nil {
-		logger = log.WithFields(log.Fields{})
+	settingsLock.Lock()
+	output := logOutput
+	if output == "" && upperProjectName != "" && upperServiceName != "" {
+		output = os.Getenv(fmt.Sprintf("%s_%s_LOGFILE", upperProjectName, upperServiceName))
 	}
-	logfilename := ""
-	if upperProjectName != "" && upperServiceName != "" {
-		logfilename = os.Getenv(fmt.Sprintf("%s_%s_LOGFILE", upperProjectName, upperServiceName))
+	if output == "" {
+		output = stdoutLogOutput
 	}
-	if logfilename == "" {
-		logfilename = "stdout"
+	// init logging
+	handler, err := newOutputHandler(output)
+	if err != nil {
+		handler, _ = newOutputHandler(stdoutLogOutput)
 	}
-	var logfile *os.File
-	if logfilename == "stdout" {
-		logfile = os.Stdout
-	} else if logfilename == "stderr" {
-		logfile = os.Stderr
-	} else {
-		logfile, _ = os.OpenFile(logfilename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	settingsLock.Unlock()
+	if err != nil {
+		defer logger.Warnf("Cannot log to [%s], logging to stdout instead: %v", output, err)
+	}
+	// release the connection of a previous syslog or journald handler
+	if closer, ok := SetOutputHandler(handler).(io.Closer); ok {
+		closer.Close()
 	}
-	// init logging
-	log.SetHandler(verbosetextlog.New(logfile))
 
 	// set default log level to INFO
-	log.SetLevel(level)
+	SetLevel(level)
 
 	return logger
 }
@@ -136,7 +318,61 @@ func InitLogging() *log.Entry {
 	return InitLoggingWithLevel(log.InfoLevel)
 }
 
+// GetServiceName returns the service name passed to InitConfig or ""
+func GetServiceName() string {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	return appServiceName
+}
+
+// GetVersion returns Version or, if not set, the version of the main module
+func GetVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		return info.Main.Version
+	}
+	return ""
+}
+
 // GenerateGUID generates a globally unique identifier
 func GenerateGUID() string {
 	return uuid.New().String()
 }
+
+// GenerateUUIDv5 generates a name based UUID (version 5), i.e. the same namespace
+// and name always result in the same UUID. namespace is either a UUID, e.g.
+// uuid.NameSpaceURL.String(), or an arbitrary string like "dataset-path" which
+// is converted to a UUID itself.
+func GenerateUUIDv5(namespace, name string) string {
+	namespaceUUID, err := uuid.Parse(namespace)
+	if err != nil {
+		namespaceUUID = uuid.NewSHA1(uuid.Nil, []byte(namespace))
+	}
+	return uuid.NewSHA1(namespaceUUID, []byte(name)).String()
+}
+
+// GenerateULID generates a lexicographically sortable unique identifier.
+// IDs generated within the same millisecond by this process are monotonically increasing.
+func GenerateULID() string {
+	return ulid.Make().String()
+}
+
+// shortIDAlphabet is Crockford's base32 alphabet, avoiding the ambiguous characters I, L, O and U
+const shortIDAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// shortIDLength results in 60 random bits, i.e. a collision is expected after about 10^9 IDs
+const shortIDLength = 12
+
+// GenerateShortID generates a short random identifier for humans, e.g. "7K3QX9M2ZC4D"
+func GenerateShortID() string {
+	var random [shortIDLength]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		panic(err)
+	}
+	for index, value := range random {
+		random[index] = shortIDAlphabet[value%byte(len(shortIDAlphabet))]
+	}
+	return string(random[:])
+}
@@ -0,0 +1,157 @@
+package apputil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestGenerateULIDIsMonotonic(t *testing.T) {
+	previous := GenerateULID()
+	for i := 0; i < 10000; i++ {
+		id := GenerateULID()
+		if id <= previous {
+			t.Fatalf("ULID [%s] is not greater than previous ULID [%s]", id, previous)
+		}
+		previous = id
+	}
+}
+
+func TestGenerateShortID(t *testing.T) {
+	ids := make(map[string]bool)
+	for i := 0; i < 10000; i++ {
+		id := GenerateShortID()
+		if len(id) != shortIDLength {
+			t.Fatalf("expected length %d, got [%s]", shortIDLength, id)
+		}
+		if strings.Trim(id, shortIDAlphabet) != "" {
+			t.Fatalf("ID [%s] contains characters not in alphabet", id)
+		}
+		if ids[id] {
+			t.Fatalf("duplicate ID [%s]", id)
+		}
+		ids[id] = true
+	}
+}
+
+func TestGenerateUUIDv5(t *testing.T) {
+	if id := GenerateUUIDv5("6ba7b810-9dad-11d1-80b4-00c04fd430c8", "python.org"); id != "886313e1-3b8a-5372-9b90-0c9aee199e5d" {
+		t.Errorf("unexpected UUID [%s] for DNS namespace", id)
+	}
+	if GenerateUUIDv5("dataset-path", "/data/a") != GenerateUUIDv5("dataset-path", "/data/a") {
+		t.Error("expected the same UUID for the same namespace and name")
+	}
+	if GenerateUUIDv5("dataset-path", "/data/a") == GenerateUUIDv5("dataset-path", "/data/b") {
+		t.Error("expected different UUIDs for different names")
+	}
+}
+
+func TestInitConfigEReturnsError(t *testing.T) {
+	SetExplicitConfigFile(t.TempDir() + "/missing.yaml")
+	defer SetExplicitConfigFile("")
+
+	if err := InitConfigE("test", "missing", nil); err == nil {
+		t.Error("expected error for missing config file")
+	}
+}
+
+// resetConfig replaces the configuration with the given YAML
+func resetConfig(t *testing.T, yaml string) {
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	if err := viper.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeFiles creates the files in dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMergeConfigDir(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		files    map[string]string // nil for a missing directory
+		required bool
+		value    string
+		other    string // default base
+		fails    bool
+	}{
+		{name: "lexical order", files: map[string]string{"20-b.yaml": "key: b", "10-a.yml": "key: a\nother: a"}, value: "b", other: "a"},
+		{name: "hidden and other files skipped", files: map[string]string{"10-a.yaml": "key: a", ".hidden.yaml": "key: hidden", "notes.txt": "key: txt"}, value: "a"},
+		{name: "empty", files: map[string]string{}, value: "base"},
+		{name: "missing", value: "base"},
+		{name: "missing required", required: true, fails: true},
+		{name: "invalid", files: map[string]string{"10-a.yaml": "key: [", "20-b.yaml": "key: b"}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resetConfig(t, "key: base\nother: base")
+			dir := filepath.Join(t.TempDir(), "conf.d")
+			if test.files != nil {
+				if err := os.Mkdir(dir, 0o755); err != nil {
+					t.Fatal(err)
+				}
+				writeFiles(t, dir, test.files)
+			}
+			err := mergeConfigDir(dir, test.required)
+			if (err != nil) != test.fails {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if test.fails {
+				return
+			}
+			if value := viper.GetString("key"); value != test.value {
+				t.Errorf("expected key [%s], got [%s]", test.value, value)
+			}
+			if test.other == "" {
+				test.other = "base"
+			}
+			if other := viper.GetString("other"); other != test.other {
+				t.Errorf("expected other [%s], got [%s]", test.other, other)
+			}
+		})
+	}
+}
+
+func TestMergeProfileConfig(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		profile string
+		files   map[string]string
+		value   string
+		fails   bool
+	}{
+		{name: "overlay", profile: "dev", files: map[string]string{"service.dev.yaml": "key: dev"}, value: "dev"},
+		{name: "other profile", profile: "prod", files: map[string]string{"service.dev.yaml": "key: dev", "service.prod.yaml": "key: prod"}, value: "prod"},
+		{name: "missing profile", profile: "test", files: map[string]string{"service.dev.yaml": "key: dev"}, value: "base"},
+		{name: "invalid overlay", profile: "dev", files: map[string]string{"service.dev.yaml": "key: ["}, fails: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			resetConfig(t, "key: base\nother: base")
+			dir := t.TempDir()
+			writeFiles(t, dir, test.files)
+			err := mergeProfileConfig(filepath.Join(dir, "service.yaml"), test.profile)
+			if (err != nil) != test.fails {
+				t.Fatalf("expected failure %v, got %v", test.fails, err)
+			}
+			if test.fails {
+				return
+			}
+			if value := viper.GetString("key"); value != test.value {
+				t.Errorf("expected key [%s], got [%s]", test.value, value)
+			}
+			if other := viper.GetString("other"); other != "base" {
+				t.Errorf("expected keys missing in the overlay to be kept, got [%s]", other)
+			}
+		})
+	}
+}
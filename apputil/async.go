@@ -0,0 +1,149 @@
+package apputil
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	"github.com/apex/log"
+)
+
+// OverflowPolicy defines what AsyncHandler does if its buffer is full
+type OverflowPolicy int
+
+const (
+	// BlockOnOverflow blocks the logging goroutine until there is space in the buffer
+	BlockOnOverflow OverflowPolicy = iota
+	// DropOldestOnOverflow drops the oldest buffered entry
+	DropOldestOnOverflow
+)
+
+// asyncItem is either an entry to write or a flush request
+type asyncItem struct {
+	entry   *log.Entry
+	flushed chan struct{}
+}
+
+// AsyncHandler buffers entries and passes them on to the wrapped handler in a
+// background goroutine, so logging does not wait for the output
+type AsyncHandler struct {
+	handler   log.Handler
+	policy    OverflowPolicy
+	items     chan asyncItem
+	dropped   atomic.Int64
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewAsyncHandler creates an AsyncHandler with a buffer for size entries and
+// starts its background writer. Call Close to stop it.
+func NewAsyncHandler(handler log.Handler, size int, policy OverflowPolicy) *AsyncHandler {
+	h := &AsyncHandler{
+		handler: handler,
+		policy:  policy,
+		items:   make(chan asyncItem, size),
+		done:    make(chan struct{}),
+	}
+	go h.write()
+	return h
+}
+
+// HandleLog implements log.Handler. The source of the entry is determined
+// before it is buffered, see verbosetextlog.Source.
+func (h *AsyncHandler) HandleLog(e *log.Entry) error {
+	buffered := *e
+	buffered.Fields = make(log.Fields, len(e.Fields)+1)
+	for name, value := range e.Fields {
+		buffered.Fields[name] = value
+	}
+	if _, ok := buffered.Fields[verbosetextlog.SourceField]; !ok {
+		buffered.Fields[verbosetextlog.SourceField] = verbosetextlog.Source()
+	}
+	h.enqueue(asyncItem{entry: &buffered})
+	return nil
+}
+
+// Flush blocks until all entries buffered before the call have been written
+func (h *AsyncHandler) Flush() {
+	flushed := make(chan struct{})
+	h.enqueue(asyncItem{flushed: flushed})
+	select {
+	case <-flushed:
+	case <-h.done:
+	}
+}
+
+// Close writes all buffered entries and stops the background writer.
+// Entries handled after Close are dropped.
+func (h *AsyncHandler) Close() {
+	h.Flush()
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// Dropped returns the number of entries dropped due to a full buffer
+func (h *AsyncHandler) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+func (h *AsyncHandler) enqueue(item asyncItem) {
+	for {
+		select {
+		case <-h.done:
+			h.drop(item)
+			return
+		case h.items <- item:
+			return
+		default:
+		}
+		if h.policy == BlockOnOverflow {
+			select {
+			case <-h.done:
+				h.drop(item)
+			case h.items <- item:
+			}
+			return
+		}
+		// make room by dropping the oldest entry
+		select {
+		case oldest := <-h.items:
+			h.drop(oldest)
+		default:
+		}
+	}
+}
+
+func (h *AsyncHandler) drop(item asyncItem) {
+	if item.flushed != nil {
+		close(item.flushed)
+	} else {
+		h.dropped.Add(1)
+	}
+}
+
+func (h *AsyncHandler) write() {
+	var reported int64
+	for {
+		select {
+		case <-h.done:
+			return
+		case item := <-h.items:
+			if item.flushed != nil {
+				close(item.flushed)
+				continue
+			}
+			if dropped := h.dropped.Load(); dropped > reported {
+				h.handler.HandleLog(&log.Entry{
+					Level:     log.WarnLevel,
+					Message:   "Dropped log entries due to full buffer",
+					Fields:    log.Fields{"dropped": dropped - reported, verbosetextlog.SourceField: "async.go"},
+					Timestamp: item.entry.Timestamp,
+				})
+				reported = dropped
+			}
+			h.handler.HandleLog(item.entry)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package apputil
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+)
+
+func TestAsyncHandlerFlush(t *testing.T) {
+	output := memory.New()
+	handler := NewAsyncHandler(output, 10, BlockOnOverflow)
+	defer handler.Close()
+
+	for i := 0; i < 100; i++ {
+		handler.HandleLog(&log.Entry{Level: log.InfoLevel, Message: fmt.Sprint(i), Fields: log.Fields{}})
+	}
+	handler.Flush()
+
+	if len(output.Entries) != 100 {
+		t.Fatalf("expected 100 entries after flush, got %d", len(output.Entries))
+	}
+	for i, entry := range output.Entries {
+		if entry.Message != fmt.Sprint(i) {
+			t.Fatalf("expected entry %d in order, got [%s]", i, entry.Message)
+		}
+	}
+}
+
+func TestAsyncHandlerDropOldest(t *testing.T) {
+	blocked := make(chan struct{})
+	output := memory.New()
+	handler := NewAsyncHandler(log.HandlerFunc(func(e *log.Entry) error {
+		<-blocked
+		return output.HandleLog(e)
+	}), 2, DropOldestOnOverflow)
+	defer handler.Close()
+
+	for i := 0; i < 10; i++ {
+		handler.HandleLog(&log.Entry{Level: log.InfoLevel, Message: fmt.Sprint(i), Fields: log.Fields{}})
+	}
+	if handler.Dropped() == 0 {
+		t.Error("expected dropped entries")
+	}
+	close(blocked)
+	handler.Flush()
+
+	if last := output.Entries[len(output.Entries)-1]; last.Message != "9" {
+		t.Errorf("expected newest entry to be kept, got [%s]", last.Message)
+	}
+}
@@ -0,0 +1,81 @@
+package apputil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// byteSizeUnits maps (lower case) units to their number of bytes
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"k":   1000,
+	"kb":  1000,
+	"kib": 1 << 10,
+	"m":   1000 * 1000,
+	"mb":  1000 * 1000,
+	"mib": 1 << 20,
+	"g":   1000 * 1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"gib": 1 << 30,
+	"t":   1000 * 1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"tib": 1 << 40,
+}
+
+// GetDuration returns the duration configured for key, e.g. "30s", "5m" or "1h30m".
+// defaultValue is returned if key is not set. Numbers without unit are rejected,
+// as it is unclear whether seconds or milliseconds are meant.
+func GetDuration(key string, defaultValue time.Duration) (time.Duration, error) {
+	if !viper.IsSet(key) {
+		return defaultValue, nil
+	}
+	value := strings.TrimSpace(viper.GetString(key))
+	if _, err := strconv.ParseFloat(value, 64); err == nil && value != "0" {
+		return 0, fmt.Errorf("Config key [%s] has no duration unit: [%s], use e.g. [%ss]", key, value, value)
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Config key [%s] is not a valid duration: %w", key, err)
+	}
+	if duration < 0 {
+		return 0, fmt.Errorf("Config key [%s] must not be negative: [%s]", key, value)
+	}
+	return duration, nil
+}
+
+// GetByteSize returns the number of bytes configured for key, e.g. "512MiB",
+// "10MB" or "1024". defaultValue is returned if key is not set.
+func GetByteSize(key string, defaultValue int64) (int64, error) {
+	if !viper.IsSet(key) {
+		return defaultValue, nil
+	}
+	size, err := ParseByteSize(viper.GetString(key))
+	if err != nil {
+		return 0, fmt.Errorf("Config key [%s] is not a valid byte size: %w", key, err)
+	}
+	return size, nil
+}
+
+// ParseByteSize parses sizes like "512MiB" (binary, 1024 based), "10MB" (decimal,
+// 1000 based) or "1024" (bytes). Units are case insensitive.
+func ParseByteSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	numberEnd := strings.IndexFunc(value, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if numberEnd == -1 {
+		numberEnd = len(value)
+	}
+	number, err := strconv.ParseFloat(value[:numberEnd], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte size [%s]", value)
+	}
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(value[numberEnd:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid byte size unit in [%s]", value)
+	}
+	return int64(number * float64(unit)), nil
+}
@@ -0,0 +1,86 @@
+package apputil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"1024":    1024,
+		"512MiB":  512 << 20,
+		"10MB":    10_000_000,
+		"1.5 GiB": 3 << 29,
+		"2k":      2000,
+	} {
+		size, err := ParseByteSize(value)
+		if err != nil || size != expected {
+			t.Errorf("expected %d for [%s], got %d (%v)", expected, value, size, err)
+		}
+	}
+	for _, value := range []string{"", "MiB", "10XB", "-1"} {
+		if _, err := ParseByteSize(value); err == nil {
+			t.Errorf("expected error for [%s]", value)
+		}
+	}
+}
+
+func TestGetDuration(t *testing.T) {
+	viper.Set("test.duration", "5m")
+	viper.Set("test.nounit", 30)
+	defer viper.Reset()
+
+	if duration, err := GetDuration("test.duration", time.Second); err != nil || duration != 5*time.Minute {
+		t.Errorf("expected 5m, got %v (%v)", duration, err)
+	}
+	if duration, err := GetDuration("test.missing", time.Second); err != nil || duration != time.Second {
+		t.Errorf("expected default 1s, got %v (%v)", duration, err)
+	}
+	if _, err := GetDuration("test.nounit", time.Second); err == nil {
+		t.Error("expected error for duration without unit")
+	}
+}
+
+func TestUnknownConfigKeys(t *testing.T) {
+	RegisterConfigKeys("test",
+		ConfigKey{Key: "test.pool.size", Type: "int"},
+		ConfigKey{Key: "test.sinks", Type: "list"},
+	)
+	viper.Set("test.pool.size", 5)
+	viper.Set("test.pool.sise", 5)
+	viper.Set("test.sinks", []map[string]string{{"type": "stdout"}})
+	viper.Set("log.levels.dbutil", "warn")
+	viper.Set("servicekey", "value")
+	defer viper.Reset()
+
+	unknown := UnknownConfigKeys("serviceKey")
+	if len(unknown) != 1 || unknown[0] != "test.pool.sise" {
+		t.Errorf("expected only the misspelled key to be unknown, got %v", unknown)
+	}
+}
+
+func TestWriteConfigReference(t *testing.T) {
+	RegisterConfigKeys("test", ConfigKey{Key: "test.pool.size", Type: "int", Default: "10", Description: "pool size"})
+
+	var markdown strings.Builder
+	if err := WriteConfigReference(&markdown, "markdown"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(markdown.String(), "| `test.pool.size` | int | 10 | test | pool size |\n") {
+		t.Errorf("missing key in markdown reference:\n%s", markdown.String())
+	}
+
+	var yaml strings.Builder
+	if err := WriteConfigReference(&yaml, "yaml"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(yaml.String(), "# test:\n  # pool:\n    # pool size (int, test)\n    # size: 10\n") {
+		t.Errorf("missing key in yaml reference:\n%s", yaml.String())
+	}
+	if err := WriteConfigReference(&yaml, "json"); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
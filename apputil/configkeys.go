@@ -0,0 +1,142 @@
+package apputil
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// ConfigKey documents a configuration key consumed by a package or service
+type ConfigKey struct {
+	Key         string // dotted key, a segment * matches any segment, e.g. log.levels.*
+	Type        string // e.g. string, int, bool, duration, bytesize, list or map
+	Default     string // documented default, empty if there is none
+	Description string
+	Component   string // set by RegisterConfigKeys
+}
+
+var (
+	configKeysLock sync.RWMutex
+	configKeys     = make(map[string]ConfigKey)
+)
+
+func init() {
+	RegisterConfigKeys("apputil",
+		ConfigKey{Key: debugLogLevelConfigKey, Type: "bool", Default: "false", Description: "enables debug logging"},
+		ConfigKey{Key: componentLogLevelsConfigKey + ".*", Type: "string", Description: "log level of a named logger, e.g. log.levels.dbutil: warn"},
+		ConfigKey{Key: maskKeysConfigKey, Type: "list", Description: "additional field names whose values are masked in logs"},
+		ConfigKey{Key: maskPatternsConfigKey, Type: "list", Description: "regular expressions of values masked in logs"},
+		ConfigKey{Key: logColorConfigKey, Type: "bool", Description: "forces colored log output on or off, default is auto detection"},
+		ConfigKey{Key: logOutputConfigKey, Type: "string", Default: stdoutLogOutput, Description: "stdout, stderr, syslog, journald or a file name"},
+		ConfigKey{Key: logDedupConfigKey, Type: "bool", Default: "false", Description: "collapses repeated log entries"},
+		ConfigKey{Key: logAsyncBufferSizeConfigKey, Type: "int", Description: "enables asynchronous logging with a buffer of this size"},
+		ConfigKey{Key: logAsyncPolicyConfigKey, Type: "string", Default: "block", Description: "block or dropOldest if the async log buffer is full"},
+		ConfigKey{Key: syslogNetworkConfigKey, Type: "string", Description: "network of a remote syslog, e.g. udp, default is the local syslog"},
+		ConfigKey{Key: syslogAddressConfigKey, Type: "string", Description: "address of a remote syslog"},
+		ConfigKey{Key: crashReportURLConfigKey, Type: "string", Description: "webhook crash reports are posted to on panics"},
+	)
+}
+
+// RegisterConfigKeys documents the configuration keys component consumes, so
+// InitConfig can warn about unknown, e.g. misspelled keys and App can print
+// a reference with the config schema subcommand. Packages register their
+// keys in init, services should register theirs before InitConfig.
+func RegisterConfigKeys(component string, keys ...ConfigKey) {
+	configKeysLock.Lock()
+	defer configKeysLock.Unlock()
+	for _, key := range keys {
+		key.Key = strings.ToLower(key.Key)
+		key.Component = component
+		configKeys[key.Key] = key
+	}
+}
+
+// ConfigKeys returns all registered configuration keys sorted by key
+func ConfigKeys() []ConfigKey {
+	configKeysLock.RLock()
+	defer configKeysLock.RUnlock()
+	keys := make([]ConfigKey, 0, len(configKeys))
+	for _, key := range configKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].Key < keys[j].Key })
+	return keys
+}
+
+// UnknownConfigKeys returns the configured keys which are neither registered
+// nor one of known, e.g. the required keys of a service
+func UnknownConfigKeys(known ...string) []string {
+	registered := ConfigKeys()
+	var unknown []string
+	for _, key := range viper.AllKeys() {
+		if !matchesConfigKey(key, registered, known) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+func matchesConfigKey(key string, registered []ConfigKey, known []string) bool {
+	for _, knownKey := range known {
+		if strings.EqualFold(key, knownKey) {
+			return true
+		}
+	}
+	segments := strings.Split(key, ".")
+	for _, registeredKey := range registered {
+		pattern := strings.Split(registeredKey.Key, ".")
+		// structured values like lists of maps are registered by their top level key
+		if len(pattern) > len(segments) {
+			continue
+		}
+		matches := true
+		for index := range pattern {
+			if pattern[index] != "*" && pattern[index] != segments[index] {
+				matches = false
+				break
+			}
+		}
+		if matches && (len(pattern) == len(segments) || registeredKey.Type == "map" || registeredKey.Type == "list") {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteConfigReference writes the registered configuration keys as markdown
+// table or, if format is yaml, as commented YAML file with the defaults
+func WriteConfigReference(writer io.Writer, format string) error {
+	keys := ConfigKeys()
+	switch format {
+	case "", "markdown":
+		fmt.Fprintln(writer, "| Key | Type | Default | Component | Description |")
+		fmt.Fprintln(writer, "|-----|------|---------|-----------|-------------|")
+		for _, key := range keys {
+			fmt.Fprintf(writer, "| `%s` | %s | %s | %s | %s |\n", key.Key, key.Type, key.Default, key.Component, strings.ReplaceAll(key.Description, "|", "\\|"))
+		}
+	case "yaml":
+		var previous []string
+		for _, key := range keys {
+			segments := strings.Split(key.Key, ".")
+			common := 0
+			for common < len(previous)-1 && common < len(segments)-1 && previous[common] == segments[common] {
+				common++
+			}
+			for depth := common; depth < len(segments)-1; depth++ {
+				fmt.Fprintf(writer, "%s# %s:\n", strings.Repeat("  ", depth), segments[depth])
+			}
+			indent := strings.Repeat("  ", len(segments)-1)
+			fmt.Fprintf(writer, "%s# %s (%s, %s)\n", indent, key.Description, key.Type, key.Component)
+			fmt.Fprintf(writer, "%s# %s: %s\n", indent, segments[len(segments)-1], key.Default)
+			previous = segments
+		}
+	default:
+		return fmt.Errorf("unknown config reference format [%s], expected markdown or yaml", format)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package apputil
+
+import (
+	"context"
+
+	"github.com/apex/log"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// field names used for correlation of log entries
+const (
+	RequestIDField     = "request_id"
+	TraceIDField       = "trace_id"
+	SpanIDField        = "span_id"
+	CallerServiceField = "caller_service"
+)
+
+type loggerKey struct{}
+
+type correlationKey struct{}
+
+// Correlation identifies the request a context belongs to
+type Correlation struct {
+	RequestID     string
+	TraceID       string
+	CallerService string // name of the calling service, if known
+}
+
+// ContextWithLogger returns a copy of ctx carrying the given logger
+func ContextWithLogger(ctx context.Context, logger *log.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the logger stored in ctx by ContextWithLogger, e.g. one
+// carrying request_id and trace_id fields set by the serviceutil interceptors.
+// If ctx carries no logger, a logger without fields is returned.
+// If ctx carries an OpenTelemetry span, its trace_id and span_id are added.
+func FromContext(ctx context.Context) *log.Entry {
+	logger, ok := ctx.Value(loggerKey{}).(*log.Entry)
+	if !ok {
+		logger = log.WithFields(log.Fields{})
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		logger = logger.WithFields(log.Fields{
+			TraceIDField: spanContext.TraceID().String(),
+			SpanIDField:  spanContext.SpanID().String(),
+		})
+	}
+	return logger
+}
+
+// ContextWithCorrelation returns a copy of ctx carrying the given correlation,
+// e.g. set by the serviceutil interceptors
+func ContextWithCorrelation(ctx context.Context, correlation Correlation) context.Context {
+	return context.WithValue(ctx, correlationKey{}, correlation)
+}
+
+// CorrelationFromContext returns the correlation stored in ctx by ContextWithCorrelation.
+// If ctx carries an OpenTelemetry span, its trace ID takes precedence.
+func CorrelationFromContext(ctx context.Context) Correlation {
+	correlation, _ := ctx.Value(correlationKey{}).(Correlation)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		correlation.TraceID = spanContext.TraceID().String()
+	}
+	return correlation
+}
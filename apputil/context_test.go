@@ -0,0 +1,43 @@
+package apputil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/apex/log/handlers/memory"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFromContextAddsSpanIDs(t *testing.T) {
+	output := memory.New()
+	defer SetOutputHandler(SetOutputHandler(output))
+
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x01, 0x02},
+		SpanID:  trace.SpanID{0x03},
+	})
+	ctx := ContextWithLogger(context.Background(), Named("test").WithField(RequestIDField, "42"))
+	ctx = trace.ContextWithSpanContext(ctx, spanContext)
+
+	FromContext(ctx).Info("correlated")
+
+	fields := output.Entries[0].Fields
+	if fields.Get(RequestIDField) != "42" {
+		t.Errorf("expected request_id 42, got %v", fields.Get(RequestIDField))
+	}
+	if fields.Get(TraceIDField) != spanContext.TraceID().String() || fields.Get(SpanIDField) != spanContext.SpanID().String() {
+		t.Errorf("expected trace and span ID of span context, got %v", fields)
+	}
+}
+
+func TestCorrelationFromContext(t *testing.T) {
+	ctx := ContextWithCorrelation(context.Background(), Correlation{RequestID: "42", TraceID: "from-header"})
+	spanContext := trace.NewSpanContext(trace.SpanContextConfig{TraceID: trace.TraceID{0x01}, SpanID: trace.SpanID{0x02}})
+
+	if correlation := CorrelationFromContext(ctx); correlation.RequestID != "42" || correlation.TraceID != "from-header" {
+		t.Errorf("unexpected correlation %+v", correlation)
+	}
+	if correlation := CorrelationFromContext(trace.ContextWithSpanContext(ctx, spanContext)); correlation.TraceID != spanContext.TraceID().String() {
+		t.Errorf("expected trace ID of span, got %+v", correlation)
+	}
+}
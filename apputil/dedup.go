@@ -0,0 +1,100 @@
+package apputil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	"github.com/apex/log"
+)
+
+// DedupInterval is the maximum time repetitions of an entry are collapsed before
+// the entry is written again with their count
+const DedupInterval = time.Minute
+
+// RepeatedField is the field holding the number of collapsed repetitions
+const RepeatedField = "repeated"
+
+// DedupHandler collapses consecutive entries with the same level and message.
+// The first entry is passed on immediately, repetitions are counted and the last
+// repetition is passed on with the count in field "repeated" once a different
+// entry arrives, DedupInterval passed or Flush is called. The source of a
+// repetition is determined when it arrives, see verbosetextlog.Source.
+type DedupHandler struct {
+	handler  log.Handler
+	interval time.Duration
+
+	mutex    sync.Mutex
+	last     *log.Entry
+	repeated int
+	since    time.Time
+	timer    *time.Timer // flushes the repetitions once the interval passed
+}
+
+// NewDedupHandler creates a DedupHandler passing entries on to handler
+func NewDedupHandler(handler log.Handler) *DedupHandler {
+	return &DedupHandler{handler: handler, interval: DedupInterval}
+}
+
+// HandleLog implements log.Handler
+func (h *DedupHandler) HandleLog(e *log.Entry) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.last != nil && h.last.Level == e.Level && h.last.Message == e.Message {
+		// keep the source of the repetition, it may be passed on with another entry
+		repeated := *e
+		repeated.Fields = make(log.Fields, len(e.Fields)+1)
+		for name, value := range e.Fields {
+			repeated.Fields[name] = value
+		}
+		if _, ok := repeated.Fields[verbosetextlog.SourceField]; !ok {
+			repeated.Fields[verbosetextlog.SourceField] = verbosetextlog.Source()
+		}
+		h.last = &repeated
+		h.repeated++
+		wait := h.interval - time.Since(h.since)
+		if wait <= 0 {
+			return h.flushLocked()
+		}
+		if h.timer == nil {
+			h.timer = time.AfterFunc(wait, func() { h.Flush() })
+		}
+		return nil
+	}
+
+	err := h.flushLocked()
+	h.last = e
+	h.since = time.Now()
+	if handleErr := h.handler.HandleLog(e); handleErr != nil {
+		err = handleErr
+	}
+	return err
+}
+
+// Flush passes on the pending repetition count, if any
+func (h *DedupHandler) Flush() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.flushLocked()
+}
+
+func (h *DedupHandler) flushLocked() error {
+	if h.timer != nil {
+		h.timer.Stop()
+		h.timer = nil
+	}
+	if h.repeated == 0 {
+		return nil
+	}
+	repeated := *h.last
+	repeated.Fields = make(log.Fields, len(h.last.Fields)+1)
+	for name, value := range h.last.Fields {
+		repeated.Fields[name] = value
+	}
+	repeated.Fields[RepeatedField] = h.repeated
+	h.repeated = 0
+	h.since = time.Now()
+	return h.handler.HandleLog(&repeated)
+}
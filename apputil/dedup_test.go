@@ -0,0 +1,86 @@
+package apputil
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+)
+
+func TestDedupHandler(t *testing.T) {
+	output := memory.New()
+	handler := NewDedupHandler(output)
+
+	for _, message := range []string{"retrying", "retrying", "retrying", "connected", "connected"} {
+		handler.HandleLog(&log.Entry{Level: log.WarnLevel, Message: message, Fields: log.Fields{}})
+	}
+	handler.Flush()
+
+	expected := []struct {
+		message  string
+		repeated interface{}
+	}{{"retrying", nil}, {"retrying", 2}, {"connected", nil}, {"connected", 1}}
+	if len(output.Entries) != len(expected) {
+		t.Fatalf("expected %d entries, got %d", len(expected), len(output.Entries))
+	}
+	for index, entry := range output.Entries {
+		if entry.Message != expected[index].message || entry.Fields.Get(RepeatedField) != expected[index].repeated {
+			t.Errorf("expected %v at %d, got [%s] repeated=%v", expected[index], index, entry.Message, entry.Fields.Get(RepeatedField))
+		}
+	}
+}
+
+func TestDedupHandlerKeepsSourceOfRepetition(t *testing.T) {
+	output := memory.New()
+	logger := &log.Logger{Handler: NewDedupHandler(output), Level: log.DebugLevel}
+
+	var source string
+	for i := 0; i < 2; i++ {
+		_, file, line, _ := runtime.Caller(0)
+		source = fmt.Sprintf("%s:%d", filepath.Base(file), line+2)
+		logger.WithField("attempt", i).Warn("retrying")
+	}
+	logger.Info("connected")
+
+	if len(output.Entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(output.Entries))
+	}
+	summary := output.Entries[1]
+	if summary.Message != "retrying" || summary.Fields.Get(RepeatedField) != 1 || summary.Fields.Get("attempt") != 1 {
+		t.Errorf("expected summary of the repetition, got [%s] %v", summary.Message, summary.Fields)
+	}
+	if summary.Fields.Get("_source") != source {
+		t.Errorf("expected source %s of the repetition, got %v", source, summary.Fields.Get("_source"))
+	}
+}
+
+func TestDedupHandlerFlushesAfterInterval(t *testing.T) {
+	output := memory.New()
+	handler := NewDedupHandler(output)
+	handler.interval = 20 * time.Millisecond
+
+	for i := 0; i < 3; i++ {
+		handler.HandleLog(&log.Entry{Level: log.WarnLevel, Message: "retrying", Fields: log.Fields{}})
+	}
+	// silence after the burst
+	deadline := time.Now().Add(time.Second)
+	for {
+		handler.mutex.Lock()
+		entries := len(output.Entries)
+		handler.mutex.Unlock()
+		if entries == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected repetitions to be passed on after the interval, got %d entries", entries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if repeated := output.Entries[1].Fields.Get(RepeatedField); repeated != 2 {
+		t.Errorf("expected 2 repetitions, got %v", repeated)
+	}
+}
@@ -0,0 +1,73 @@
+package apputil
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/apex/log"
+)
+
+var (
+	// ExitFunc terminates the process after the exit hooks ran. It can be
+	// replaced in tests, but must not return when called for a fatal log
+	// entry, as apex/log calls os.Exit afterwards, e.g. panic instead.
+	ExitFunc = os.Exit
+	// ExitHookTimeout limits the time all exit hooks may take together
+	ExitHookTimeout = 10 * time.Second
+
+	exitHooksLock sync.Mutex
+	exitHooks     []exitHook
+	exiting       atomic.Bool
+)
+
+type exitHook struct {
+	name string
+	hook func(ctx context.Context)
+}
+
+// RegisterExitHook registers a function to be called before the process exits
+// via Exit or a fatal log entry, e.g. to close DB or AMQP connections.
+// Hooks are called in reverse order of registration and should stop when ctx is done.
+func RegisterExitHook(name string, hook func(ctx context.Context)) {
+	exitHooksLock.Lock()
+	defer exitHooksLock.Unlock()
+	exitHooks = append(exitHooks, exitHook{name: name, hook: hook})
+}
+
+// Exit runs all exit hooks within ExitHookTimeout, flushes the logs and exits with the given code.
+// If Exit is called again while the hooks are running, it exits immediately.
+func Exit(code int) {
+	if !exiting.CompareAndSwap(false, true) {
+		ExitFunc(code)
+		return
+	}
+	defer exiting.Store(false)
+
+	exitHooksLock.Lock()
+	hooks := make([]exitHook, len(exitHooks))
+	copy(hooks, exitHooks)
+	exitHooksLock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ExitHookTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for index := len(hooks) - 1; index >= 0; index-- {
+			log.Debugf("Running exit hook [%s]", hooks[index].name)
+			hooks[index].hook(ctx)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warnf("Exit hooks did not finish within %v", ExitHookTimeout)
+	}
+	FlushLogs()
+	ExitFunc(code)
+}
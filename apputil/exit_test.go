@@ -0,0 +1,28 @@
+package apputil
+
+import (
+	"context"
+	"testing"
+)
+
+type exitCode int
+
+func TestFatalRunsExitHooks(t *testing.T) {
+	InitLogging()
+	ExitFunc = func(code int) { panic(exitCode(code)) }
+
+	var calls []string
+	RegisterExitHook("first", func(ctx context.Context) { calls = append(calls, "first") })
+	RegisterExitHook("second", func(ctx context.Context) { calls = append(calls, "second") })
+
+	defer func() {
+		if code, ok := recover().(exitCode); !ok || code != 1 {
+			t.Fatalf("expected exit code 1, got %v", code)
+		}
+		if len(calls) != 2 || calls[0] != "second" || calls[1] != "first" {
+			t.Errorf("expected hooks to run in reverse order, got %v", calls)
+		}
+	}()
+
+	Named("test").Fatal("fatal error")
+}
@@ -0,0 +1,95 @@
+// Package journaldlog provides an apex/log handler writing to systemd-journald
+// using its native protocol, so fields are stored as journal fields
+package journaldlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	apexlog "github.com/apex/log"
+)
+
+// SocketPath is the native protocol socket of journald
+const SocketPath = "/run/systemd/journal/socket"
+
+// priorities maps levels to syslog priorities used by journald
+var priorities = map[apexlog.Level]int{
+	apexlog.DebugLevel: 7,
+	apexlog.InfoLevel:  6,
+	apexlog.WarnLevel:  4,
+	apexlog.ErrorLevel: 3,
+	apexlog.FatalLevel: 2,
+}
+
+type Handler struct {
+	conn       io.WriteCloser
+	identifier string
+}
+
+// New connects to journald. Entries are stored with the given SYSLOG_IDENTIFIER.
+func New(identifier string) (*Handler, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: SocketPath, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to journald [%w]", err)
+	}
+	return &Handler{conn: conn, identifier: identifier}, nil
+}
+
+// HandleLog sends the entry with MESSAGE, PRIORITY and SYSLOG_IDENTIFIER set.
+// Entry fields are sent as upper case journal fields, e.g. request_id as REQUEST_ID.
+func (h *Handler) HandleLog(e *apexlog.Entry) error {
+	var buffer bytes.Buffer
+	writeField(&buffer, "MESSAGE", e.Message)
+	writeField(&buffer, "PRIORITY", strconv.Itoa(priorities[e.Level]))
+	if h.identifier != "" {
+		writeField(&buffer, "SYSLOG_IDENTIFIER", h.identifier)
+	}
+	for _, name := range e.Fields.Names() {
+		if fieldName := journalFieldName(name); fieldName != "" {
+			writeField(&buffer, fieldName, fmt.Sprint(e.Fields.Get(name)))
+		}
+	}
+	_, err := h.conn.Write(buffer.Bytes())
+	return err
+}
+
+// Close closes the connection to journald
+func (h *Handler) Close() error {
+	return h.conn.Close()
+}
+
+// writeField writes name=value, or the length prefixed binary format for values containing newlines
+func writeField(buffer *bytes.Buffer, name string, value string) {
+	buffer.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		buffer.WriteByte('=')
+		buffer.WriteString(value)
+		buffer.WriteByte('\n')
+		return
+	}
+	buffer.WriteByte('\n')
+	binary.Write(buffer, binary.LittleEndian, uint64(len(value)))
+	buffer.WriteString(value)
+	buffer.WriteByte('\n')
+}
+
+// journalFieldName converts name to a valid journal field name, i.e. upper case
+// letters, digits and underscores, not starting with an underscore or digit
+func journalFieldName(name string) string {
+	fieldName := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+	return strings.TrimLeft(fieldName, "_0123456789")
+}
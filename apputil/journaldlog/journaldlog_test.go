@@ -0,0 +1,77 @@
+package journaldlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	apexlog "github.com/apex/log"
+)
+
+// fakeConn records the datagrams sent to journald
+type fakeConn struct {
+	datagrams [][]byte
+}
+
+func (conn *fakeConn) Write(p []byte) (int, error) {
+	conn.datagrams = append(conn.datagrams, append([]byte{}, p...))
+	return len(p), nil
+}
+
+func (conn *fakeConn) Close() error { return nil }
+
+func TestHandleLogPriorities(t *testing.T) {
+	for level, priority := range map[apexlog.Level]string{
+		apexlog.DebugLevel: "7",
+		apexlog.InfoLevel:  "6",
+		apexlog.WarnLevel:  "4",
+		apexlog.ErrorLevel: "3",
+		apexlog.FatalLevel: "2",
+	} {
+		conn := &fakeConn{}
+		handler := &Handler{conn: conn, identifier: "service"}
+		if err := handler.HandleLog(&apexlog.Entry{Level: level, Message: "message"}); err != nil {
+			t.Fatal(err)
+		}
+		expected := "MESSAGE=message\nPRIORITY=" + priority + "\nSYSLOG_IDENTIFIER=service\n"
+		if len(conn.datagrams) != 1 || string(conn.datagrams[0]) != expected {
+			t.Errorf("expected %q for level %v, got %q", expected, level, conn.datagrams)
+		}
+	}
+}
+
+func TestHandleLogFields(t *testing.T) {
+	conn := &fakeConn{}
+	handler := &Handler{conn: conn}
+	handler.HandleLog(&apexlog.Entry{Level: apexlog.InfoLevel, Message: "message", Fields: apexlog.Fields{
+		"request_id": "42",
+		"_source":    "main.go:1",
+		"1st-try":    true,
+		"__":         "dropped",
+		"stack":      "line 1\nline 2",
+	}})
+	if len(conn.datagrams) != 1 {
+		t.Fatalf("expected one datagram, got %d", len(conn.datagrams))
+	}
+	datagram := string(conn.datagrams[0])
+	for _, field := range []string{"\nREQUEST_ID=42\n", "\nSOURCE=main.go:1\n", "\nST_TRY=true\n"} {
+		if !strings.Contains(datagram, field) {
+			t.Errorf("expected %q in %q", field, datagram)
+		}
+	}
+	if strings.Contains(datagram, "dropped") {
+		t.Errorf("expected field without valid name to be dropped, got %q", datagram)
+	}
+
+	var multiline bytes.Buffer
+	multiline.WriteString("\nSTACK\n")
+	binary.Write(&multiline, binary.LittleEndian, uint64(len("line 1\nline 2")))
+	multiline.WriteString("line 1\nline 2\n")
+	if !strings.Contains(datagram, multiline.String()) {
+		t.Errorf("expected length prefixed multiline value in %q", datagram)
+	}
+	if strings.Contains(datagram, "SYSLOG_IDENTIFIER") {
+		t.Errorf("expected no identifier if empty, got %q", datagram)
+	}
+}
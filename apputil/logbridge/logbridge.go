@@ -0,0 +1,99 @@
+// Package logbridge redirects the output of the standard library log package
+// and of grpclog, which is used by grpc-go and grpc-gateway, to apputil loggers
+package logbridge
+
+import (
+	"fmt"
+	stdlog "log"
+	"os"
+	"strings"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	apexlog "github.com/apex/log"
+	"google.golang.org/grpc/grpclog"
+)
+
+func init() {
+	// report the code calling the standard or grpc logger as source
+	verbosetextlog.SkipPackages(
+		"log",
+		"google.golang.org/grpc/grpclog",
+		"google.golang.org/grpc/internal/grpclog",
+		"github.com/science-computing/service-common-golang/apputil/logbridge",
+	)
+}
+
+// Redirect redirects the standard library log package and grpclog. Call it
+// early in main, as grpclog must be set up before using any grpc functions.
+func Redirect() {
+	RedirectStdLog()
+	RedirectGrpcLog()
+}
+
+// RedirectStdLog writes lines of the standard library log package as info
+// entries of the logger "stdlog"
+func RedirectStdLog() {
+	stdlog.SetFlags(0)
+	stdlog.SetPrefix("")
+	stdlog.SetOutput(&stdLogWriter{logger: apputil.Named("stdlog")})
+}
+
+type stdLogWriter struct {
+	logger *apexlog.Entry
+}
+
+func (writer *stdLogWriter) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\n")
+	// apex/log reports handler errors via the standard logger, so logging them
+	// again could recurse endlessly
+	if strings.HasPrefix(message, "error logging: ") {
+		fmt.Fprintln(os.Stderr, message)
+		return len(p), nil
+	}
+	writer.logger.Info(message)
+	return len(p), nil
+}
+
+// RedirectGrpcLog writes grpclog output as entries of the logger "grpc".
+// As grpc logs connection state changes on info level, grpc info messages are
+// logged on debug level, warnings and errors on their respective level.
+func RedirectGrpcLog() {
+	grpclog.SetLoggerV2(&grpcLogger{logger: apputil.Named("grpc")})
+}
+
+// grpcLogger implements grpclog.LoggerV2
+type grpcLogger struct {
+	logger *apexlog.Entry
+}
+
+func (l *grpcLogger) Info(args ...interface{})   { l.logger.Debug(fmt.Sprint(args...)) }
+func (l *grpcLogger) Infoln(args ...interface{}) { l.logger.Debug(sprintln(args...)) }
+func (l *grpcLogger) Infof(format string, args ...interface{}) {
+	l.logger.Debugf(format, args...)
+}
+func (l *grpcLogger) Warning(args ...interface{})   { l.logger.Warn(fmt.Sprint(args...)) }
+func (l *grpcLogger) Warningln(args ...interface{}) { l.logger.Warn(sprintln(args...)) }
+func (l *grpcLogger) Warningf(format string, args ...interface{}) {
+	l.logger.Warnf(format, args...)
+}
+func (l *grpcLogger) Error(args ...interface{})   { l.logger.Error(fmt.Sprint(args...)) }
+func (l *grpcLogger) Errorln(args ...interface{}) { l.logger.Error(sprintln(args...)) }
+func (l *grpcLogger) Errorf(format string, args ...interface{}) {
+	l.logger.Errorf(format, args...)
+}
+func (l *grpcLogger) Fatal(args ...interface{})   { l.logger.Fatal(fmt.Sprint(args...)) }
+func (l *grpcLogger) Fatalln(args ...interface{}) { l.logger.Fatal(sprintln(args...)) }
+func (l *grpcLogger) Fatalf(format string, args ...interface{}) {
+	l.logger.Fatalf(format, args...)
+}
+
+// V reports whether verbose grpc logging is enabled, i.e. the debug level is active
+func (l *grpcLogger) V(level int) bool {
+	return level <= 0 || apputil.GetLevel() == apexlog.DebugLevel
+}
+
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
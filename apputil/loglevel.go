@@ -0,0 +1,270 @@
+package apputil
+
+import (
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	"github.com/apex/log"
+)
+
+var (
+	currentLevel     atomic.Int32
+	levelBeforeDebug atomic.Int32
+	componentLevels  atomic.Pointer[map[string]log.Level]
+	outputHandler    atomic.Pointer[handlerHolder]
+	globalFields     atomic.Pointer[log.Fields]
+	levelSignalOnce  sync.Once
+	installOnce      sync.Once
+
+	// guards the settings used to build the output handler
+	outputLock       sync.Mutex
+	rawOutputHandler log.Handler
+	maskKeys         []string
+	maskPatterns     []*regexp.Regexp
+	dedupEnabled     bool
+	dedupHandler     *DedupHandler
+	asyncBufferSize  int
+	asyncPolicy      OverflowPolicy
+	asyncHandler     *AsyncHandler
+)
+
+func init() {
+	currentLevel.Store(int32(log.InfoLevel))
+	levelBeforeDebug.Store(int32(log.InfoLevel))
+}
+
+// handlerHolder allows to store handlers of different types in an atomic.Pointer
+type handlerHolder struct {
+	handler log.Handler
+}
+
+// levelHandler drops all entries below the level of its component (or the
+// current level if the component has none) and passes the remaining ones to
+// the output handler. apex/log itself is set to DebugLevel, so the level can
+// be changed at runtime without touching the global logger.
+type levelHandler struct {
+	component string
+}
+
+func (handler *levelHandler) HandleLog(e *log.Entry) error {
+	if e.Level < componentLevel(handler.component) {
+		return nil
+	}
+	holder := outputHandler.Load()
+	if holder == nil {
+		return nil
+	}
+	if fields := globalFields.Load(); fields != nil {
+		e = withFields(e, *fields)
+	}
+	err := holder.handler.HandleLog(e)
+	// run exit hooks before apex/log exits the process
+	if e.Level == log.FatalLevel {
+		Exit(1)
+	}
+	return err
+}
+
+// SetGlobalFields sets fields added to all log entries, e.g. the pod name.
+// Fields of an entry take precedence over global fields of the same name.
+func SetGlobalFields(fields log.Fields) {
+	copied := make(log.Fields, len(fields))
+	for name, value := range fields {
+		copied[name] = value
+	}
+	globalFields.Store(&copied)
+}
+
+// withFields returns a copy of e with the given fields added unless already set
+func withFields(e *log.Entry, fields log.Fields) *log.Entry {
+	merged := *e
+	merged.Fields = make(log.Fields, len(e.Fields)+len(fields))
+	for name, value := range fields {
+		merged.Fields[name] = value
+	}
+	for name, value := range e.Fields {
+		merged.Fields[name] = value
+	}
+	return &merged
+}
+
+// SetOutputHandler atomically replaces the handler log entries are written to
+// (after level filtering and masking) and returns the previous one. It is set
+// by InitLogging and InitConfig according to the configured log output.
+func SetOutputHandler(handler log.Handler) log.Handler {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	previous := rawOutputHandler
+	rawOutputHandler = handler
+	updateOutputHandlerLocked()
+	// install the level handler only once, as apex/log does not synchronize access
+	installOnce.Do(func() {
+		log.SetHandler(&levelHandler{})
+		log.SetLevel(log.DebugLevel)
+	})
+	return previous
+}
+
+// AddMasking adds field names and patterns to mask in all log entries, see NewMaskingHandler.
+// DefaultMaskKeys and DefaultMaskPatterns are always masked.
+func AddMasking(keys []string, patterns []*regexp.Regexp) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	maskKeys = append(maskKeys, keys...)
+	maskPatterns = append(maskPatterns, patterns...)
+	updateOutputHandlerLocked()
+}
+
+func updateOutputHandlerLocked() {
+	if rawOutputHandler == nil {
+		outputHandler.Store(nil)
+		return
+	}
+	// write pending entries before replacing the handler
+	if dedupHandler != nil {
+		dedupHandler.Flush()
+		dedupHandler = nil
+	}
+	if asyncHandler != nil {
+		asyncHandler.Close()
+		asyncHandler = nil
+	}
+	var handler log.Handler = rawOutputHandler
+	if asyncBufferSize > 0 {
+		asyncHandler = NewAsyncHandler(handler, asyncBufferSize, asyncPolicy)
+		handler = asyncHandler
+	}
+	if dedupEnabled {
+		dedupHandler = NewDedupHandler(handler)
+		handler = dedupHandler
+	}
+	handler = NewMaskingHandler(handler, slices.Concat(DefaultMaskKeys, maskKeys), slices.Concat(DefaultMaskPatterns, maskPatterns))
+	outputHandler.Store(&handlerHolder{handler: handler})
+}
+
+// SetAsyncLogging enables writing log entries in the background with a buffer
+// for bufferSize entries (see AsyncHandler), or disables it if bufferSize is 0.
+// Call FlushLogs to wait for buffered entries to be written.
+func SetAsyncLogging(bufferSize int, policy OverflowPolicy) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	asyncBufferSize = bufferSize
+	asyncPolicy = policy
+	updateOutputHandlerLocked()
+}
+
+// FlushLogs writes all pending log entries, i.e. buffered entries of
+// asynchronous logging and collapsed repetitions. It is called by Exit.
+func FlushLogs() {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	if dedupHandler != nil {
+		dedupHandler.Flush()
+	}
+	if asyncHandler != nil {
+		asyncHandler.Flush()
+	}
+}
+
+// SetDeduplication enables or disables collapsing of consecutive identical
+// log entries, see DedupHandler
+func SetDeduplication(enabled bool) {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	dedupEnabled = enabled
+	updateOutputHandlerLocked()
+}
+
+// SetLevel changes the log level at runtime. It is safe to call SetLevel while
+// other goroutines are logging.
+func SetLevel(level log.Level) {
+	currentLevel.Store(int32(level))
+	// restored when toggling debug off, see WatchLevelSignal
+	if level != log.DebugLevel {
+		levelBeforeDebug.Store(int32(level))
+	}
+}
+
+// GetLevel returns the current log level
+func GetLevel() log.Level {
+	return log.Level(currentLevel.Load())
+}
+
+// Named returns a logger for the given component, e.g. Named("amqputil").
+// Its level can be set with SetComponentLevel or the config key log.levels,
+// e.g. log.levels: {amqputil: debug, dbutil: warn}. Components without an
+// explicit level use the current level.
+func Named(component string) *log.Entry {
+	if outputHandler.Load() == nil {
+		InitLogging()
+	}
+	return log.NewEntry(&log.Logger{Handler: &levelHandler{component: component}, Level: log.DebugLevel})
+}
+
+// SetComponentLevel changes the log level of the named component at runtime
+func SetComponentLevel(component string, level log.Level) {
+	for {
+		old := componentLevels.Load()
+		levels := make(map[string]log.Level)
+		if old != nil {
+			for name, l := range *old {
+				levels[name] = l
+			}
+		}
+		levels[component] = level
+		if componentLevels.CompareAndSwap(old, &levels) {
+			return
+		}
+	}
+}
+
+// componentLevel returns the level of the given component or the current level
+func componentLevel(component string) log.Level {
+	if component != "" {
+		if levels := componentLevels.Load(); levels != nil {
+			if level, ok := (*levels)[component]; ok {
+				return level
+			}
+		}
+	}
+	return GetLevel()
+}
+
+// WatchLevelSignal toggles the log level between debug and the previous level,
+// info if debug was configured, whenever the process receives SIGHUP, e.g. kill -HUP <pid>. Subsequent calls are no-ops.
+func WatchLevelSignal() {
+	levelSignalOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGHUP)
+		go func() {
+			for range signals {
+				toggleDebugLevel()
+			}
+		}()
+	})
+}
+
+func toggleDebugLevel() {
+	if GetLevel() == log.DebugLevel {
+		SetLevel(log.Level(levelBeforeDebug.Load()))
+	} else {
+		SetLevel(log.DebugLevel)
+	}
+	// write the change regardless of the level, which may filter warnings
+	if holder := outputHandler.Load(); holder != nil {
+		holder.handler.HandleLog(&log.Entry{
+			Level:     log.WarnLevel,
+			Message:   "Log level set to [" + GetLevel().String() + "] by SIGHUP",
+			Fields:    log.Fields{verbosetextlog.SourceField: "loglevel.go"},
+			Timestamp: time.Now(),
+		})
+	}
+}
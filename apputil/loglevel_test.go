@@ -0,0 +1,74 @@
+package apputil
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/memory"
+)
+
+// run with -race
+func TestConcurrentInitAndLogging(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				InitLoggingWithLevel(log.ErrorLevel)
+				SetComponentLevel("race", log.WarnLevel)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				Named("race").Info("not logged")
+				logger.Debug("not logged")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGlobalFields(t *testing.T) {
+	handler := memory.New()
+	previous := SetOutputHandler(handler)
+	defer SetOutputHandler(previous)
+	SetGlobalFields(log.Fields{"k8s.pod.name": "orders-1", "component": "global"})
+	defer globalFields.Store(nil)
+
+	Named("fields").WithField("component", "entry").Error("with global fields")
+	entry := handler.Entries[len(handler.Entries)-1]
+	if entry.Fields["k8s.pod.name"] != "orders-1" || entry.Fields["component"] != "entry" {
+		t.Errorf("unexpected fields %v", entry.Fields)
+	}
+}
+
+func TestToggleDebugLevel(t *testing.T) {
+	handler := memory.New()
+	previous := SetOutputHandler(handler)
+	defer SetOutputHandler(previous)
+	defer SetLevel(GetLevel())
+
+	SetLevel(log.ErrorLevel)
+	toggleDebugLevel()
+	if GetLevel() != log.DebugLevel {
+		t.Fatalf("expected debug level, got %v", GetLevel())
+	}
+	toggleDebugLevel()
+	if GetLevel() != log.ErrorLevel {
+		t.Fatalf("expected configured error level to be restored, got %v", GetLevel())
+	}
+	if len(handler.Entries) != 2 || handler.Entries[1].Message != "Log level set to [error] by SIGHUP" {
+		t.Errorf("expected both changes to be logged at error level, got %v", handler.Entries)
+	}
+
+	// debug configured at startup toggles to info
+	levelBeforeDebug.Store(int32(log.InfoLevel))
+	SetLevel(log.DebugLevel)
+	toggleDebugLevel()
+	if GetLevel() != log.InfoLevel {
+		t.Errorf("expected info level after configured debug level, got %v", GetLevel())
+	}
+}
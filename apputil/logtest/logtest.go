@@ -0,0 +1,83 @@
+// Package logtest provides a log handler recording entries, so tests can
+// assert on logging behavior
+package logtest
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	apexlog "github.com/apex/log"
+)
+
+// Recorder is a log handler keeping all entries in memory
+type Recorder struct {
+	mutex   sync.Mutex
+	entries []*apexlog.Entry
+}
+
+// New creates an empty Recorder
+func New() *Recorder {
+	return &Recorder{}
+}
+
+// Capture replaces the apputil log output with a new Recorder until the test
+// finishes. Entries are recorded after level filtering and masking.
+func Capture(t testing.TB) *Recorder {
+	recorder := New()
+	previous := apputil.SetOutputHandler(recorder)
+	t.Cleanup(func() {
+		apputil.SetOutputHandler(previous)
+	})
+	return recorder
+}
+
+// HandleLog implements log.Handler
+func (r *Recorder) HandleLog(e *apexlog.Entry) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = append(r.entries, e)
+	return nil
+}
+
+// Entries returns all recorded entries
+func (r *Recorder) Entries() []*apexlog.Entry {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	entries := make([]*apexlog.Entry, len(r.entries))
+	copy(entries, r.entries)
+	return entries
+}
+
+// HasEntryContaining checks if the message of any entry contains substring
+func (r *Recorder) HasEntryContaining(substring string) bool {
+	return r.find(func(e *apexlog.Entry) bool { return strings.Contains(e.Message, substring) })
+}
+
+// HasEntry checks if there is an entry with the given level whose message contains substring
+func (r *Recorder) HasEntry(level apexlog.Level, substring string) bool {
+	return r.find(func(e *apexlog.Entry) bool { return e.Level == level && strings.Contains(e.Message, substring) })
+}
+
+// HasEntryWithField checks if there is an entry with the given field value
+func (r *Recorder) HasEntryWithField(name string, value interface{}) bool {
+	return r.find(func(e *apexlog.Entry) bool { return e.Fields.Get(name) == value })
+}
+
+// Reset removes all recorded entries
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.entries = nil
+}
+
+func (r *Recorder) find(match func(e *apexlog.Entry) bool) bool {
+	for _, e := range r.Entries() {
+		if match(e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package apputil
+
+import (
+	"os"
+
+	"github.com/science-computing/service-common-golang/apputil/journaldlog"
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+// special log outputs, any other output is used as file name
+const (
+	stdoutLogOutput   = "stdout"
+	stderrLogOutput   = "stderr"
+	syslogLogOutput   = "syslog"
+	journaldLogOutput = "journald"
+)
+
+const syslogNetworkConfigKey = "log.syslog.network"
+const syslogAddressConfigKey = "log.syslog.address"
+
+// newOutputHandler creates the handler for the given log output, i.e. stdout,
+// stderr, syslog, journald or the name of a file to append to.
+// settingsLock must be held.
+func newOutputHandler(output string) (log.Handler, error) {
+	switch output {
+	case syslogLogOutput:
+		return newSyslogHandler(viper.GetString(syslogNetworkConfigKey), viper.GetString(syslogAddressConfigKey), appServiceName)
+	case journaldLogOutput:
+		return journaldlog.New(appServiceName)
+	}
+
+	var logfile *os.File
+	switch output {
+	case stdoutLogOutput:
+		logfile = os.Stdout
+	case stderrLogOutput:
+		logfile = os.Stderr
+	default:
+		var err error
+		if logfile, err = os.OpenFile(output, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640); err != nil {
+			return nil, err
+		}
+	}
+	handler := verbosetextlog.New(logfile)
+	if logColor != nil {
+		handler.Color = *logColor
+	}
+	return handler, nil
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+
+package apputil
+
+import (
+	"errors"
+
+	"github.com/apex/log"
+)
+
+func newSyslogHandler(network, address, tag string) (log.Handler, error) {
+	return nil, errors.New("syslog is not supported on this platform")
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !plan9
+
+package apputil
+
+import (
+	"github.com/science-computing/service-common-golang/apputil/sysloglog"
+
+	"github.com/apex/log"
+)
+
+func newSyslogHandler(network, address, tag string) (log.Handler, error) {
+	return sysloglog.New(network, address, tag)
+}
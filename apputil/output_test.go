@@ -0,0 +1,87 @@
+package apputil
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+// lockedOutputHandler creates the handler for output with settingsLock held
+func lockedOutputHandler(output string) (log.Handler, error) {
+	settingsLock.Lock()
+	defer settingsLock.Unlock()
+	return newOutputHandler(output)
+}
+
+func TestNewOutputHandler(t *testing.T) {
+	for output, writer := range map[string]*os.File{stdoutLogOutput: os.Stdout, stderrLogOutput: os.Stderr} {
+		handler, err := lockedOutputHandler(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if text, ok := handler.(*verbosetextlog.Handler); !ok || text.Writer != writer {
+			t.Errorf("expected text handler writing to %s, got %#v", output, handler)
+		}
+	}
+
+	settingsLock.Lock()
+	color := true
+	logColor = &color
+	settingsLock.Unlock()
+	defer func() {
+		settingsLock.Lock()
+		logColor = nil
+		settingsLock.Unlock()
+	}()
+	file := filepath.Join(t.TempDir(), "service.log")
+	handler, err := lockedOutputHandler(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !handler.(*verbosetextlog.Handler).Color {
+		t.Error("expected configured color to override the auto detection")
+	}
+	handler.HandleLog(&log.Entry{Level: log.WarnLevel, Message: "to file", Fields: log.Fields{"user": "alice"}})
+	handler.(*verbosetextlog.Handler).Writer.(*os.File).Close()
+	content, err := os.ReadFile(file)
+	if err != nil || !strings.Contains(string(content), "to file") || !strings.Contains(string(content), "alice") {
+		t.Errorf("expected entry with fields in log file, got %q %v", content, err)
+	}
+
+	if _, err := lockedOutputHandler(filepath.Join(t.TempDir(), "missing", "service.log")); err == nil {
+		t.Error("expected error for log file in missing directory")
+	}
+
+	viper.Set(syslogNetworkConfigKey, "invalid")
+	defer viper.Set(syslogNetworkConfigKey, nil)
+	if _, err := lockedOutputHandler(syslogLogOutput); err == nil {
+		t.Error("expected error for invalid syslog network")
+	}
+}
+
+// closingHandler records whether it was closed
+type closingHandler struct {
+	closed bool
+}
+
+func (h *closingHandler) HandleLog(e *log.Entry) error { return nil }
+func (h *closingHandler) Close() error                 { h.closed = true; return nil }
+
+func TestInitLoggingClosesPreviousHandler(t *testing.T) {
+	previous := SetOutputHandler(&closingHandler{})
+	defer SetOutputHandler(previous)
+	defer SetLevel(GetLevel())
+
+	closing := &closingHandler{}
+	SetOutputHandler(closing)
+	InitLoggingWithLevel(GetLevel())
+	if !closing.closed {
+		t.Error("expected previous output handler to be closed")
+	}
+}
@@ -0,0 +1,85 @@
+package apputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"time"
+
+	"github.com/apex/log"
+	"github.com/spf13/viper"
+)
+
+const crashReportURLConfigKey = "crashreport.url"
+
+// panicExitCode is the exit code of the go runtime for unrecovered panics
+const panicExitCode = 2
+
+// CrashReport is logged and sent to the crash report webhook on panics
+type CrashReport struct {
+	Service string    `json:"service"`
+	Version string    `json:"version"`
+	Host    string    `json:"host"`
+	Time    time.Time `json:"time"`
+	Panic   string    `json:"panic"`
+	Stack   string    `json:"stack"`
+}
+
+// HandlePanics logs a recovered panic with its stack trace, service name and
+// version as single entry, posts it as JSON to the URL configured with
+// crashreport.url (if any) and exits via Exit. It must be deferred directly,
+// i.e. defer apputil.HandlePanics() at the beginning of main and goroutines.
+func HandlePanics() {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	settingsLock.Lock()
+	serviceName := appServiceName
+	settingsLock.Unlock()
+
+	report := CrashReport{
+		Service: serviceName,
+		Version: GetVersion(),
+		Time:    time.Now(),
+		Panic:   fmt.Sprint(value),
+		Stack:   string(debug.Stack()),
+	}
+	report.Host, _ = os.Hostname()
+
+	log.WithFields(log.Fields{
+		"service": report.Service,
+		"version": report.Version,
+		"panic":   report.Panic,
+		"stack":   report.Stack,
+	}).Error("Panic")
+
+	if url := viper.GetString(crashReportURLConfigKey); url != "" {
+		if err := postCrashReport(url, report); err != nil {
+			log.Errorf("Failed to send crash report to [%s]: %v", url, err)
+		}
+	}
+
+	Exit(panicExitCode)
+}
+
+func postCrashReport(url string, report CrashReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: 5 * time.Second}
+	response, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status [%s]", response.Status)
+	}
+	return nil
+}
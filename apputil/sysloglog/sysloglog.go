@@ -0,0 +1,72 @@
+//go:build !windows && !plan9
+
+// Package sysloglog provides an apex/log handler writing to syslog
+package sysloglog
+
+import (
+	"fmt"
+	"log/syslog"
+	"strings"
+
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+
+	apexlog "github.com/apex/log"
+)
+
+// priorityWriter writes messages with a syslog priority, i.e. a syslog.Writer
+type priorityWriter interface {
+	Debug(message string) error
+	Info(message string) error
+	Warning(message string) error
+	Err(message string) error
+	Crit(message string) error
+	Close() error
+}
+
+type Handler struct {
+	writer priorityWriter
+}
+
+// New connects to the syslog daemon at address using network, e.g. "udp".
+// If network is empty, the local syslog daemon is used.
+// Entries are tagged with tag (the program name if empty).
+func New(network, address, tag string) (*Handler, error) {
+	writer, err := syslog.Dial(network, address, syslog.LOG_DAEMON|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog [%w]", err)
+	}
+	return &Handler{writer: writer}, nil
+}
+
+// HandleLog writes the message followed by the fields as name=value pairs
+// with a syslog priority matching the entry level. The internal source field
+// (see verbosetextlog.SourceField) is omitted.
+func (h *Handler) HandleLog(e *apexlog.Entry) error {
+	var builder strings.Builder
+	builder.WriteString(e.Message)
+	for _, name := range e.Fields.Names() {
+		if name == verbosetextlog.SourceField {
+			continue
+		}
+		fmt.Fprintf(&builder, " %s=%v", name, e.Fields.Get(name))
+	}
+	message := builder.String()
+
+	switch e.Level {
+	case apexlog.DebugLevel:
+		return h.writer.Debug(message)
+	case apexlog.InfoLevel:
+		return h.writer.Info(message)
+	case apexlog.WarnLevel:
+		return h.writer.Warning(message)
+	case apexlog.ErrorLevel:
+		return h.writer.Err(message)
+	default:
+		return h.writer.Crit(message)
+	}
+}
+
+// Close closes the connection to the syslog daemon
+func (h *Handler) Close() error {
+	return h.writer.Close()
+}
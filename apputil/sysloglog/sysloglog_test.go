@@ -0,0 +1,52 @@
+//go:build !windows && !plan9
+
+package sysloglog
+
+import (
+	"testing"
+
+	apexlog "github.com/apex/log"
+)
+
+// fakeWriter records the priority and message of each write
+type fakeWriter struct {
+	written []string
+}
+
+func (w *fakeWriter) write(priority, message string) error {
+	w.written = append(w.written, priority+" "+message)
+	return nil
+}
+
+func (w *fakeWriter) Debug(message string) error   { return w.write("debug", message) }
+func (w *fakeWriter) Info(message string) error    { return w.write("info", message) }
+func (w *fakeWriter) Warning(message string) error { return w.write("warning", message) }
+func (w *fakeWriter) Err(message string) error     { return w.write("err", message) }
+func (w *fakeWriter) Crit(message string) error    { return w.write("crit", message) }
+func (w *fakeWriter) Close() error                 { return nil }
+
+func TestHandleLog(t *testing.T) {
+	for level, expected := range map[apexlog.Level]string{
+		apexlog.DebugLevel: "debug message",
+		apexlog.InfoLevel:  "info message",
+		apexlog.WarnLevel:  "warning message",
+		apexlog.ErrorLevel: "err message",
+		apexlog.FatalLevel: "crit message",
+	} {
+		writer := &fakeWriter{}
+		handler := &Handler{writer: writer}
+		if err := handler.HandleLog(&apexlog.Entry{Level: level, Message: "message"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(writer.written) != 1 || writer.written[0] != expected {
+			t.Errorf("expected [%s] for level %v, got %v", expected, level, writer.written)
+		}
+	}
+
+	writer := &fakeWriter{}
+	handler := &Handler{writer: writer}
+	handler.HandleLog(&apexlog.Entry{Level: apexlog.InfoLevel, Message: "message", Fields: apexlog.Fields{"user": "alice", "count": 2, "_source": "main.go:1"}})
+	if len(writer.written) != 1 || writer.written[0] != "info message count=2 user=alice" {
+		t.Errorf("expected sorted fields after the message, got %v", writer.written)
+	}
+}
@@ -3,25 +3,115 @@ package verbosetextlog
 import (
 	"fmt"
 	"io"
+	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	apexlog "github.com/apex/log"
 	"github.com/apex/log/handlers/text"
 )
 
+const apexLogPackage = "github.com/apex/log"
+
+// SourceField holds the source of an entry determined by Source, if set
+const SourceField = "_source"
+
+// skippedPackages are never reported as source of a log entry
+var skippedPackages atomic.Pointer[[]string]
+
+func init() {
+	skippedPackages.Store(&[]string{apexLogPackage})
+}
+
+// SkipPackages registers packages (import paths) of wrappers around the
+// logger, so their frames are skipped when determining the source of an entry
+func SkipPackages(packages ...string) {
+	for {
+		old := skippedPackages.Load()
+		updated := append(append([]string{}, *old...), packages...)
+		if skippedPackages.CompareAndSwap(old, &updated) {
+			return
+		}
+	}
+}
+
 type Handler struct {
-	mutex  sync.Mutex
-	Writer io.Writer
+	mutex      sync.Mutex
+	Writer     io.Writer
+	Color      bool // emit ANSI color codes
+	CallerSkip int  // number of additional frames to skip when determining the source
 }
 
+// New creates a handler writing to w. Colors are enabled if w is a terminal
+// and the NO_COLOR environment variable is not set.
 func New(w io.Writer) *Handler {
 	return &Handler{
 		Writer: w,
+		Color:  isTerminal(w) && os.Getenv("NO_COLOR") == "",
+	}
+}
+
+// isTerminal checks if w is a character device, e.g. a TTY
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Source returns the base name of the file and the line which logged the
+// current entry, e.g. "main.go:42". Handlers passing entries on asynchronously
+// must call it while handling the entry and store it in SourceField.
+func Source() string {
+	file, line := caller(0)
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line)
+}
+
+// caller returns file and line of the code which logged the current entry, i.e.
+// the first frame after the apex/log frames which is not in a skipped package
+func caller(skip int) (string, int) {
+	var pcs [32]uintptr
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs[:])])
+	skipped := *skippedPackages.Load()
+	seenLogger := false
+	var first runtime.Frame
+	for {
+		frame, more := frames.Next()
+		if first.PC == 0 {
+			first = frame
+		}
+		// skip handlers wrapping this one until reaching apex/log
+		if !seenLogger {
+			seenLogger = functionPackage(frame.Function) == apexLogPackage
+		} else if !slices.Contains(skipped, functionPackage(frame.Function)) {
+			if skip == 0 {
+				return frame.File, frame.Line
+			}
+			skip--
+		}
+		if !more {
+			break
+		}
+	}
+	// not called via apex/log
+	return first.File, first.Line
+}
+
+// functionPackage returns the package of a fully qualified function name,
+// e.g. github.com/apex/log for github.com/apex/log.(*Entry).Infof
+func functionPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	if dot := strings.Index(function[slash+1:], "."); dot >= 0 {
+		return function[:slash+1+dot]
 	}
+	return function
 }
 
 func (h *Handler) HandleLog(e *apexlog.Entry) error {
@@ -32,31 +122,32 @@ func (h *Handler) HandleLog(e *apexlog.Entry) error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
 
-	ts := time.Now()
-
-	var file string
-	var line int
-	var ok bool
-	// try to guess the number of stack frames to skip
-	// This might break with major internal changes to the library
-	for i := 4; i < 10; i++ {
-		_, file, line, ok = runtime.Caller(i)
-		if !ok {
-			break
-		}
-		if !strings.Contains(file, "github.com/apex/log") {
-			break
-		}
+	ts := e.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
 	}
 
-	if file != "" {
-		file = filepath.Base(file)
+	source, ok := e.Fields.Get(SourceField).(string)
+	if !ok {
+		file, line := caller(h.CallerSkip)
+		source = fmt.Sprintf("%s:%d", filepath.Base(file), line)
 	}
 
-	fmt.Fprintf(h.Writer, "\033[%dm%6s\033[0m[%s] %-25s -- %s:%d", color, level, ts.Format("2006-01-02 15:04:05"), e.Message, file, line)
+	if h.Color {
+		fmt.Fprintf(h.Writer, "\033[%dm%6s\033[0m[%s] %-25s -- %s", color, level, ts.Format("2006-01-02 15:04:05"), e.Message, source)
+	} else {
+		fmt.Fprintf(h.Writer, "%6s[%s] %-25s -- %s", level, ts.Format("2006-01-02 15:04:05"), e.Message, source)
+	}
 
 	for _, name := range names {
-		fmt.Fprintf(h.Writer, " \033[%dm%s\033[0m=%v", color, name, e.Fields.Get(name))
+		if name == SourceField {
+			continue
+		}
+		if h.Color {
+			fmt.Fprintf(h.Writer, " \033[%dm%s\033[0m=%v", color, name, e.Fields.Get(name))
+		} else {
+			fmt.Fprintf(h.Writer, " %s=%v", name, e.Fields.Get(name))
+		}
 	}
 
 	fmt.Fprintln(h.Writer)
@@ -0,0 +1,62 @@
+package verbosetextlog_test
+
+import (
+	"bytes"
+	"fmt"
+	stdlog "log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/apputil/logbridge"
+	"github.com/science-computing/service-common-golang/apputil/verbosetextlog"
+)
+
+// line returns the source of the line after the caller, e.g. "verbosetextlog_test.go:42"
+func line() string {
+	_, file, line, _ := runtime.Caller(1)
+	return fmt.Sprintf("%s:%d", filepath.Base(file), line+1)
+}
+
+func TestSourceSkipsWrapperPackages(t *testing.T) {
+	var output bytes.Buffer
+	handler := verbosetextlog.New(&output)
+	previous := apputil.SetOutputHandler(handler)
+	defer apputil.SetOutputHandler(previous)
+
+	// logbridge registers itself and the standard library log package in SkipPackages
+	logbridge.RedirectStdLog()
+	defer func() {
+		stdlog.SetOutput(os.Stderr)
+		stdlog.SetFlags(stdlog.LstdFlags)
+	}()
+
+	source := line()
+	stdlog.Print("via wrapper")
+	if !strings.Contains(output.String(), "via wrapper") || !strings.Contains(output.String(), "-- "+source) {
+		t.Errorf("expected source %s of the wrapper's caller, got %q", source, output.String())
+	}
+
+	output.Reset()
+	source = line()
+	apputil.Named("test").Info("direct")
+	if !strings.Contains(output.String(), "-- "+source) {
+		t.Errorf("expected source %s, got %q", source, output.String())
+	}
+
+	output.Reset()
+	handler.CallerSkip = 1
+	source = line()
+	logFrom()
+	if !strings.Contains(output.String(), "-- "+source) {
+		t.Errorf("expected source %s with CallerSkip, got %q", source, output.String())
+	}
+}
+
+// logFrom logs via the standard logger, so the caller is the source with CallerSkip 1
+func logFrom() {
+	stdlog.Print("skipped caller")
+}
@@ -0,0 +1,90 @@
+package auditutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// AmqpSink publishes events as protojson encoded auditpb.AuditEvent to an exchange and waits for
+// the publisher confirm of each event
+type AmqpSink struct {
+	mutex       sync.Mutex
+	helper      *amqputil.AmqpConnectionHelper
+	amqpContext *amqputil.AmqpContext
+	exchange    string
+	routingKey  string
+}
+
+// NewAmqpSink creates an AmqpSink publishing to exchange with routingKey.
+// If exchange is empty, routingKey is the name of the queue, which is declared if missing.
+func NewAmqpSink(helper *amqputil.AmqpConnectionHelper, exchange, routingKey string) *AmqpSink {
+	return &AmqpSink{helper: helper, exchange: exchange, routingKey: routingKey}
+}
+
+// Write publishes the event. The channel is reset and publishing retried once
+// if it fails, e.g. because the connection was lost.
+func (sink *AmqpSink) Write(ctx context.Context, event *Event) error {
+	body, err := marshalProtoJSON(event)
+	if err != nil {
+		return err
+	}
+	publishing := amqp.Publishing{
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    event.Time,
+		Type:         "audit.event",
+		Body:         body,
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if err = sink.publish(ctx, publishing); err != nil && sink.amqpContext != nil {
+		logger.Warnf("Retrying to publish audit event: %v", err)
+		if sink.amqpContext.Reset() == nil {
+			err = sink.publish(ctx, publishing)
+		}
+	}
+	return err
+}
+
+func (sink *AmqpSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.amqpContext == nil {
+		return nil
+	}
+	err := sink.amqpContext.Close()
+	sink.amqpContext = nil
+	return err
+}
+
+func (sink *AmqpSink) publish(ctx context.Context, publishing amqp.Publishing) error {
+	if sink.amqpContext == nil {
+		amqpContext, err := sink.helper.NewAmqpContext("")
+		if err != nil {
+			return fmt.Errorf("cannot connect to AMQP [%w]", err)
+		}
+		sink.amqpContext = amqpContext
+	}
+	if sink.exchange == "" {
+		if err := sink.amqpContext.EnsureQueueExists(sink.routingKey); err != nil {
+			return err
+		}
+	}
+	return sink.amqpContext.PublishConfirmed(ctx, sink.exchange, sink.routingKey, publishing)
+}
+
+// marshalProtoJSON encodes the event as protojson of auditpb.AuditEvent
+func marshalProtoJSON(event *Event) ([]byte, error) {
+	message, err := event.ToProto()
+	if err != nil {
+		return nil, err
+	}
+	return protojson.Marshal(message)
+}
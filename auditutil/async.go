@@ -0,0 +1,133 @@
+package auditutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrBufferFull is returned by AsyncSink.Write if its buffer is full
+var ErrBufferFull = errors.New("audit buffer is full")
+
+// Flusher is implemented by sinks buffering events, see Flush
+type Flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// asyncItem is either an event to write or a flush request
+type asyncItem struct {
+	ctx     context.Context
+	event   *Event
+	flushed chan struct{}
+}
+
+// AsyncSink buffers events and writes them to the wrapped sink in a
+// background goroutine, so Write never blocks
+type AsyncSink struct {
+	sink      Sink
+	items     chan asyncItem
+	dropped   atomic.Int64
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+// NewAsyncSink creates an AsyncSink with a buffer for size events and starts
+// its background writer. Call Close to write the buffered events and stop it.
+func NewAsyncSink(sink Sink, size int) *AsyncSink {
+	s := &AsyncSink{
+		sink:    sink,
+		items:   make(chan asyncItem, size),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.write()
+	return s
+}
+
+// Write buffers the event. If the buffer is full, the event is not written
+// and ErrBufferFull is returned. The event is written with ctx without its
+// cancellation, as the request may finish before.
+func (s *AsyncSink) Write(ctx context.Context, event *Event) error {
+	select {
+	case <-s.done:
+		return errors.New("audit sink is closed")
+	default:
+	}
+	select {
+	case s.items <- asyncItem{ctx: context.WithoutCancel(ctx), event: event}:
+		return nil
+	default:
+		s.dropped.Add(1)
+		return ErrBufferFull
+	}
+}
+
+// Flush waits until all events buffered before the call have been written and
+// flushes the wrapped sink if it is a Flusher
+func (s *AsyncSink) Flush(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case s.items <- asyncItem{flushed: flushed}:
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if flusher, ok := s.sink.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
+}
+
+// Close writes all buffered events, stops the background writer and closes the wrapped sink
+func (s *AsyncSink) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		<-s.stopped
+		err = s.sink.Close()
+	})
+	return err
+}
+
+// Dropped returns the number of events rejected due to a full buffer
+func (s *AsyncSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *AsyncSink) write() {
+	defer close(s.stopped)
+	for {
+		select {
+		case item := <-s.items:
+			s.handle(item)
+		case <-s.done:
+			// drain events buffered before Close
+			for {
+				select {
+				case item := <-s.items:
+					s.handle(item)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *AsyncSink) handle(item asyncItem) {
+	if item.flushed != nil {
+		close(item.flushed)
+		return
+	}
+	if err := s.sink.Write(item.ctx, item.event); err != nil {
+		logger.Errorf("Failed to write audit event [%s] of [%s]: %v", item.event.Action, item.event.Actor, err)
+	}
+}
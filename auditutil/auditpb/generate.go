@@ -0,0 +1,4 @@
+// Package auditpb contains the protobuf schema of audit events written by auditutil
+package auditpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative audit_event.proto
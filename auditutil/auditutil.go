@@ -0,0 +1,292 @@
+// Package auditutil records audit events, i.e. who did what to which resource,
+// to one or more configurable sinks
+package auditutil
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+	"github.com/science-computing/service-common-golang/shutdownutil"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	sinksConfigKey      = "audit.sinks"
+	bufferSizeConfigKey = "audit.buffersize"
+	defaultBufferSize   = 1000
+)
+
+func init() {
+	apputil.RegisterConfigKeys("auditutil",
+		apputil.ConfigKey{Key: sinksConfigKey, Type: "list", Default: "stdout", Description: "sinks audit events are written to, see SinkConfig"},
+		apputil.ConfigKey{Key: bufferSizeConfigKey, Type: "int", Default: "1000", Description: "events buffered for asynchronous sinks"},
+	)
+}
+
+// outcomes of audited actions
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+var (
+	logger = apputil.Named("auditutil")
+
+	sinkLock     sync.RWMutex
+	defaultSink  Sink = NewWriterSink(nil)
+	serviceName  string
+	exitHookOnce sync.Once
+)
+
+// Event describes an audited action
+type Event struct {
+	Time          time.Time              `json:"time"`
+	Service       string                 `json:"service,omitempty"`
+	Actor         string                 `json:"actor,omitempty"`
+	Action        string                 `json:"action"`
+	Resource      string                 `json:"resource,omitempty"`
+	Outcome       string                 `json:"outcome,omitempty"`
+	Details       map[string]interface{} `json:"details,omitempty"`
+	RequestID     string                 `json:"request_id,omitempty"`
+	TraceID       string                 `json:"trace_id,omitempty"`
+	CallerService string                 `json:"caller_service,omitempty"`
+}
+
+// Init sets the service name of events and the sink configured with audit.sinks,
+// e.g. audit.sinks: [{type: stdout}, {type: file, path: /var/log/audit.log}].
+// Without configuration events are written to stdout.
+// The sink is wrapped in an AsyncSink buffering audit.buffersize events
+// (default 1000, 0 writes synchronously), which is flushed by an exit hook.
+func Init(service string) error {
+	sink, err := NewSinkFromConfig(sinksConfigKey)
+	if err != nil {
+		return err
+	}
+	if sink == nil {
+		sink = NewWriterSink(nil)
+	}
+	bufferSize := defaultBufferSize
+	if viper.IsSet(bufferSizeConfigKey) {
+		bufferSize = viper.GetInt(bufferSizeConfigKey)
+	}
+	if bufferSize > 0 {
+		sink = NewAsyncSink(sink, bufferSize)
+	}
+
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	serviceName = service
+	defaultSink = sink
+	exitHookOnce.Do(func() {
+		apputil.RegisterExitHook("auditutil", func(ctx context.Context) {
+			if err := Flush(ctx); err != nil {
+				logger.Errorf("Failed to flush audit events: %v", err)
+			}
+		})
+	})
+	return nil
+}
+
+// SetSink replaces the sink events are written to and returns the previous one
+func SetSink(sink Sink) Sink {
+	sinkLock.Lock()
+	defer sinkLock.Unlock()
+	previous := defaultSink
+	defaultSink = sink
+	return previous
+}
+
+// Emit writes the event to the sink. Time, Service and the correlation IDs
+// set by the serviceutil interceptors (see apputil.CorrelationFromContext)
+// are set if empty.
+func Emit(ctx context.Context, event Event) error {
+	correlation := apputil.CorrelationFromContext(ctx)
+	if event.RequestID == "" {
+		event.RequestID = correlation.RequestID
+	}
+	if event.TraceID == "" {
+		event.TraceID = correlation.TraceID
+	}
+	if event.CallerService == "" {
+		event.CallerService = correlation.CallerService
+	}
+
+	sinkLock.RLock()
+	sink := defaultSink
+	if event.Service == "" {
+		event.Service = serviceName
+	}
+	sinkLock.RUnlock()
+
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	if err := sink.Write(ctx, &event); err != nil {
+		logger.Errorf("Failed to write audit event [%s] of [%s]: %v", event.Action, event.Actor, err)
+		return fmt.Errorf("failed to write audit event [%w]", err)
+	}
+	return nil
+}
+
+// Flush writes all buffered events of the sink, see Flusher. It is called on
+// exit by a hook registered by Init.
+func Flush(ctx context.Context) error {
+	sinkLock.RLock()
+	sink := defaultSink
+	sinkLock.RUnlock()
+	if flusher, ok := sink.(Flusher); ok {
+		return flusher.Flush(ctx)
+	}
+	return nil
+}
+
+// Close closes the sink
+func Close() error {
+	sinkLock.RLock()
+	defer sinkLock.RUnlock()
+	return defaultSink.Close()
+}
+
+// RegisterShutdown flushes and closes the sink in shutdownutil.PhaseTelemetry
+func RegisterShutdown() {
+	shutdownutil.Register("audit", shutdownutil.PhaseTelemetry, 0, func(ctx context.Context) error {
+		if err := Flush(ctx); err != nil {
+			return err
+		}
+		return Close()
+	})
+}
+
+// SinkConfig configures a sink, see NewSinkFromConfig
+type SinkConfig struct {
+	Type          string // stdout, file, webhook, db, amqp or syslog
+	Path          string // file: path of the audit log
+	MaxSize       string // file: size to rotate at, e.g. 100MiB
+	MaxAge        string // file: age of rotated files to remove, e.g. 2160h
+	MaxTotalSize  string // file: total size of rotated files to keep, e.g. 10GiB
+	Compress      bool   // file: compress rotated files
+	URL           string // webhook: URL events are posted to, db and amqp: connection URL
+	Address       string // syslog: host:port of the endpoint
+	TLS           bool   // syslog: connect via TLS
+	CAFile        string // syslog: CA certificates to verify the endpoint, system CAs if empty
+	Format        string // syslog: rfc5424 or cef
+	Vendor        string // syslog: CEF device vendor
+	Product       string // syslog: CEF device product
+	Exchange      string // amqp: exchange to publish to, default exchange if empty
+	RoutingKey    string // amqp: routing key, or queue name for the default exchange
+	Timeout       string // webhook: request timeout, e.g. 5s
+	BatchSize     int    // db: events written at once
+	FlushInterval string // db: maximum time events are buffered, e.g. 1s
+}
+
+// NewSinkFromConfig creates the sinks configured as list of SinkConfig with the
+// given key. Multiple sinks are combined to a MultiSink. If the key is not set, nil is returned.
+func NewSinkFromConfig(key string) (Sink, error) {
+	if !viper.IsSet(key) {
+		return nil, nil
+	}
+	var configs []SinkConfig
+	if err := viper.UnmarshalKey(key, &configs); err != nil {
+		return nil, fmt.Errorf("invalid audit sink config [%s]: %w", key, err)
+	}
+	var sinks []Sink
+	for _, config := range configs {
+		sink, err := newSink(config)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return NewMultiSink(sinks...), nil
+}
+
+func newSink(config SinkConfig) (Sink, error) {
+	switch config.Type {
+	case "stdout":
+		return NewWriterSink(nil), nil
+	case "file":
+		return newFileSink(config)
+	case "webhook":
+		timeout := defaultWebhookTimeout
+		if config.Timeout != "" {
+			var err error
+			if timeout, err = time.ParseDuration(config.Timeout); err != nil {
+				return nil, fmt.Errorf("invalid timeout of audit webhook sink: %w", err)
+			}
+		}
+		return NewWebhookSink(config.URL, timeout), nil
+	case "db":
+		options := DbSinkOptions{BatchSize: config.BatchSize}
+		if config.FlushInterval != "" {
+			var err error
+			if options.FlushInterval, err = time.ParseDuration(config.FlushInterval); err != nil {
+				return nil, fmt.Errorf("invalid flushInterval of audit db sink: %w", err)
+			}
+		}
+		helper := &dbutil.DbConnectionHelper{DbConnectionURL: config.URL, MaxOpenConns: 2, MaxIdleConns: 1}
+		return NewDbSink(helper, options), nil
+	case "amqp":
+		return NewAmqpSink(&amqputil.AmqpConnectionHelper{AmqpConnectionURL: config.URL}, config.Exchange, config.RoutingKey), nil
+	case "syslog":
+		return newSyslogSink(config)
+	default:
+		return nil, fmt.Errorf("unknown audit sink type [%s]", config.Type)
+	}
+}
+
+func newFileSink(config SinkConfig) (Sink, error) {
+	var maxSize int64
+	retention := RetentionPolicy{Compress: config.Compress}
+	var err error
+	if config.MaxSize != "" {
+		if maxSize, err = apputil.ParseByteSize(config.MaxSize); err != nil {
+			return nil, fmt.Errorf("invalid maxSize of audit file sink: %w", err)
+		}
+	}
+	if config.MaxTotalSize != "" {
+		if retention.MaxTotalSize, err = apputil.ParseByteSize(config.MaxTotalSize); err != nil {
+			return nil, fmt.Errorf("invalid maxTotalSize of audit file sink: %w", err)
+		}
+	}
+	if config.MaxAge != "" {
+		if retention.MaxAge, err = time.ParseDuration(config.MaxAge); err != nil {
+			return nil, fmt.Errorf("invalid maxAge of audit file sink: %w", err)
+		}
+	}
+	sink, err := NewFileSink(config.Path, maxSize)
+	if err != nil {
+		return nil, err
+	}
+	sink.SetRetention(retention)
+	return sink, nil
+}
+
+func newSyslogSink(config SinkConfig) (Sink, error) {
+	options := SyslogSinkOptions{Address: config.Address, Format: config.Format, Vendor: config.Vendor, Product: config.Product}
+	if config.TLS {
+		options.TLS = &tls.Config{}
+		if config.CAFile != "" {
+			pem, err := os.ReadFile(config.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read CA file of audit syslog sink: %w", err)
+			}
+			options.TLS.RootCAs = x509.NewCertPool()
+			if !options.TLS.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates in CA file [%s] of audit syslog sink", config.CAFile)
+			}
+		}
+	}
+	return NewSyslogSink(options)
+}
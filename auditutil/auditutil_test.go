@@ -0,0 +1,336 @@
+package auditutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/auditutil/auditpb"
+	"github.com/science-computing/service-common-golang/dbutil"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestEmitToStackedSinks(t *testing.T) {
+	var received Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	defer SetSink(SetSink(NewMultiSink(NewWriterSink(&buffer), NewWebhookSink(server.URL, time.Second))))
+
+	if err := Emit(context.Background(), Event{Actor: "alice", Action: "delete", Resource: "project/1", Outcome: OutcomeSuccess}); err != nil {
+		t.Fatal(err)
+	}
+	var written Event
+	if err := json.Unmarshal(buffer.Bytes(), &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.Actor != "alice" || written.Time.IsZero() {
+		t.Errorf("unexpected event written: %+v", written)
+	}
+	if received.Action != "delete" {
+		t.Errorf("unexpected event posted: %+v", received)
+	}
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := sink.Write(context.Background(), &Event{Action: strings.Repeat("x", 50)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, _ := filepath.Glob(path + "*")
+	if len(files) != 3 {
+		t.Errorf("expected 3 files after rotation, got %v", files)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected current audit file: %v", err)
+	}
+}
+
+func TestNewSinkFromConfig(t *testing.T) {
+	viper.Set("test.sinks", []map[string]interface{}{
+		{"type": "stdout"},
+		{"type": "file", "path": filepath.Join(t.TempDir(), "audit.log"), "maxSize": "1MiB"},
+	})
+	sink, err := NewSinkFromConfig("test.sinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	if multi, ok := sink.(*MultiSink); !ok || len(multi.sinks) != 2 {
+		t.Errorf("expected MultiSink with 2 sinks, got %#v", sink)
+	}
+
+	viper.Set("test.sinks", []map[string]interface{}{{"type": "carrier-pigeon"}})
+	if _, err := NewSinkFromConfig("test.sinks"); err == nil {
+		t.Error("expected error for unknown sink type")
+	}
+}
+
+type sqlStateError string
+
+func (err sqlStateError) Error() string    { return "sql error " + string(err) }
+func (err sqlStateError) SQLState() string { return string(err) }
+
+func TestDbSinkBatchQuery(t *testing.T) {
+	query, args, err := insertQuery([]*Event{
+		{Action: "create", Details: map[string]interface{}{"id": 1}},
+		{Action: "delete"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(query, "($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11), ($12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22)") || len(args) != 22 {
+		t.Errorf("unexpected query [%s] with %d args", query, len(args))
+	}
+	if string(args[6].([]byte)) != `{"id":1}` || args[17].([]byte) != nil {
+		t.Errorf("unexpected details %v and %v", args[6], args[13])
+	}
+
+	for state, transient := range map[string]bool{"08006": true, "40001": true, "23505": false, "42P01": false} {
+		if isTransient(fmt.Errorf("wrapped: %w", sqlStateError(state))) != transient {
+			t.Errorf("expected transient=%v for SQLSTATE %s", transient, state)
+		}
+	}
+}
+
+func TestDbSinkKeepsFailedBatches(t *testing.T) {
+	capped := NewDbSink(&dbutil.DbConnectionHelper{}, DbSinkOptions{BatchSize: 10000})
+	capped.Close()
+	if capped.options.BatchSize*insertColumns > 65535 {
+		t.Errorf("expected batch size to be capped, got %d", capped.options.BatchSize)
+	}
+
+	// the DB cannot be opened, so all writes fail
+	sink := NewDbSink(&dbutil.DbConnectionHelper{}, DbSinkOptions{BatchSize: 2, FlushInterval: time.Hour, MaxPending: 3})
+	defer sink.Close()
+	events := []*Event{{Action: "1"}, {Action: "2"}, {Action: "3"}, {Action: "4"}}
+	for index, event := range events {
+		if err := sink.Write(context.Background(), event); (err != nil) != (index > 0) {
+			t.Fatalf("unexpected error writing event %d: %v", index, err)
+		}
+	}
+	if !reflect.DeepEqual(sink.pending, events[1:]) || sink.Dropped() != 1 {
+		t.Errorf("expected the 3 newest events to be kept in order, got %v and %d dropped", sink.pending, sink.Dropped())
+	}
+
+	sink.pending = []*Event{{Action: "invalid", Details: map[string]interface{}{"value": func() {}}}}
+	if err := sink.Flush(context.Background()); err == nil || len(sink.pending) != 0 || sink.Dropped() != 2 {
+		t.Errorf("expected event which cannot be encoded to be dropped, got %v", err)
+	}
+}
+
+func TestAmqpSinkEncoding(t *testing.T) {
+	event := &Event{Time: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), Actor: "alice", Action: "login", Details: map[string]interface{}{"ip": "10.0.0.1"}}
+	body, err := marshalProtoJSON(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := &auditpb.AuditEvent{}
+	if err := protojson.Unmarshal(body, message); err != nil {
+		t.Fatal(err)
+	}
+	if message.SchemaVersion != SchemaVersion {
+		t.Errorf("expected schema version %d, got %d", SchemaVersion, message.SchemaVersion)
+	}
+	decoded := EventFromProto(message)
+	if decoded.Actor != "alice" || !decoded.Time.Equal(event.Time) || decoded.Details["ip"] != "10.0.0.1" {
+		t.Errorf("unexpected encoding %s", body)
+	}
+}
+
+type recordingSink struct {
+	events []*Event
+}
+
+func (sink *recordingSink) Write(ctx context.Context, event *Event) error {
+	sink.events = append(sink.events, event)
+	return nil
+}
+
+func (sink *recordingSink) Close() error { return nil }
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	sink := &recordingSink{}
+	defer SetSink(SetSink(sink))
+
+	interceptor := UnaryServerInterceptor(InterceptorOptions{
+		Methods:  []string{"/example.Projects/"},
+		Resource: func(fullMethod string, req interface{}) string { return "project/" + req.(string) },
+	})
+	ctx := ContextWithPrincipal(context.Background(), "alice")
+	ctx = apputil.ContextWithCorrelation(ctx, apputil.Correlation{RequestID: "42", CallerService: "frontend"})
+	failing := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.PermissionDenied, "denied")
+	}
+	interceptor(ctx, "1", &grpc.UnaryServerInfo{FullMethod: "/example.Projects/Delete"}, failing)
+	interceptor(ctx, "1", &grpc.UnaryServerInfo{FullMethod: "/example.Health/Check"}, failing)
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 audit event, got %d", len(sink.events))
+	}
+	event := sink.events[0]
+	if event.Actor != "alice" || event.Action != "/example.Projects/Delete" || event.Resource != "project/1" ||
+		event.Outcome != OutcomeFailure || event.Details["code"] != "PermissionDenied" ||
+		event.RequestID != "42" || event.CallerService != "frontend" {
+		t.Errorf("unexpected audit event %+v", event)
+	}
+}
+
+type blockingSink struct {
+	recordingSink
+	release chan struct{}
+}
+
+func (sink *blockingSink) Write(ctx context.Context, event *Event) error {
+	<-sink.release
+	return sink.recordingSink.Write(ctx, event)
+}
+
+func TestAsyncSink(t *testing.T) {
+	sink := &blockingSink{release: make(chan struct{})}
+	async := NewAsyncSink(sink, 2)
+
+	// the writer takes the first event and blocks, two more fill the buffer
+	for i := 0; i < 3; i++ {
+		if err := async.Write(context.Background(), &Event{Action: "write"}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := async.Write(context.Background(), &Event{Action: "write"}); err != ErrBufferFull {
+		t.Errorf("expected ErrBufferFull, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := async.Flush(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected flush to time out, got %v", err)
+	}
+
+	close(sink.release)
+	if err := async.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(sink.events) != 3 || async.Dropped() != 1 {
+		t.Errorf("expected 3 written and 1 dropped events, got %d and %d", len(sink.events), async.Dropped())
+	}
+	async.Close()
+}
+
+func TestFileSinkRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	sink, err := NewFileSink(path, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archived []string
+	sink.SetRetention(RetentionPolicy{
+		MaxTotalSize: 1,
+		Compress:     true,
+		Archive: func(ctx context.Context, path string) error {
+			archived = append(archived, path)
+			return nil
+		},
+	})
+	for i := 0; i < 3; i++ {
+		if err := sink.Write(context.Background(), &Event{Action: strings.Repeat("x", 50)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sink.Close()
+
+	files, _ := filepath.Glob(path + ".*")
+	if len(files) != 0 {
+		t.Errorf("expected rotated files to be removed, got %v", files)
+	}
+	if len(archived) != 2 || !strings.HasSuffix(archived[0], ".gz") {
+		t.Errorf("expected 2 compressed files to be archived, got %v", archived)
+	}
+}
+
+func TestDbReaderQuery(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	query, args, size, err := selectQuery(EventFilter{Actor: "alice", From: from}, Page{Size: 5000, Token: "17"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(query, " WHERE actor = $1 AND time >= $2 AND id < $3 ORDER BY id DESC LIMIT 1001") ||
+		len(args) != 3 || args[2] != int64(17) || size != 1000 {
+		t.Errorf("unexpected query [%s] with args %v", query, args)
+	}
+	if _, _, _, err := selectQuery(EventFilter{}, Page{Token: "invalid"}); err == nil {
+		t.Error("expected error for invalid page token")
+	}
+}
+
+func TestSyslogSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buffer := make([]byte, 4096)
+		n, _ := conn.Read(buffer)
+		received <- string(buffer[:n])
+	}()
+
+	sink, err := NewSyslogSink(SyslogSinkOptions{Address: listener.Addr().String(), Format: FormatCEF, Vendor: "ACME"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	event := &Event{Time: time.Unix(1700000000, 0), Service: "projects", Actor: "alice", Action: "delete", Resource: "a=b", Outcome: OutcomeFailure}
+	if err := sink.Write(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	frame := <-received
+	length, message, _ := strings.Cut(frame, " ")
+	if length != fmt.Sprint(len(message)) {
+		t.Errorf("expected octet counting frame, got [%s]", frame)
+	}
+	if !strings.HasPrefix(message, "<84>1 2023-11-14T22:13:20Z ") ||
+		!strings.Contains(message, "CEF:0|ACME|projects|") ||
+		!strings.Contains(message, "|delete|delete|6|rt=1700000000000 suser=alice act=delete outcome=failure cs1Label=resource cs1=a\\=b") {
+		t.Errorf("unexpected message [%s]", message)
+	}
+
+	sink.options.Format = FormatRFC5424
+	if message := sink.format(event); !strings.HasSuffix(message, ` - delete [audit@32473 actor="alice" action="delete" resource="a=b" outcome="failure"] delete`) {
+		t.Errorf("unexpected message [%s]", message)
+	}
+}
@@ -0,0 +1,128 @@
+package auditutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// EventFilter selects events by QueryEvents. Empty fields match all events.
+type EventFilter struct {
+	Actor    string
+	Resource string
+	Action   string
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+}
+
+// Page selects a page of events, most recent first
+type Page struct {
+	Size  int    // default 100, at most 1000
+	Token string // NextToken of the previous page, empty for the first page
+}
+
+// EventPage is a page of events returned by QueryEvents
+type EventPage struct {
+	Events    []Event
+	NextToken string // empty if there are no more events
+}
+
+// QueryEvents returns the events written by DbSinks matching filter, most recent first
+func (sink *DbSink) QueryEvents(ctx context.Context, filter EventFilter, page Page) (*EventPage, error) {
+	query, args, size, err := selectQuery(filter, page)
+	if err != nil {
+		return nil, err
+	}
+
+	dbContext := sink.helper.GetDbContext(&ctx, false)
+	defer dbContext.Close()
+	rows, err := dbContext.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events [%w]", err)
+	}
+	if closer, ok := rows.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	result := &EventPage{}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var event Event
+		var details []byte
+		if err := rows.Scan(&id, &event.Time, &event.Service, &event.Actor, &event.Action, &event.Resource,
+			&event.Outcome, &details, &event.RequestID, &event.TraceID, &event.CallerService); err != nil {
+			return nil, fmt.Errorf("failed to read audit event [%w]", err)
+		}
+		if len(details) > 0 {
+			if err := json.Unmarshal(details, &event.Details); err != nil {
+				return nil, fmt.Errorf("failed to read details of audit event [%w]", err)
+			}
+		}
+		ids = append(ids, id)
+		result.Events = append(result.Events, event)
+	}
+	// one more event than requested is selected to detect further pages
+	if len(result.Events) > size {
+		result.Events = result.Events[:size]
+		result.NextToken = strconv.FormatInt(ids[size-1], 10)
+	}
+	return result, nil
+}
+
+// selectQuery builds the query of QueryEvents using keyset pagination on the
+// id column, i.e. the page token is the id of the last event of the previous page
+func selectQuery(filter EventFilter, page Page) (string, []interface{}, int, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Actor != "" {
+		addCondition("actor = $%d", filter.Actor)
+	}
+	if filter.Resource != "" {
+		addCondition("resource = $%d", filter.Resource)
+	}
+	if filter.Action != "" {
+		addCondition("action = $%d", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		addCondition("time >= $%d", filter.From)
+	}
+	if !filter.To.IsZero() {
+		addCondition("time < $%d", filter.To)
+	}
+	if page.Token != "" {
+		beforeID, err := strconv.ParseInt(page.Token, 10, 64)
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("invalid page token [%s]", page.Token)
+		}
+		addCondition("id < $%d", beforeID)
+	}
+
+	size := page.Size
+	if size <= 0 {
+		size = defaultPageSize
+	} else if size > maxPageSize {
+		size = maxPageSize
+	}
+
+	var query strings.Builder
+	fmt.Fprintf(&query, "SELECT id, time, service, actor, action, resource, outcome, details, request_id, trace_id, caller_service FROM %s", DbSinkTable)
+	if len(conditions) > 0 {
+		query.WriteString(" WHERE " + strings.Join(conditions, " AND "))
+	}
+	fmt.Fprintf(&query, " ORDER BY id DESC LIMIT %d", size+1)
+	return query.String(), args, size, nil
+}
@@ -0,0 +1,281 @@
+package auditutil
+
+import (
+	"context"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/science-computing/service-common-golang/dbutil"
+)
+
+// DbSinkTable is the table events are written to by DbSink
+const DbSinkTable = "audit_events"
+
+const (
+	defaultDbBatchSize     = 100
+	defaultDbFlushInterval = time.Second
+	defaultDbMaxRetries    = 3
+	defaultDbMaxPending    = 10000
+	dbRetryBackoff         = 100 * time.Millisecond
+	insertColumns          = 11
+	// maxDbBatchSize keeps the parameters of an INSERT below the limit of Postgres
+	maxDbBatchSize = 65535 / insertColumns
+)
+
+var droppedDbEvents = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "audit_db_sink_dropped_events_total",
+	Help: "The total number of audit events dropped by DbSink as its buffer overflowed",
+})
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// DbSinkOptions configures a DbSink. Zero values select the defaults.
+type DbSinkOptions struct {
+	BatchSize     int           // events written per INSERT, default 100, at most 5957
+	FlushInterval time.Duration // maximum time events are buffered, default 1s
+	MaxRetries    int           // retries on transient errors, default 3
+	MaxPending    int           // events buffered while writes fail, default 10000
+}
+
+// DbSink writes events in batches to the audit_events table of a Postgres
+// database. Transient errors like lost connections or serialization failures
+// are retried. Events of failed writes are buffered again and written with the
+// next flush. If more than MaxPending events are buffered, the oldest are
+// dropped.
+type DbSink struct {
+	helper  *dbutil.DbConnectionHelper
+	options DbSinkOptions
+
+	mutex   sync.Mutex
+	pending []*Event
+	dropped atomic.Int64
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewDbSink creates a DbSink using the given connection helper and starts its
+// background flushing. Call Close to write remaining events.
+func NewDbSink(helper *dbutil.DbConnectionHelper, options DbSinkOptions) *DbSink {
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultDbBatchSize
+	}
+	options.BatchSize = min(options.BatchSize, maxDbBatchSize)
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = defaultDbFlushInterval
+	}
+	if options.MaxRetries <= 0 {
+		options.MaxRetries = defaultDbMaxRetries
+	}
+	if options.MaxPending <= 0 {
+		options.MaxPending = defaultDbMaxPending
+	}
+	options.MaxPending = max(options.MaxPending, options.BatchSize)
+	sink := &DbSink{
+		helper:  helper,
+		options: options,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go sink.flushPeriodically()
+	return sink
+}
+
+// Migrate creates the audit_events table and its indexes if they do not exist
+func (sink *DbSink) Migrate() error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		migration, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Running audit migration [%s]", name)
+		dbContext := sink.helper.GetDbContext(nil, true)
+		dbContext.Execute(string(migration))
+		err = dbContext.LastError()
+		dbContext.Close()
+		if err != nil {
+			return fmt.Errorf("audit migration [%s] failed: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Write buffers the event. If the buffer reaches the batch size, the batch is
+// written before Write returns.
+func (sink *DbSink) Write(ctx context.Context, event *Event) error {
+	sink.mutex.Lock()
+	sink.pending = append(sink.pending, event)
+	if len(sink.pending) < sink.options.BatchSize {
+		sink.mutex.Unlock()
+		return nil
+	}
+	batch := sink.pending
+	sink.pending = nil
+	sink.mutex.Unlock()
+	return sink.write(ctx, batch)
+}
+
+// Flush writes all buffered events
+func (sink *DbSink) Flush(ctx context.Context) error {
+	sink.mutex.Lock()
+	batch := sink.pending
+	sink.pending = nil
+	sink.mutex.Unlock()
+	return sink.write(ctx, batch)
+}
+
+// Dropped returns the number of events dropped due to a full buffer or as
+// they could not be encoded
+func (sink *DbSink) Dropped() int64 {
+	return sink.dropped.Load()
+}
+
+// write writes events in batches of BatchSize. The events of a failed batch
+// and the following ones are buffered again before the events written since.
+// Batches with events which cannot be encoded are dropped.
+func (sink *DbSink) write(ctx context.Context, events []*Event) error {
+	var err error
+	for len(events) > 0 {
+		batch := events[:min(len(events), sink.options.BatchSize)]
+		query, args, encodeErr := insertQuery(batch)
+		if encodeErr != nil {
+			sink.dropped.Add(int64(len(batch)))
+			droppedDbEvents.Add(float64(len(batch)))
+			err = fmt.Errorf("failed to encode %d audit events [%w]", len(batch), encodeErr)
+		} else if writeErr := sink.writeBatch(ctx, len(batch), query, args); writeErr != nil {
+			sink.requeue(events)
+			return writeErr
+		}
+		events = events[len(batch):]
+	}
+	return err
+}
+
+// requeue buffers events before the pending events and drops the oldest
+// events beyond MaxPending
+func (sink *DbSink) requeue(events []*Event) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.pending = append(events[:len(events):len(events)], sink.pending...)
+	if overflow := len(sink.pending) - sink.options.MaxPending; overflow > 0 {
+		logger.Errorf("Dropping %d audit events as the buffer is full", overflow)
+		sink.pending = sink.pending[overflow:]
+		sink.dropped.Add(int64(overflow))
+		droppedDbEvents.Add(float64(overflow))
+	}
+}
+
+// Close stops the background flushing and writes all buffered events
+func (sink *DbSink) Close() error {
+	select {
+	case <-sink.done:
+	default:
+		close(sink.done)
+		<-sink.stopped
+	}
+	return sink.Flush(context.Background())
+}
+
+func (sink *DbSink) flushPeriodically() {
+	defer close(sink.stopped)
+	ticker := time.NewTicker(sink.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-sink.done:
+			return
+		case <-ticker.C:
+			if err := sink.Flush(context.Background()); err != nil {
+				logger.Errorf("Failed to write audit events: %v", err)
+			}
+		}
+	}
+}
+
+// writeBatch executes the INSERT of a batch of size events with retries
+func (sink *DbSink) writeBatch(ctx context.Context, size int, query string, args []interface{}) error {
+	var err error
+	backoff := dbRetryBackoff
+	for attempt := 0; ; attempt++ {
+		dbContext := sink.helper.GetDbContext(&ctx, false)
+		if dbContext.LastError() == nil {
+			dbContext.Execute(query, args...)
+		}
+		err = dbContext.LastError()
+		dbContext.Close()
+		if err == nil || attempt >= sink.options.MaxRetries || !isTransient(err) {
+			break
+		}
+		logger.Warnf("Retrying to write %d audit events after transient error: %v", size, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %d audit events [%w]", size, err)
+	}
+	return nil
+}
+
+// insertQuery builds a single INSERT for all events, so a batch is written atomically
+func insertQuery(batch []*Event) (string, []interface{}, error) {
+	var query strings.Builder
+	fmt.Fprintf(&query, "INSERT INTO %s (time, service, actor, action, resource, outcome, details, request_id, trace_id, caller_service, schema_version) VALUES ", DbSinkTable)
+	args := make([]interface{}, 0, len(batch)*insertColumns)
+	for index, event := range batch {
+		var details []byte
+		if len(event.Details) > 0 {
+			var err error
+			if details, err = json.Marshal(event.Details); err != nil {
+				return "", nil, err
+			}
+		}
+		if index > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for column := 1; column <= insertColumns; column++ {
+			if column > 1 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", len(args)+column)
+		}
+		query.WriteString(")")
+		args = append(args, event.Time, event.Service, event.Actor, event.Action, event.Resource, event.Outcome, details,
+			event.RequestID, event.TraceID, event.CallerService, SchemaVersion)
+	}
+	return query.String(), args, nil
+}
+
+// isTransient reports whether a write failing with err may succeed when retried
+func isTransient(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	if errors.As(err, &sqlErr) {
+		state := sqlErr.SQLState()
+		// connection exceptions, serialization failures, deadlocks, insufficient resources, shutdowns
+		return strings.HasPrefix(state, "08") || state == "40001" || state == "40P01" ||
+			strings.HasPrefix(state, "53") || strings.HasPrefix(state, "57P")
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.As(err, &netErr)
+}
@@ -0,0 +1,254 @@
+package auditutil
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rotatedTimeLayout = "20060102T150405.000000000"
+
+// RetentionPolicy defines how long rotated audit files are kept, see FileSink.SetRetention
+type RetentionPolicy struct {
+	MaxAge       time.Duration // rotated files older than this are removed, 0 keeps them
+	MaxTotalSize int64         // oldest rotated files are removed while all exceed this size, 0 keeps them
+	Compress     bool          // rotated files are compressed with gzip
+	// Archive is optionally called with a rotated file before it is removed,
+	// e.g. to upload it to object storage. If it fails, the file is kept.
+	Archive func(ctx context.Context, path string) error
+}
+
+// FileSink appends events as JSON lines to a file, which is rotated when
+// reaching a maximum size
+type FileSink struct {
+	mutex     sync.Mutex
+	path      string
+	maxSize   int64
+	file      *os.File
+	size      int64
+	retention RetentionPolicy
+
+	// cleanupLock serializes compressing and removing rotated files
+	cleanupLock sync.Mutex
+	cleanups    sync.WaitGroup
+}
+
+// NewFileSink opens the file at path. When writing an event would exceed
+// maxSize, the file is renamed to <path>.<timestamp> and a new file is
+// started. A maxSize of 0 disables rotation.
+func NewFileSink(path string, maxSize int64) (*FileSink, error) {
+	if path == "" {
+		return nil, errors.New("missing path of audit file sink")
+	}
+	sink := &FileSink{path: path, maxSize: maxSize}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// SetRetention sets the policy applied to rotated files after each rotation
+// and applies it once in the background
+func (sink *FileSink) SetRetention(retention RetentionPolicy) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	sink.retention = retention
+	sink.cleanupInBackground()
+}
+
+func (sink *FileSink) Write(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.maxSize > 0 && sink.size > 0 && sink.size+int64(len(line)) > sink.maxSize {
+		if err := sink.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := sink.file.Write(line)
+	sink.size += int64(n)
+	return err
+}
+
+// Close closes the file after waiting for running retention cleanups
+func (sink *FileSink) Close() error {
+	sink.cleanups.Wait()
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return sink.file.Close()
+}
+
+func (sink *FileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file [%w]", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to open audit file [%w]", err)
+	}
+	sink.file = file
+	sink.size = info.Size()
+	return nil
+}
+
+func (sink *FileSink) rotate() error {
+	if err := sink.file.Close(); err != nil {
+		return err
+	}
+	rotated := fmt.Sprintf("%s.%s", sink.path, time.Now().UTC().Format(rotatedTimeLayout))
+	if err := os.Rename(sink.path, rotated); err != nil {
+		return fmt.Errorf("failed to rotate audit file [%w]", err)
+	}
+	sink.cleanupInBackground()
+	return sink.open()
+}
+
+// cleanupInBackground applies the retention policy without blocking writes.
+// It must be called with mutex held.
+func (sink *FileSink) cleanupInBackground() {
+	retention := sink.retention
+	if !retention.Compress && retention.MaxAge == 0 && retention.MaxTotalSize == 0 {
+		return
+	}
+	sink.cleanups.Add(1)
+	go func() {
+		defer sink.cleanups.Done()
+		sink.cleanupLock.Lock()
+		defer sink.cleanupLock.Unlock()
+		if err := sink.cleanup(retention); err != nil {
+			logger.Errorf("Failed to clean up rotated audit files of [%s]: %v", sink.path, err)
+		}
+	}()
+}
+
+type rotatedFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+func (sink *FileSink) cleanup(retention RetentionPolicy) error {
+	files, err := sink.rotatedFiles()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if retention.Compress {
+		for index, file := range files {
+			if strings.HasSuffix(file.path, ".gz") {
+				continue
+			}
+			compressed, err := compressFile(file.path)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			files[index] = compressed
+		}
+	}
+
+	// files are sorted oldest first, remove them while exceeding the limits
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.size
+	}
+	for _, file := range files {
+		tooOld := retention.MaxAge > 0 && time.Since(file.modTime) > retention.MaxAge
+		tooLarge := retention.MaxTotalSize > 0 && totalSize > retention.MaxTotalSize
+		if !tooOld && !tooLarge {
+			continue
+		}
+		if retention.Archive != nil {
+			if err := retention.Archive(context.Background(), file.path); err != nil {
+				errs = append(errs, fmt.Errorf("failed to archive [%s]: %w", file.path, err))
+				continue
+			}
+		}
+		if err := os.Remove(file.path); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		totalSize -= file.size
+	}
+	return errors.Join(errs...)
+}
+
+// rotatedFiles returns the rotated files of the sink, oldest first
+func (sink *FileSink) rotatedFiles() ([]rotatedFile, error) {
+	paths, err := filepath.Glob(sink.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var files []rotatedFile
+	for _, path := range paths {
+		suffix := strings.TrimSuffix(strings.TrimPrefix(path, sink.path+"."), ".gz")
+		if _, err := time.Parse(rotatedTimeLayout, suffix); err != nil {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+	}
+	// the timestamp layout sorts chronologically
+	sort.Slice(files, func(i, j int) bool { return files[i].path < files[j].path })
+	return files, nil
+}
+
+// compressFile replaces the file with a gzip compressed <path>.gz keeping its modification time
+func compressFile(path string) (rotatedFile, error) {
+	source, err := os.Open(path)
+	if err != nil {
+		return rotatedFile{}, err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return rotatedFile{}, err
+	}
+
+	compressedPath := path + ".gz"
+	target, err := os.OpenFile(compressedPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return rotatedFile{}, err
+	}
+	writer := gzip.NewWriter(target)
+	_, err = io.Copy(writer, source)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(compressedPath)
+		return rotatedFile{}, fmt.Errorf("failed to compress [%s]: %w", path, err)
+	}
+
+	os.Chtimes(compressedPath, info.ModTime(), info.ModTime())
+	if err := os.Remove(path); err != nil {
+		return rotatedFile{}, err
+	}
+	compressed, err := os.Stat(compressedPath)
+	if err != nil {
+		return rotatedFile{}, err
+	}
+	return rotatedFile{path: compressedPath, size: compressed.Size(), modTime: info.ModTime()}, nil
+}
@@ -0,0 +1,95 @@
+package auditutil
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying the authenticated
+// principal, e.g. set by an authentication interceptor
+func ContextWithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by ContextWithPrincipal or ""
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalKey{}).(string)
+	return principal
+}
+
+// InterceptorOptions configures the audit interceptors
+type InterceptorOptions struct {
+	// Methods to audit as full method names like /pkg.Service/Method, or
+	// prefixes ending with / like /pkg.Service/ to audit all methods of a service
+	Methods []string
+	// Principal returns the actor, default PrincipalFromContext
+	Principal func(ctx context.Context) string
+	// Resource optionally returns the resource affected by a unary request
+	Resource func(fullMethod string, req interface{}) string
+}
+
+// UnaryServerInterceptor emits an audit event for each call of a configured
+// method with the gRPC status code as detail. Add it after the serviceutil
+// interceptors via Service.GrpcOptions, e.g.
+//
+//	grpc.ChainUnaryInterceptor(auditutil.UnaryServerInterceptor(options))
+func UnaryServerInterceptor(options InterceptorOptions) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !options.audited(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		resp, err := handler(ctx, req)
+		resource := ""
+		if options.Resource != nil {
+			resource = options.Resource(info.FullMethod, req)
+		}
+		options.emit(ctx, info.FullMethod, resource, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is the stream variant of UnaryServerInterceptor,
+// emitting one event when the stream ends. Resource is not called for streams.
+func StreamServerInterceptor(options InterceptorOptions) grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !options.audited(info.FullMethod) {
+			return handler(srv, stream)
+		}
+		err := handler(srv, stream)
+		options.emit(stream.Context(), info.FullMethod, "", err)
+		return err
+	}
+}
+
+func (options *InterceptorOptions) audited(fullMethod string) bool {
+	for _, method := range options.Methods {
+		if method == fullMethod || (strings.HasSuffix(method, "/") && strings.HasPrefix(fullMethod, method)) {
+			return true
+		}
+	}
+	return false
+}
+
+// emit writes the event of a call. Failures are logged by Emit and do not fail the call.
+func (options *InterceptorOptions) emit(ctx context.Context, fullMethod, resource string, err error) {
+	principal := options.Principal
+	if principal == nil {
+		principal = PrincipalFromContext
+	}
+	outcome := OutcomeSuccess
+	if err != nil {
+		outcome = OutcomeFailure
+	}
+	Emit(ctx, Event{
+		Actor:    principal(ctx),
+		Action:   fullMethod,
+		Resource: resource,
+		Outcome:  outcome,
+		Details:  map[string]interface{}{"code": status.Code(err).String()},
+	})
+}
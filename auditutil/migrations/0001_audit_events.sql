@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+    id       BIGSERIAL PRIMARY KEY,
+    time     TIMESTAMPTZ NOT NULL,
+    service  TEXT NOT NULL DEFAULT '',
+    actor    TEXT NOT NULL DEFAULT '',
+    action   TEXT NOT NULL,
+    resource TEXT NOT NULL DEFAULT '',
+    outcome  TEXT NOT NULL DEFAULT '',
+    details  JSONB
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_time_idx ON audit_events (time);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, time);
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON audit_events (resource, id);
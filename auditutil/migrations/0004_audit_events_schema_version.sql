@@ -0,0 +1 @@
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS schema_version INTEGER NOT NULL DEFAULT 1;
@@ -0,0 +1,59 @@
+package auditutil
+
+import (
+	"fmt"
+
+	"github.com/science-computing/service-common-golang/auditutil/auditpb"
+
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// SchemaVersion is the version of auditpb.AuditEvent written by the sinks
+const SchemaVersion = 1
+
+// ToProto converts the event to its protobuf representation. Details must
+// only contain values supported by structpb.NewValue.
+func (event *Event) ToProto() (*auditpb.AuditEvent, error) {
+	message := &auditpb.AuditEvent{
+		SchemaVersion: SchemaVersion,
+		Time:          timestamppb.New(event.Time),
+		Service:       event.Service,
+		Actor:         event.Actor,
+		Action:        event.Action,
+		Resource:      event.Resource,
+		Outcome:       event.Outcome,
+		RequestId:     event.RequestID,
+		TraceId:       event.TraceID,
+		CallerService: event.CallerService,
+	}
+	if len(event.Details) > 0 {
+		details, err := structpb.NewStruct(event.Details)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encode details of audit event: %w", err)
+		}
+		message.Details = details
+	}
+	return message, nil
+}
+
+// EventFromProto converts an event of any schema version to an Event
+func EventFromProto(message *auditpb.AuditEvent) Event {
+	event := Event{
+		Service:       message.GetService(),
+		Actor:         message.GetActor(),
+		Action:        message.GetAction(),
+		Resource:      message.GetResource(),
+		Outcome:       message.GetOutcome(),
+		RequestID:     message.GetRequestId(),
+		TraceID:       message.GetTraceId(),
+		CallerService: message.GetCallerService(),
+	}
+	if message.Time != nil {
+		event.Time = message.Time.AsTime()
+	}
+	if message.Details != nil {
+		event.Details = message.Details.AsMap()
+	}
+	return event
+}
@@ -0,0 +1,131 @@
+package auditutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultWebhookTimeout = 5 * time.Second
+
+// Sink is a destination for audit events
+type Sink interface {
+	Write(ctx context.Context, event *Event) error
+	Close() error
+}
+
+// WriterSink writes events as JSON lines to a writer
+type WriterSink struct {
+	mutex  sync.Mutex
+	writer io.Writer
+}
+
+// NewWriterSink creates a WriterSink writing to w, or stdout if w is nil
+func NewWriterSink(w io.Writer) *WriterSink {
+	if w == nil {
+		w = os.Stdout
+	}
+	return &WriterSink{writer: w}
+}
+
+func (sink *WriterSink) Write(ctx context.Context, event *Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	_, err = sink.writer.Write(append(line, '\n'))
+	return err
+}
+
+func (sink *WriterSink) Close() error {
+	return nil
+}
+
+// WebhookSink posts events as JSON to an HTTP endpoint
+type WebhookSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookSink creates a WebhookSink posting to url with the given request timeout
+func NewWebhookSink(url string, timeout time.Duration) *WebhookSink {
+	return &WebhookSink{url: url, client: &http.Client{Timeout: timeout}}
+}
+
+func (sink *WebhookSink) Write(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	response, err := sink.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("audit webhook returned [%s]", response.Status)
+	}
+	return nil
+}
+
+func (sink *WebhookSink) Close() error {
+	return nil
+}
+
+// MultiSink writes events to several sinks
+type MultiSink struct {
+	sinks []Sink
+}
+
+// NewMultiSink creates a MultiSink writing to all given sinks
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// Write writes the event to all sinks, also if some of them fail
+func (sink *MultiSink) Write(ctx context.Context, event *Event) error {
+	var errs []error
+	for _, s := range sink.sinks {
+		if err := s.Write(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush flushes all sinks which are a Flusher
+func (sink *MultiSink) Flush(ctx context.Context) error {
+	var errs []error
+	for _, s := range sink.sinks {
+		if flusher, ok := s.(Flusher); ok {
+			if err := flusher.Flush(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (sink *MultiSink) Close() error {
+	var errs []error
+	for _, s := range sink.sinks {
+		if err := s.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,216 @@
+package auditutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+// formats of SyslogSink
+const (
+	FormatRFC5424 = "rfc5424"
+	FormatCEF     = "cef"
+)
+
+// StructuredDataID is the SD-ID of the structured data written in RFC5424 format
+const StructuredDataID = "audit@32473"
+
+const (
+	syslogFacilityAuthPriv = 10
+	syslogSeverityWarning  = 4
+	syslogSeverityNotice   = 5
+	syslogWriteTimeout     = 10 * time.Second
+)
+
+// SyslogSinkOptions configures a SyslogSink
+type SyslogSinkOptions struct {
+	Address string      // host:port of the syslog endpoint
+	TLS     *tls.Config // connect via TLS if set, plain TCP otherwise
+	Format  string      // FormatRFC5424 (default) or FormatCEF
+	Vendor  string      // CEF device vendor
+	Product string      // CEF device product, default service of the event
+}
+
+// SyslogSink sends events to a syslog endpoint over TCP or TLS, framed by
+// octet counting (RFC 6587), e.g. for SIEM integration. The messages follow
+// RFC 5424 with the event as structured data, or carry the event in CEF.
+type SyslogSink struct {
+	mutex    sync.Mutex
+	options  SyslogSinkOptions
+	hostname string
+	conn     net.Conn
+}
+
+// NewSyslogSink creates a SyslogSink, which connects on the first event
+func NewSyslogSink(options SyslogSinkOptions) (*SyslogSink, error) {
+	if options.Address == "" {
+		return nil, fmt.Errorf("missing address of audit syslog sink")
+	}
+	switch options.Format {
+	case "":
+		options.Format = FormatRFC5424
+	case FormatRFC5424, FormatCEF:
+	default:
+		return nil, fmt.Errorf("unknown audit syslog format [%s]", options.Format)
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+	return &SyslogSink{options: options, hostname: hostname}, nil
+}
+
+// Write sends the event, reconnecting once if the connection was lost
+func (sink *SyslogSink) Write(ctx context.Context, event *Event) error {
+	message := sink.format(event)
+	frame := []byte(strconv.Itoa(len(message)) + " " + message)
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	err := sink.send(ctx, frame)
+	if err != nil && sink.conn != nil {
+		sink.conn.Close()
+		sink.conn = nil
+		err = sink.send(ctx, frame)
+	}
+	return err
+}
+
+func (sink *SyslogSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.conn == nil {
+		return nil
+	}
+	err := sink.conn.Close()
+	sink.conn = nil
+	return err
+}
+
+func (sink *SyslogSink) send(ctx context.Context, frame []byte) error {
+	if sink.conn == nil {
+		var err error
+		if sink.options.TLS != nil {
+			dialer := &tls.Dialer{Config: sink.options.TLS}
+			sink.conn, err = dialer.DialContext(ctx, "tcp", sink.options.Address)
+		} else {
+			var dialer net.Dialer
+			sink.conn, err = dialer.DialContext(ctx, "tcp", sink.options.Address)
+		}
+		if err != nil {
+			sink.conn = nil
+			return fmt.Errorf("cannot connect to syslog [%s]: %w", sink.options.Address, err)
+		}
+	}
+	sink.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+	_, err := sink.conn.Write(frame)
+	return err
+}
+
+// format returns the RFC 5424 message of the event
+func (sink *SyslogSink) format(event *Event) string {
+	severity := syslogSeverityNotice
+	if event.Outcome == OutcomeFailure {
+		severity = syslogSeverityWarning
+	}
+	appName := headerValue(event.Service)
+	header := fmt.Sprintf("<%d>1 %s %s %s - %s", syslogFacilityAuthPriv*8+severity,
+		event.Time.UTC().Format(time.RFC3339Nano), headerValue(sink.hostname), appName, headerValue(event.Action))
+	if sink.options.Format == FormatCEF {
+		return header + " - " + sink.formatCEF(event, severity)
+	}
+	return header + " " + structuredData(event) + " " + event.Action
+}
+
+// structuredData returns the event as RFC 5424 structured data element
+func structuredData(event *Event) string {
+	var data strings.Builder
+	data.WriteString("[" + StructuredDataID)
+	param := func(name, value string) {
+		if value != "" {
+			escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+			fmt.Fprintf(&data, ` %s="%s"`, name, escaped)
+		}
+	}
+	param("actor", event.Actor)
+	param("action", event.Action)
+	param("resource", event.Resource)
+	param("outcome", event.Outcome)
+	param("requestId", event.RequestID)
+	param("traceId", event.TraceID)
+	param("callerService", event.CallerService)
+	names := make([]string, 0, len(event.Details))
+	for name := range event.Details {
+		// PARAM-NAME must not contain these characters
+		if !strings.ContainsAny(name, `= ]"`) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param(name, fmt.Sprint(event.Details[name]))
+	}
+	data.WriteString("]")
+	return data.String()
+}
+
+// formatCEF returns the event in ArcSight Common Event Format
+func (sink *SyslogSink) formatCEF(event *Event, severity int) string {
+	escapeHeader := strings.NewReplacer(`\`, `\\`, `|`, `\|`).Replace
+	escapeExtension := strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\n", `\n`, "\r", `\r`).Replace
+
+	product := sink.options.Product
+	if product == "" {
+		product = event.Service
+	}
+	// CEF severity is 0-10, map notice to 3 and warning to 6
+	cefSeverity := 3
+	if severity == syslogSeverityWarning {
+		cefSeverity = 6
+	}
+
+	var extension []string
+	add := func(key, value string) {
+		if value != "" {
+			extension = append(extension, key+"="+escapeExtension(value))
+		}
+	}
+	add("rt", strconv.FormatInt(event.Time.UnixMilli(), 10))
+	add("suser", event.Actor)
+	add("act", event.Action)
+	add("outcome", event.Outcome)
+	if event.Resource != "" {
+		add("cs1Label", "resource")
+		add("cs1", event.Resource)
+	}
+	if event.RequestID != "" {
+		add("cs2Label", "requestId")
+		add("cs2", event.RequestID)
+	}
+	if event.TraceID != "" {
+		add("cs3Label", "traceId")
+		add("cs3", event.TraceID)
+	}
+	add("sproc", event.CallerService)
+
+	return fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|%s",
+		escapeHeader(sink.options.Vendor), escapeHeader(product), escapeHeader(apputil.GetVersion()),
+		escapeHeader(event.Action), escapeHeader(event.Action), cefSeverity, strings.Join(extension, " "))
+}
+
+// headerValue returns value as RFC 5424 header field, i.e. without spaces or "-" if empty
+func headerValue(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return strings.ReplaceAll(value, " ", "_")
+}
@@ -0,0 +1,131 @@
+// Package blobutil provides object storage backed by S3 compatible services or the filesystem
+package blobutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/spf13/viper"
+)
+
+// config keys of NewStoreFromConfig
+const (
+	typeConfigKey       = "blob.type"
+	pathConfigKey       = "blob.path"
+	endpointConfigKey   = "blob.endpoint"
+	bucketConfigKey     = "blob.bucket"
+	regionConfigKey     = "blob.region"
+	accessKeyConfigKey  = "blob.accesskey"
+	secretKeyConfigKey  = "blob.secretkey"
+	tlsConfigKey        = "blob.tls"
+	encryptionConfigKey = "blob.encryption"
+	kmsKeyIDConfigKey   = "blob.kmskeyid"
+	partSizeConfigKey   = "blob.partsize"
+)
+
+func init() {
+	apputil.RegisterConfigKeys("blobutil",
+		apputil.ConfigKey{Key: typeConfigKey, Type: "string", Default: "s3", Description: "s3 or fs"},
+		apputil.ConfigKey{Key: pathConfigKey, Type: "string", Description: "fs: base directory of the blobs"},
+		apputil.ConfigKey{Key: endpointConfigKey, Type: "string", Description: "s3: endpoint, e.g. minio:9000"},
+		apputil.ConfigKey{Key: bucketConfigKey, Type: "string", Description: "s3: bucket"},
+		apputil.ConfigKey{Key: regionConfigKey, Type: "string", Description: "s3: region"},
+		apputil.ConfigKey{Key: accessKeyConfigKey, Type: "string", Description: "s3: access key"},
+		apputil.ConfigKey{Key: secretKeyConfigKey, Type: "string", Description: "s3: secret key"},
+		apputil.ConfigKey{Key: tlsConfigKey, Type: "bool", Default: "true", Description: "s3: connect via TLS"},
+		apputil.ConfigKey{Key: encryptionConfigKey, Type: "string", Description: "s3: server side encryption, sse-s3 or sse-kms"},
+		apputil.ConfigKey{Key: kmsKeyIDConfigKey, Type: "string", Description: "s3: KMS key for sse-kms"},
+		apputil.ConfigKey{Key: partSizeConfigKey, Type: "bytesize", Description: "s3: part size of multipart uploads"},
+	)
+}
+
+// ErrNotFound is returned if an object does not exist
+var ErrNotFound = errors.New("object not found")
+
+var logger = apputil.Named("blobutil")
+
+// ObjectInfo describes a stored object
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+}
+
+// PutOptions configures Store.Put. It is an alias of a struct type, so other
+// packages can declare interfaces Store satisfies without importing blobutil,
+// e.g. amqputil.ClaimStore.
+type PutOptions = struct {
+	ContentType string
+	Metadata    map[string]string
+}
+
+// Store stores objects by key
+type Store interface {
+	// Put stores the content of reader. If size is -1, the content is streamed
+	// in parts without knowing its size in advance.
+	Put(ctx context.Context, key string, reader io.Reader, size int64, options PutOptions) error
+	// Get returns the content of the object, which must be closed, or ErrNotFound
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Stat returns the info of the object or ErrNotFound
+	Stat(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object, deleting a missing object is no error
+	Delete(ctx context.Context, key string) error
+	// List returns the objects with keys starting with prefix, sorted by key
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	// PresignGet returns a URL to download the object without credentials until expiry
+	PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+	// PresignPut returns a URL to upload the object without credentials until expiry
+	PresignPut(ctx context.Context, key string, expiry time.Duration) (*url.URL, error)
+}
+
+// NewStoreFromConfig creates the Store configured by blob.type, which is s3
+// (default, see S3Options for the keys) or fs, storing objects below blob.path
+func NewStoreFromConfig() (Store, error) {
+	switch storeType := viper.GetString(typeConfigKey); storeType {
+	case "", "s3":
+		options, err := s3OptionsFromConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewS3Store(options)
+	case "fs":
+		path := viper.GetString(pathConfigKey)
+		if path == "" {
+			return nil, fmt.Errorf("missing config [%s]", pathConfigKey)
+		}
+		return NewFileStore(path)
+	default:
+		return nil, fmt.Errorf("unknown blob store type [%s]", storeType)
+	}
+}
+
+func s3OptionsFromConfig() (S3Options, error) {
+	options := S3Options{
+		Endpoint:   viper.GetString(endpointConfigKey),
+		Bucket:     viper.GetString(bucketConfigKey),
+		Region:     viper.GetString(regionConfigKey),
+		AccessKey:  viper.GetString(accessKeyConfigKey),
+		SecretKey:  viper.GetString(secretKeyConfigKey),
+		UseTLS:     !viper.IsSet(tlsConfigKey) || viper.GetBool(tlsConfigKey),
+		Encryption: Encryption(viper.GetString(encryptionConfigKey)),
+		KMSKeyID:   viper.GetString(kmsKeyIDConfigKey),
+	}
+	for _, key := range []string{endpointConfigKey, bucketConfigKey} {
+		if viper.GetString(key) == "" {
+			return options, fmt.Errorf("missing config [%s]", key)
+		}
+	}
+	partSize, err := apputil.GetByteSize(partSizeConfigKey, 0)
+	if err != nil {
+		return options, err
+	}
+	options.PartSize = uint64(partSize)
+	return options, nil
+}
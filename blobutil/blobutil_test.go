@@ -0,0 +1,47 @@
+package blobutil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for _, key := range []string{"reports/b.json", "reports/a.json", "other.txt"} {
+		if err := store.Put(ctx, key, strings.NewReader(`{"id":1}`), -1, PutOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader, err := store.Get(ctx, "reports/a.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(content) != `{"id":1}` {
+		t.Errorf("unexpected content %q", content)
+	}
+
+	objects, err := store.List(ctx, "reports/")
+	if err != nil || len(objects) != 2 || objects[0].Key != "reports/a.json" || objects[0].ContentType != "application/json" {
+		t.Errorf("unexpected objects %+v, %v", objects, err)
+	}
+
+	if err := store.Delete(ctx, "reports/a.json"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Stat(ctx, "reports/a.json"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected deleted object to be missing, got %v", err)
+	}
+	if _, err := store.Get(ctx, "../escape"); err == nil {
+		t.Error("expected key outside of root to be rejected")
+	}
+}
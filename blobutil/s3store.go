@@ -0,0 +1,154 @@
+package blobutil
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+// Encryption selects the server side encryption of uploaded objects
+type Encryption string
+
+const (
+	EncryptionNone Encryption = ""
+	EncryptionS3   Encryption = "sse-s3"  // keys managed by the storage service
+	EncryptionKMS  Encryption = "sse-kms" // keys managed by a KMS, see S3Options.KMSKeyID
+)
+
+// S3Options configures a S3Store, configured by blob.endpoint, blob.bucket,
+// blob.region, blob.accesskey, blob.secretkey, blob.tls (default true),
+// blob.encryption, blob.kmskeyid and blob.partsize for NewStoreFromConfig
+type S3Options struct {
+	Endpoint   string // host:port, e.g. s3.eu-central-1.amazonaws.com or minio:9000
+	Bucket     string
+	Region     string
+	AccessKey  string // static credentials, credentials are taken from the environment if empty
+	SecretKey  string
+	UseTLS     bool
+	Encryption Encryption
+	KMSKeyID   string
+	PartSize   uint64 // size of parts of multipart uploads, chosen by the client if 0
+}
+
+// S3Store stores objects in a bucket of a S3 compatible service like AWS S3 or MinIO
+type S3Store struct {
+	client  *minio.Client
+	options S3Options
+	sse     encrypt.ServerSide
+}
+
+// NewS3Store creates a S3Store. The bucket must exist.
+func NewS3Store(options S3Options) (*S3Store, error) {
+	creds := credentials.NewChainCredentials([]credentials.Provider{&credentials.EnvAWS{}, &credentials.EnvMinio{}, &credentials.IAM{}})
+	if options.AccessKey != "" {
+		creds = credentials.NewStaticV4(options.AccessKey, options.SecretKey, "")
+	}
+	client, err := minio.New(options.Endpoint, &minio.Options{Creds: creds, Secure: options.UseTLS, Region: options.Region})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client for [%s] [%w]", options.Endpoint, err)
+	}
+
+	store := &S3Store{client: client, options: options}
+	switch options.Encryption {
+	case EncryptionNone:
+	case EncryptionS3:
+		store.sse = encrypt.NewSSE()
+	case EncryptionKMS:
+		if store.sse, err = encrypt.NewSSEKMS(options.KMSKeyID, nil); err != nil {
+			return nil, fmt.Errorf("invalid KMS encryption config [%w]", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption [%s]", options.Encryption)
+	}
+	logger.Debugf("Created S3 store for bucket [%s] at [%s]", options.Bucket, options.Endpoint)
+	return store, nil
+}
+
+// Client returns the underlying client for operations not covered by S3Store
+func (store *S3Store) Client() *minio.Client {
+	return store.client
+}
+
+func (store *S3Store) Put(ctx context.Context, key string, reader io.Reader, size int64, options PutOptions) error {
+	_, err := store.client.PutObject(ctx, store.options.Bucket, key, reader, size, minio.PutObjectOptions{
+		ContentType:          options.ContentType,
+		UserMetadata:         options.Metadata,
+		ServerSideEncryption: store.sse,
+		PartSize:             store.options.PartSize,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put object [%s] [%w]", key, err)
+	}
+	return nil
+}
+
+func (store *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	// GetObject does not send a request, so check existence first to return ErrNotFound
+	if _, err := store.Stat(ctx, key); err != nil {
+		return nil, err
+	}
+	object, err := store.client.GetObject(ctx, store.options.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object [%s] [%w]", key, err)
+	}
+	return object, nil
+}
+
+func (store *S3Store) Stat(ctx context.Context, key string) (ObjectInfo, error) {
+	info, err := store.client.StatObject(ctx, store.options.Bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, convertError(key, err)
+	}
+	return ObjectInfo{Key: info.Key, Size: info.Size, LastModified: info.LastModified, ContentType: info.ContentType}, nil
+}
+
+func (store *S3Store) Delete(ctx context.Context, key string) error {
+	if err := store.client.RemoveObject(ctx, store.options.Bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete object [%s] [%w]", key, err)
+	}
+	return nil
+}
+
+func (store *S3Store) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for info := range store.client.ListObjects(ctx, store.options.Bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list objects with prefix [%s] [%w]", prefix, info.Err)
+		}
+		objects = append(objects, ObjectInfo{Key: info.Key, Size: info.Size, LastModified: info.LastModified, ContentType: info.ContentType})
+	}
+	return objects, nil
+}
+
+func (store *S3Store) PresignGet(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return store.client.PresignedGetObject(ctx, store.options.Bucket, key, expiry, nil)
+}
+
+func (store *S3Store) PresignPut(ctx context.Context, key string, expiry time.Duration) (*url.URL, error) {
+	return store.client.PresignedPutObject(ctx, store.options.Bucket, key, expiry)
+}
+
+// HealthCheck verifies the bucket exists and is accessible, e.g. as healthutil.Check
+func (store *S3Store) HealthCheck(ctx context.Context) error {
+	exists, err := store.client.BucketExists(ctx, store.options.Bucket)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("bucket [%s] does not exist", store.options.Bucket)
+	}
+	return nil
+}
+
+func convertError(key string, err error) error {
+	if response := minio.ToErrorResponse(err); response.Code == "NoSuchKey" || response.StatusCode == 404 {
+		return ErrNotFound
+	}
+	return fmt.Errorf("failed to access object [%s] [%w]", key, err)
+}
@@ -0,0 +1,149 @@
+package cacheutil
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestCodecs(t *testing.T) {
+	data, err := ProtoCodec{}.Marshal(wrapperspb.String("cached"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &wrapperspb.StringValue{}
+	if err := (ProtoCodec{}).Unmarshal(data, decoded); err != nil || decoded.Value != "cached" {
+		t.Errorf("expected decoded proto message, got %v, %v", decoded, err)
+	}
+	if _, err := (ProtoCodec{}).Marshal("no message"); err == nil {
+		t.Error("expected error encoding a non proto message")
+	}
+
+	var value map[string]int
+	data, _ = JSONCodec{}.Marshal(map[string]int{"a": 1})
+	if err := (JSONCodec{}).Unmarshal(data, &value); err != nil || value["a"] != 1 {
+		t.Errorf("expected decoded JSON, got %v, %v", value, err)
+	}
+}
+
+func TestRedisCacheUnavailable(t *testing.T) {
+	cache := NewRedisCache(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, nil)
+	defer cache.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var value string
+	if err := cache.Get(ctx, "key", &value); err == nil || errors.Is(err, ErrCacheMiss) {
+		t.Errorf("expected connection error, got %v", err)
+	}
+	if err := cache.HealthCheck(ctx); err == nil {
+		t.Error("expected failing health check")
+	}
+}
+
+func TestMemoryExpiresAndEvicts(t *testing.T) {
+	cache := NewMemory[string, int]("test", time.Minute, 2)
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Get("a")
+	cache.Set("c", 3)
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected least recently used entry to be evicted")
+	}
+	if value, ok := cache.Get("a"); !ok || value != 1 {
+		t.Errorf("expected cached value, got %v, %v", value, ok)
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := cache.Get("a"); ok {
+		t.Error("expected entry to be expired")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("expected 1 entry, got %d", cache.Len())
+	}
+}
+
+func TestMemoryGetOrLoadDeduplicates(t *testing.T) {
+	cache := NewMemory[string, string]("test", 0, 0)
+	loads := 0
+	release := make(chan struct{})
+	load := func(ctx context.Context) (string, error) {
+		loads++
+		<-release
+		return "loaded", nil
+	}
+
+	results := make(chan string)
+	for i := 0; i < 3; i++ {
+		go func() {
+			value, _ := cache.GetOrLoad(context.Background(), "key", load)
+			results <- value
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	for i := 0; i < 3; i++ {
+		if value := <-results; value != "loaded" {
+			t.Errorf("expected loaded value, got %q", value)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("expected a single load, got %d", loads)
+	}
+
+	failing := func(ctx context.Context) (string, error) { return "", errors.New("failed") }
+	if _, err := cache.GetOrLoad(context.Background(), "other", failing); err == nil {
+		t.Error("expected load error")
+	}
+	if _, ok := cache.Get("other"); ok {
+		t.Error("expected failed load not to be cached")
+	}
+}
+
+func TestMemoryGetOrLoadPanics(t *testing.T) {
+	cache := NewMemory[string, string]("test", 0, 0)
+	release := make(chan struct{})
+	panicking := func(ctx context.Context) (string, error) {
+		<-release
+		panic("broken loader")
+	}
+
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- recover() }()
+		cache.GetOrLoad(context.Background(), "key", panicking)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	waited := make(chan error)
+	go func() {
+		_, err := cache.GetOrLoad(context.Background(), "key", panicking)
+		waited <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+
+	if recovered := <-panicked; recovered != "broken loader" {
+		t.Errorf("expected panic to be passed on, got %v", recovered)
+	}
+	select {
+	case err := <-waited:
+		if err == nil || !strings.Contains(err.Error(), "panicked") {
+			t.Errorf("expected waiter to fail, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter hangs after the load panicked")
+	}
+
+	value, err := cache.GetOrLoad(context.Background(), "key", func(ctx context.Context) (string, error) { return "loaded", nil })
+	if err != nil || value != "loaded" {
+		t.Errorf("expected key to be loaded again, got %q, %v", value, err)
+	}
+}
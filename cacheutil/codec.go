@@ -0,0 +1,44 @@
+package cacheutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Codec encodes cached values
+type Codec interface {
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, value interface{}) error
+}
+
+// JSONCodec encodes values as JSON
+type JSONCodec struct{}
+
+func (JSONCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec) Unmarshal(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+// ProtoCodec encodes values, which must be proto.Message, in protobuf binary format
+type ProtoCodec struct{}
+
+func (ProtoCodec) Marshal(value interface{}) ([]byte, error) {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("cannot encode %T, proto.Message required", value)
+	}
+	return proto.Marshal(message)
+}
+
+func (ProtoCodec) Unmarshal(data []byte, value interface{}) error {
+	message, ok := value.(proto.Message)
+	if !ok {
+		return fmt.Errorf("cannot decode into %T, proto.Message required", value)
+	}
+	return proto.Unmarshal(data, message)
+}
@@ -0,0 +1,196 @@
+package cacheutil
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Memory is an in-process cache with expiry and least recently used eviction,
+// e.g. for hot lookups not worth a Redis roundtrip. It is safe for concurrent use.
+type Memory[K comparable, V any] struct {
+	name       string
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mutex   sync.Mutex
+	entries map[K]*list.Element
+	lru     *list.List
+	loads   map[K]*memoryLoad[V]
+}
+
+type memoryEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// memoryLoad is a running loader call, which concurrent GetOrLoad calls for the same key wait for
+type memoryLoad[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+}
+
+// NewMemory creates a Memory cache reported as name in the cache metrics. Entries
+// expire after ttl unless ttl is 0. If more than maxEntries are cached, the least
+// recently used entries are evicted, unless maxEntries is 0.
+func NewMemory[K comparable, V any](name string, ttl time.Duration, maxEntries int) *Memory[K, V] {
+	return &Memory[K, V]{
+		name:       name,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[K]*list.Element),
+		lru:        list.New(),
+		loads:      make(map[K]*memoryLoad[V]),
+	}
+}
+
+// Get returns the value cached for key and whether it was found
+func (cache *Memory[K, V]) Get(key K) (V, bool) {
+	cache.mutex.Lock()
+	value, ok := cache.get(key)
+	cache.mutex.Unlock()
+	cache.observe("get", ok)
+	return value, ok
+}
+
+// Set caches value for key with the default ttl
+func (cache *Memory[K, V]) Set(key K, value V) {
+	cache.SetWithTTL(key, value, cache.ttl)
+}
+
+// SetWithTTL caches value for key, which expires after ttl unless ttl is 0
+func (cache *Memory[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.set(key, value, ttl)
+}
+
+// Delete removes the given keys from the cache
+func (cache *Memory[K, V]) Delete(keys ...K) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for _, key := range keys {
+		if element, ok := cache.entries[key]; ok {
+			cache.remove(element)
+		}
+	}
+}
+
+// Len returns the number of cached entries including expired ones not yet removed
+func (cache *Memory[K, V]) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.lru.Len()
+}
+
+// Clear removes all entries
+func (cache *Memory[K, V]) Clear() {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	cache.entries = make(map[K]*list.Element)
+	cache.lru.Init()
+}
+
+// GetOrLoad returns the value cached for key or caches and returns the value
+// returned by load. Concurrent calls for the same key share a single load call.
+// Errors of load are returned and not cached. If load panics, the panic is
+// passed on and the calls waiting for it return an error.
+func (cache *Memory[K, V]) GetOrLoad(ctx context.Context, key K, load func(ctx context.Context) (V, error)) (V, error) {
+	cache.mutex.Lock()
+	if value, ok := cache.get(key); ok {
+		cache.mutex.Unlock()
+		cache.observe("get", true)
+		return value, nil
+	}
+	running, ok := cache.loads[key]
+	if !ok {
+		running = &memoryLoad[V]{done: make(chan struct{})}
+		cache.loads[key] = running
+	}
+	cache.mutex.Unlock()
+	cache.observe("get", false)
+
+	if ok {
+		select {
+		case <-running.done:
+			return running.value, running.err
+		case <-ctx.Done():
+			var zero V
+			return zero, ctx.Err()
+		}
+	}
+
+	defer func() {
+		recovered := recover()
+		if recovered != nil {
+			running.err = fmt.Errorf("loading cache entry [%v] panicked: %v", key, recovered)
+		}
+		cache.mutex.Lock()
+		if running.err == nil {
+			cache.set(key, running.value, cache.ttl)
+		}
+		delete(cache.loads, key)
+		cache.mutex.Unlock()
+		close(running.done)
+		if recovered != nil {
+			panic(recovered)
+		}
+	}()
+	running.value, running.err = load(ctx)
+	return running.value, running.err
+}
+
+// get returns an unexpired entry and marks it as recently used, the mutex must be held
+func (cache *Memory[K, V]) get(key K) (V, bool) {
+	element, ok := cache.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	entry := element.Value.(*memoryEntry[K, V])
+	if !entry.expires.IsZero() && !cache.now().Before(entry.expires) {
+		cache.remove(element)
+		var zero V
+		return zero, false
+	}
+	cache.lru.MoveToFront(element)
+	return entry.value, true
+}
+
+// set adds or replaces an entry and evicts the least recently used ones, the mutex must be held
+func (cache *Memory[K, V]) set(key K, value V, ttl time.Duration) {
+	var expires time.Time
+	if ttl > 0 {
+		expires = cache.now().Add(ttl)
+	}
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*memoryEntry[K, V])
+		entry.value, entry.expires = value, expires
+		cache.lru.MoveToFront(element)
+		return
+	}
+	cache.entries[key] = cache.lru.PushFront(&memoryEntry[K, V]{key: key, value: value, expires: expires})
+	for cache.maxEntries > 0 && cache.lru.Len() > cache.maxEntries {
+		cache.remove(cache.lru.Back())
+		cacheEvictions.WithLabelValues(cache.name).Inc()
+	}
+}
+
+func (cache *Memory[K, V]) remove(element *list.Element) {
+	cache.lru.Remove(element)
+	delete(cache.entries, element.Value.(*memoryEntry[K, V]).key)
+}
+
+func (cache *Memory[K, V]) observe(operation string, hit bool) {
+	result := resultMiss
+	if hit {
+		result = resultHit
+	}
+	cacheRequests.WithLabelValues(cache.name, operation, result).Inc()
+}
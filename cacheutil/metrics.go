@@ -0,0 +1,30 @@
+package cacheutil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// results of cache requests
+const (
+	resultHit   = "hit"
+	resultMiss  = "miss"
+	resultOK    = "ok"
+	resultError = "error"
+)
+
+var (
+	cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_requests_total",
+		Help: "The total number of cache requests by cache, operation and result",
+	}, []string{"cache", "operation", "result"})
+	cacheRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cache_request_duration_seconds",
+		Help:    "The duration of remote cache requests",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+	}, []string{"cache", "operation"})
+	cacheEvictions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "cache_evictions_total",
+		Help: "The total number of entries evicted from in-memory caches because they were full",
+	}, []string{"cache"})
+)
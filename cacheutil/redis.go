@@ -0,0 +1,156 @@
+// Package cacheutil provides caches backed by Redis or process memory
+package cacheutil
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+)
+
+// ErrCacheMiss is returned by Get if the key is not cached
+var ErrCacheMiss = errors.New("cache miss")
+
+// config keys of NewRedisCacheFromConfig
+const (
+	redisAddressConfigKey  = "redis.address"
+	redisPasswordConfigKey = "redis.password"
+	redisDBConfigKey       = "redis.db"
+	redisTLSConfigKey      = "redis.tls"
+	redisPoolSizeConfigKey = "redis.poolsize"
+	redisPrefixConfigKey   = "redis.prefix"
+)
+
+func init() {
+	apputil.RegisterConfigKeys("cacheutil",
+		apputil.ConfigKey{Key: redisAddressConfigKey, Type: "string", Description: "Redis address, e.g. redis:6379"},
+		apputil.ConfigKey{Key: redisPasswordConfigKey, Type: "string", Description: "Redis password"},
+		apputil.ConfigKey{Key: redisDBConfigKey, Type: "int", Default: "0", Description: "Redis database"},
+		apputil.ConfigKey{Key: redisTLSConfigKey, Type: "bool", Default: "false", Description: "connect via TLS"},
+		apputil.ConfigKey{Key: redisPoolSizeConfigKey, Type: "int", Default: "10 per CPU", Description: "connection pool size"},
+		apputil.ConfigKey{Key: redisPrefixConfigKey, Type: "string", Description: "prefix of all keys"},
+	)
+}
+
+var logger = apputil.Named("cacheutil")
+
+// RedisCache stores values encoded by a Codec in Redis
+type RedisCache struct {
+	client *redis.Client
+	codec  Codec
+	prefix string
+	name   string
+}
+
+// NewRedisCacheFromConfig creates a RedisCache configured by redis.address,
+// redis.password, redis.db, redis.tls, redis.poolsize (default 10 per CPU) and
+// redis.prefix, which is prepended to all keys. codec defaults to JSONCodec.
+func NewRedisCacheFromConfig(codec Codec) (*RedisCache, error) {
+	address := viper.GetString(redisAddressConfigKey)
+	if address == "" {
+		return nil, fmt.Errorf("missing config [%s]", redisAddressConfigKey)
+	}
+	options := &redis.Options{
+		Addr:     address,
+		Password: viper.GetString(redisPasswordConfigKey),
+		DB:       viper.GetInt(redisDBConfigKey),
+		PoolSize: viper.GetInt(redisPoolSizeConfigKey),
+	}
+	if viper.GetBool(redisTLSConfigKey) {
+		options.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	cache := NewRedisCache(options, codec)
+	cache.prefix = viper.GetString(redisPrefixConfigKey)
+	return cache, nil
+}
+
+// NewRedisCache creates a RedisCache with the given client options. codec defaults to JSONCodec.
+func NewRedisCache(options *redis.Options, codec Codec) *RedisCache {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
+	logger.Debugf("Creating Redis client for [%s]", options.Addr)
+	return &RedisCache{client: redis.NewClient(options), codec: codec, name: "redis"}
+}
+
+// Client returns the underlying client for operations not covered by RedisCache
+func (cache *RedisCache) Client() *redis.Client {
+	return cache.client
+}
+
+// Get decodes the value cached for key into value or returns ErrCacheMiss
+func (cache *RedisCache) Get(ctx context.Context, key string, value interface{}) error {
+	start := time.Now()
+	data, err := cache.client.Get(ctx, cache.prefix+key).Bytes()
+	cache.observe("get", start, err)
+	if errors.Is(err, redis.Nil) {
+		return ErrCacheMiss
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get [%s] from cache [%w]", key, err)
+	}
+	if err := cache.codec.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to decode [%s] from cache [%w]", key, err)
+	}
+	return nil
+}
+
+// Set caches value for key, which expires after ttl unless ttl is 0
+func (cache *RedisCache) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) error {
+	data, err := cache.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode [%s] for cache [%w]", key, err)
+	}
+	start := time.Now()
+	err = cache.client.Set(ctx, cache.prefix+key, data, ttl).Err()
+	cache.observe("set", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to set [%s] in cache [%w]", key, err)
+	}
+	return nil
+}
+
+// Delete removes the given keys from the cache
+func (cache *RedisCache) Delete(ctx context.Context, keys ...string) error {
+	prefixed := make([]string, len(keys))
+	for index, key := range keys {
+		prefixed[index] = cache.prefix + key
+	}
+	start := time.Now()
+	err := cache.client.Del(ctx, prefixed...).Err()
+	cache.observe("delete", start, err)
+	if err != nil {
+		return fmt.Errorf("failed to delete %v from cache [%w]", keys, err)
+	}
+	return nil
+}
+
+// HealthCheck pings Redis, e.g. as serviceutil.Service readiness check
+func (cache *RedisCache) HealthCheck(ctx context.Context) error {
+	return cache.client.Ping(ctx).Err()
+}
+
+// Close closes the client
+func (cache *RedisCache) Close() error {
+	return cache.client.Close()
+}
+
+func (cache *RedisCache) observe(operation string, start time.Time, err error) {
+	cacheRequestDuration.WithLabelValues(cache.name, operation).Observe(time.Since(start).Seconds())
+	result := resultOK
+	switch {
+	case operation == "get" && err == nil:
+		result = resultHit
+	case errors.Is(err, redis.Nil):
+		result = resultMiss
+	case err != nil:
+		result = resultError
+	}
+	cacheRequests.WithLabelValues(cache.name, operation, result).Inc()
+}
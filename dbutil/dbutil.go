@@ -9,8 +9,8 @@ import (
 	"time"
 
 	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/shutdownutil"
 
-	"github.com/apex/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 
@@ -30,7 +30,7 @@ const (
 )
 
 var (
-	logger         = apputil.InitLogging()
+	logger         = apputil.Named("dbutil")
 	activeContexts = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "active_db_contexts",
 		Help: "The total number active db contexts",
@@ -87,26 +87,9 @@ type Query struct {
 // ctx allows optional context cancellation if not nil
 // DbContext.Err and any transaction are resetted
 func (helper *DbConnectionHelper) GetDbContext(ctx *context.Context, useTransaction bool) (dbContext *DbContext) {
-	helper.lock.Lock()
 	dbContext = &DbContext{ctx: ctx}
-	func() {
-		defer helper.lock.Unlock()
-
-		dbConnectionURL := helper.DbConnectionURL
-
-		log.Debugf("Get DbContext for URL [%v]", dbConnectionURL)
-
-		dbContext.db = helper.dbConnection
-		if dbContext.db == nil {
-			if dbContext.db, dbContext.err = getDBConnection(dbConnectionURL); dbContext.err != nil {
-				return
-			}
-			helper.dbConnection = dbContext.db
-			dbContext.db.SetMaxOpenConns(helper.MaxOpenConns)
-			dbContext.db.SetMaxIdleConns(helper.MaxIdleConns)
-			dbContext.db.SetConnMaxLifetime(time.Duration(helper.ConnMaxLifeTime) * time.Second)
-		}
-	}()
+	logger.Debugf("Get DbContext for URL [%v]", helper.DbConnectionURL)
+	dbContext.db, dbContext.err = helper.connection()
 
 	if useTransaction {
 		//open transaction with/without cancellation context
@@ -124,6 +107,53 @@ func (helper *DbConnectionHelper) GetDbContext(ctx *context.Context, useTransact
 	return dbContext
 }
 
+// connection returns the shared connection pool, which is opened on first use
+func (helper *DbConnectionHelper) connection() (*sql.DB, error) {
+	helper.lock.Lock()
+	defer helper.lock.Unlock()
+
+	if helper.dbConnection == nil {
+		db, err := getDBConnection(helper.DbConnectionURL)
+		if err != nil {
+			return nil, err
+		}
+		helper.dbConnection = db
+		db.SetMaxOpenConns(helper.MaxOpenConns)
+		db.SetMaxIdleConns(helper.MaxIdleConns)
+		db.SetConnMaxLifetime(time.Duration(helper.ConnMaxLifeTime) * time.Second)
+	}
+	return helper.dbConnection, nil
+}
+
+// SetConnectionURL replaces the connection URL, e.g. after credentials were
+// rotated. The current pool is closed once its queries finished and contexts
+// obtained afterwards use a new pool.
+func (helper *DbConnectionHelper) SetConnectionURL(url string) {
+	helper.lock.Lock()
+	defer helper.lock.Unlock()
+
+	helper.DbConnectionURL = url
+	if previous := helper.dbConnection; previous != nil {
+		helper.dbConnection = nil
+		go previous.Close()
+	}
+}
+
+// DB returns the shared connection pool, e.g. for operations needing a
+// dedicated connection via sql.DB.Conn
+func (helper *DbConnectionHelper) DB() (*sql.DB, error) {
+	return helper.connection()
+}
+
+// HealthCheck pings the DB, e.g. as healthutil.Check
+func (helper *DbConnectionHelper) HealthCheck(ctx context.Context) error {
+	db, err := helper.connection()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
 // CloseContexts closes all open db connections
 func (helper *DbConnectionHelper) CloseContexts() {
 	helper.lock.Lock()
@@ -135,6 +165,14 @@ func (helper *DbConnectionHelper) CloseContexts() {
 	}
 }
 
+// RegisterShutdown closes the connections of helper in shutdownutil.PhaseConnections
+func (helper *DbConnectionHelper) RegisterShutdown(name string) {
+	shutdownutil.Register(name, shutdownutil.PhaseConnections, 0, func(ctx context.Context) error {
+		helper.CloseContexts()
+		return nil
+	})
+}
+
 // RegisterErrorHandler registers function as error handler to call in case
 // DbContext.Err is set. Any previous handler is overwritten.
 func (dbContext *DbContext) RegisterErrorHandler(errorHandler func(err error)) {
@@ -151,11 +189,11 @@ func (dbContext *DbContext) handleError() {
 // The operation becomes a no-op if there is a previous error in DbContext.err.
 func (dbContext *DbContext) QueryRow(query string, args ...interface{}) (*sql.Row, error) {
 	if dbContext.err != nil {
-		log.Errorf("Skipping QueryRow due to previous error [%v]", dbContext.err)
+		logger.Errorf("Skipping QueryRow due to previous error [%v]", dbContext.err)
 		return nil, SKIP_ERROR
 	}
 
-	log.Debugf("Executing SQL [%v] with args %v", query, args)
+	logger.Debugf("Executing SQL [%v] with args %v", query, args)
 	row := dbContext.db.QueryRow(query, args...)
 
 	dbContext.handleError()
@@ -168,11 +206,11 @@ func (dbContext *DbContext) QueryRow(query string, args ...interface{}) (*sql.Ro
 // If supressErrNoRows and error occurrs, destination value are reset to ""
 func (dbContext *DbContext) ScanQueryRow(supressErrNoRows bool, query Query, destination []interface{}) error {
 	if dbContext.err != nil {
-		log.Errorf("Skipping QueryRow [%v] due to previous error [%v]", query, dbContext.err)
+		logger.Errorf("Skipping QueryRow [%v] due to previous error [%v]", query, dbContext.err)
 		return SKIP_ERROR
 	}
 
-	log.Debugf("Executing SQL [%v] with args %v", query, query.Args)
+	logger.Debugf("Executing SQL [%v] with args %v", query, query.Args)
 	var row *sql.Row
 	if query.Args != nil {
 		row = dbContext.db.QueryRow(query.Query, query.Args...)
@@ -203,11 +241,11 @@ func (dbContext *DbContext) ScanQueryRow(supressErrNoRows bool, query Query, des
 // The operation becomes a no-op if there is a previous error in DbContext.err.
 func (dbContext *DbContext) Query(query string, args ...interface{}) (RowsAccessor, error) {
 	if dbContext.err != nil {
-		log.Errorf("Skipping Query [%v] due to previous error [%v]", query, dbContext.err)
+		logger.Errorf("Skipping Query [%v] due to previous error [%v]", query, dbContext.err)
 		return nil, SKIP_ERROR
 	}
 
-	log.Debugf("Executing SQL [%v] with args %v", query, args)
+	logger.Debugf("Executing SQL [%v] with args %v", query, args)
 
 	dbContext.handleError()
 	var rows *sql.Rows
@@ -219,11 +257,11 @@ func (dbContext *DbContext) Query(query string, args ...interface{}) (RowsAccess
 // The operation becomes a no-op if there is a previous error in DbContext.err
 func (dbContext *DbContext) Execute(query string, args ...interface{}) error {
 	if dbContext.err != nil {
-		log.Errorf("Skipping Execute [%v] due to previous error [%v]", query, dbContext.err)
+		logger.Errorf("Skipping Execute [%v] due to previous error [%v]", query, dbContext.err)
 		return SKIP_ERROR
 	}
 
-	log.Debugf("Executing SQL [%v] with args %v", query, args)
+	logger.Debugf("Executing SQL [%v] with args %v", query, args)
 
 	// execute in transaction if present
 	if dbContext.tx != nil {
@@ -296,10 +334,10 @@ func (dbContext *DbContext) Rollback(restartTx bool) error {
 func (dbContext *DbContext) Close() error {
 	// commit in case of no error
 	if dbContext.err == nil {
-		log.Debug("Committing transaction")
+		logger.Debug("Committing transaction")
 		dbContext.Commit(false)
 	} else {
-		log.Debugf("Rolling back transaction due to error: %v", dbContext.err)
+		logger.Debugf("Rolling back transaction due to error: %v", dbContext.err)
 		dbContext.Rollback(false)
 	}
 
@@ -317,7 +355,7 @@ func (dbContext *DbContext) Close() error {
 
 // getDBConnection opens a connection to given dbConnectionUrl
 func getDBConnection(dbConnectionURL string) (db *sql.DB, err error) {
-	log.Debugf("Opening DB connection to [%v]", dbConnectionURL)
+	logger.Debugf("Opening DB connection to [%v]", dbConnectionURL)
 	db, err = sql.Open("pgx", dbConnectionURL)
 
 	if err != nil {
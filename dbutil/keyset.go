@@ -0,0 +1,48 @@
+package dbutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keyset paginates queries by the values of unique ordering columns instead of
+// offsets, so pages stay stable while rows are inserted
+type Keyset struct {
+	Columns    []string // result columns ordering the rows, the last one must be unique, e.g. created_at, id
+	Descending bool
+}
+
+// Page wraps query to return up to limit rows after the row with the given
+// column values, or the first page if after is empty. query must not contain
+// ORDER BY or LIMIT clauses and must select the keyset columns.
+func (keyset Keyset) Page(query Query, after []interface{}, limit int) (Query, error) {
+	if len(keyset.Columns) == 0 {
+		return query, fmt.Errorf("keyset without columns")
+	}
+	if len(after) != 0 && len(after) != len(keyset.Columns) {
+		return query, fmt.Errorf("expected %d keyset values but got %d", len(keyset.Columns), len(after))
+	}
+	args := append([]interface{}{}, query.Args...)
+	direction, comparison := "ASC", ">"
+	if keyset.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	var paged strings.Builder
+	fmt.Fprintf(&paged, "SELECT * FROM (%s) AS page", query.Query)
+	if len(after) > 0 {
+		placeholders := make([]string, len(after))
+		for index, value := range after {
+			args = append(args, value)
+			placeholders[index] = fmt.Sprintf("$%d", len(args))
+		}
+		fmt.Fprintf(&paged, " WHERE (%s) %s (%s)", strings.Join(keyset.Columns, ", "), comparison, strings.Join(placeholders, ", "))
+	}
+	order := make([]string, len(keyset.Columns))
+	for index, column := range keyset.Columns {
+		order[index] = column + " " + direction
+	}
+	args = append(args, limit)
+	fmt.Fprintf(&paged, " ORDER BY %s LIMIT $%d", strings.Join(order, ", "), len(args))
+	return Query{Query: paged.String(), Args: args}, nil
+}
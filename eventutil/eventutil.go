@@ -0,0 +1,115 @@
+// Package eventutil publishes and consumes versioned protobuf domain events
+// over AMQP with a transactional outbox and an idempotent inbox in Postgres
+package eventutil
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DefaultExchange is the topic exchange events are published to
+const DefaultExchange = "events"
+
+// ContentType of published events, which are encoded in protobuf binary format
+const ContentType = "application/x-protobuf"
+
+// AMQP headers of published events
+const (
+	TypeHeader   = "event-type"   // full protobuf name of the event message
+	SourceHeader = "event-source" // name of the publishing service
+)
+
+var (
+	logger = apputil.Named("eventutil")
+
+	versionPattern = regexp.MustCompile(`^v[0-9]+$`)
+)
+
+// Metadata describes a received event
+type Metadata struct {
+	ID          string // unique ID of the event, which is the same for redeliveries
+	Type        string
+	Topic       string
+	Source      string
+	Time        time.Time
+	Redelivered bool
+}
+
+// Topic returns the routing key of events of the given message type. Event
+// messages must be defined in a versioned protobuf package, e.g. message
+// OrderCreated in package acme.orders.v1 is published as acme.orders.order_created.v1.
+func Topic(message proto.Message) (string, error) {
+	return topic(message.ProtoReflect().Descriptor())
+}
+
+func topic(descriptor protoreflect.MessageDescriptor) (string, error) {
+	pkg := string(descriptor.ParentFile().Package())
+	index := strings.LastIndex(pkg, ".")
+	if index < 0 || !versionPattern.MatchString(pkg[index+1:]) {
+		return "", fmt.Errorf("event [%s] must be defined in a versioned package like domain.v1", descriptor.FullName())
+	}
+	return pkg[:index] + "." + snakeCase(string(descriptor.Name())) + "." + pkg[index+1:], nil
+}
+
+func snakeCase(name string) string {
+	var builder strings.Builder
+	for index, r := range name {
+		if unicode.IsUpper(r) {
+			if index > 0 {
+				builder.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// encode returns the topic, type and protobuf encoding of message
+func encode(message proto.Message) (string, string, []byte, error) {
+	routingKey, err := Topic(message)
+	if err != nil {
+		return "", "", nil, err
+	}
+	body, err := proto.Marshal(message)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("failed to encode event [%s] [%w]", routingKey, err)
+	}
+	return routingKey, string(message.ProtoReflect().Descriptor().FullName()), body, nil
+}
+
+// newPublishing wraps an encoded event
+func newPublishing(id, source, eventType string, body []byte, created time.Time) amqp.Publishing {
+	return amqp.Publishing{
+		ContentType:  ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    id,
+		Timestamp:    created.UTC(),
+		Type:         eventType,
+		AppId:        source,
+		Headers:      amqp.Table{TypeHeader: eventType, SourceHeader: source},
+		Body:         body,
+	}
+}
+
+func metadataOf(delivery *amqp.Delivery) Metadata {
+	eventType, _ := delivery.Headers[TypeHeader].(string)
+	source, _ := delivery.Headers[SourceHeader].(string)
+	return Metadata{
+		ID:          delivery.MessageId,
+		Type:        eventType,
+		Topic:       delivery.RoutingKey,
+		Source:      source,
+		Time:        delivery.Timestamp,
+		Redelivered: delivery.Redelivered,
+	}
+}
@@ -0,0 +1,47 @@
+package eventutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/auditutil/auditpb"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestTopic(t *testing.T) {
+	topic, err := Topic(&auditpb.AuditEvent{})
+	if err != nil || topic != "auditutil.audit_event.v1" {
+		t.Errorf("unexpected topic %q, %v", topic, err)
+	}
+	if _, err := Topic(wrapperspb.String("unversioned")); err == nil {
+		t.Error("expected error for unversioned package")
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	routingKey, eventType, body, err := encode(&auditpb.AuditEvent{Action: "delete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := time.Now()
+	publishing := newPublishing("id-1", "orders", eventType, body, created)
+	delivery := &amqp.Delivery{
+		MessageId:  publishing.MessageId,
+		Headers:    publishing.Headers,
+		Timestamp:  publishing.Timestamp,
+		RoutingKey: routingKey,
+		Body:       publishing.Body,
+	}
+
+	metadata := metadataOf(delivery)
+	if metadata.ID != "id-1" || metadata.Source != "orders" || metadata.Type != "auditutil.v1.AuditEvent" || !metadata.Time.Equal(created) {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	decoded := &auditpb.AuditEvent{}
+	if err := proto.Unmarshal(delivery.Body, decoded); err != nil || decoded.Action != "delete" {
+		t.Errorf("unexpected event %v, %v", decoded, err)
+	}
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS event_outbox (
+    id         BIGSERIAL PRIMARY KEY,
+    event_id   TEXT NOT NULL,
+    topic      TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    source     TEXT NOT NULL DEFAULT '',
+    payload    BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS event_inbox (
+    consumer    TEXT NOT NULL,
+    event_id    TEXT NOT NULL,
+    received_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (consumer, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS event_inbox_received_at_idx ON event_inbox (received_at);
@@ -0,0 +1,193 @@
+package eventutil
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// tables of the outbox and inbox
+const (
+	OutboxTable = "event_outbox"
+	InboxTable  = "event_inbox"
+)
+
+const (
+	defaultOutboxPollInterval = time.Second
+	defaultOutboxBatchSize    = 100
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate creates the outbox and inbox tables if they do not exist
+func Migrate(helper *dbutil.DbConnectionHelper) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		migration, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Running event migration [%s]", name)
+		dbContext := helper.GetDbContext(nil, true)
+		dbContext.Execute(string(migration))
+		err = dbContext.LastError()
+		dbContext.Close()
+		if err != nil {
+			return fmt.Errorf("event migration [%s] failed: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// OutboxOptions configures an Outbox. Zero values select the defaults.
+type OutboxOptions struct {
+	PollInterval time.Duration // interval the outbox table is checked in, default 1s
+	BatchSize    int           // events published per poll, default 100
+}
+
+// Outbox stores events in the event_outbox table within the transaction of the
+// caller, so they are published if and only if the transaction commits. A relay
+// publishes stored events in order and deletes them after the broker confirmed
+// them, i.e. events are published at least once.
+type Outbox struct {
+	helper    *dbutil.DbConnectionHelper
+	publisher *Publisher
+	options   OutboxOptions
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewOutbox creates an Outbox storing events in the DB of helper and relaying them via publisher
+func NewOutbox(helper *dbutil.DbConnectionHelper, publisher *Publisher, options OutboxOptions) *Outbox {
+	if options.PollInterval <= 0 {
+		options.PollInterval = defaultOutboxPollInterval
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultOutboxBatchSize
+	}
+	return &Outbox{helper: helper, publisher: publisher, options: options}
+}
+
+// Add stores message as event in the outbox using dbContext, which should have
+// been created with a transaction
+func (outbox *Outbox) Add(dbContext dbutil.DbAccessor, message proto.Message) error {
+	routingKey, eventType, body, err := encode(message)
+	if err != nil {
+		return err
+	}
+	return dbContext.Execute(fmt.Sprintf("INSERT INTO %s (event_id, topic, event_type, source, payload) VALUES ($1, $2, $3, $4, $5)", OutboxTable),
+		apputil.GenerateGUID(), routingKey, eventType, outbox.publisher.source, body)
+}
+
+// Start starts relaying stored events in the background
+func (outbox *Outbox) Start() {
+	if outbox.done != nil {
+		return
+	}
+	outbox.done = make(chan struct{})
+	outbox.stopped = make(chan struct{})
+	go func() {
+		defer close(outbox.stopped)
+		ticker := time.NewTicker(outbox.options.PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-outbox.done:
+				return
+			case <-ticker.C:
+			}
+			// relay until the outbox is drained
+			for {
+				relayed, err := outbox.Relay(context.Background())
+				if err != nil {
+					logger.Errorf("Failed to relay outbox events: %v", err)
+				}
+				if err != nil || relayed < outbox.options.BatchSize {
+					break
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops relaying after the current batch
+func (outbox *Outbox) Stop() {
+	if outbox.done == nil {
+		return
+	}
+	close(outbox.done)
+	<-outbox.stopped
+	outbox.done = nil
+}
+
+// Relay publishes a batch of stored events and returns the number of published
+// events. Rows are locked, so several replicas can relay concurrently.
+func (outbox *Outbox) Relay(ctx context.Context) (int, error) {
+	db, err := outbox.helper.DB()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT id, event_id, topic, event_type, source, payload, created_at FROM %s ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED", OutboxTable),
+		outbox.options.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	type storedEvent struct {
+		id                                int64
+		eventID, topic, eventType, source string
+		payload                           []byte
+		created                           time.Time
+	}
+	var events []storedEvent
+	for rows.Next() {
+		var event storedEvent
+		if err := rows.Scan(&event.id, &event.eventID, &event.topic, &event.eventType, &event.source, &event.payload, &event.created); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	relayed := 0
+	var publishErr error
+	for _, event := range events {
+		if publishErr = outbox.publisher.publish(ctx, event.topic, newPublishing(event.eventID, event.source, event.eventType, event.payload, event.created)); publishErr != nil {
+			break
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE id = $1", OutboxTable), event.id); err != nil {
+			return 0, err
+		}
+		relayed++
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	if relayed > 0 {
+		logger.Debugf("Relayed %d outbox events", relayed)
+	}
+	return relayed, publishErr
+}
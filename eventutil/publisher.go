@@ -0,0 +1,94 @@
+package eventutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+	"github.com/science-computing/service-common-golang/apputil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Publisher publishes events to a topic exchange and waits for publisher confirms
+type Publisher struct {
+	helper   *amqputil.AmqpConnectionHelper
+	exchange string
+	source   string
+
+	mutex       sync.Mutex
+	amqpContext *amqputil.AmqpContext
+	declared    bool
+}
+
+// NewPublisher creates a Publisher for events of the service source. exchange defaults to DefaultExchange.
+func NewPublisher(helper *amqputil.AmqpConnectionHelper, exchange, source string) *Publisher {
+	if exchange == "" {
+		exchange = DefaultExchange
+	}
+	return &Publisher{helper: helper, exchange: exchange, source: source}
+}
+
+// Publish publishes message with a new event ID to the topic of its type, see Topic.
+// Use Outbox to publish consistently with DB changes.
+func (publisher *Publisher) Publish(ctx context.Context, message proto.Message) error {
+	routingKey, eventType, body, err := encode(message)
+	if err != nil {
+		return err
+	}
+	return publisher.publish(ctx, routingKey, newPublishing(apputil.GenerateGUID(), publisher.source, eventType, body, time.Now()))
+}
+
+// publish publishes an encoded event. The channel is reset and publishing
+// retried once if it fails, e.g. because the connection was lost.
+func (publisher *Publisher) publish(ctx context.Context, routingKey string, publishing amqp.Publishing) error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	err := publisher.publishLocked(ctx, routingKey, publishing)
+	if err != nil && publisher.amqpContext != nil {
+		logger.Warnf("Retrying to publish event [%s]: %v", routingKey, err)
+		publisher.declared = false
+		if publisher.amqpContext.Reset() == nil {
+			err = publisher.publishLocked(ctx, routingKey, publishing)
+		}
+	}
+	return err
+}
+
+func (publisher *Publisher) publishLocked(ctx context.Context, routingKey string, publishing amqp.Publishing) error {
+	if publisher.amqpContext == nil {
+		amqpContext, err := publisher.helper.NewAmqpContext("")
+		if err != nil {
+			return fmt.Errorf("cannot connect to AMQP [%w]", err)
+		}
+		publisher.amqpContext = amqpContext
+	}
+	if !publisher.declared {
+		if err := declareExchange(publisher.amqpContext, publisher.exchange); err != nil {
+			return err
+		}
+		publisher.declared = true
+	}
+	logger.Debugf("Publishing event [%s] with ID [%s]", routingKey, publishing.MessageId)
+	return publisher.amqpContext.PublishConfirmed(ctx, publisher.exchange, routingKey, publishing)
+}
+
+// Close closes the AMQP connection
+func (publisher *Publisher) Close() error {
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+	if publisher.amqpContext == nil {
+		return nil
+	}
+	err := publisher.amqpContext.Close()
+	publisher.amqpContext = nil
+	return err
+}
+
+// declareExchange declares a durable topic exchange
+func declareExchange(amqpContext *amqputil.AmqpContext, exchange string) error {
+	return amqpContext.EnsureExchangeExists(exchange, amqp.ExchangeTopic)
+}
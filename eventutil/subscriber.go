@@ -0,0 +1,202 @@
+package eventutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handler processes an event. dbContext is the transaction the event was
+// recorded in the inbox with, so changes are committed together with the
+// inbox entry, or nil if the Subscriber has no DB. If Handler returns an
+// error or panics, the transaction is rolled back and the event is moved to
+// the dead letter queue.
+type Handler func(ctx context.Context, dbContext dbutil.DbAccessor, metadata Metadata, message proto.Message) error
+
+type registeredHandler struct {
+	prototype proto.Message
+	handler   Handler
+}
+
+// Subscriber consumes events from a durable queue named after the consumer,
+// which is bound to the topics of the handled event types. Events failing
+// processing are dead lettered to the queue <consumer>.dlq.
+type Subscriber struct {
+	amqpHelper *amqputil.AmqpConnectionHelper
+	dbHelper   *dbutil.DbConnectionHelper
+	exchange   string
+	consumer   string
+	handlers   map[string]registeredHandler
+}
+
+// NewSubscriber creates a Subscriber for the given consumer name, e.g. the
+// service name. If dbHelper is not nil, events are recorded in the event_inbox
+// table and redelivered events already processed are skipped. exchange
+// defaults to DefaultExchange.
+func NewSubscriber(amqpHelper *amqputil.AmqpConnectionHelper, dbHelper *dbutil.DbConnectionHelper, exchange, consumer string) *Subscriber {
+	if exchange == "" {
+		exchange = DefaultExchange
+	}
+	return &Subscriber{amqpHelper: amqpHelper, dbHelper: dbHelper, exchange: exchange, consumer: consumer, handlers: make(map[string]registeredHandler)}
+}
+
+// Handle registers handler for events of the type of prototype. It must be called before Run.
+func (subscriber *Subscriber) Handle(prototype proto.Message, handler Handler) error {
+	if _, err := Topic(prototype); err != nil {
+		return err
+	}
+	subscriber.handlers[string(prototype.ProtoReflect().Descriptor().FullName())] = registeredHandler{prototype: prototype, handler: handler}
+	return nil
+}
+
+// Run declares the queues and processes events until ctx is done or the
+// connection is lost, which is returned as error
+func (subscriber *Subscriber) Run(ctx context.Context) error {
+	amqpContext, err := subscriber.amqpHelper.NewAmqpContext(subscriber.consumer)
+	if err != nil {
+		return fmt.Errorf("cannot connect to AMQP [%w]", err)
+	}
+	defer amqpContext.Close()
+
+	if err := subscriber.declare(amqpContext); err != nil {
+		return err
+	}
+	channel := amqpContext.Channel()
+	if err := channel.Qos(1, 0, false); err != nil {
+		return err
+	}
+	deliveries, err := channel.Consume(subscriber.consumer, subscriber.consumer, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("cannot consume queue [%s] [%w]", subscriber.consumer, err)
+	}
+	logger.Infof("Consuming events of %d types as [%s]", len(subscriber.handlers), subscriber.consumer)
+
+	for {
+		select {
+		case <-ctx.Done():
+			channel.Cancel(subscriber.consumer, false)
+			return ctx.Err()
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return errors.New("AMQP delivery channel closed")
+			}
+			subscriber.process(ctx, &delivery)
+		}
+	}
+}
+
+// declare declares the exchange, the queue with its bindings and the dead letter queue
+func (subscriber *Subscriber) declare(amqpContext *amqputil.AmqpContext) error {
+	if err := declareExchange(amqpContext, subscriber.exchange); err != nil {
+		return err
+	}
+	deadLetterExchange := subscriber.exchange + ".dlx"
+	if err := declareExchange(amqpContext, deadLetterExchange); err != nil {
+		return err
+	}
+	channel := amqpContext.Channel()
+	binder, ok := channel.(amqputil.TopologyChannelAccessor)
+	if !ok {
+		return fmt.Errorf("AMQP channel cannot bind queues")
+	}
+
+	deadLetterQueue := subscriber.consumer + ".dlq"
+	if _, err := channel.QueueDeclare(deadLetterQueue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("cannot declare queue [%s] [%w]", deadLetterQueue, err)
+	}
+	if err := binder.QueueBind(deadLetterQueue, deadLetterQueue, deadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("cannot bind queue [%s] [%w]", deadLetterQueue, err)
+	}
+
+	args := amqp.Table{"x-dead-letter-exchange": deadLetterExchange, "x-dead-letter-routing-key": deadLetterQueue}
+	if _, err := channel.QueueDeclare(subscriber.consumer, true, false, false, false, args); err != nil {
+		return fmt.Errorf("cannot declare queue [%s] [%w]", subscriber.consumer, err)
+	}
+	for _, registered := range subscriber.handlers {
+		topic, _ := Topic(registered.prototype)
+		if err := binder.QueueBind(subscriber.consumer, topic, subscriber.exchange, false, nil); err != nil {
+			return fmt.Errorf("cannot bind queue [%s] to [%s] [%w]", subscriber.consumer, topic, err)
+		}
+	}
+	return nil
+}
+
+// process handles a delivery and acknowledges it, dead letters it or requeues it on transient errors
+func (subscriber *Subscriber) process(ctx context.Context, delivery *amqp.Delivery) {
+	metadata := metadataOf(delivery)
+	entry := apputil.FromContext(ctx).WithField("event_id", metadata.ID).WithField("event_type", metadata.Type)
+
+	registered, ok := subscriber.handlers[metadata.Type]
+	if !ok {
+		entry.Errorf("No handler for event type, dead lettering event")
+		delivery.Nack(false, false)
+		return
+	}
+	message := registered.prototype.ProtoReflect().New().Interface()
+	if err := proto.Unmarshal(delivery.Body, message); err != nil {
+		entry.Errorf("Cannot decode event, dead lettering it: %v", err)
+		delivery.Nack(false, false)
+		return
+	}
+
+	var dbContext *dbutil.DbContext
+	if subscriber.dbHelper != nil {
+		dbContext = subscriber.dbHelper.GetDbContext(&ctx, true)
+		err := dbContext.LastError()
+		if err == nil {
+			err = dbContext.Execute(fmt.Sprintf("INSERT INTO %s (consumer, event_id) VALUES ($1, $2)", InboxTable), subscriber.consumer, metadata.ID)
+		}
+		if err != nil {
+			dbContext.Close()
+			if isUniqueViolation(err) {
+				entry.Debugf("Skipping event already processed")
+				delivery.Ack(false)
+				return
+			}
+			entry.Warnf("Cannot record event in inbox, requeuing it: %v", err)
+			delivery.Nack(false, true)
+			return
+		}
+	}
+
+	if err := handle(ctx, registered.handler, dbContext, metadata, message); err != nil {
+		entry.Errorf("Failed to handle event, dead lettering it: %v", err)
+		if dbContext != nil {
+			dbContext.SetLastError(err)
+			dbContext.Close()
+		}
+		delivery.Nack(false, false)
+		return
+	}
+	if dbContext != nil {
+		dbContext.Close()
+	}
+	delivery.Ack(false)
+}
+
+func handle(ctx context.Context, handler Handler, dbContext *dbutil.DbContext, metadata Metadata, message proto.Message) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("handler panicked: %v", recovered)
+		}
+	}()
+	// avoid passing a typed nil as DbAccessor
+	var accessor dbutil.DbAccessor
+	if dbContext != nil {
+		accessor = dbContext
+	}
+	return handler(ctx, accessor, metadata, message)
+}
+
+// isUniqueViolation reports whether err is a Postgres unique violation
+func isUniqueViolation(err error) bool {
+	var sqlErr interface{ SQLState() string }
+	return errors.As(err, &sqlErr) && sqlErr.SQLState() == "23505"
+}
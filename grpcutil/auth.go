@@ -0,0 +1,84 @@
+package grpcutil
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationMetadataKey is the metadata key of bearer tokens
+const AuthorizationMetadataKey = "authorization"
+
+// AuthFunc authenticates a call and returns its context, e.g. with the principal
+// stored by auditutil.ContextWithPrincipal. Errors should be status errors with
+// codes.Unauthenticated or codes.PermissionDenied.
+type AuthFunc func(ctx context.Context, fullMethod string) (context.Context, error)
+
+// Auth rejects calls for which authenticate fails. Methods listed in skip,
+// e.g. /grpc.health.v1.Health/Check, are not authenticated.
+func Auth(authenticate AuthFunc, skip ...string) ServerInterceptor {
+	return ServerInterceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if slices.Contains(skip, info.FullMethod) {
+				return handler(ctx, req)
+			}
+			ctx, err := authenticate(ctx, info.FullMethod)
+			if err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if slices.Contains(skip, info.FullMethod) {
+				return handler(srv, stream)
+			}
+			ctx, err := authenticate(stream.Context(), info.FullMethod)
+			if err != nil {
+				return err
+			}
+			return handler(srv, &wrappedServerStream{ServerStream: stream, ctx: ctx})
+		},
+	}
+}
+
+// BearerToken returns the bearer token of the authorization metadata of an incoming call
+func BearerToken(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, ok := strings.CutPrefix(firstMetadataValue(md, AuthorizationMetadataKey), "Bearer ")
+	if !ok || token == "" {
+		return "", status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	return token, nil
+}
+
+// AuthClient sends the token returned by token as bearer token with each call
+func AuthClient(token func(ctx context.Context) (string, error)) ClientInterceptor {
+	withToken := func(ctx context.Context) (context.Context, error) {
+		value, err := token(ctx)
+		if err != nil {
+			return nil, status.Errorf(codes.Unauthenticated, "cannot get token [%v]", err)
+		}
+		return metadata.AppendToOutgoingContext(ctx, AuthorizationMetadataKey, "Bearer "+value), nil
+	}
+	return ClientInterceptor{
+		Unary: func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx, err := withToken(ctx)
+			if err != nil {
+				return err
+			}
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+		Stream: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx, err := withToken(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return streamer(ctx, desc, cc, method, opts...)
+		},
+	}
+}
@@ -0,0 +1,73 @@
+// Package grpcutil provides the standard gRPC client and server interceptors
+// of serviceutil.Service for use with any grpc.Server or grpc.ClientConn
+package grpcutil
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// ServerInterceptor pairs the unary and stream variant of a server interceptor
+type ServerInterceptor struct {
+	Unary  grpc.UnaryServerInterceptor
+	Stream grpc.StreamServerInterceptor
+}
+
+// ClientInterceptor pairs the unary and stream variant of a client interceptor
+type ClientInterceptor struct {
+	Unary  grpc.UnaryClientInterceptor
+	Stream grpc.StreamClientInterceptor
+}
+
+// Chain returns server options chaining the given interceptors, the first one being the outermost
+func Chain(interceptors ...ServerInterceptor) []grpc.ServerOption {
+	var unary []grpc.UnaryServerInterceptor
+	var stream []grpc.StreamServerInterceptor
+	for _, interceptor := range interceptors {
+		if interceptor.Unary != nil {
+			unary = append(unary, interceptor.Unary)
+		}
+		if interceptor.Stream != nil {
+			stream = append(stream, interceptor.Stream)
+		}
+	}
+	return []grpc.ServerOption{grpc.ChainUnaryInterceptor(unary...), grpc.ChainStreamInterceptor(stream...)}
+}
+
+// ChainClient returns dial options chaining the given interceptors, the first one being the outermost
+func ChainClient(interceptors ...ClientInterceptor) []grpc.DialOption {
+	var unary []grpc.UnaryClientInterceptor
+	var stream []grpc.StreamClientInterceptor
+	for _, interceptor := range interceptors {
+		if interceptor.Unary != nil {
+			unary = append(unary, interceptor.Unary)
+		}
+		if interceptor.Stream != nil {
+			stream = append(stream, interceptor.Stream)
+		}
+	}
+	return []grpc.DialOption{grpc.WithChainUnaryInterceptor(unary...), grpc.WithChainStreamInterceptor(stream...)}
+}
+
+// StandardServerInterceptors returns the interceptors used by serviceutil.Service:
+// Recovery, RequestID, Metrics and Logging
+func StandardServerInterceptors() []ServerInterceptor {
+	return []ServerInterceptor{Recovery(), RequestID(), Metrics(), Logging()}
+}
+
+// StandardClientInterceptors returns RequestIDClient, MetricsClient and
+// LoggingClient, serviceName is sent as x-caller-service if set
+func StandardClientInterceptors(serviceName string) []ClientInterceptor {
+	return []ClientInterceptor{RequestIDClient(serviceName), MetricsClient(), LoggingClient()}
+}
+
+// wrappedServerStream overrides the context of a grpc.ServerStream
+type wrappedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *wrappedServerStream) Context() context.Context {
+	return stream.ctx
+}
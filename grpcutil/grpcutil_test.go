@@ -0,0 +1,117 @@
+package grpcutil
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}
+
+func TestRecovery(t *testing.T) {
+	_, err := Recovery().Unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	if status.Code(err) != codes.Internal {
+		t.Errorf("expected Internal, got %v", err)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		RequestIDMetadataKey, "request-1",
+		TraceParentMetadataKey, "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	))
+	RequestID().Unary(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		correlation := apputil.CorrelationFromContext(ctx)
+		if correlation.RequestID != "request-1" || correlation.TraceID != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("unexpected correlation %+v", correlation)
+		}
+
+		// the correlation is propagated to outgoing calls
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if firstMetadataValue(md, RequestIDMetadataKey) != "request-1" || firstMetadataValue(md, CallerServiceMetadataKey) != "orders" {
+				t.Errorf("unexpected outgoing metadata %v", md)
+			}
+			return nil
+		}
+		return nil, RequestIDClient("orders").Unary(ctx, "/other.Service/Call", nil, nil, nil, invoker)
+	})
+}
+
+func TestAuth(t *testing.T) {
+	authenticate := func(ctx context.Context, fullMethod string) (context.Context, error) {
+		token, err := BearerToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if token != "secret" {
+			return nil, status.Error(codes.PermissionDenied, "invalid token")
+		}
+		return ctx, nil
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	interceptor := Auth(authenticate, "/grpc.health.v1.Health/Check").Unary
+
+	if _, err := interceptor(context.Background(), nil, info, handler); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("expected Unauthenticated, got %v", err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(AuthorizationMetadataKey, "Bearer secret"))
+	if _, err := interceptor(ctx, nil, info, handler); err != nil {
+		t.Errorf("expected authenticated call, got %v", err)
+	}
+	if _, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: "/grpc.health.v1.Health/Check"}, handler); err != nil {
+		t.Errorf("expected skipped method to be allowed, got %v", err)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	Timeout(time.Second).Unary(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if deadline, ok := ctx.Deadline(); !ok || time.Until(deadline) > time.Second {
+			t.Errorf("expected deadline within 1s, got %v", deadline)
+		}
+		return nil, nil
+	})
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	record := func(name string) ServerInterceptor {
+		return ServerInterceptor{Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			order = append(order, name)
+			return handler(ctx, req)
+		}}
+	}
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer(Chain(append(StandardServerInterceptors(), record("first"), record("second"))...)...)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(listener)
+	defer server.Stop()
+
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }
+	options := append(ChainClient(StandardClientInterceptors("test")...), grpc.WithContextDialer(dialer), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient("passthrough:///bufnet", options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(order) != 2 || order[0] != "first" {
+		t.Errorf("unexpected order %v", order)
+	}
+}
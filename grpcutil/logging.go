@@ -0,0 +1,65 @@
+package grpcutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/apex/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Logging logs each call with its status code and duration using the logger
+// of the request context, so it should follow RequestID. Successful calls are
+// logged at debug level, client errors at info and server errors at warn level.
+func Logging() ServerInterceptor {
+	return ServerInterceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			logCall(apputil.FromContext(ctx), "Handled", info.FullMethod, start, err)
+			return resp, err
+		},
+		Stream: func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, stream)
+			logCall(apputil.FromContext(stream.Context()), "Handled", info.FullMethod, start, err)
+			return err
+		},
+	}
+}
+
+// LoggingClient logs each outgoing call like Logging, streams are logged when established
+func LoggingClient() ClientInterceptor {
+	return ClientInterceptor{
+		Unary: func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			start := time.Now()
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			logCall(apputil.FromContext(ctx), "Called", method, start, err)
+			return err
+		},
+		Stream: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			start := time.Now()
+			stream, err := streamer(ctx, desc, cc, method, opts...)
+			logCall(apputil.FromContext(ctx), "Opened stream", method, start, err)
+			return stream, err
+		},
+	}
+}
+
+func logCall(entry *log.Entry, action string, fullMethod string, start time.Time, err error) {
+	code := status.Code(err)
+	entry = entry.WithFields(log.Fields{"grpc.method": fullMethod, "grpc.code": code.String(), "duration": time.Since(start).String()})
+	switch code {
+	case codes.OK:
+		entry.Debugf("%s [%s]", action, fullMethod)
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.ResourceExhausted, codes.FailedPrecondition, codes.OutOfRange:
+		entry.Infof("%s [%s] with [%s]: %v", action, fullMethod, code, status.Convert(err).Message())
+	default:
+		entry.Warnf("%s [%s] with [%s]: %v", action, fullMethod, code, status.Convert(err).Message())
+	}
+}
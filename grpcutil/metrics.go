@@ -0,0 +1,76 @@
+package grpcutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	serverHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "The total number of handled gRPC calls by method and status code",
+	}, []string{"method", "code"})
+	serverHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "The duration of handled gRPC calls",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	clientHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_client_handled_total",
+		Help: "The total number of outgoing gRPC calls by method and status code",
+	}, []string{"method", "code"})
+	clientHandlingSeconds = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_client_handling_seconds",
+		Help:    "The duration of outgoing unary gRPC calls",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+	panicsRecovered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_panics_recovered_total",
+		Help: "The total number of panics of gRPC handlers recovered by method",
+	}, []string{"method"})
+)
+
+// Metrics records the number of calls by status code and their duration
+func Metrics() ServerInterceptor {
+	return ServerInterceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			start := time.Now()
+			resp, err := handler(ctx, req)
+			observe(serverHandled, serverHandlingSeconds, info.FullMethod, start, err)
+			return resp, err
+		},
+		Stream: func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			start := time.Now()
+			err := handler(srv, stream)
+			observe(serverHandled, serverHandlingSeconds, info.FullMethod, start, err)
+			return err
+		},
+	}
+}
+
+// MetricsClient records outgoing unary calls like Metrics, streams are counted when established
+func MetricsClient() ClientInterceptor {
+	return ClientInterceptor{
+		Unary: func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			start := time.Now()
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			observe(clientHandled, clientHandlingSeconds, method, start, err)
+			return err
+		},
+		Stream: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			stream, err := streamer(ctx, desc, cc, method, opts...)
+			clientHandled.WithLabelValues(method, status.Code(err).String()).Inc()
+			return stream, err
+		},
+	}
+}
+
+func observe(handled *prometheus.CounterVec, seconds *prometheus.HistogramVec, method string, start time.Time, err error) {
+	handled.WithLabelValues(method, status.Code(err).String()).Inc()
+	seconds.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
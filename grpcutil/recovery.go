@@ -0,0 +1,34 @@
+package grpcutil
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Recovery turns panics of handlers into codes.Internal errors and logs them with the stack trace
+func Recovery() ServerInterceptor {
+	return ServerInterceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+			defer recoverPanic(ctx, info.FullMethod, &err)
+			return handler(ctx, req)
+		},
+		Stream: func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+			defer recoverPanic(stream.Context(), info.FullMethod, &err)
+			return handler(srv, stream)
+		},
+	}
+}
+
+func recoverPanic(ctx context.Context, fullMethod string, err *error) {
+	if recovered := recover(); recovered != nil {
+		apputil.FromContext(ctx).WithField("stack", string(debug.Stack())).Errorf("Recovered from panic in [%s]: %v", fullMethod, recovered)
+		panicsRecovered.WithLabelValues(fullMethod).Inc()
+		*err = status.Error(codes.Internal, "An internal error occurred")
+	}
+}
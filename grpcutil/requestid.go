@@ -0,0 +1,123 @@
+package grpcutil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/apex/log"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// metadata keys used for request correlation
+const (
+	RequestIDMetadataKey     = "x-request-id"
+	TraceParentMetadataKey   = "traceparent"
+	CallerServiceMetadataKey = "x-caller-service"
+)
+
+// RequestID stores a logger with request_id and trace_id fields in the request
+// context, see apputil.FromContext. The request ID is taken from the
+// x-request-id metadata or generated and is returned as response header. The
+// IDs and the caller given as x-caller-service metadata are also stored as
+// apputil.Correlation.
+func RequestID() ServerInterceptor {
+	return ServerInterceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return handler(WithRequestLogger(ctx), req)
+		},
+		Stream: func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			return handler(srv, &wrappedServerStream{ServerStream: stream, ctx: WithRequestLogger(stream.Context())})
+		},
+	}
+}
+
+// WithRequestLogger returns a copy of the context of an incoming request with
+// the correlation and logger set by RequestID
+func WithRequestLogger(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	requestID := firstMetadataValue(md, RequestIDMetadataKey)
+	if requestID == "" {
+		requestID = apputil.GenerateGUID()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDMetadataKey, requestID))
+
+	correlation := apputil.Correlation{
+		RequestID:     requestID,
+		TraceID:       traceIDFromTraceParent(firstMetadataValue(md, TraceParentMetadataKey)),
+		CallerService: firstMetadataValue(md, CallerServiceMetadataKey),
+	}
+	fields := log.Fields{apputil.RequestIDField: requestID}
+	if correlation.TraceID != "" {
+		fields[apputil.TraceIDField] = correlation.TraceID
+	}
+	if correlation.CallerService != "" {
+		fields[apputil.CallerServiceField] = correlation.CallerService
+	}
+	ctx = apputil.ContextWithCorrelation(ctx, correlation)
+	return apputil.ContextWithLogger(ctx, apputil.FromContext(ctx).WithFields(fields))
+}
+
+// RequestIDClient propagates the request ID and trace of the context (see
+// apputil.CorrelationFromContext) as outgoing metadata and sends serviceName
+// as x-caller-service if set. Metadata already set is kept.
+func RequestIDClient(serviceName string) ClientInterceptor {
+	return ClientInterceptor{
+		Unary: func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			return invoker(withOutgoingCorrelation(ctx, serviceName), method, req, reply, cc, opts...)
+		},
+		Stream: func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return streamer(withOutgoingCorrelation(ctx, serviceName), desc, cc, method, opts...)
+		},
+	}
+}
+
+func withOutgoingCorrelation(ctx context.Context, serviceName string) context.Context {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	correlation := apputil.CorrelationFromContext(ctx)
+	var pairs []string
+	if correlation.RequestID != "" && len(md.Get(RequestIDMetadataKey)) == 0 {
+		pairs = append(pairs, RequestIDMetadataKey, correlation.RequestID)
+	}
+	if serviceName != "" && len(md.Get(CallerServiceMetadataKey)) == 0 {
+		pairs = append(pairs, CallerServiceMetadataKey, serviceName)
+	}
+	if len(md.Get(TraceParentMetadataKey)) == 0 {
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			pairs = append(pairs, TraceParentMetadataKey, fmt.Sprintf("00-%s-%s-%s", spanContext.TraceID(), spanContext.SpanID(), spanContext.TraceFlags()))
+		} else if correlation.TraceID != "" {
+			// continue the trace of the incoming request with a new parent ID
+			parentID := make([]byte, 8)
+			rand.Read(parentID)
+			pairs = append(pairs, TraceParentMetadataKey, fmt.Sprintf("00-%s-%s-01", correlation.TraceID, hex.EncodeToString(parentID)))
+		}
+	}
+	if len(pairs) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+func firstMetadataValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// traceIDFromTraceParent extracts the trace ID from a W3C traceparent header,
+// i.e. version-traceid-parentid-flags
+func traceIDFromTraceParent(traceParent string) string {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
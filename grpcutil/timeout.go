@@ -0,0 +1,39 @@
+package grpcutil
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Timeout sets a deadline of timeout on unary calls without an earlier
+// deadline, so handlers of abandoned calls do not run forever. Streams are
+// not limited.
+func Timeout(timeout time.Duration) ServerInterceptor {
+	return ServerInterceptor{
+		Unary: func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			ctx, cancel := withDefaultTimeout(ctx, timeout)
+			defer cancel()
+			return handler(ctx, req)
+		},
+	}
+}
+
+// TimeoutClient sets a deadline of timeout on outgoing unary calls without an earlier deadline
+func TimeoutClient(timeout time.Duration) ClientInterceptor {
+	return ClientInterceptor{
+		Unary: func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx, cancel := withDefaultTimeout(ctx, timeout)
+			defer cancel()
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	}
+}
+
+func withDefaultTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= timeout {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,199 @@
+// Package healthutil provides a registry of named health checks, which
+// serviceutil uses for the gRPC health service and the /readyz endpoint
+package healthutil
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// DefaultTimeout limits the duration of a single check
+const DefaultTimeout = 5 * time.Second
+
+// Criticality defines how a failing check affects the overall status
+type Criticality int
+
+const (
+	// Critical checks make the service unavailable if they fail
+	Critical Criticality = iota
+	// NonCritical checks only degrade the service if they fail
+	NonCritical
+)
+
+func (criticality Criticality) String() string {
+	if criticality == NonCritical {
+		return "noncritical"
+	}
+	return "critical"
+}
+
+// Status is the result of a check or of all checks
+type Status string
+
+const (
+	StatusUp       Status = "up"
+	StatusDegraded Status = "degraded"
+	StatusDown     Status = "down"
+)
+
+// Check returns an error if the checked component is not healthy
+type Check func(ctx context.Context) error
+
+// CheckResult is the result of a single check
+type CheckResult struct {
+	Status      Status        `json:"status"`
+	Criticality string        `json:"criticality"`
+	Error       string        `json:"error,omitempty"`
+	Duration    time.Duration `json:"duration"`
+}
+
+// Report is the result of all registered checks. Status is down if a critical
+// check failed, degraded if a non critical check failed and up otherwise.
+type Report struct {
+	Status Status                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks"`
+}
+
+var (
+	logger      = apputil.Named("healthutil")
+	checkStatus = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "health_check_status",
+		Help: "The status of health checks, 1 if the last run succeeded and 0 otherwise",
+	}, []string{"check", "criticality"})
+)
+
+type registeredCheck struct {
+	check       Check
+	criticality Criticality
+}
+
+// Registry holds named checks. It is safe for concurrent use.
+type Registry struct {
+	// Timeout limits the duration of a single check, DefaultTimeout if 0
+	Timeout time.Duration
+
+	mutex  sync.RWMutex
+	checks map[string]registeredCheck
+}
+
+// DefaultRegistry is used by the package level functions and serviceutil.Service
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{checks: make(map[string]registeredCheck)}
+}
+
+// Register adds check with the given name, replacing any check with the same name
+func (registry *Registry) Register(name string, criticality Criticality, check Check) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	registry.checks[name] = registeredCheck{check: check, criticality: criticality}
+}
+
+// Unregister removes the check with the given name
+func (registry *Registry) Unregister(name string) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if registered, ok := registry.checks[name]; ok {
+		checkStatus.DeleteLabelValues(name, registered.criticality.String())
+		delete(registry.checks, name)
+	}
+}
+
+// Names returns the sorted names of the registered checks
+func (registry *Registry) Names() []string {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	names := make([]string, 0, len(registry.checks))
+	for name := range registry.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Run runs all checks concurrently and reports their results
+func (registry *Registry) Run(ctx context.Context) Report {
+	registry.mutex.RLock()
+	checks := make(map[string]registeredCheck, len(registry.checks))
+	for name, registered := range registry.checks {
+		checks[name] = registered
+	}
+	registry.mutex.RUnlock()
+
+	timeout := registry.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	report := Report{Status: StatusUp, Checks: make(map[string]CheckResult, len(checks))}
+	for name, registered := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := run(ctx, timeout, name, registered)
+			mutex.Lock()
+			defer mutex.Unlock()
+			report.Checks[name] = result
+			switch {
+			case result.Status == StatusUp:
+			case registered.criticality == Critical:
+				report.Status = StatusDown
+			case report.Status == StatusUp:
+				report.Status = StatusDegraded
+			}
+		}()
+	}
+	wg.Wait()
+	return report
+}
+
+func run(ctx context.Context, timeout time.Duration, name string, registered registeredCheck) (result CheckResult) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Errorf("Health check [%s] panicked: %v", name, recovered)
+			result = CheckResult{Status: StatusDown, Error: "check panicked"}
+		}
+		result.Criticality = registered.criticality.String()
+		result.Duration = time.Since(start)
+		value := 0.0
+		if result.Status == StatusUp {
+			value = 1
+		}
+		checkStatus.WithLabelValues(name, result.Criticality).Set(value)
+	}()
+
+	if err := registered.check(ctx); err != nil {
+		logger.Warnf("Health check [%s] failed: %v", name, err)
+		return CheckResult{Status: StatusDown, Error: err.Error()}
+	}
+	return CheckResult{Status: StatusUp}
+}
+
+// Register adds a check to the DefaultRegistry
+func Register(name string, criticality Criticality, check Check) {
+	DefaultRegistry.Register(name, criticality, check)
+}
+
+// Unregister removes a check from the DefaultRegistry
+func Unregister(name string) {
+	DefaultRegistry.Unregister(name)
+}
+
+// Run runs the checks of the DefaultRegistry
+func Run(ctx context.Context) Report {
+	return DefaultRegistry.Run(ctx)
+}
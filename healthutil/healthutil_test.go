@@ -0,0 +1,44 @@
+package healthutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunReportsStatus(t *testing.T) {
+	registry := NewRegistry()
+	registry.Register("db", Critical, func(ctx context.Context) error { return nil })
+	registry.Register("cache", NonCritical, func(ctx context.Context) error { return errors.New("unavailable") })
+
+	report := registry.Run(context.Background())
+	if report.Status != StatusDegraded {
+		t.Errorf("expected degraded status, got %v", report.Status)
+	}
+	if result := report.Checks["cache"]; result.Status != StatusDown || result.Error != "unavailable" || result.Criticality != "noncritical" {
+		t.Errorf("unexpected cache result %+v", result)
+	}
+
+	registry.Register("broker", Critical, func(ctx context.Context) error { panic("broken") })
+	if report := registry.Run(context.Background()); report.Status != StatusDown {
+		t.Errorf("expected down status, got %v", report.Status)
+	}
+
+	registry.Unregister("broker")
+	registry.Unregister("cache")
+	if report := registry.Run(context.Background()); report.Status != StatusUp || len(report.Checks) != 1 {
+		t.Errorf("expected single passing check, got %+v", report)
+	}
+}
+
+func TestRunTimesOutChecks(t *testing.T) {
+	registry := &Registry{Timeout: 10 * time.Millisecond, checks: make(map[string]registeredCheck)}
+	registry.Register("slow", Critical, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if report := registry.Run(context.Background()); report.Status != StatusDown {
+		t.Errorf("expected timed out check to fail, got %+v", report)
+	}
+}
@@ -0,0 +1,37 @@
+package httputil
+
+import (
+	"sync"
+
+	"github.com/science-computing/service-common-golang/retryutil"
+)
+
+// ErrCircuitOpen is returned for requests to a host whose circuit breaker is open
+var ErrCircuitOpen = retryutil.ErrCircuitOpen
+
+// CircuitBreakerOptions configures the circuit breaking of NewClient. Failed
+// requests are transport errors or 5xx responses.
+type CircuitBreakerOptions = retryutil.CircuitBreakerOptions
+
+// circuitBreakers holds a breaker per host
+type circuitBreakers struct {
+	options  CircuitBreakerOptions
+	mutex    sync.Mutex
+	breakers map[string]*retryutil.CircuitBreaker
+}
+
+func newCircuitBreakers(options CircuitBreakerOptions) *circuitBreakers {
+	return &circuitBreakers{options: options, breakers: make(map[string]*retryutil.CircuitBreaker)}
+}
+
+// get returns the breaker of host
+func (b *circuitBreakers) get(host string) *retryutil.CircuitBreaker {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	breaker, ok := b.breakers[host]
+	if !ok {
+		breaker = retryutil.NewCircuitBreaker(host, b.options)
+		b.breakers[host] = breaker
+	}
+	return breaker
+}
@@ -0,0 +1,76 @@
+// Package httputil provides an HTTP client for calling external REST APIs
+package httputil
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+// header names propagated to outgoing requests
+const (
+	RequestIDHeader      = "X-Request-Id"
+	TraceParentHeader    = "Traceparent"
+	CallerServiceHeader  = "X-Caller-Service"
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+var logger = apputil.Named("httputil")
+
+// Options configures NewClient. Zero values select the defaults.
+type Options struct {
+	Name           string                 // name of the called API used as metrics label, default is the request host
+	ServiceName    string                 // sent as X-Caller-Service header if set
+	Timeout        time.Duration          // overall timeout including retries, default 30s
+	DialTimeout    time.Duration          // default 5s
+	MaxRetries     int                    // retries of idempotent requests, default 3, negative disables retries
+	MinBackoff     time.Duration          // delay before the first retry, doubled for each retry, default 100ms
+	MaxBackoff     time.Duration          // default 5s
+	CircuitBreaker *CircuitBreakerOptions // enables circuit breaking per host if set
+	Transport      http.RoundTripper      // default is a http.Transport with the configured timeouts
+}
+
+func (options *Options) setDefaults() {
+	if options.Timeout == 0 {
+		options.Timeout = 30 * time.Second
+	}
+	if options.DialTimeout == 0 {
+		options.DialTimeout = 5 * time.Second
+	}
+	if options.MaxRetries == 0 {
+		options.MaxRetries = 3
+	}
+	if options.MinBackoff == 0 {
+		options.MinBackoff = 100 * time.Millisecond
+	}
+	if options.MaxBackoff == 0 {
+		options.MaxBackoff = 5 * time.Second
+	}
+}
+
+// NewClient creates a http.Client which retries idempotent requests with
+// exponential backoff, propagates the request ID and trace of the request
+// context (see apputil.CorrelationFromContext), records Prometheus metrics
+// and optionally rejects requests to failing hosts with ErrCircuitOpen.
+func NewClient(options Options) *http.Client {
+	options.setDefaults()
+	transport := options.Transport
+	if transport == nil {
+		transport = &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           (&net.Dialer{Timeout: options.DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+			TLSHandshakeTimeout:   options.DialTimeout,
+			ResponseHeaderTimeout: options.Timeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          100,
+			MaxIdleConnsPerHost:   10,
+		}
+	}
+	roundTripper := &roundTripper{next: transport, options: options}
+	if options.CircuitBreaker != nil {
+		roundTripper.breakers = newCircuitBreakers(*options.CircuitBreaker)
+	}
+	return &http.Client{Transport: roundTripper, Timeout: options.Timeout}
+}
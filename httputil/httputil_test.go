@@ -0,0 +1,77 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+func TestClientRetriesIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(r.Header.Get(RequestIDHeader) + " " + r.Header.Get(CallerServiceHeader)))
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{ServiceName: "tester", MinBackoff: time.Millisecond})
+	ctx := apputil.ContextWithCorrelation(context.Background(), apputil.Correlation{RequestID: "req-1", TraceID: strings.Repeat("a", 32)})
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	response, err := client.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	body := make([]byte, 64)
+	n, _ := response.Body.Read(body)
+	if response.StatusCode != http.StatusOK || string(body[:n]) != "req-1 tester" {
+		t.Errorf("unexpected response %d %q", response.StatusCode, body[:n])
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 calls, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	response, err = client.Post(server.URL, "text/plain", strings.NewReader("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable || calls.Load() != 1 {
+		t.Errorf("expected POST not to be retried, got %d after %d calls", response.StatusCode, calls.Load())
+	}
+}
+
+func TestClientOpensCircuit(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	client := NewClient(Options{MaxRetries: -1, CircuitBreaker: &CircuitBreakerOptions{Failures: 2, OpenDuration: time.Minute}})
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+	}
+	if _, err := client.Get(server.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected open circuit, got %v", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("expected 2 calls, got %d", calls.Load())
+	}
+}
@@ -0,0 +1,26 @@
+package httputil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	clientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_requests_total",
+		Help: "The total number of outgoing HTTP requests by API, method and status code, 0 if no response was received",
+	}, []string{"api", "method", "code"})
+	clientRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_client_request_duration_seconds",
+		Help:    "The duration of outgoing HTTP requests including retries",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"api", "method"})
+	clientRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_retries_total",
+		Help: "The total number of retried outgoing HTTP requests",
+	}, []string{"api", "method"})
+	circuitBreakerRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_client_circuit_open_total",
+		Help: "The total number of outgoing HTTP requests rejected by an open circuit breaker",
+	}, []string{"api"})
+)
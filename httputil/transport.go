@@ -0,0 +1,161 @@
+package httputil
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/retryutil"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// roundTripper implements retries, header propagation, metrics and circuit breaking of NewClient
+type roundTripper struct {
+	next     http.RoundTripper
+	options  Options
+	breakers *circuitBreakers
+}
+
+func (rt *roundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	request = request.Clone(ctx)
+	rt.propagate(ctx, request)
+
+	api := rt.options.Name
+	if api == "" {
+		api = request.URL.Host
+	}
+	start := time.Now()
+	defer func() {
+		clientRequestDuration.WithLabelValues(api, request.Method).Observe(time.Since(start).Seconds())
+	}()
+
+	retryable := isIdempotent(request) && (request.Body == nil || request.Body == http.NoBody || request.GetBody != nil)
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && request.GetBody != nil {
+			body, err := request.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("failed to rewind request body for retry [%w]", err)
+			}
+			request.Body = body
+		}
+
+		response, err := rt.send(api, request)
+		if errors.Is(err, ErrCircuitOpen) || !retryable || attempt >= rt.options.MaxRetries || !shouldRetry(ctx, response, err) {
+			return response, err
+		}
+
+		delay := rt.backoff(attempt, response)
+		if response != nil {
+			io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+			response.Body.Close()
+		}
+		apputil.FromContext(ctx).Debugf("Retrying %s %s in %v after [%v]", request.Method, request.URL.Redacted(), delay, describe(response, err))
+		clientRetries.WithLabelValues(api, request.Method).Inc()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// send sends a single request, guarded by the circuit breaker of its host
+func (rt *roundTripper) send(api string, request *http.Request) (*http.Response, error) {
+	host := request.URL.Host
+	var breaker *retryutil.CircuitBreaker
+	if rt.breakers != nil {
+		breaker = rt.breakers.get(host)
+		if err := breaker.Allow(); err != nil {
+			circuitBreakerRejections.WithLabelValues(api).Inc()
+			return nil, fmt.Errorf("request to [%s] rejected [%w]", host, err)
+		}
+	}
+
+	response, err := rt.next.RoundTrip(request)
+	code := "0"
+	if response != nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	clientRequests.WithLabelValues(api, request.Method, code).Inc()
+
+	if breaker != nil {
+		if err != nil && request.Context().Err() != nil {
+			breaker.Release()
+		} else {
+			breaker.Record(err != nil || response.StatusCode >= http.StatusInternalServerError)
+		}
+	}
+	return response, err
+}
+
+// propagate sets the correlation headers of the request unless already set
+func (rt *roundTripper) propagate(ctx context.Context, request *http.Request) {
+	correlation := apputil.CorrelationFromContext(ctx)
+	if correlation.RequestID != "" && request.Header.Get(RequestIDHeader) == "" {
+		request.Header.Set(RequestIDHeader, correlation.RequestID)
+	}
+	if rt.options.ServiceName != "" && request.Header.Get(CallerServiceHeader) == "" {
+		request.Header.Set(CallerServiceHeader, rt.options.ServiceName)
+	}
+	if request.Header.Get(TraceParentHeader) != "" {
+		return
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		request.Header.Set(TraceParentHeader, fmt.Sprintf("00-%s-%s-%s", spanContext.TraceID(), spanContext.SpanID(), spanContext.TraceFlags()))
+	} else if correlation.TraceID != "" {
+		// continue the trace of the incoming request with a new parent ID
+		parentID := make([]byte, 8)
+		rand.Read(parentID)
+		request.Header.Set(TraceParentHeader, fmt.Sprintf("00-%s-%s-01", correlation.TraceID, hex.EncodeToString(parentID)))
+	}
+}
+
+// backoff returns the delay before the given retry, honoring a Retry-After header in seconds
+func (rt *roundTripper) backoff(attempt int, response *http.Response) time.Duration {
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, rt.options.MaxBackoff)
+		}
+	}
+	return retryutil.Policy{InitialBackoff: rt.options.MinBackoff, MaxBackoff: rt.options.MaxBackoff}.Backoff(attempt)
+}
+
+// isIdempotent reports whether a request may be sent more than once
+func isIdempotent(request *http.Request) bool {
+	switch request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return request.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// shouldRetry reports whether the result of a request is a transient failure
+func shouldRetry(ctx context.Context, response *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil
+	}
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func describe(response *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return response.Status
+}
@@ -0,0 +1,134 @@
+package idempotencyutil
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"time"
+
+	"github.com/science-computing/service-common-golang/dbutil"
+)
+
+// states of idempotency keys
+const (
+	statePending = "pending"
+	stateDone    = "done"
+)
+
+// DefaultLockTimeout is the time after which a pending key, e.g. of a crashed instance, may be taken over
+const DefaultLockTimeout = time.Minute
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Migrate creates the idempotency_keys table if it does not exist
+func Migrate(helper *dbutil.DbConnectionHelper) error {
+	names, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		migration, err := migrations.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Running idempotency migration [%s]", name)
+		dbContext := helper.GetDbContext(nil, true)
+		dbContext.Execute(string(migration))
+		err = dbContext.LastError()
+		dbContext.Close()
+		if err != nil {
+			return fmt.Errorf("idempotency migration [%s] failed: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// DbStore keeps idempotency keys in the idempotency_keys table, see Migrate.
+// Expired keys are replaced on reuse and removed by DeleteExpired.
+type DbStore struct {
+	helper      *dbutil.DbConnectionHelper
+	lockTimeout time.Duration
+}
+
+// NewDbStore creates a DbStore. Pending keys older than lockTimeout (default
+// DefaultLockTimeout) are taken over, so it must exceed the handling time of calls.
+func NewDbStore(helper *dbutil.DbConnectionHelper, lockTimeout time.Duration) *DbStore {
+	if lockTimeout <= 0 {
+		lockTimeout = DefaultLockTimeout
+	}
+	return &DbStore{helper: helper, lockTimeout: lockTimeout}
+}
+
+func (store *DbStore) Reserve(ctx context.Context, method string, key string, fingerprint string, ttl time.Duration) (*Record, error) {
+	dbContext := store.helper.GetDbContext(&ctx, false)
+	defer dbContext.Close()
+
+	// insert the key or take over an expired or stale one
+	var reserved string
+	err := dbContext.ScanQueryRow(false, dbutil.Query{
+		Query: `INSERT INTO idempotency_keys (method, idempotency_key, fingerprint, state, expires_at)
+			VALUES ($1, $2, $3, $4, now() + $5 * interval '1 millisecond')
+			ON CONFLICT (method, idempotency_key) DO UPDATE
+			SET fingerprint = EXCLUDED.fingerprint, state = EXCLUDED.state, response = NULL, status = NULL,
+				created_at = now(), expires_at = EXCLUDED.expires_at
+			WHERE idempotency_keys.expires_at < now()
+				OR (idempotency_keys.state = $4 AND idempotency_keys.created_at < now() - $6 * interval '1 millisecond')
+			RETURNING state`,
+		Args: []interface{}{method, key, fingerprint, statePending, ttl.Milliseconds(), store.lockTimeout.Milliseconds()},
+	}, []interface{}{&reserved})
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to reserve idempotency key [%w]", err)
+	}
+
+	dbContext.ResetError()
+	var storedFingerprint, state string
+	record := &Record{}
+	err = dbContext.ScanQueryRow(false, dbutil.Query{
+		Query: "SELECT fingerprint, state, response, status FROM idempotency_keys WHERE method = $1 AND idempotency_key = $2",
+		Args:  []interface{}{method, key},
+	}, []interface{}{&storedFingerprint, &state, &record.Response, &record.Status})
+	if errors.Is(err, sql.ErrNoRows) {
+		// a concurrent call released the key in between
+		dbContext.ResetError()
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read idempotency key [%w]", err)
+	}
+	switch {
+	case storedFingerprint != fingerprint:
+		return nil, ErrFingerprintMismatch
+	case state != stateDone:
+		return nil, ErrInProgress
+	}
+	return record, nil
+}
+
+func (store *DbStore) Complete(ctx context.Context, method string, key string, record Record) error {
+	dbContext := store.helper.GetDbContext(&ctx, false)
+	defer dbContext.Close()
+	return dbContext.Execute("UPDATE idempotency_keys SET state = $3, response = $4, status = $5 WHERE method = $1 AND idempotency_key = $2",
+		method, key, stateDone, record.Response, record.Status)
+}
+
+func (store *DbStore) Release(ctx context.Context, method string, key string) error {
+	dbContext := store.helper.GetDbContext(&ctx, false)
+	defer dbContext.Close()
+	return dbContext.Execute("DELETE FROM idempotency_keys WHERE method = $1 AND idempotency_key = $2 AND state = $3", method, key, statePending)
+}
+
+// DeleteExpired removes expired keys, e.g. run daily by a schedutil job
+func (store *DbStore) DeleteExpired(ctx context.Context) error {
+	dbContext := store.helper.GetDbContext(&ctx, false)
+	defer dbContext.Close()
+	return dbContext.Execute("DELETE FROM idempotency_keys WHERE expires_at < now()")
+}
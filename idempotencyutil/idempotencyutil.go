@@ -0,0 +1,203 @@
+// Package idempotencyutil replays the stored responses of gRPC calls retried
+// with the same idempotency key
+package idempotencyutil
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// metadata keys of idempotent calls
+const (
+	// KeyMetadataKey is the metadata key clients send the idempotency key as
+	KeyMetadataKey = "idempotency-key"
+	// ReplayedMetadataKey is the response header set to "true" for replayed responses
+	ReplayedMetadataKey = "idempotent-replayed"
+)
+
+var logger = apputil.Named("idempotencyutil")
+
+// errors returned by Store.Reserve
+var (
+	// ErrInProgress indicates that a call with the same key is still running
+	ErrInProgress = errors.New("request with the same idempotency key is in progress")
+	// ErrFingerprintMismatch indicates that the key was used for a different request
+	ErrFingerprintMismatch = errors.New("idempotency key was used for a different request")
+)
+
+// Record is the stored result of a completed call
+type Record struct {
+	Response []byte // the response marshaled as anypb.Any, nil if the call failed
+	Status   []byte // the status of a failed call marshaled as google.rpc.Status
+}
+
+// Store keeps the idempotency keys of calls
+type Store interface {
+	// Reserve marks the key of method as in progress and returns nil, or returns
+	// the record of a completed call with the same key. It returns
+	// ErrInProgress or ErrFingerprintMismatch if the key cannot be reserved.
+	Reserve(ctx context.Context, method string, key string, fingerprint string, ttl time.Duration) (*Record, error)
+	// Complete stores the record of the reserved key
+	Complete(ctx context.Context, method string, key string, record Record) error
+	// Release removes the reservation of a call failing transiently, so it may be retried
+	Release(ctx context.Context, method string, key string) error
+}
+
+// Options configures UnaryServerInterceptor. Zero values select the defaults.
+type Options struct {
+	// Methods to make idempotent as full method names like /pkg.Service/Method,
+	// or prefixes ending with / like /pkg.Service/ for all methods of a service
+	Methods []string
+	// RequireKey rejects calls of the methods without idempotency key with
+	// codes.InvalidArgument instead of handling them without deduplication
+	RequireKey bool
+	// TTL is the time responses are replayed for, default 24h
+	TTL time.Duration
+}
+
+// UnaryServerInterceptor handles calls of the configured methods with an
+// idempotency-key metadata only once per key. Retries with the same key and
+// request get the stored response or error, retries while the first call runs
+// fail with codes.Aborted and reusing a key for a different request fails with
+// codes.InvalidArgument. Transient errors like codes.Unavailable are not stored,
+// so the call may be retried.
+func UnaryServerInterceptor(store Store, options Options) grpc.UnaryServerInterceptor {
+	if options.TTL <= 0 {
+		options.TTL = 24 * time.Hour
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !options.idempotent(info.FullMethod) {
+			return handler(ctx, req)
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		keys := md.Get(KeyMetadataKey)
+		if len(keys) == 0 || keys[0] == "" {
+			if options.RequireKey {
+				return nil, status.Errorf(codes.InvalidArgument, "missing %s metadata", KeyMetadataKey)
+			}
+			return handler(ctx, req)
+		}
+		key := keys[0]
+
+		fingerprint, err := fingerprintOf(info.FullMethod, req)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot fingerprint request [%v]", err)
+		}
+		record, err := store.Reserve(ctx, info.FullMethod, key, fingerprint, options.TTL)
+		switch {
+		case errors.Is(err, ErrInProgress):
+			return nil, status.Error(codes.Aborted, err.Error())
+		case errors.Is(err, ErrFingerprintMismatch):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case err != nil:
+			apputil.FromContext(ctx).Errorf("Cannot reserve idempotency key of [%s]: %v", info.FullMethod, err)
+			return nil, status.Error(codes.Unavailable, "cannot check idempotency key")
+		case record != nil:
+			apputil.FromContext(ctx).Debugf("Replaying response of [%s] for idempotency key", info.FullMethod)
+			grpc.SetHeader(ctx, metadata.Pairs(ReplayedMetadataKey, "true"))
+			return replay(record)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil && transient(status.Code(err)) {
+			if releaseErr := store.Release(ctx, info.FullMethod, key); releaseErr != nil {
+				apputil.FromContext(ctx).Warnf("Cannot release idempotency key of [%s]: %v", info.FullMethod, releaseErr)
+			}
+			return resp, err
+		}
+		record, recordErr := recordOf(resp, err)
+		if recordErr == nil {
+			recordErr = store.Complete(ctx, info.FullMethod, key, *record)
+		}
+		if recordErr != nil {
+			// the call stays reserved until it expires, as it must not run again
+			apputil.FromContext(ctx).Errorf("Cannot store response of [%s] for idempotency key: %v", info.FullMethod, recordErr)
+		}
+		return resp, err
+	}
+}
+
+func (options *Options) idempotent(fullMethod string) bool {
+	for _, method := range options.Methods {
+		if method == fullMethod || (strings.HasSuffix(method, "/") && strings.HasPrefix(fullMethod, method)) {
+			return true
+		}
+	}
+	return false
+}
+
+// fingerprintOf returns a hash of the method and the deterministically marshaled request
+func fingerprintOf(fullMethod string, req interface{}) (string, error) {
+	message, ok := req.(proto.Message)
+	if !ok {
+		return "", errors.New("request is not a proto message")
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(message)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	hash.Write([]byte(fullMethod))
+	hash.Write([]byte{0})
+	hash.Write(data)
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// transient reports whether calls failing with code may succeed when retried
+func transient(code codes.Code) bool {
+	switch code {
+	case codes.Canceled, codes.DeadlineExceeded, codes.Unavailable, codes.Aborted, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	}
+	return false
+}
+
+func recordOf(resp interface{}, err error) (*Record, error) {
+	if err != nil {
+		data, marshalErr := proto.Marshal(status.Convert(err).Proto())
+		return &Record{Status: data}, marshalErr
+	}
+	message, ok := resp.(proto.Message)
+	if !ok {
+		return nil, errors.New("response is not a proto message")
+	}
+	wrapped, err := anypb.New(message)
+	if err != nil {
+		return nil, err
+	}
+	data, err := proto.Marshal(wrapped)
+	return &Record{Response: data}, err
+}
+
+func replay(record *Record) (interface{}, error) {
+	if record.Response == nil {
+		stored := &spb.Status{}
+		if err := proto.Unmarshal(record.Status, stored); err != nil {
+			return nil, status.Errorf(codes.Internal, "cannot decode stored status [%v]", err)
+		}
+		return nil, status.ErrorProto(stored)
+	}
+	wrapped := &anypb.Any{}
+	if err := proto.Unmarshal(record.Response, wrapped); err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot decode stored response [%v]", err)
+	}
+	resp, err := wrapped.UnmarshalNew()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "cannot decode stored response [%v]", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,116 @@
+package idempotencyutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// memoryStore is a Store for tests
+type memoryStore struct {
+	mutex   sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+type memoryEntry struct {
+	fingerprint string
+	record      *Record
+}
+
+func (store *memoryStore) Reserve(ctx context.Context, method string, key string, fingerprint string, ttl time.Duration) (*Record, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	entry, ok := store.entries[method+key]
+	switch {
+	case !ok:
+		store.entries[method+key] = &memoryEntry{fingerprint: fingerprint}
+		return nil, nil
+	case entry.fingerprint != fingerprint:
+		return nil, ErrFingerprintMismatch
+	case entry.record == nil:
+		return nil, ErrInProgress
+	}
+	return entry.record, nil
+}
+
+func (store *memoryStore) Complete(ctx context.Context, method string, key string, record Record) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.entries[method+key].record = &record
+	return nil
+}
+
+func (store *memoryStore) Release(ctx context.Context, method string, key string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.entries, method+key)
+	return nil
+}
+
+var info = &grpc.UnaryServerInfo{FullMethod: "/orders.OrderService/CreateOrder"}
+
+func call(interceptor grpc.UnaryServerInterceptor, key string, request string, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(KeyMetadataKey, key))
+	return interceptor(ctx, wrapperspb.String(request), info, handler)
+}
+
+func TestReplaysResponse(t *testing.T) {
+	interceptor := UnaryServerInterceptor(&memoryStore{entries: map[string]*memoryEntry{}}, Options{Methods: []string{"/orders.OrderService/"}})
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return wrapperspb.Int64(int64(calls)), nil
+	}
+
+	first, err := call(interceptor, "key-1", "order", handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayed, err := call(interceptor, "key-1", "order", handler)
+	if err != nil || calls != 1 || !proto.Equal(first.(proto.Message), replayed.(proto.Message)) {
+		t.Errorf("expected replayed response %v, got %v %v after %d calls", first, replayed, err, calls)
+	}
+	if _, err := call(interceptor, "key-1", "other order", handler); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for reused key, got %v", err)
+	}
+	if _, err := call(interceptor, "key-2", "order", handler); err != nil || calls != 2 {
+		t.Errorf("expected new key to be handled, got %v after %d calls", err, calls)
+	}
+}
+
+func TestStoresOnlyPermanentErrors(t *testing.T) {
+	interceptor := UnaryServerInterceptor(&memoryStore{entries: map[string]*memoryEntry{}}, Options{Methods: []string{info.FullMethod}})
+	code := codes.Unavailable
+	calls := 0
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		calls++
+		return nil, status.Error(code, "failed")
+	}
+
+	call(interceptor, "key", "order", handler)
+	code = codes.FailedPrecondition
+	if _, err := call(interceptor, "key", "order", handler); status.Code(err) != codes.FailedPrecondition || calls != 2 {
+		t.Errorf("expected transient error to be retried, got %v after %d calls", err, calls)
+	}
+	if _, err := call(interceptor, "key", "order", handler); status.Code(err) != codes.FailedPrecondition || calls != 2 {
+		t.Errorf("expected permanent error to be replayed, got %v after %d calls", err, calls)
+	}
+}
+
+func TestRequireKey(t *testing.T) {
+	interceptor := UnaryServerInterceptor(&memoryStore{entries: map[string]*memoryEntry{}}, Options{Methods: []string{info.FullMethod}, RequireKey: true})
+	_, err := interceptor(context.Background(), wrapperspb.String("order"), info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without key, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+// Package k8sutil integrates services with Kubernetes: pod metadata in logs
+// and traces, leader election via Lease objects and preStop coordination
+package k8sutil
+
+import (
+	"os"
+	"strings"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/traceutil"
+
+	"github.com/apex/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// environment variables set via the downward API, e.g.
+//
+//	env:
+//	- name: POD_NAME
+//	  valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	- name: POD_NAMESPACE
+//	  valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	- name: NODE_NAME
+//	  valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//	- name: POD_IP
+//	  valueFrom: {fieldRef: {fieldPath: status.podIP}}
+const (
+	PodNameEnv      = "POD_NAME"
+	PodNamespaceEnv = "POD_NAMESPACE"
+	NodeNameEnv     = "NODE_NAME"
+	PodIPEnv        = "POD_IP"
+)
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+var logger = apputil.Named("k8sutil")
+
+// Metadata describes the pod the service runs in
+type Metadata struct {
+	PodName   string
+	Namespace string
+	NodeName  string
+	PodIP     string
+}
+
+// InCluster returns true if the process runs in a Kubernetes pod
+func InCluster() bool {
+	return os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// GetMetadata returns the metadata of the pod from the downward API
+// environment variables. The pod name defaults to the hostname and the
+// namespace to the one of the service account.
+func GetMetadata() Metadata {
+	metadata := Metadata{
+		PodName:   os.Getenv(PodNameEnv),
+		Namespace: os.Getenv(PodNamespaceEnv),
+		NodeName:  os.Getenv(NodeNameEnv),
+		PodIP:     os.Getenv(PodIPEnv),
+	}
+	if metadata.PodName == "" {
+		metadata.PodName, _ = os.Hostname()
+	}
+	if metadata.Namespace == "" {
+		if namespace, err := os.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+			metadata.Namespace = strings.TrimSpace(string(namespace))
+		}
+	}
+	return metadata
+}
+
+// Attributes returns the set metadata as OpenTelemetry semantic convention attributes
+func (metadata Metadata) Attributes() []attribute.KeyValue {
+	var attributes []attribute.KeyValue
+	for key, value := range metadata.fields() {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return attributes
+}
+
+// Fields returns the set metadata as log fields named like the attributes
+func (metadata Metadata) Fields() log.Fields {
+	fields := log.Fields{}
+	for key, value := range metadata.fields() {
+		fields[key] = value
+	}
+	return fields
+}
+
+func (metadata Metadata) fields() map[string]string {
+	fields := map[string]string{}
+	for key, value := range map[string]string{
+		"k8s.pod.name":       metadata.PodName,
+		"k8s.namespace.name": metadata.Namespace,
+		"k8s.node.name":      metadata.NodeName,
+		"k8s.pod.ip":         metadata.PodIP,
+	} {
+		if value != "" {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// Init adds the pod metadata to all log entries (see apputil.SetGlobalFields)
+// and to the trace resource (see traceutil.AddResourceAttributes) if the
+// process runs in Kubernetes. It must be called before traceutil.Init.
+func Init() Metadata {
+	metadata := GetMetadata()
+	if !InCluster() {
+		logger.Debugf("Not running in Kubernetes, pod metadata not added to logs and traces")
+		return metadata
+	}
+	apputil.SetGlobalFields(metadata.Fields())
+	traceutil.AddResourceAttributes(metadata.Attributes()...)
+	return metadata
+}
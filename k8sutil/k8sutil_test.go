@@ -0,0 +1,167 @@
+package k8sutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/serviceutil"
+
+	"google.golang.org/grpc"
+)
+
+// fakeLeaseServer serves a single lease with optimistic concurrency
+type fakeLeaseServer struct {
+	mutex   sync.Mutex
+	lease   *lease
+	version int
+}
+
+func (server *fakeLeaseServer) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	switch request.Method {
+	case http.MethodGet:
+		if server.lease == nil {
+			http.NotFound(writer, request)
+			return
+		}
+		json.NewEncoder(writer).Encode(server.lease)
+	case http.MethodPost, http.MethodPut:
+		received := &lease{}
+		json.NewDecoder(request.Body).Decode(received)
+		if (request.Method == http.MethodPost) != (server.lease == nil) ||
+			(server.lease != nil && received.Metadata.ResourceVersion != server.lease.Metadata.ResourceVersion) {
+			http.Error(writer, "conflict", http.StatusConflict)
+			return
+		}
+		server.version++
+		received.Metadata.ResourceVersion = strings.Repeat("v", server.version)
+		server.lease = received
+	}
+}
+
+func (server *fakeLeaseServer) holder() string {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if server.lease == nil {
+		return ""
+	}
+	return server.lease.Spec.HolderIdentity
+}
+
+func newTestElector(url string, identity string, started chan<- string) *leaderElector {
+	options := LeaderElectionOptions{
+		LeaseName:        "scheduler",
+		Namespace:        "test",
+		Identity:         identity,
+		LeaseDuration:    time.Second,
+		RetryPeriod:      10 * time.Millisecond,
+		OnStartedLeading: func(ctx context.Context) { started <- identity; <-ctx.Done() },
+	}
+	options.setDefaults()
+	return &leaderElector{options: options, client: &apiClient{baseURL: url, client: http.DefaultClient}, now: time.Now}
+}
+
+func TestLeaderElection(t *testing.T) {
+	server := &fakeLeaseServer{}
+	httpServer := httptest.NewServer(server)
+	defer httpServer.Close()
+
+	started := make(chan string, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		newTestElector(httpServer.URL, "pod-a", started).run(ctx)
+		close(stopped)
+	}()
+	if leader := <-started; leader != "pod-a" {
+		t.Fatalf("expected pod-a to lead, got %s", leader)
+	}
+
+	otherCtx, otherCancel := context.WithCancel(context.Background())
+	defer otherCancel()
+	go newTestElector(httpServer.URL, "pod-b", started).run(otherCtx)
+	time.Sleep(50 * time.Millisecond)
+	if server.holder() != "pod-a" {
+		t.Fatalf("expected pod-a to keep the lease, got %s", server.holder())
+	}
+
+	// pod-b takes over after pod-a released the lease
+	cancel()
+	<-stopped
+	select {
+	case leader := <-started:
+		if leader != "pod-b" {
+			t.Errorf("expected pod-b to lead, got %s", leader)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("expected pod-b to take over the released lease")
+	}
+}
+
+func TestMetadataFields(t *testing.T) {
+	t.Setenv(PodNameEnv, "orders-7d9f")
+	t.Setenv(PodNamespaceEnv, "shop")
+	t.Setenv(NodeNameEnv, "")
+	fields := GetMetadata().Fields()
+	if fields["k8s.pod.name"] != "orders-7d9f" || fields["k8s.namespace.name"] != "shop" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if _, ok := fields["k8s.node.name"]; ok {
+		t.Error("expected unset node name to be omitted")
+	}
+}
+
+// freePort returns a currently unused TCP port
+func freePort(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return fmt.Sprint(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestPreStopFailsReadinessWithDefaultWiring(t *testing.T) {
+	service := &serviceutil.Service{
+		Name:               "prestop",
+		MetricsPort:        freePort(t),
+		GrpcPublishPort:    freePort(t),
+		RegisterServerFunc: func(*grpc.Server, interface{}) {},
+	}
+	HandleShutdown(nil, 10*time.Millisecond)
+	service.Start()
+	defer service.Stop(context.Background())
+
+	metrics := "http://127.0.0.1:" + service.MetricsPort
+	status := func(path string) int {
+		response, err := http.Get(metrics + path)
+		if err != nil {
+			return 0
+		}
+		response.Body.Close()
+		return response.StatusCode
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for status("/readyz") != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("expected service to become ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if code := status(PreStopPath); code != http.StatusNoContent {
+		t.Fatalf("expected preStop hook to succeed, got %d", code)
+	}
+	if code := status("/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected service to be unready after preStop, got %d", code)
+	}
+}
@@ -0,0 +1,250 @@
+package k8sutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+// microTimeFormat is the format of MicroTime fields of Kubernetes objects
+const microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// lease is a coordination.k8s.io/v1 Lease
+type lease struct {
+	APIVersion string        `json:"apiVersion"`
+	Kind       string        `json:"kind"`
+	Metadata   leaseMetadata `json:"metadata"`
+	Spec       leaseSpec     `json:"spec"`
+}
+
+type leaseMetadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// LeaderElectionOptions configures RunLeaderElection. Zero values select the defaults.
+type LeaderElectionOptions struct {
+	LeaseName     string        // name of the Lease object, required
+	Namespace     string        // default is the namespace of the pod
+	Identity      string        // identity of this candidate, default is the pod name
+	LeaseDuration time.Duration // time other candidates wait before taking over an unrenewed lease, default 15s
+	RenewDeadline time.Duration // time the leader retries renewing before giving up leadership, default 10s
+	RetryPeriod   time.Duration // interval of acquire and renew attempts, default 2s
+	// OnStartedLeading is called when leadership is acquired, ctx is canceled when it is lost
+	OnStartedLeading func(ctx context.Context)
+	// OnStoppedLeading is called after leadership is lost or released
+	OnStoppedLeading func()
+}
+
+func (options *LeaderElectionOptions) setDefaults() error {
+	if options.LeaseName == "" {
+		return errors.New("lease name is required")
+	}
+	if options.OnStartedLeading == nil {
+		return errors.New("OnStartedLeading is required")
+	}
+	metadata := GetMetadata()
+	if options.Namespace == "" {
+		options.Namespace = metadata.Namespace
+	}
+	if options.Identity == "" {
+		options.Identity = metadata.PodName
+	}
+	if options.Namespace == "" || options.Identity == "" {
+		return errors.New("namespace and identity are required outside of Kubernetes")
+	}
+	if options.LeaseDuration <= 0 {
+		options.LeaseDuration = 15 * time.Second
+	}
+	if options.RenewDeadline <= 0 {
+		options.RenewDeadline = 10 * time.Second
+	}
+	if options.RetryPeriod <= 0 {
+		options.RetryPeriod = 2 * time.Second
+	}
+	return nil
+}
+
+// leaderElector holds the state of a candidate
+type leaderElector struct {
+	options LeaderElectionOptions
+	client  *apiClient
+	now     func() time.Time
+
+	// last observed lease of another holder and when it was observed, so
+	// expiry does not depend on the clocks of other pods
+	observed     leaseSpec
+	observedTime time.Time
+}
+
+// RunLeaderElection campaigns for the lease until ctx is done. While this
+// candidate is the leader, OnStartedLeading runs with a context canceled on
+// loss of leadership. The lease is released when ctx is done. The service
+// account needs get, create and update permissions on leases.
+func RunLeaderElection(ctx context.Context, options LeaderElectionOptions) error {
+	if err := options.setDefaults(); err != nil {
+		return err
+	}
+	client, err := newInClusterClient()
+	if err != nil {
+		return err
+	}
+	elector := &leaderElector{options: options, client: client, now: time.Now}
+	return elector.run(ctx)
+}
+
+func (elector *leaderElector) run(ctx context.Context) error {
+	ticker := time.NewTicker(elector.options.RetryPeriod)
+	defer ticker.Stop()
+	for {
+		acquired, err := elector.tryAcquireOrRenew(ctx)
+		if err != nil {
+			logger.Warnf("Failed to acquire lease [%s]: %v", elector.options.LeaseName, err)
+		}
+		if acquired {
+			elector.lead(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs OnStartedLeading and renews the lease until renewing fails for RenewDeadline or ctx is done
+func (elector *leaderElector) lead(ctx context.Context) {
+	logger.Infof("Acquired leadership of lease [%s] as [%s]", elector.options.LeaseName, elector.options.Identity)
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer apputil.HandlePanics()
+		defer close(done)
+		elector.options.OnStartedLeading(leaderCtx)
+	}()
+
+	ticker := time.NewTicker(elector.options.RetryPeriod)
+	lastRenew := elector.now()
+	for leading := true; leading; {
+		select {
+		case <-ctx.Done():
+			leading = false
+		case <-ticker.C:
+			renewed, err := elector.tryAcquireOrRenew(ctx)
+			if renewed {
+				lastRenew = elector.now()
+				continue
+			}
+			if err != nil {
+				logger.Warnf("Failed to renew lease [%s]: %v", elector.options.LeaseName, err)
+			}
+			leading = err != nil && elector.now().Sub(lastRenew) < elector.options.RenewDeadline
+		}
+	}
+	ticker.Stop()
+	cancel()
+	<-done
+
+	if ctx.Err() != nil {
+		elector.release()
+	}
+	logger.Infof("Lost leadership of lease [%s]", elector.options.LeaseName)
+	if elector.options.OnStoppedLeading != nil {
+		elector.options.OnStoppedLeading()
+	}
+}
+
+// tryAcquireOrRenew returns true if this candidate holds the lease afterwards
+func (elector *leaderElector) tryAcquireOrRenew(ctx context.Context) (bool, error) {
+	now := elector.now()
+	spec := leaseSpec{
+		HolderIdentity:       elector.options.Identity,
+		LeaseDurationSeconds: int(elector.options.LeaseDuration.Seconds()),
+		AcquireTime:          now.UTC().Format(microTimeFormat),
+		RenewTime:            now.UTC().Format(microTimeFormat),
+	}
+
+	current := &lease{}
+	err := elector.client.do(ctx, "GET", elector.leasePath(), nil, current)
+	if errors.Is(err, errNotFound) {
+		created := &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   leaseMetadata{Name: elector.options.LeaseName, Namespace: elector.options.Namespace},
+			Spec:       spec,
+		}
+		if err := elector.client.do(ctx, "POST", elector.collectionPath(), created, nil); err != nil {
+			if errors.Is(err, errConflict) {
+				return false, nil
+			}
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := current.Spec.HolderIdentity
+	if current.Spec != elector.observed {
+		elector.observed, elector.observedTime = current.Spec, now
+	}
+	if holder != "" && holder != elector.options.Identity {
+		duration := time.Duration(current.Spec.LeaseDurationSeconds) * time.Second
+		if elector.observedTime.Add(duration).After(now) {
+			return false, nil
+		}
+	}
+
+	if holder == elector.options.Identity {
+		spec.AcquireTime = current.Spec.AcquireTime
+		spec.LeaseTransitions = current.Spec.LeaseTransitions
+	} else {
+		spec.LeaseTransitions = current.Spec.LeaseTransitions + 1
+	}
+	current.Spec = spec
+	if err := elector.client.do(ctx, "PUT", elector.leasePath(), current, nil); err != nil {
+		if errors.Is(err, errConflict) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// release clears the holder, so other candidates take over without waiting for expiry
+func (elector *leaderElector) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), elector.options.RetryPeriod)
+	defer cancel()
+	current := &lease{}
+	if err := elector.client.do(ctx, "GET", elector.leasePath(), nil, current); err != nil || current.Spec.HolderIdentity != elector.options.Identity {
+		return
+	}
+	current.Spec.HolderIdentity = ""
+	current.Spec.LeaseDurationSeconds = 1
+	if err := elector.client.do(ctx, "PUT", elector.leasePath(), current, nil); err != nil {
+		logger.Warnf("Failed to release lease [%s]: %v", elector.options.LeaseName, err)
+	}
+}
+
+// collectionPath returns the API path of the leases in the namespace
+func (elector *leaderElector) collectionPath() string {
+	return fmt.Sprintf("/apis/coordination.k8s.io/v1/namespaces/%s/leases", elector.options.Namespace)
+}
+
+// leasePath returns the API path of the lease
+func (elector *leaderElector) leasePath() string {
+	return elector.collectionPath() + "/" + elector.options.LeaseName
+}
@@ -0,0 +1,93 @@
+package k8sutil
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/healthutil"
+)
+
+// DefaultPreStopDelay is the time between failing readiness and shutting down,
+// so the pod is removed from the service endpoints before it stops serving
+const DefaultPreStopDelay = 5 * time.Second
+
+// PreStopPath is the path of the preStop handler registered by HandleShutdown
+const PreStopPath = "/prestop"
+
+// ErrDraining is returned by the readiness check after shutdown began
+var ErrDraining = errors.New("pod is shutting down")
+
+var (
+	draining     atomic.Bool
+	shutdownOnce sync.Once
+)
+
+// Draining returns true after shutdown began via preStop hook or SIGTERM
+func Draining() bool {
+	return draining.Load()
+}
+
+// HandleShutdown coordinates the termination of the pod with the service:
+//
+//   - a critical check of registry (default healthutil.DefaultRegistry, which
+//     serviceutil.Service serves by default) fails once shutdown began, so the
+//     pod becomes unready
+//   - GET /prestop on the metrics port of serviceutil.Service begins shutdown
+//     and returns after delay, for use as HTTP preStop hook
+//   - SIGTERM begins shutdown, waits for delay unless the preStop hook did,
+//     and exits via apputil.Exit, which runs the exit hooks
+//
+// delay defaults to DefaultPreStopDelay and must be less than the
+// terminationGracePeriodSeconds of the pod minus apputil.ExitHookTimeout.
+func HandleShutdown(registry *healthutil.Registry, delay time.Duration) {
+	if registry == nil {
+		registry = healthutil.DefaultRegistry
+	}
+	if delay <= 0 {
+		delay = DefaultPreStopDelay
+	}
+	shutdownOnce.Do(func() {
+		registry.Register("k8s-shutdown", healthutil.Critical, func(ctx context.Context) error {
+			if Draining() {
+				return ErrDraining
+			}
+			return nil
+		})
+		http.HandleFunc(PreStopPath, func(writer http.ResponseWriter, request *http.Request) {
+			waitForEndpoints(request.Context(), delay)
+			writer.WriteHeader(http.StatusNoContent)
+		})
+
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM)
+		go func() {
+			defer apputil.HandlePanics()
+			<-signals
+			logger.Infof("Received SIGTERM, shutting down")
+			waitForEndpoints(context.Background(), delay)
+			apputil.Exit(0)
+		}()
+	})
+}
+
+// waitForEndpoints begins shutdown and waits for delay, unless shutdown already began
+func waitForEndpoints(ctx context.Context, delay time.Duration) {
+	if !draining.CompareAndSwap(false, true) {
+		return
+	}
+	logger.Infof("Draining, waiting %v for the pod to be removed from the endpoints", delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
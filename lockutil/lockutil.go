@@ -0,0 +1,106 @@
+// Package lockutil provides distributed locks for mutual exclusion across replicas
+package lockutil
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+// DefaultTTL is the time a lock expires after if it is not renewed, e.g. because its holder crashed
+const DefaultTTL = 30 * time.Second
+
+// ErrNotAcquired is returned by TryAcquire if the lock is held by someone else
+var ErrNotAcquired = errors.New("lock is held by another owner")
+
+// ErrLockLost is returned by Release if the lock expired or its connection was lost before
+var ErrLockLost = errors.New("lock was lost")
+
+var logger = apputil.Named("lockutil")
+
+// Lock is an acquired lock, which is renewed in the background until released
+type Lock interface {
+	// Name returns the name of the lock
+	Name() string
+	// Token returns the fencing token, which is greater than the tokens of all
+	// previous holders of the lock. Pass it to the protected resource to reject
+	// writes of a previous holder, which lost the lock without noticing.
+	Token() int64
+	// Lost is closed if the lock could not be renewed and must be considered released
+	Lost() <-chan struct{}
+	// Release releases the lock and stops its renewal
+	Release(ctx context.Context) error
+}
+
+// Locker acquires named locks
+type Locker interface {
+	// TryAcquire acquires the lock with the given name or returns ErrNotAcquired
+	TryAcquire(ctx context.Context, name string) (Lock, error)
+}
+
+// Acquire tries to acquire the lock every retryInterval until it is acquired or ctx is done
+func Acquire(ctx context.Context, locker Locker, name string, retryInterval time.Duration) (Lock, error) {
+	for {
+		lock, err := locker.TryAcquire(ctx, name)
+		if !errors.Is(err, ErrNotAcquired) {
+			return lock, err
+		}
+		timer := time.NewTimer(retryInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// renewal runs renew periodically until stopped and closes lost if renew fails
+type renewal struct {
+	lost    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func startRenewal(name string, interval time.Duration, renew func(ctx context.Context) error) *renewal {
+	r := &renewal{lost: make(chan struct{}), done: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(r.stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				err := renew(ctx)
+				cancel()
+				if err != nil {
+					logger.Warnf("Lost lock [%s]: %v", name, err)
+					close(r.lost)
+					return
+				}
+			}
+		}
+	}()
+	return r
+}
+
+// stop stops the renewal and reports whether the lock was lost before
+func (r *renewal) stop() bool {
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	<-r.stopped
+	select {
+	case <-r.lost:
+		return true
+	default:
+		return false
+	}
+}
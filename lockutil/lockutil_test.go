@@ -0,0 +1,61 @@
+package lockutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/cacheutil"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// busyLocker acquires a lock after failing a number of times
+type busyLocker struct {
+	failures int
+}
+
+func (locker *busyLocker) TryAcquire(ctx context.Context, name string) (Lock, error) {
+	if locker.failures > 0 {
+		locker.failures--
+		return nil, ErrNotAcquired
+	}
+	return &redisLock{name: name, token: 1, renewal: startRenewal(name, time.Hour, nil)}, nil
+}
+
+func TestAcquireRetries(t *testing.T) {
+	lock, err := Acquire(context.Background(), &busyLocker{failures: 2}, "job", time.Millisecond)
+	if err != nil || lock.Name() != "job" {
+		t.Fatalf("expected acquired lock, got %v, %v", lock, err)
+	}
+	if lost := lock.(*redisLock).renewal.stop(); lost {
+		t.Error("expected lock not to be lost")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := Acquire(ctx, &busyLocker{failures: 1000}, "job", time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestRenewalReportsLoss(t *testing.T) {
+	r := startRenewal("job", time.Millisecond, func(ctx context.Context) error { return errors.New("expired") })
+	select {
+	case <-r.lost:
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be lost")
+	}
+	if !r.stop() {
+		t.Error("expected stop to report lost lock")
+	}
+}
+
+func TestRedisLockerUnavailable(t *testing.T) {
+	cache := cacheutil.NewRedisCache(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, nil)
+	defer cache.Close()
+	if _, err := NewRedisLocker(cache, 0).TryAcquire(context.Background(), "job"); err == nil || errors.Is(err, ErrNotAcquired) {
+		t.Errorf("expected connection error, got %v", err)
+	}
+}
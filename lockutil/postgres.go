@@ -0,0 +1,95 @@
+package lockutil
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/science-computing/service-common-golang/dbutil"
+)
+
+// PostgresLocker acquires session level advisory locks, which Postgres releases
+// when the connection holding them is closed, e.g. if the holder crashed. Each
+// lock holds a dedicated connection, which is checked every ttl/3.
+// Fencing tokens are transaction IDs, which increase monotonically.
+type PostgresLocker struct {
+	helper *dbutil.DbConnectionHelper
+	ttl    time.Duration
+}
+
+// NewPostgresLocker creates a PostgresLocker using the connection pool of helper. ttl defaults to DefaultTTL.
+func NewPostgresLocker(helper *dbutil.DbConnectionHelper, ttl time.Duration) *PostgresLocker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &PostgresLocker{helper: helper, ttl: ttl}
+}
+
+func (locker *PostgresLocker) TryAcquire(ctx context.Context, name string) (Lock, error) {
+	db, err := locker.helper.DB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get connection for lock [%s] [%w]", name, err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock(hashtext($1))", name).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to acquire lock [%s] [%w]", name, err)
+	}
+	if !acquired {
+		conn.Close()
+		return nil, ErrNotAcquired
+	}
+	var token int64
+	if err := conn.QueryRowContext(ctx, "SELECT txid_current()").Scan(&token); err != nil {
+		conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", name)
+		conn.Close()
+		return nil, fmt.Errorf("failed to get fencing token of lock [%s] [%w]", name, err)
+	}
+
+	lock := &postgresLock{name: name, conn: conn, token: token}
+	lock.renewal = startRenewal(name, locker.ttl/3, conn.PingContext)
+	logger.Debugf("Acquired lock [%s] with token %d", name, token)
+	return lock, nil
+}
+
+type postgresLock struct {
+	name    string
+	conn    *sql.Conn
+	token   int64
+	renewal *renewal
+}
+
+func (lock *postgresLock) Name() string {
+	return lock.name
+}
+
+func (lock *postgresLock) Token() int64 {
+	return lock.token
+}
+
+func (lock *postgresLock) Lost() <-chan struct{} {
+	return lock.renewal.lost
+}
+
+func (lock *postgresLock) Release(ctx context.Context) error {
+	lost := lock.renewal.stop()
+	defer lock.conn.Close()
+	if lost {
+		return ErrLockLost
+	}
+	var released bool
+	if err := lock.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock(hashtext($1))", lock.name).Scan(&released); err != nil {
+		return fmt.Errorf("failed to release lock [%s] [%w]", lock.name, err)
+	}
+	if !released {
+		return ErrLockLost
+	}
+	logger.Debugf("Released lock [%s]", lock.name)
+	return nil
+}
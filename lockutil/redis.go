@@ -0,0 +1,103 @@
+package lockutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/cacheutil"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scripts changing a lock only if it is still held by the given owner
+var (
+	renewScript  = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("pexpire", KEYS[1], ARGV[2]) else return 0 end`)
+	deleteScript = redis.NewScript(`if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`)
+)
+
+// RedisLocker acquires locks stored as Redis keys, which expire after the TTL
+// unless renewed. Fencing tokens are taken from a counter per lock.
+type RedisLocker struct {
+	client redis.UniversalClient
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisLocker creates a RedisLocker using the client of cache. Lock keys
+// are prefixed with "lock:". ttl defaults to DefaultTTL.
+func NewRedisLocker(cache *cacheutil.RedisCache, ttl time.Duration) *RedisLocker {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &RedisLocker{client: cache.Client(), prefix: "lock:", ttl: ttl}
+}
+
+func (locker *RedisLocker) TryAcquire(ctx context.Context, name string) (Lock, error) {
+	key := locker.prefix + name
+	owner := apputil.GenerateGUID()
+	acquired, err := locker.client.SetNX(ctx, key, owner, locker.ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock [%s] [%w]", name, err)
+	}
+	if !acquired {
+		return nil, ErrNotAcquired
+	}
+	token, err := locker.client.Incr(ctx, key+":fence").Result()
+	if err != nil {
+		deleteScript.Run(ctx, locker.client, []string{key}, owner)
+		return nil, fmt.Errorf("failed to get fencing token of lock [%s] [%w]", name, err)
+	}
+
+	lock := &redisLock{locker: locker, name: name, key: key, owner: owner, token: token}
+	lock.renewal = startRenewal(name, locker.ttl/3, lock.renew)
+	logger.Debugf("Acquired lock [%s] with token %d", name, token)
+	return lock, nil
+}
+
+type redisLock struct {
+	locker  *RedisLocker
+	name    string
+	key     string
+	owner   string
+	token   int64
+	renewal *renewal
+}
+
+func (lock *redisLock) Name() string {
+	return lock.name
+}
+
+func (lock *redisLock) Token() int64 {
+	return lock.token
+}
+
+func (lock *redisLock) Lost() <-chan struct{} {
+	return lock.renewal.lost
+}
+
+func (lock *redisLock) Release(ctx context.Context) error {
+	lost := lock.renewal.stop()
+	deleted, err := deleteScript.Run(ctx, lock.locker.client, []string{lock.key}, lock.owner).Int()
+	if err != nil {
+		return fmt.Errorf("failed to release lock [%s] [%w]", lock.name, err)
+	}
+	if lost || deleted == 0 {
+		return ErrLockLost
+	}
+	logger.Debugf("Released lock [%s]", lock.name)
+	return nil
+}
+
+func (lock *redisLock) renew(ctx context.Context) error {
+	renewed, err := renewScript.Run(ctx, lock.locker.client, []string{lock.key}, lock.owner, lock.locker.ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if renewed == 0 {
+		return errors.New("lock expired")
+	}
+	return nil
+}
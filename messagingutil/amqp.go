@@ -0,0 +1,144 @@
+package messagingutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// KeyHeader carries Message.Key in AMQP messages
+const KeyHeader = "message-key"
+
+// AmqpProducer publishes messages to an exchange with Message.Topic as routing
+// key and waits for the publisher confirm of each message
+type AmqpProducer struct {
+	helper   *amqputil.AmqpConnectionHelper
+	exchange string
+
+	mutex       sync.Mutex
+	amqpContext *amqputil.AmqpContext
+}
+
+// NewAmqpProducer creates an AmqpProducer. If exchange is empty, messages are
+// published to the queue named by Message.Topic, which is declared if missing.
+func NewAmqpProducer(helper *amqputil.AmqpConnectionHelper, exchange string) *AmqpProducer {
+	return &AmqpProducer{helper: helper, exchange: exchange}
+}
+
+func (producer *AmqpProducer) Publish(ctx context.Context, message Message) error {
+	headers := amqp.Table{}
+	for key, value := range message.Headers {
+		headers[key] = value
+	}
+	if message.Key != "" {
+		headers[KeyHeader] = message.Key
+	}
+	publishing := amqp.Publishing{
+		DeliveryMode: amqp.Persistent,
+		Timestamp:    message.Time,
+		Headers:      headers,
+		Body:         message.Value,
+	}
+
+	producer.mutex.Lock()
+	defer producer.mutex.Unlock()
+	if producer.amqpContext == nil {
+		if producer.amqpContext = producer.helper.GetAmqpContext(""); producer.amqpContext == nil {
+			return fmt.Errorf("cannot connect to AMQP [%s]", producer.helper.AmqpConnectionURL)
+		}
+	}
+	if producer.exchange == "" {
+		if err := producer.amqpContext.EnsureQueueExists(message.Topic); err != nil {
+			return err
+		}
+	}
+	return producer.amqpContext.PublishConfirmed(ctx, producer.exchange, message.Topic, publishing)
+}
+
+func (producer *AmqpProducer) Close() error {
+	producer.mutex.Lock()
+	defer producer.mutex.Unlock()
+	if producer.amqpContext == nil {
+		return nil
+	}
+	err := producer.amqpContext.Close()
+	producer.amqpContext = nil
+	return err
+}
+
+// AmqpConsumer consumes messages from a queue. Messages the handler returns an
+// error for are rejected without requeuing, i.e. dead lettered if the queue
+// has a dead letter exchange.
+type AmqpConsumer struct {
+	helper     *amqputil.AmqpConnectionHelper
+	queue      string
+	consumerID string
+	prefetch   int
+}
+
+// NewAmqpConsumer creates an AmqpConsumer receiving up to prefetch unacknowledged messages at once
+func NewAmqpConsumer(helper *amqputil.AmqpConnectionHelper, queue, consumerID string, prefetch int) *AmqpConsumer {
+	if prefetch <= 0 {
+		prefetch = 1
+	}
+	return &AmqpConsumer{helper: helper, queue: queue, consumerID: consumerID, prefetch: prefetch}
+}
+
+func (consumer *AmqpConsumer) Consume(ctx context.Context, handler Handler) error {
+	amqpContext := consumer.helper.GetAmqpContext(consumer.consumerID)
+	if amqpContext == nil {
+		return fmt.Errorf("cannot connect to AMQP [%s]", consumer.helper.AmqpConnectionURL)
+	}
+	defer amqpContext.Close()
+	if err := amqpContext.EnsureQueueExists(consumer.queue); err != nil {
+		return err
+	}
+	channel := amqpContext.Channel()
+	if err := channel.Qos(consumer.prefetch, 0, false); err != nil {
+		return err
+	}
+	deliveries, err := channel.Consume(consumer.queue, consumer.consumerID, false, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("cannot consume queue [%s] [%w]", consumer.queue, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			channel.Cancel(consumer.consumerID, false)
+			return ctx.Err()
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return errors.New("AMQP delivery channel closed")
+			}
+			message := messageOf(&delivery)
+			if err := handler(ctx, message); err != nil {
+				logger.Errorf("Failed to handle message from [%s], rejecting it: %v", consumer.queue, err)
+				delivery.Nack(false, false)
+				continue
+			}
+			delivery.Ack(false)
+		}
+	}
+}
+
+func (consumer *AmqpConsumer) Close() error {
+	return nil
+}
+
+func messageOf(delivery *amqp.Delivery) *Message {
+	message := &Message{Topic: delivery.RoutingKey, Value: delivery.Body, Time: delivery.Timestamp, Headers: map[string]string{}}
+	for key, value := range delivery.Headers {
+		if key == KeyHeader {
+			message.Key = fmt.Sprint(value)
+			continue
+		}
+		message.Headers[key] = fmt.Sprint(value)
+	}
+	return message
+}
@@ -0,0 +1,176 @@
+package messagingutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// config keys of the Kafka producer and consumer
+const (
+	kafkaBrokersConfigKey        = "kafka.brokers"
+	kafkaGroupIDConfigKey        = "kafka.groupid"
+	kafkaCommitConfigKey         = "kafka.commit"
+	kafkaCommitIntervalConfigKey = "kafka.commitinterval"
+)
+
+func init() {
+	apputil.RegisterConfigKeys("messagingutil",
+		apputil.ConfigKey{Key: kafkaBrokersConfigKey, Type: "list", Description: "Kafka broker addresses"},
+		apputil.ConfigKey{Key: kafkaGroupIDConfigKey, Type: "string", Description: "Kafka consumer group"},
+		apputil.ConfigKey{Key: kafkaCommitConfigKey, Type: "string", Default: "sync", Description: "commit strategy, sync or interval"},
+		apputil.ConfigKey{Key: kafkaCommitIntervalConfigKey, Type: "duration", Default: "1s", Description: "commit interval of the interval strategy"},
+	)
+}
+
+// CommitStrategy defines when offsets of consumed Kafka messages are committed
+type CommitStrategy string
+
+const (
+	// CommitSync commits the offset of each message after the handler returned,
+	// so no message is lost, but throughput is limited by the commit roundtrips
+	CommitSync CommitStrategy = "sync"
+	// CommitInterval commits the offsets of handled messages periodically, so
+	// messages handled since the last commit are redelivered after a crash
+	CommitInterval CommitStrategy = "interval"
+)
+
+// KafkaProducer publishes messages to Kafka. Messages with the same key are
+// written to the same partition.
+type KafkaProducer struct {
+	writer *kafka.Writer
+}
+
+// NewKafkaProducer creates a KafkaProducer waiting for all in-sync replicas to acknowledge messages
+func NewKafkaProducer(brokers []string) *KafkaProducer {
+	return &KafkaProducer{writer: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 10 * time.Millisecond,
+	}}
+}
+
+// NewKafkaProducerFromConfig creates a KafkaProducer for the brokers configured as list kafka.brokers
+func NewKafkaProducerFromConfig() (*KafkaProducer, error) {
+	brokers := viper.GetStringSlice(kafkaBrokersConfigKey)
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("missing config [%s]", kafkaBrokersConfigKey)
+	}
+	return NewKafkaProducer(brokers), nil
+}
+
+func (producer *KafkaProducer) Publish(ctx context.Context, message Message) error {
+	if err := producer.writer.WriteMessages(ctx, kafkaMessage(message)); err != nil {
+		return fmt.Errorf("failed to publish message to [%s] [%w]", message.Topic, err)
+	}
+	return nil
+}
+
+func (producer *KafkaProducer) Close() error {
+	return producer.writer.Close()
+}
+
+// KafkaConsumerOptions configures a KafkaConsumer
+type KafkaConsumerOptions struct {
+	Brokers []string
+	// GroupID of the consumer group, whose members share the partitions of the topics
+	GroupID        string
+	Topics         []string
+	CommitStrategy CommitStrategy // default CommitSync
+	CommitInterval time.Duration  // of CommitInterval, default 1s
+}
+
+// KafkaConsumer consumes messages as member of a consumer group. If the
+// handler returns an error, Consume returns it without committing the
+// message, so it is redelivered when consuming is restarted.
+type KafkaConsumer struct {
+	reader  *kafka.Reader
+	options KafkaConsumerOptions
+}
+
+// NewKafkaConsumer creates a KafkaConsumer
+func NewKafkaConsumer(options KafkaConsumerOptions) (*KafkaConsumer, error) {
+	if len(options.Brokers) == 0 || options.GroupID == "" || len(options.Topics) == 0 {
+		return nil, errors.New("brokers, group ID and topics are required")
+	}
+	config := kafka.ReaderConfig{
+		Brokers:     options.Brokers,
+		GroupID:     options.GroupID,
+		GroupTopics: options.Topics,
+	}
+	switch options.CommitStrategy {
+	case "", CommitSync:
+		options.CommitStrategy = CommitSync
+	case CommitInterval:
+		if options.CommitInterval <= 0 {
+			options.CommitInterval = time.Second
+		}
+		config.CommitInterval = options.CommitInterval
+	default:
+		return nil, fmt.Errorf("unknown commit strategy [%s]", options.CommitStrategy)
+	}
+	return &KafkaConsumer{reader: kafka.NewReader(config), options: options}, nil
+}
+
+// NewKafkaConsumerFromConfig creates a KafkaConsumer for the given topics configured
+// by kafka.brokers, kafka.groupid, kafka.commit (sync or interval) and kafka.commitinterval
+func NewKafkaConsumerFromConfig(topics ...string) (*KafkaConsumer, error) {
+	commitInterval, err := apputil.GetDuration(kafkaCommitIntervalConfigKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewKafkaConsumer(KafkaConsumerOptions{
+		Brokers:        viper.GetStringSlice(kafkaBrokersConfigKey),
+		GroupID:        viper.GetString(kafkaGroupIDConfigKey),
+		Topics:         topics,
+		CommitStrategy: CommitStrategy(viper.GetString(kafkaCommitConfigKey)),
+		CommitInterval: commitInterval,
+	})
+}
+
+func (consumer *KafkaConsumer) Consume(ctx context.Context, handler Handler) error {
+	for {
+		received, err := consumer.reader.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+		message := messageOfKafka(received)
+		if err := handler(ctx, message); err != nil {
+			return fmt.Errorf("failed to handle message from [%s] partition %d offset %d [%w]", received.Topic, received.Partition, received.Offset, err)
+		}
+		// with CommitInterval the commit is only queued
+		if err := consumer.reader.CommitMessages(ctx, received); err != nil {
+			return fmt.Errorf("failed to commit offset of [%s] [%w]", received.Topic, err)
+		}
+	}
+}
+
+func (consumer *KafkaConsumer) Close() error {
+	return consumer.reader.Close()
+}
+
+func kafkaMessage(message Message) kafka.Message {
+	converted := kafka.Message{Topic: message.Topic, Value: message.Value, Time: message.Time}
+	if message.Key != "" {
+		converted.Key = []byte(message.Key)
+	}
+	for key, value := range message.Headers {
+		converted.Headers = append(converted.Headers, kafka.Header{Key: key, Value: []byte(value)})
+	}
+	return converted
+}
+
+func messageOfKafka(received kafka.Message) *Message {
+	message := &Message{Topic: received.Topic, Key: string(received.Key), Value: received.Value, Time: received.Time, Headers: map[string]string{}}
+	for _, header := range received.Headers {
+		message.Headers[header.Key] = string(header.Value)
+	}
+	return message
+}
@@ -0,0 +1,245 @@
+package messagingutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/segmentio/kafka-go"
+	"github.com/spf13/viper"
+)
+
+// contentTypeHeader carries the content type of messages published by KafkaAccessor
+const contentTypeHeader = "content-type"
+
+// KafkaAccessor implements amqputil.AmqpAccessor with Kafka, so code written
+// against amqputil runs unchanged. Queues are topics, which are created on
+// first publish if the cluster allows it, and the consumerId is the consumer
+// group. Received deliveries commit their offset on Ack or Nack. A requeued
+// message is published to the end of its topic again before its offset is
+// committed. Queue options and Channel are not supported.
+type KafkaAccessor struct {
+	brokers    []string
+	consumerId string
+	writer     *kafka.Writer
+
+	mutex   sync.Mutex
+	readers map[string]*kafka.Reader
+	err     error
+}
+
+var _ amqputil.AmqpAccessor = (*KafkaAccessor)(nil)
+
+// NewKafkaAccessor creates a KafkaAccessor consuming as group consumerId
+func NewKafkaAccessor(brokers []string, consumerId string) *KafkaAccessor {
+	return &KafkaAccessor{
+		brokers:    brokers,
+		consumerId: consumerId,
+		writer: &kafka.Writer{
+			Addr:                   kafka.TCP(brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			BatchTimeout:           10 * time.Millisecond,
+			AllowAutoTopicCreation: true,
+		},
+		readers: make(map[string]*kafka.Reader),
+	}
+}
+
+// NewKafkaAccessorFromConfig creates a KafkaAccessor for the brokers configured as list kafka.brokers
+func NewKafkaAccessorFromConfig(consumerId string) (*KafkaAccessor, error) {
+	brokers := viper.GetStringSlice(kafkaBrokersConfigKey)
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("missing config [%s]", kafkaBrokersConfigKey)
+	}
+	return NewKafkaAccessor(brokers, consumerId), nil
+}
+
+func (accessor *KafkaAccessor) PublishMessage(queueName string, message interface{}, options ...amqputil.QueueOptions) error {
+	return accessor.PublishMessageCtx(context.Background(), queueName, message, options...)
+}
+
+// PublishMessageCtx writes message JSON encoded to topic queueName, options are ignored
+func (accessor *KafkaAccessor) PublishMessageCtx(ctx context.Context, queueName string, message interface{}, options ...amqputil.QueueOptions) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return accessor.fail(fmt.Errorf("failed to encode message for [%s] [%w]", queueName, err))
+	}
+	err = accessor.writer.WriteMessages(ctx, kafka.Message{
+		Topic:   queueName,
+		Value:   body,
+		Headers: []kafka.Header{{Key: contentTypeHeader, Value: []byte(amqputil.ContentTypeJSON)}},
+	})
+	if err != nil {
+		return accessor.fail(fmt.Errorf("failed to publish message to [%s] [%w]", queueName, err))
+	}
+	return nil
+}
+
+// ReceiveMessage works like ReceiveMessageCtx, but returns
+// amqputil.ErrNoMessage if no message arrives within amqputil.DefaultReceiveTimeout
+func (accessor *KafkaAccessor) ReceiveMessage(queueName string, message interface{}) (*amqp.Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), amqputil.DefaultReceiveTimeout)
+	defer cancel()
+	delivery, err := accessor.ReceiveMessageCtx(ctx, queueName, message)
+	if errors.Is(err, context.DeadlineExceeded) {
+		accessor.SetLastError(amqputil.ErrNoMessage)
+		return nil, amqputil.ErrNoMessage
+	}
+	return delivery, err
+}
+
+// ReceiveMessageCtx fetches the next message of topic queueName and decodes it into message
+func (accessor *KafkaAccessor) ReceiveMessageCtx(ctx context.Context, queueName string, message interface{}) (*amqp.Delivery, error) {
+	reader := accessor.reader(queueName)
+	received, err := reader.FetchMessage(ctx)
+	if err != nil {
+		return nil, accessor.fail(err)
+	}
+	delivery := deliveryOfKafka(received, accessor.consumerId)
+	delivery.Acknowledger = &kafkaAcknowledger{reader: reader, writer: accessor.writer, message: received}
+	if err := json.Unmarshal(received.Value, message); err != nil {
+		return &delivery, accessor.fail(fmt.Errorf("failed to decode message from [%s] [%w]", queueName, err))
+	}
+	return &delivery, nil
+}
+
+// reader returns the reader of the consumer group for topic
+func (accessor *KafkaAccessor) reader(topic string) *kafka.Reader {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	reader, ok := accessor.readers[topic]
+	if !ok {
+		reader = kafka.NewReader(kafka.ReaderConfig{Brokers: accessor.brokers, GroupID: accessor.consumerId, Topic: topic})
+		accessor.readers[topic] = reader
+	}
+	return reader
+}
+
+// Channel returns nil, as Kafka has no AMQP channel
+func (accessor *KafkaAccessor) Channel() amqputil.ChannelAccessor {
+	return nil
+}
+
+// Ping verifies that the first reachable broker accepts connections
+func (accessor *KafkaAccessor) Ping(ctx context.Context) error {
+	var err error
+	for _, broker := range accessor.brokers {
+		var connection *kafka.Conn
+		if connection, err = kafka.DialContext(ctx, "tcp", broker); err == nil {
+			return connection.Close()
+		}
+	}
+	if err == nil {
+		err = errors.New("no Kafka brokers configured")
+	}
+	return fmt.Errorf("cannot connect to Kafka [%w]", err)
+}
+
+// Close closes the writer and all readers
+func (accessor *KafkaAccessor) Close() error {
+	err := accessor.writer.Close()
+	if resetErr := accessor.Reset(); err == nil {
+		err = resetErr
+	}
+	return err
+}
+
+// Reset closes the readers, uncommitted messages are consumed again
+func (accessor *KafkaAccessor) Reset() error {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	var err error
+	for topic, reader := range accessor.readers {
+		if closeErr := reader.Close(); err == nil {
+			err = closeErr
+		}
+		delete(accessor.readers, topic)
+	}
+	accessor.err = nil
+	return err
+}
+
+func (accessor *KafkaAccessor) LastError() error {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	return accessor.err
+}
+
+func (accessor *KafkaAccessor) SetLastError(err error) {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	accessor.err = err
+}
+
+func (accessor *KafkaAccessor) ResetError() {
+	accessor.SetLastError(nil)
+}
+
+func (accessor *KafkaAccessor) fail(err error) error {
+	accessor.SetLastError(err)
+	return err
+}
+
+// kafkaCommitter commits offsets, i.e. a kafka.Reader
+type kafkaCommitter interface {
+	CommitMessages(ctx context.Context, messages ...kafka.Message) error
+}
+
+// kafkaWriter writes messages, i.e. a kafka.Writer
+type kafkaWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+}
+
+// kafkaAcknowledger commits the offset of a received message, requeued
+// messages are written to their topic again first
+type kafkaAcknowledger struct {
+	reader  kafkaCommitter
+	writer  kafkaWriter
+	message kafka.Message
+}
+
+func (acknowledger *kafkaAcknowledger) Ack(tag uint64, multiple bool) error {
+	return acknowledger.reader.CommitMessages(context.Background(), acknowledger.message)
+}
+
+func (acknowledger *kafkaAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		message := acknowledger.message
+		if err := acknowledger.writer.WriteMessages(context.Background(), kafka.Message{
+			Topic: message.Topic, Key: message.Key, Value: message.Value, Headers: message.Headers,
+		}); err != nil {
+			return fmt.Errorf("failed to requeue message of [%s] at offset %d [%w]", message.Topic, message.Offset, err)
+		}
+	}
+	return acknowledger.Ack(tag, multiple)
+}
+
+func (acknowledger *kafkaAcknowledger) Reject(tag uint64, requeue bool) error {
+	return acknowledger.Nack(tag, false, requeue)
+}
+
+func deliveryOfKafka(received kafka.Message, consumerId string) amqp.Delivery {
+	delivery := amqp.Delivery{
+		ConsumerTag: consumerId,
+		DeliveryTag: uint64(received.Offset),
+		RoutingKey:  received.Topic,
+		Timestamp:   received.Time,
+		Body:        received.Value,
+		Headers:     amqp.Table{},
+	}
+	for _, header := range received.Headers {
+		if header.Key == contentTypeHeader {
+			delivery.ContentType = string(header.Value)
+			continue
+		}
+		delivery.Headers[header.Key] = string(header.Value)
+	}
+	return delivery
+}
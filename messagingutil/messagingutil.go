@@ -0,0 +1,43 @@
+// Package messagingutil defines broker agnostic producers and consumers with
+// implementations for AMQP, Kafka and NATS JetStream
+package messagingutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+var logger = apputil.Named("messagingutil")
+
+// Message is a message sent or received via a broker
+type Message struct {
+	// Topic is the Kafka topic or the AMQP routing key
+	Topic string
+	// Key selects the Kafka partition, so messages with the same key are
+	// consumed in order. It is sent as message-key header via AMQP.
+	Key     string
+	Value   []byte
+	Headers map[string]string
+	Time    time.Time
+}
+
+// Producer publishes messages
+type Producer interface {
+	// Publish publishes the message and returns when the broker accepted it
+	Publish(ctx context.Context, message Message) error
+	Close() error
+}
+
+// Handler processes a received message. A message is acknowledged if the
+// handler returns nil, see the consumers for the handling of errors.
+type Handler func(ctx context.Context, message *Message) error
+
+// Consumer consumes messages
+type Consumer interface {
+	// Consume calls handler for each received message until ctx is done or
+	// consuming fails, which is returned
+	Consume(ctx context.Context, handler Handler) error
+	Close() error
+}
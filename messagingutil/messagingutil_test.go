@@ -0,0 +1,106 @@
+package messagingutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaMessageConversion(t *testing.T) {
+	message := Message{Topic: "orders", Key: "order-1", Value: []byte("created"), Headers: map[string]string{"source": "shop"}, Time: time.Now()}
+	received := messageOfKafka(kafkaMessage(message))
+	if received.Topic != "orders" || received.Key != "order-1" || string(received.Value) != "created" || received.Headers["source"] != "shop" {
+		t.Errorf("unexpected message %+v", received)
+	}
+}
+
+func TestAmqpMessageConversion(t *testing.T) {
+	received := messageOf(&amqp.Delivery{RoutingKey: "orders", Body: []byte("created"), Headers: amqp.Table{KeyHeader: "order-1", "attempt": int32(2)}})
+	if received.Topic != "orders" || received.Key != "order-1" || received.Headers["attempt"] != "2" {
+		t.Errorf("unexpected message %+v", received)
+	}
+	if _, ok := received.Headers[KeyHeader]; ok {
+		t.Error("expected key header to be removed")
+	}
+}
+
+func TestNewKafkaConsumerValidates(t *testing.T) {
+	if _, err := NewKafkaConsumer(KafkaConsumerOptions{Brokers: []string{"localhost:9092"}, Topics: []string{"orders"}}); err == nil {
+		t.Error("expected error without group ID")
+	}
+	if _, err := NewKafkaConsumer(KafkaConsumerOptions{Brokers: []string{"localhost:9092"}, GroupID: "shop", Topics: []string{"orders"}, CommitStrategy: "never"}); err == nil {
+		t.Error("expected error for unknown commit strategy")
+	}
+}
+
+func TestNewNatsConsumerValidates(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewNatsConsumer(ctx, NatsConsumerOptions{URL: "nats://localhost:4222", Stream: "ORDERS"}); err == nil {
+		t.Error("expected error without durable name")
+	}
+	if _, err := NewNatsConsumer(ctx, NatsConsumerOptions{URL: "nats://localhost:4222", Stream: "ORDERS", Durable: "shop", AckPolicy: "sometimes"}); err == nil {
+		t.Error("expected error for unknown ack policy")
+	}
+}
+
+func TestKafkaDeliveryConversion(t *testing.T) {
+	delivery := deliveryOfKafka(kafka.Message{Topic: "orders", Offset: 7, Value: []byte(`{}`),
+		Headers: []kafka.Header{{Key: contentTypeHeader, Value: []byte("application/json")}, {Key: "tenant", Value: []byte("a")}}}, "billing")
+	if delivery.RoutingKey != "orders" || delivery.DeliveryTag != 7 || delivery.ConsumerTag != "billing" ||
+		delivery.ContentType != "application/json" || delivery.Headers["tenant"] != "a" {
+		t.Errorf("unexpected delivery %+v", delivery)
+	}
+}
+
+// fakeKafka records committed and written messages
+type fakeKafka struct {
+	committed, written []kafka.Message
+	writeErr           error
+}
+
+func (fake *fakeKafka) CommitMessages(ctx context.Context, messages ...kafka.Message) error {
+	fake.committed = append(fake.committed, messages...)
+	return nil
+}
+
+func (fake *fakeKafka) WriteMessages(ctx context.Context, messages ...kafka.Message) error {
+	if fake.writeErr != nil {
+		return fake.writeErr
+	}
+	fake.written = append(fake.written, messages...)
+	return nil
+}
+
+func TestKafkaNackRequeues(t *testing.T) {
+	fake := &fakeKafka{}
+	message := kafka.Message{Topic: "orders", Partition: 1, Offset: 7, Key: []byte("k"), Value: []byte(`{}`)}
+	acknowledger := &kafkaAcknowledger{reader: fake, writer: fake, message: message}
+	if err := acknowledger.Nack(7, false, true); err != nil {
+		t.Fatal(err)
+	}
+	if len(fake.written) != 1 || fake.written[0].Topic != "orders" || string(fake.written[0].Key) != "k" || fake.written[0].Offset != 0 {
+		t.Errorf("expected requeued message to be written to its topic again, got %+v", fake.written)
+	}
+	if len(fake.committed) != 1 || fake.committed[0].Offset != 7 {
+		t.Errorf("expected offset of requeued message to be committed, got %+v", fake.committed)
+	}
+
+	fake = &fakeKafka{writeErr: errors.New("unavailable")}
+	acknowledger = &kafkaAcknowledger{reader: fake, writer: fake, message: message}
+	if err := acknowledger.Nack(7, false, true); err == nil || len(fake.committed) != 0 {
+		t.Errorf("expected offset to stay uncommitted if requeueing failed, got %v %+v", err, fake.committed)
+	}
+	if err := acknowledger.Nack(7, false, false); err != nil || len(fake.written) != 0 || len(fake.committed) != 1 {
+		t.Errorf("expected discarded message to be committed only, got %v", err)
+	}
+}
+
+func TestNatsName(t *testing.T) {
+	if name := natsName("orders.created v1"); name != "orders_created_v1" {
+		t.Errorf("unexpected stream name %s", name)
+	}
+}
@@ -0,0 +1,225 @@
+package messagingutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/spf13/viper"
+)
+
+// config keys of the NATS producer and consumer
+const (
+	natsURLConfigKey        = "nats.url"
+	natsStreamConfigKey     = "nats.stream"
+	natsDurableConfigKey    = "nats.durable"
+	natsAckPolicyConfigKey  = "nats.ackpolicy"
+	natsAckWaitConfigKey    = "nats.ackwait"
+	natsMaxDeliverConfigKey = "nats.maxdeliver"
+)
+
+func init() {
+	apputil.RegisterConfigKeys("messagingutil",
+		apputil.ConfigKey{Key: natsURLConfigKey, Type: "string", Description: "NATS server URL"},
+		apputil.ConfigKey{Key: natsStreamConfigKey, Type: "string", Description: "JetStream stream consumed from"},
+		apputil.ConfigKey{Key: natsDurableConfigKey, Type: "string", Description: "name of the durable JetStream consumer"},
+		apputil.ConfigKey{Key: natsAckPolicyConfigKey, Type: "string", Default: "explicit", Description: "explicit, all or none"},
+		apputil.ConfigKey{Key: natsAckWaitConfigKey, Type: "duration", Description: "time until unacknowledged messages are redelivered"},
+		apputil.ConfigKey{Key: natsMaxDeliverConfigKey, Type: "int", Description: "maximum deliveries of a message, default unlimited"},
+	)
+}
+
+// NatsProducer publishes messages to JetStream with Message.Topic as subject
+// and waits for the acknowledgement of the stream
+type NatsProducer struct {
+	conn      *nats.Conn
+	jetStream jetstream.JetStream
+}
+
+// NewNatsProducer connects to the NATS server at url, e.g. nats://localhost:4222
+func NewNatsProducer(url string) (*NatsProducer, error) {
+	conn, jetStream, err := connectNats(url)
+	if err != nil {
+		return nil, err
+	}
+	return &NatsProducer{conn: conn, jetStream: jetStream}, nil
+}
+
+// NewNatsProducerFromConfig connects to the NATS server configured as nats.url
+func NewNatsProducerFromConfig() (*NatsProducer, error) {
+	return NewNatsProducer(viper.GetString(natsURLConfigKey))
+}
+
+func (producer *NatsProducer) Publish(ctx context.Context, message Message) error {
+	msg := nats.NewMsg(message.Topic)
+	msg.Data = message.Value
+	for key, value := range message.Headers {
+		msg.Header.Set(key, value)
+	}
+	if message.Key != "" {
+		msg.Header.Set(KeyHeader, message.Key)
+	}
+	if _, err := producer.jetStream.PublishMsg(ctx, msg); err != nil {
+		return fmt.Errorf("failed to publish message to [%s] [%w]", message.Topic, err)
+	}
+	return nil
+}
+
+func (producer *NatsProducer) Close() error {
+	return producer.conn.Drain()
+}
+
+// NatsConsumerOptions configures a NatsConsumer
+type NatsConsumerOptions struct {
+	URL    string
+	Stream string // name of the existing stream to consume
+	// Durable is the name of the consumer, whose position in the stream is kept
+	// by the server and shared by all instances using the same name
+	Durable string
+	// FilterSubjects restricts consumed messages to these subjects, all if empty
+	FilterSubjects []string
+	// AckPolicy is explicit (default, each message is acknowledged), all
+	// (acknowledging a message acknowledges all previous ones) or none
+	AckPolicy string
+	AckWait   time.Duration // time until unacknowledged messages are redelivered, server default if 0
+	// MaxDeliver limits the deliveries of a message the handler fails for, unlimited if 0
+	MaxDeliver int
+}
+
+// NatsConsumer consumes messages from a JetStream stream via a durable
+// consumer. Messages the handler returns an error for are redelivered.
+type NatsConsumer struct {
+	conn     *nats.Conn
+	consumer jetstream.Consumer
+	ackNone  bool
+}
+
+// NewNatsConsumer connects to the NATS server and creates or updates the durable consumer
+func NewNatsConsumer(ctx context.Context, options NatsConsumerOptions) (*NatsConsumer, error) {
+	if options.Stream == "" || options.Durable == "" {
+		return nil, errors.New("stream and durable name are required")
+	}
+	config := jetstream.ConsumerConfig{
+		Durable:        options.Durable,
+		FilterSubjects: options.FilterSubjects,
+		AckWait:        options.AckWait,
+		MaxDeliver:     options.MaxDeliver,
+	}
+	switch options.AckPolicy {
+	case "", "explicit":
+		config.AckPolicy = jetstream.AckExplicitPolicy
+	case "all":
+		config.AckPolicy = jetstream.AckAllPolicy
+	case "none":
+		config.AckPolicy = jetstream.AckNonePolicy
+	default:
+		return nil, fmt.Errorf("unknown ack policy [%s]", options.AckPolicy)
+	}
+	if config.MaxDeliver == 0 {
+		config.MaxDeliver = -1
+	}
+
+	conn, jetStream, err := connectNats(options.URL)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := jetStream.CreateOrUpdateConsumer(ctx, options.Stream, config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("cannot create consumer [%s] of stream [%s] [%w]", options.Durable, options.Stream, err)
+	}
+	return &NatsConsumer{conn: conn, consumer: consumer, ackNone: config.AckPolicy == jetstream.AckNonePolicy}, nil
+}
+
+// NewNatsConsumerFromConfig creates a NatsConsumer for the given subjects configured by
+// nats.url, nats.stream, nats.durable, nats.ackpolicy, nats.ackwait and nats.maxdeliver
+func NewNatsConsumerFromConfig(ctx context.Context, subjects ...string) (*NatsConsumer, error) {
+	ackWait, err := apputil.GetDuration(natsAckWaitConfigKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewNatsConsumer(ctx, NatsConsumerOptions{
+		URL:            viper.GetString(natsURLConfigKey),
+		Stream:         viper.GetString(natsStreamConfigKey),
+		Durable:        viper.GetString(natsDurableConfigKey),
+		FilterSubjects: subjects,
+		AckPolicy:      viper.GetString(natsAckPolicyConfigKey),
+		AckWait:        ackWait,
+		MaxDeliver:     viper.GetInt(natsMaxDeliverConfigKey),
+	})
+}
+
+func (consumer *NatsConsumer) Consume(ctx context.Context, handler Handler) error {
+	messages, err := consumer.consumer.Messages()
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, messages.Stop)
+	defer stop()
+	defer messages.Stop()
+
+	for {
+		msg, err := messages.Next()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		if err := handler(ctx, messageOfNats(msg)); err != nil {
+			logger.Errorf("Failed to handle message from [%s], requesting redelivery: %v", msg.Subject(), err)
+			if !consumer.ackNone {
+				msg.Nak()
+			}
+			continue
+		}
+		if !consumer.ackNone {
+			if err := msg.Ack(); err != nil {
+				logger.Warnf("Failed to acknowledge message from [%s]: %v", msg.Subject(), err)
+			}
+		}
+	}
+}
+
+func (consumer *NatsConsumer) Close() error {
+	return consumer.conn.Drain()
+}
+
+func connectNats(url string) (*nats.Conn, jetstream.JetStream, error) {
+	if url == "" {
+		return nil, nil, fmt.Errorf("missing config [%s]", natsURLConfigKey)
+	}
+	conn, err := nats.Connect(url, nats.Name(apputil.GetVersion()), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot connect to NATS [%s] [%w]", url, err)
+	}
+	jetStream, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, jetStream, nil
+}
+
+func messageOfNats(msg jetstream.Msg) *Message {
+	message := &Message{Topic: msg.Subject(), Value: msg.Data(), Headers: map[string]string{}}
+	if metadata, err := msg.Metadata(); err == nil {
+		message.Time = metadata.Timestamp
+	}
+	for key, values := range msg.Headers() {
+		if len(values) == 0 {
+			continue
+		}
+		if key == KeyHeader {
+			message.Key = values[0]
+			continue
+		}
+		message.Headers[key] = values[0]
+	}
+	return message
+}
@@ -0,0 +1,282 @@
+package messagingutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/spf13/viper"
+)
+
+// natsFetchWait limits single fetches, so cancellation is noticed in time
+const natsFetchWait = 5 * time.Second
+
+// NatsAccessor implements amqputil.AmqpAccessor with NATS JetStream, so code
+// written against amqputil runs unchanged. Each queue is a work queue stream
+// with the queue name as subject, which is created on first use and stored in
+// files for durable QueueOptions and in memory otherwise. The consumerId names
+// a durable consumer, whose position is kept by the server. Channel is not
+// supported.
+type NatsAccessor struct {
+	conn       *nats.Conn
+	jetStream  jetstream.JetStream
+	consumerId string
+
+	mutex     sync.Mutex
+	streams   map[string]bool
+	consumers map[string]jetstream.Consumer
+	err       error
+}
+
+var _ amqputil.AmqpAccessor = (*NatsAccessor)(nil)
+
+// NewNatsAccessor connects to the NATS server at url, e.g. nats://localhost:4222
+func NewNatsAccessor(url, consumerId string) (*NatsAccessor, error) {
+	conn, jetStream, err := connectNats(url)
+	if err != nil {
+		return nil, err
+	}
+	return &NatsAccessor{
+		conn:       conn,
+		jetStream:  jetStream,
+		consumerId: consumerId,
+		streams:    make(map[string]bool),
+		consumers:  make(map[string]jetstream.Consumer),
+	}, nil
+}
+
+// NewNatsAccessorFromConfig connects to the NATS server configured as nats.url
+func NewNatsAccessorFromConfig(consumerId string) (*NatsAccessor, error) {
+	return NewNatsAccessor(viper.GetString(natsURLConfigKey), consumerId)
+}
+
+func (accessor *NatsAccessor) PublishMessage(queueName string, message interface{}, options ...amqputil.QueueOptions) error {
+	return accessor.PublishMessageCtx(context.Background(), queueName, message, options...)
+}
+
+// PublishMessageCtx publishes message JSON encoded to the stream of queueName
+// and waits for the acknowledgement of the stream
+func (accessor *NatsAccessor) PublishMessageCtx(ctx context.Context, queueName string, message interface{}, options ...amqputil.QueueOptions) error {
+	if err := accessor.ensureStream(ctx, queueName, options...); err != nil {
+		return accessor.fail(err)
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		return accessor.fail(fmt.Errorf("failed to encode message for [%s] [%w]", queueName, err))
+	}
+	msg := nats.NewMsg(queueName)
+	msg.Data = body
+	msg.Header.Set(contentTypeHeader, amqputil.ContentTypeJSON)
+	if _, err := accessor.jetStream.PublishMsg(ctx, msg); err != nil {
+		return accessor.fail(fmt.Errorf("failed to publish message to [%s] [%w]", queueName, err))
+	}
+	return nil
+}
+
+// ReceiveMessage works like ReceiveMessageCtx, but returns
+// amqputil.ErrNoMessage if no message arrives within amqputil.DefaultReceiveTimeout
+func (accessor *NatsAccessor) ReceiveMessage(queueName string, message interface{}) (*amqp.Delivery, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), amqputil.DefaultReceiveTimeout)
+	defer cancel()
+	delivery, err := accessor.ReceiveMessageCtx(ctx, queueName, message)
+	if errors.Is(err, context.DeadlineExceeded) {
+		accessor.SetLastError(amqputil.ErrNoMessage)
+		return nil, amqputil.ErrNoMessage
+	}
+	return delivery, err
+}
+
+// ReceiveMessageCtx fetches the next message of queueName and decodes it into
+// message. Requeued messages are redelivered, rejected ones are terminated.
+func (accessor *NatsAccessor) ReceiveMessageCtx(ctx context.Context, queueName string, message interface{}) (*amqp.Delivery, error) {
+	consumer, err := accessor.consumer(ctx, queueName)
+	if err != nil {
+		return nil, accessor.fail(err)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, accessor.fail(err)
+		}
+		wait := natsFetchWait
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			if wait = time.Until(deadline); wait <= 0 {
+				return nil, accessor.fail(context.DeadlineExceeded)
+			}
+		}
+		msg, err := consumer.Next(jetstream.FetchMaxWait(wait))
+		if errors.Is(err, nats.ErrTimeout) {
+			continue
+		}
+		if err != nil {
+			return nil, accessor.fail(fmt.Errorf("failed to fetch message from [%s] [%w]", queueName, err))
+		}
+		delivery := deliveryOfNats(msg, accessor.consumerId)
+		if err := json.Unmarshal(msg.Data(), message); err != nil {
+			return &delivery, accessor.fail(fmt.Errorf("failed to decode message from [%s] [%w]", queueName, err))
+		}
+		return &delivery, nil
+	}
+}
+
+// ensureStream creates the stream of queueName if it was not created before
+func (accessor *NatsAccessor) ensureStream(ctx context.Context, queueName string, options ...amqputil.QueueOptions) error {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	if accessor.streams[queueName] {
+		return nil
+	}
+	config := jetstream.StreamConfig{
+		Name:      natsName(queueName),
+		Subjects:  []string{queueName},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.MemoryStorage,
+	}
+	if len(options) > 0 && (options[0].Durable || options[0].MaxRetries > 0) {
+		config.Storage = jetstream.FileStorage
+	}
+	if _, err := accessor.jetStream.CreateStream(ctx, config); err != nil && !errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+		return fmt.Errorf("cannot create stream for [%s] [%w]", queueName, err)
+	}
+	accessor.streams[queueName] = true
+	return nil
+}
+
+// consumer returns the durable consumer of queueName
+func (accessor *NatsAccessor) consumer(ctx context.Context, queueName string) (jetstream.Consumer, error) {
+	if err := accessor.ensureStream(ctx, queueName); err != nil {
+		return nil, err
+	}
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	if consumer, ok := accessor.consumers[queueName]; ok {
+		return consumer, nil
+	}
+	consumer, err := accessor.jetStream.CreateOrUpdateConsumer(ctx, natsName(queueName), jetstream.ConsumerConfig{
+		Durable:   natsName(accessor.consumerId),
+		AckPolicy: jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot create consumer [%s] for [%s] [%w]", accessor.consumerId, queueName, err)
+	}
+	accessor.consumers[queueName] = consumer
+	return consumer, nil
+}
+
+// Channel returns nil, as NATS has no AMQP channel
+func (accessor *NatsAccessor) Channel() amqputil.ChannelAccessor {
+	return nil
+}
+
+// Ping verifies that JetStream responds
+func (accessor *NatsAccessor) Ping(ctx context.Context) error {
+	if !accessor.conn.IsConnected() {
+		return fmt.Errorf("NATS connection is %s", accessor.conn.Status())
+	}
+	if _, err := accessor.jetStream.AccountInfo(ctx); err != nil {
+		return fmt.Errorf("JetStream does not respond [%w]", err)
+	}
+	return nil
+}
+
+// Close drains the connection
+func (accessor *NatsAccessor) Close() error {
+	return accessor.conn.Drain()
+}
+
+// Reset forgets the known streams and consumers, which are looked up again on next use
+func (accessor *NatsAccessor) Reset() error {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	accessor.streams = make(map[string]bool)
+	accessor.consumers = make(map[string]jetstream.Consumer)
+	accessor.err = nil
+	return nil
+}
+
+func (accessor *NatsAccessor) LastError() error {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	return accessor.err
+}
+
+func (accessor *NatsAccessor) SetLastError(err error) {
+	accessor.mutex.Lock()
+	defer accessor.mutex.Unlock()
+	accessor.err = err
+}
+
+func (accessor *NatsAccessor) ResetError() {
+	accessor.SetLastError(nil)
+}
+
+func (accessor *NatsAccessor) fail(err error) error {
+	accessor.SetLastError(err)
+	return err
+}
+
+// natsName replaces the characters which are invalid in stream and consumer names
+func natsName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', '/', '\\', ' ', '\t':
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// natsAcknowledger settles a fetched JetStream message
+type natsAcknowledger struct {
+	msg jetstream.Msg
+}
+
+func (acknowledger *natsAcknowledger) Ack(tag uint64, multiple bool) error {
+	return acknowledger.msg.Ack()
+}
+
+func (acknowledger *natsAcknowledger) Nack(tag uint64, multiple, requeue bool) error {
+	if requeue {
+		return acknowledger.msg.Nak()
+	}
+	return acknowledger.msg.Term()
+}
+
+func (acknowledger *natsAcknowledger) Reject(tag uint64, requeue bool) error {
+	return acknowledger.Nack(tag, false, requeue)
+}
+
+func deliveryOfNats(msg jetstream.Msg, consumerId string) amqp.Delivery {
+	delivery := amqp.Delivery{
+		Acknowledger: &natsAcknowledger{msg: msg},
+		ConsumerTag:  consumerId,
+		RoutingKey:   msg.Subject(),
+		Body:         msg.Data(),
+		Headers:      amqp.Table{},
+	}
+	if metadata, err := msg.Metadata(); err == nil {
+		delivery.DeliveryTag = metadata.Sequence.Stream
+		delivery.Timestamp = metadata.Timestamp
+		delivery.Redelivered = metadata.NumDelivered > 1
+		delivery.Headers["x-delivery-count"] = int64(metadata.NumDelivered - 1)
+	}
+	for key, values := range msg.Headers() {
+		if len(values) == 0 {
+			continue
+		}
+		if key == contentTypeHeader {
+			delivery.ContentType = values[0]
+			continue
+		}
+		delivery.Headers[key] = values[0]
+	}
+	return delivery
+}
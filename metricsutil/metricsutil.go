@@ -0,0 +1,124 @@
+// Package metricsutil provides Prometheus metrics following common naming
+// conventions and the registry served by serviceutil.Service
+package metricsutil
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/proto"
+)
+
+// ServiceLabel is the label holding the service name (see apputil.GetServiceName)
+// added to all metrics created by a Factory
+const ServiceLabel = "service"
+
+// DurationBuckets are the histogram buckets in seconds of Factory.Duration
+var DurationBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+var (
+	// Registry holds the metrics created by factories
+	Registry = prometheus.NewRegistry()
+	// Gatherer gathers the metrics of Registry with the service label and those
+	// registered with the default registry, e.g. via promauto. It is served by
+	// serviceutil.Service on /metrics.
+	Gatherer prometheus.Gatherer = prometheus.Gatherers{prometheus.DefaultGatherer, serviceGatherer{Registry}}
+)
+
+// Factory creates metrics named <subsystem>_<name> and registers them with Registry
+type Factory struct {
+	subsystem string
+}
+
+// NewFactory returns a Factory for the given subsystem, e.g. "orders" for orders_created_total
+func NewFactory(subsystem string) *Factory {
+	return &Factory{subsystem: subsystem}
+}
+
+// Counter creates a counter, whose name gets the suffix _total if missing
+func (factory *Factory) Counter(name string, help string, labels ...string) *prometheus.CounterVec {
+	if !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	counter := prometheus.NewCounterVec(prometheus.CounterOpts{Subsystem: factory.subsystem, Name: name, Help: help}, labels)
+	Registry.MustRegister(counter)
+	return counter
+}
+
+// Gauge creates a gauge
+func (factory *Factory) Gauge(name string, help string, labels ...string) *prometheus.GaugeVec {
+	gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{Subsystem: factory.subsystem, Name: name, Help: help}, labels)
+	Registry.MustRegister(gauge)
+	return gauge
+}
+
+// Histogram creates a histogram with the given buckets
+func (factory *Factory) Histogram(name string, help string, buckets []float64, labels ...string) *prometheus.HistogramVec {
+	histogram := prometheus.NewHistogramVec(prometheus.HistogramOpts{Subsystem: factory.subsystem, Name: name, Help: help, Buckets: buckets}, labels)
+	Registry.MustRegister(histogram)
+	return histogram
+}
+
+// Duration creates a histogram of durations with DurationBuckets, whose name
+// gets the suffix _seconds if missing. Observe values with Observe or ObserveSince.
+func (factory *Factory) Duration(name string, help string, labels ...string) *prometheus.HistogramVec {
+	if !strings.HasSuffix(name, "_seconds") {
+		name += "_seconds"
+	}
+	return factory.Histogram(name, help, DurationBuckets, labels...)
+}
+
+// Observe starts a timer and returns a function observing the elapsed seconds, e.g.
+//
+//	defer metricsutil.Observe(requestDuration.WithLabelValues("create"))()
+func Observe(observer prometheus.Observer) func() {
+	start := time.Now()
+	return func() {
+		ObserveSince(observer, start)
+	}
+}
+
+// ObserveSince observes the seconds elapsed since start
+func ObserveSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// serviceGatherer adds the service label to the gathered metrics, as the
+// service name is usually not known yet when metrics are created
+type serviceGatherer struct {
+	gatherer prometheus.Gatherer
+}
+
+func (gatherer serviceGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := gatherer.gatherer.Gather()
+	service := apputil.GetServiceName()
+	if service == "" {
+		return families, err
+	}
+	for _, family := range families {
+		for _, metric := range family.Metric {
+			if hasLabel(metric, ServiceLabel) {
+				continue
+			}
+			metric.Label = append(metric.Label, &dto.LabelPair{Name: proto.String(ServiceLabel), Value: proto.String(service)})
+			sort.Slice(metric.Label, func(i, j int) bool {
+				return metric.Label[i].GetName() < metric.Label[j].GetName()
+			})
+		}
+	}
+	return families, err
+}
+
+func hasLabel(metric *dto.Metric, name string) bool {
+	for _, label := range metric.Label {
+		if label.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,36 @@
+package metricsutil
+
+import (
+	"testing"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFactoryNamesAndServiceLabel(t *testing.T) {
+	apputil.InitConfigE("test", "orders", nil)
+	factory := NewFactory("checkout")
+	created := factory.Counter("orders_created", "The total number of created orders", "channel")
+	duration := factory.Duration("payment", "The duration of payments")
+	created.WithLabelValues("web").Inc()
+	Observe(duration.WithLabelValues())()
+
+	families, err := Gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, family := range families {
+		names[family.GetName()] = true
+		if family.GetName() == "checkout_orders_created_total" && !hasLabel(family.Metric[0], ServiceLabel) {
+			t.Errorf("expected service label, got %v", family.Metric[0].Label)
+		}
+	}
+	if !names["checkout_orders_created_total"] || !names["checkout_payment_seconds"] {
+		t.Errorf("expected conventional names, got %v", names)
+	}
+	if testutil.CollectAndCount(duration) != 1 {
+		t.Error("expected observed duration")
+	}
+}
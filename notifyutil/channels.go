@@ -0,0 +1,195 @@
+package notifyutil
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/smtp"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/science-computing/service-common-golang/httputil"
+)
+
+var defaultClient = httputil.NewClient(httputil.Options{Name: "notifications"})
+
+// WebhookChannel posts notifications to an HTTP endpoint
+type WebhookChannel struct {
+	ChannelName string // default "webhook"
+	URL         string
+	// Body renders the request body from the Notification, default is the
+	// Notification as JSON. Header ContentType is set to ContentType.
+	Body        *template.Template
+	ContentType string       // default application/json
+	Header      http.Header  // additional headers, e.g. for authentication
+	Client      *http.Client // default is a httputil client
+}
+
+func (channel *WebhookChannel) Name() string {
+	if channel.ChannelName != "" {
+		return channel.ChannelName
+	}
+	return "webhook"
+}
+
+func (channel *WebhookChannel) Send(ctx context.Context, notification Notification) error {
+	var body bytes.Buffer
+	if channel.Body != nil {
+		if err := channel.Body.Execute(&body, notification); err != nil {
+			return err
+		}
+	} else if err := json.NewEncoder(&body).Encode(notification); err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.URL, &body)
+	if err != nil {
+		return err
+	}
+	for name, values := range channel.Header {
+		request.Header[name] = values
+	}
+	contentType := channel.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	request.Header.Set("Content-Type", contentType)
+
+	client := channel.Client
+	if client == nil {
+		client = defaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status [%s]", response.Status)
+	}
+	return nil
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(value string) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+	"emoji": func(severity Severity) string {
+		switch severity {
+		case SeverityCritical:
+			return ":rotating_light:"
+		case SeverityWarning:
+			return ":warning:"
+		}
+		return ":information_source:"
+	},
+	"color": func(severity Severity) string {
+		switch severity {
+		case SeverityCritical:
+			return "D32F2F"
+		case SeverityWarning:
+			return "F9A825"
+		}
+		return "1976D2"
+	},
+	"sorted": sortedFields,
+}
+
+type field struct {
+	Name  string
+	Value string
+}
+
+func sortedFields(fields map[string]string) []field {
+	sorted := make([]field, 0, len(fields))
+	for name, value := range fields {
+		sorted = append(sorted, field{Name: name, Value: value})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// SlackTemplate renders Slack incoming webhook messages
+var SlackTemplate = template.Must(template.New("slack").Funcs(templateFuncs).Parse(
+	`{"text":{{json (printf "%s *%s* (%s)\n%s" (emoji .Severity) .Title .Service .Text)}}` +
+		`{{with sorted .Fields}},"attachments":[{"fields":[{{range $i, $f := .}}{{if $i}},{{end}}` +
+		`{"title":{{json $f.Name}},"value":{{json $f.Value}},"short":true}{{end}}]}]{{end}}}`))
+
+// TeamsTemplate renders Microsoft Teams incoming webhook messages
+var TeamsTemplate = template.Must(template.New("teams").Funcs(templateFuncs).Parse(
+	`{"@type":"MessageCard","@context":"https://schema.org/extensions","themeColor":"{{color .Severity}}",` +
+		`"summary":{{json .Title}},"sections":[{"activityTitle":{{json .Title}},"activitySubtitle":{{json .Service}},` +
+		`"text":{{json .Text}},"facts":[{{range $i, $f := sorted .Fields}}{{if $i}},{{end}}` +
+		`{"name":{{json $f.Name}},"value":{{json $f.Value}}}{{end}}]}]}`))
+
+// SlackChannel posts notifications to a Slack incoming webhook
+func SlackChannel(url string, client *http.Client) Channel {
+	return &WebhookChannel{ChannelName: "slack", URL: url, Body: SlackTemplate, Client: client}
+}
+
+// TeamsChannel posts notifications to a Microsoft Teams incoming webhook
+func TeamsChannel(url string, client *http.Client) Channel {
+	return &WebhookChannel{ChannelName: "teams", URL: url, Body: TeamsTemplate, Client: client}
+}
+
+// EmailChannel sends notifications as plain text emails via SMTP
+type EmailChannel struct {
+	Address  string // host:port of the SMTP server
+	Username string // enables PLAIN authentication if set
+	Password string
+	From     string
+	To       []string
+	// sendMail is replaced in tests
+	sendMail func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func (channel *EmailChannel) Name() string {
+	return "email"
+}
+
+func (channel *EmailChannel) Send(ctx context.Context, notification Notification) error {
+	var auth smtp.Auth
+	if channel.Username != "" {
+		host, _, _ := strings.Cut(channel.Address, ":")
+		auth = smtp.PlainAuth("", channel.Username, channel.Password, host)
+	}
+	sendMail := channel.sendMail
+	if sendMail == nil {
+		sendMail = smtp.SendMail
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- sendMail(channel.Address, auth, channel.From, channel.To, channel.message(notification))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (channel *EmailChannel) message(notification Notification) []byte {
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", channel.From)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(channel.To, ", "))
+	fmt.Fprintf(&message, "Subject: [%s] %s: %s\r\n", strings.ToUpper(string(notification.Severity)), notification.Service, headerValue(notification.Title))
+	fmt.Fprintf(&message, "Date: %s\r\n", notification.Time.Format("Mon, 02 Jan 2006 15:04:05 -0700"))
+	message.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(notification.Text)
+	message.WriteString("\r\n")
+	for _, f := range sortedFields(notification.Fields) {
+		fmt.Fprintf(&message, "\r\n%s: %s", f.Name, f.Value)
+	}
+	return []byte(message.String())
+}
+
+// headerValue prevents injecting headers with line breaks
+func headerValue(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
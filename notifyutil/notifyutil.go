@@ -0,0 +1,242 @@
+// Package notifyutil sends operational notifications like alerts on piling up
+// dead letters to chat webhooks, generic HTTP endpoints or via email
+package notifyutil
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/ratelimitutil"
+	"github.com/science-computing/service-common-golang/workerutil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/spf13/viper"
+)
+
+// configuration keys for NewNotifierFromConfig
+const (
+	slackURLConfigKey     = "notify.slack.url"
+	teamsURLConfigKey     = "notify.teams.url"
+	webhookURLConfigKey   = "notify.webhook.url"
+	smtpAddressConfigKey  = "notify.smtp.address"
+	smtpUsernameConfigKey = "notify.smtp.username"
+	smtpPasswordConfigKey = "notify.smtp.password"
+	smtpFromConfigKey     = "notify.smtp.from"
+	smtpToConfigKey       = "notify.smtp.to"
+)
+
+func init() {
+	apputil.RegisterConfigKeys("notifyutil",
+		apputil.ConfigKey{Key: slackURLConfigKey, Type: "string", Description: "Slack incoming webhook URL"},
+		apputil.ConfigKey{Key: teamsURLConfigKey, Type: "string", Description: "Microsoft Teams incoming webhook URL"},
+		apputil.ConfigKey{Key: webhookURLConfigKey, Type: "string", Description: "URL notifications are posted to as JSON"},
+		apputil.ConfigKey{Key: smtpAddressConfigKey, Type: "string", Description: "host:port of the SMTP server for email notifications"},
+		apputil.ConfigKey{Key: smtpUsernameConfigKey, Type: "string", Description: "SMTP username"},
+		apputil.ConfigKey{Key: smtpPasswordConfigKey, Type: "string", Description: "SMTP password"},
+		apputil.ConfigKey{Key: smtpFromConfigKey, Type: "string", Description: "sender of email notifications"},
+		apputil.ConfigKey{Key: smtpToConfigKey, Type: "list", Description: "recipients of email notifications"},
+	)
+}
+
+// results of notifications
+const (
+	resultSent    = "sent"
+	resultError   = "error"
+	resultLimited = "limited"
+	resultDropped = "dropped"
+)
+
+// ErrNoChannels is returned by NewNotifierFromConfig if no channel is configured
+var ErrNoChannels = errors.New("no notification channel configured")
+
+var (
+	logger = apputil.Named("notifyutil")
+
+	notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "notifications_total",
+		Help: "The total number of notifications by channel and result",
+	}, []string{"channel", "result"})
+)
+
+// Severity of a notification
+type Severity string
+
+const (
+	SeverityInfo     Severity = "info"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+)
+
+// Notification is sent to all channels of a Notifier
+type Notification struct {
+	Key      string // identifies the kind of notification for rate limiting, default Title
+	Title    string
+	Text     string
+	Severity Severity // default SeverityWarning
+	Fields   map[string]string
+	Service  string    // set to apputil.GetServiceName by the Notifier
+	Time     time.Time // set by the Notifier if zero
+}
+
+func (notification Notification) key() string {
+	if notification.Key != "" {
+		return notification.Key
+	}
+	return notification.Title
+}
+
+// Render executes the text template tmpl with data, e.g. to build the Text of
+// a Notification. A failing template renders as its error, so notifications
+// are never lost due to template errors.
+func Render(tmpl string, data any) string {
+	parsed, err := template.New("notification").Parse(tmpl)
+	if err != nil {
+		return fmt.Sprintf("invalid template [%s]: %v", tmpl, err)
+	}
+	var text bytes.Buffer
+	if err := parsed.Execute(&text, data); err != nil {
+		return fmt.Sprintf("failed to render template [%s]: %v", tmpl, err)
+	}
+	return text.String()
+}
+
+// Channel delivers notifications, e.g. SlackChannel
+type Channel interface {
+	Name() string
+	Send(ctx context.Context, notification Notification) error
+}
+
+// Options configures NewNotifier. Zero values select the defaults.
+type Options struct {
+	Channels  []Channel
+	Limit     ratelimitutil.Limit // notifications per channel and key, default 10 per hour
+	QueueSize int                 // notifications waiting for async delivery, default 100
+	Timeout   time.Duration       // timeout of a single delivery, default 30s
+}
+
+func (options *Options) setDefaults() {
+	if options.Limit.Rate == 0 {
+		options.Limit = ratelimitutil.Limit{Rate: 10, Period: time.Hour}
+	}
+	if options.QueueSize == 0 {
+		options.QueueSize = 100
+	}
+	if options.Timeout == 0 {
+		options.Timeout = 30 * time.Second
+	}
+}
+
+// Notifier delivers notifications to its channels. Repeated notifications with
+// the same key are rate limited per channel so alert storms do not flood them.
+type Notifier struct {
+	options Options
+	limiter *ratelimitutil.Limiter
+	pool    *workerutil.Pool
+}
+
+// NewNotifier creates a Notifier with its own delivery worker
+func NewNotifier(options Options) (*Notifier, error) {
+	options.setDefaults()
+	limiter, err := ratelimitutil.NewLimiter("notifications", ratelimitutil.NewMemoryStore(), options.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &Notifier{
+		options: options,
+		limiter: limiter,
+		pool:    workerutil.NewPool("notifications", 1, options.QueueSize),
+	}, nil
+}
+
+// NewNotifierFromConfig creates a Notifier with the channels configured by
+// notify.slack.url, notify.teams.url, notify.webhook.url and notify.smtp.*
+func NewNotifierFromConfig() (*Notifier, error) {
+	var channels []Channel
+	if url := viper.GetString(slackURLConfigKey); url != "" {
+		channels = append(channels, SlackChannel(url, nil))
+	}
+	if url := viper.GetString(teamsURLConfigKey); url != "" {
+		channels = append(channels, TeamsChannel(url, nil))
+	}
+	if url := viper.GetString(webhookURLConfigKey); url != "" {
+		channels = append(channels, &WebhookChannel{URL: url})
+	}
+	if address := viper.GetString(smtpAddressConfigKey); address != "" {
+		channels = append(channels, &EmailChannel{
+			Address:  address,
+			Username: viper.GetString(smtpUsernameConfigKey),
+			Password: viper.GetString(smtpPasswordConfigKey),
+			From:     viper.GetString(smtpFromConfigKey),
+			To:       viper.GetStringSlice(smtpToConfigKey),
+		})
+	}
+	if len(channels) == 0 {
+		return nil, ErrNoChannels
+	}
+	return NewNotifier(Options{Channels: channels})
+}
+
+// Notify queues the notification for delivery without blocking. If the queue
+// is full the notification is dropped and logged.
+func (notifier *Notifier) Notify(ctx context.Context, notification Notification) {
+	notification = notifier.complete(notification)
+	err := notifier.pool.TrySubmit(ctx, func(ctx context.Context) error {
+		return notifier.Send(ctx, notification)
+	})
+	if err != nil {
+		notifications.WithLabelValues("", resultDropped).Inc()
+		apputil.FromContext(ctx).Warnf("Dropped notification [%s]: %v", notification.Title, err)
+	}
+}
+
+// Send delivers the notification to all channels and returns the joined
+// errors of failed channels. Rate limited channels are skipped.
+func (notifier *Notifier) Send(ctx context.Context, notification Notification) error {
+	notification = notifier.complete(notification)
+	var errs []error
+	for _, channel := range notifier.options.Channels {
+		result, err := notifier.limiter.Allow(ctx, channel.Name()+":"+notification.key())
+		if err == nil && !result.Allowed {
+			notifications.WithLabelValues(channel.Name(), resultLimited).Inc()
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, notifier.options.Timeout)
+		err = channel.Send(sendCtx, notification)
+		cancel()
+		if err != nil {
+			notifications.WithLabelValues(channel.Name(), resultError).Inc()
+			errs = append(errs, fmt.Errorf("failed to send notification [%s] to [%s] [%w]", notification.Title, channel.Name(), err))
+			continue
+		}
+		notifications.WithLabelValues(channel.Name(), resultSent).Inc()
+	}
+	err := errors.Join(errs...)
+	if err != nil {
+		apputil.FromContext(ctx).Error(err.Error())
+	}
+	return err
+}
+
+// Close delivers the queued notifications until ctx is done
+func (notifier *Notifier) Close(ctx context.Context) error {
+	return notifier.pool.Shutdown(ctx)
+}
+
+func (notifier *Notifier) complete(notification Notification) Notification {
+	if notification.Severity == "" {
+		notification.Severity = SeverityWarning
+	}
+	if notification.Service == "" {
+		notification.Service = apputil.GetServiceName()
+	}
+	if notification.Time.IsZero() {
+		notification.Time = time.Now()
+	}
+	return notification
+}
@@ -0,0 +1,119 @@
+package notifyutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/ratelimitutil"
+)
+
+func TestSlackChannel(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	err := SlackChannel(server.URL, nil).Send(context.Background(), Notification{
+		Title: "Dead letters", Text: "42 \"messages\"\nwaiting", Severity: SeverityCritical,
+		Fields: map[string]string{"queue": "orders", "count": "42"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var message struct {
+		Text        string
+		Attachments []struct {
+			Fields []struct{ Title, Value string }
+		}
+	}
+	if err := json.Unmarshal(<-bodies, &message); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message.Text, "*Dead letters*") || !strings.Contains(message.Text, "\"messages\"\nwaiting") {
+		t.Errorf("unexpected text [%s]", message.Text)
+	}
+	if len(message.Attachments) != 1 || len(message.Attachments[0].Fields) != 2 || message.Attachments[0].Fields[0].Title != "count" {
+		t.Errorf("unexpected attachments %+v", message.Attachments)
+	}
+}
+
+type recordingChannel struct {
+	sent chan Notification
+	err  error
+}
+
+func (channel *recordingChannel) Name() string { return "recording" }
+
+func (channel *recordingChannel) Send(ctx context.Context, notification Notification) error {
+	channel.sent <- notification
+	return channel.err
+}
+
+func TestNotifierRateLimitsAndDelivers(t *testing.T) {
+	channel := &recordingChannel{sent: make(chan Notification, 10)}
+	notifier, err := NewNotifier(Options{Channels: []Channel{channel}, Limit: ratelimitutil.Limit{Rate: 2, Period: time.Hour}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		notifier.Notify(context.Background(), Notification{Title: "Dead letters"})
+	}
+	notifier.Notify(context.Background(), Notification{Title: "Other"})
+	if err := notifier.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(channel.sent) != 3 {
+		t.Errorf("expected 3 notifications after rate limiting, got %d", len(channel.sent))
+	}
+	if notification := <-channel.sent; notification.Severity != SeverityWarning || notification.Time.IsZero() {
+		t.Errorf("expected defaults to be set, got %+v", notification)
+	}
+
+	channel.err = errors.New("unavailable")
+	if err := notifier.Send(context.Background(), Notification{Title: "Failing"}); !errors.Is(err, channel.err) {
+		t.Errorf("expected channel error, got %v", err)
+	}
+}
+
+func TestEmailChannel(t *testing.T) {
+	var message string
+	channel := &EmailChannel{Address: "smtp.example.com:587", From: "alerts@example.com", To: []string{"ops@example.com"},
+		sendMail: func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error {
+			message = string(msg)
+			return nil
+		}}
+	err := channel.Send(context.Background(), Notification{Title: "Dead\r\nBcc: evil@example.com", Text: "42 waiting", Service: "orders", Severity: SeverityCritical})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(message, "Subject: [CRITICAL] orders: Dead  Bcc: evil@example.com\r\n") || !strings.HasSuffix(message, "42 waiting\r\n") {
+		t.Errorf("unexpected message [%s]", message)
+	}
+}
+
+func TestRender(t *testing.T) {
+	if text := Render("{{.Count}} messages in [{{.Queue}}]", map[string]any{"Count": 3, "Queue": "dlq"}); text != "3 messages in [dlq]" {
+		t.Errorf("unexpected text [%s]", text)
+	}
+	if text := Render("{{.Count", nil); !strings.HasPrefix(text, "invalid template") {
+		t.Errorf("expected template error, got [%s]", text)
+	}
+}
+
+func TestTeamsTemplateIsValidJSON(t *testing.T) {
+	var body strings.Builder
+	err := TeamsTemplate.Execute(&body, Notification{Title: "Dead \"letters\"", Fields: map[string]string{"a": "1", "b": "2"}})
+	if err != nil || !json.Valid([]byte(body.String())) {
+		t.Errorf("expected valid JSON, got [%s] %v", body.String(), err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package pagingutil implements AIP-158 pagination for gRPC List methods with
+// signed, opaque page tokens holding the keyset of the last returned row
+package pagingutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+
+	"github.com/spf13/viper"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tokenKeyConfigKey configures the key signing page tokens of NewCodecFromConfig
+const tokenKeyConfigKey = "paging.tokenkey"
+
+func init() {
+	apputil.RegisterConfigKeys("pagingutil",
+		apputil.ConfigKey{Key: tokenKeyConfigKey, Type: "string", Description: "key signing page tokens, must be equal for all instances"},
+	)
+}
+
+// tokenVersion is increased on incompatible changes of Token, older tokens are rejected
+const tokenVersion = 1
+
+// page sizes used if not configured otherwise
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 1000
+)
+
+var logger = apputil.Named("pagingutil")
+
+// ErrInvalidToken is returned for tampered, outdated or mismatching page
+// tokens. It is a gRPC InvalidArgument status.
+var ErrInvalidToken = status.Error(codes.InvalidArgument, "invalid page token")
+
+// Token is the content of a page token
+type Token struct {
+	Version  int           `json:"v"`
+	Keyset   []interface{} `json:"k"`
+	Filter   string        `json:"f,omitempty"` // request parameters besides page size, must not change between pages
+	PageSize int           `json:"s,omitempty"`
+}
+
+// Codec encodes and decodes page tokens signed with HMAC-SHA256. All instances
+// of a service must use the same key.
+type Codec struct {
+	key []byte
+}
+
+// NewCodec creates a Codec signing tokens with key
+func NewCodec(key []byte) *Codec {
+	return &Codec{key: key}
+}
+
+// NewCodecFromConfig creates a Codec with the key configured by paging.tokenkey.
+// Without a key, tokens are signed with the service name, which only protects
+// against accidental modification.
+func NewCodecFromConfig() *Codec {
+	key := viper.GetString(tokenKeyConfigKey)
+	if key == "" {
+		logger.Warnf("No page token key configured in [%s]", tokenKeyConfigKey)
+		key = apputil.GetServiceName()
+	}
+	return NewCodec([]byte(key))
+}
+
+// Encode returns the opaque page token for token
+func (codec *Codec) Encode(token Token) (string, error) {
+	token.Version = tokenVersion
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(codec.sign(payload)), nil
+}
+
+// Decode verifies and decodes pageToken created for the request parameters
+// filter. An empty pageToken returns an empty Token for the first page.
+func (codec *Codec) Decode(pageToken string, filter string) (Token, error) {
+	var token Token
+	if pageToken == "" {
+		return token, nil
+	}
+	encodedPayload, encodedSignature, found := strings.Cut(pageToken, ".")
+	if !found {
+		return token, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return token, ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, codec.sign(payload)) {
+		return token, ErrInvalidToken
+	}
+	// numbers are kept as json.Number, so large IDs are passed to queries unchanged
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&token); err != nil || token.Version != tokenVersion || token.Filter != filter {
+		return Token{}, ErrInvalidToken
+	}
+	return token, nil
+}
+
+func (codec *Codec) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, codec.key)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// PageSize returns the page size for the requested size, defaultSize for 0 and
+// at most maxSize. Negative sizes are an InvalidArgument error.
+func PageSize(requested int32, defaultSize int, maxSize int) (int, error) {
+	switch {
+	case requested < 0:
+		return 0, status.Error(codes.InvalidArgument, "page size must not be negative")
+	case requested == 0:
+		return defaultSize, nil
+	case int(requested) > maxSize:
+		return maxSize, nil
+	}
+	return int(requested), nil
+}
+
+// Pager paginates a List method with keyset pagination
+type Pager struct {
+	Codec  *Codec
+	Keyset dbutil.Keyset
+	Filter string // request parameters besides page size, e.g. filter and order_by
+	Token  Token
+	Size   int
+}
+
+// NewPager decodes pageToken and determines the page size of a List request
+func NewPager(codec *Codec, keyset dbutil.Keyset, pageToken string, pageSize int32, filter string) (*Pager, error) {
+	token, err := codec.Decode(pageToken, filter)
+	if err != nil {
+		return nil, err
+	}
+	size, err := PageSize(pageSize, DefaultPageSize, MaxPageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &Pager{Codec: codec, Keyset: keyset, Filter: filter, Token: token, Size: size}, nil
+}
+
+// Query wraps query to select the current page plus one row, which tells
+// whether a next page exists
+func (pager *Pager) Query(query dbutil.Query) (dbutil.Query, error) {
+	return pager.Keyset.Page(query, pager.Token.Keyset, pager.Size+1)
+}
+
+// NextPage trims items returned by Query to the page size and returns the
+// next page token, which is empty on the last page. keyset returns the values
+// of the keyset columns of an item.
+func NextPage[T any](pager *Pager, items []T, keyset func(item T) []interface{}) ([]T, string, error) {
+	if len(items) <= pager.Size {
+		return items, "", nil
+	}
+	items = items[:pager.Size]
+	values := keyset(items[len(items)-1])
+	if len(values) != len(pager.Keyset.Columns) {
+		return nil, "", errors.New("keyset values do not match keyset columns")
+	}
+	nextToken, err := pager.Codec.Encode(Token{Keyset: values, Filter: pager.Filter, PageSize: pager.Size})
+	return items, nextToken, err
+}
@@ -0,0 +1,86 @@
+package pagingutil
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/dbutil"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCodecRoundTripAndTampering(t *testing.T) {
+	codec := NewCodec([]byte("key"))
+	encoded, err := codec.Encode(Token{Keyset: []interface{}{"2024-01-01T00:00:00Z", 9007199254740993}, Filter: "state=open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := codec.Decode(encoded, "state=open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Keyset[0] != "2024-01-01T00:00:00Z" || token.Keyset[1] != json.Number("9007199254740993") {
+		t.Errorf("unexpected keyset %v", token.Keyset)
+	}
+
+	if _, err := codec.Decode(encoded, "state=closed"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected error for changed filter, got %v", err)
+	}
+	if _, err := NewCodec([]byte("other")).Decode(encoded, "state=open"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("expected error for other key, got %v", err)
+	}
+	if _, err := codec.Decode("x"+encoded, "state=open"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for tampered token, got %v", err)
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for requested, expected := range map[int32]int{0: 50, 10: 10, 5000: 1000} {
+		if size, err := PageSize(requested, DefaultPageSize, MaxPageSize); err != nil || size != expected {
+			t.Errorf("expected page size %d for %d, got %d %v", expected, requested, size, err)
+		}
+	}
+	if _, err := PageSize(-1, DefaultPageSize, MaxPageSize); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestPagerWalksPages(t *testing.T) {
+	keyset := dbutil.Keyset{Columns: []string{"created_at", "id"}}
+	codec := NewCodec([]byte("key"))
+	pager, err := NewPager(codec, keyset, "", 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := pager.Query(dbutil.Query{Query: "SELECT id, created_at FROM orders WHERE tenant = $1", Args: []interface{}{"t1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(query.Query, "WHERE (") || query.Args[len(query.Args)-1] != 3 {
+		t.Errorf("unexpected first page query %v", query)
+	}
+
+	type order struct{ ID, Created string }
+	items, next, err := NextPage(pager, []order{{"a", "1"}, {"b", "2"}, {"c", "3"}}, func(item order) []interface{} {
+		return []interface{}{item.Created, item.ID}
+	})
+	if err != nil || len(items) != 2 || next == "" {
+		t.Fatalf("expected 2 items and next token, got %v [%s] %v", items, next, err)
+	}
+
+	pager, err = NewPager(codec, keyset, next, 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, _ = pager.Query(dbutil.Query{Query: "SELECT id, created_at FROM orders WHERE tenant = $1", Args: []interface{}{"t1"}})
+	expected := "SELECT * FROM (SELECT id, created_at FROM orders WHERE tenant = $1) AS page WHERE (created_at, id) > ($2, $3) ORDER BY created_at ASC, id ASC LIMIT $4"
+	if query.Query != expected || query.Args[1] != "2" || query.Args[2] != "b" {
+		t.Errorf("unexpected next page query %v", query)
+	}
+	if _, next, _ = NextPage(pager, []order{{"c", "3"}}, nil); next != "" {
+		t.Errorf("expected no next token on last page, got [%s]", next)
+	}
+}
@@ -0,0 +1,52 @@
+package ratelimitutil
+
+import (
+	"context"
+	"math"
+	"strconv"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterMetadataKey is the response header with the seconds until a rejected request would be allowed
+const RetryAfterMetadataKey = "retry-after"
+
+// KeyFunc returns the rate limit key of a request
+type KeyFunc func(ctx context.Context, fullMethod string) string
+
+// CallerServiceKey limits requests per calling service as given by the
+// x-caller-service metadata, see apputil.CorrelationFromContext
+func CallerServiceKey(ctx context.Context, fullMethod string) string {
+	if caller := apputil.CorrelationFromContext(ctx).CallerService; caller != "" {
+		return caller
+	}
+	return "unknown"
+}
+
+// UnaryServerInterceptor rejects requests exceeding the limit of their key with
+// codes.ResourceExhausted. It must be chained after
+// serviceutil.RequestIDUnaryInterceptor if key uses the correlation of the
+// request. Requests are allowed if the store fails.
+func UnaryServerInterceptor(limiter *Limiter, key KeyFunc) grpc.UnaryServerInterceptor {
+	if key == nil {
+		key = CallerServiceKey
+	}
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		result, err := limiter.Allow(ctx, key(ctx, info.FullMethod))
+		if err != nil {
+			logger.Warnf("Allowing request to [%s] as rate limit cannot be checked: %v", info.FullMethod, err)
+			return handler(ctx, req)
+		}
+		if !result.Allowed {
+			seconds := strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds())))
+			grpc.SetHeader(ctx, metadata.Pairs(RetryAfterMetadataKey, seconds))
+			return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ss", seconds)
+		}
+		return handler(ctx, req)
+	}
+}
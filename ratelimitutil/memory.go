@@ -0,0 +1,86 @@
+package ratelimitutil
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps rate limits in process memory, so limits apply per instance
+type MemoryStore struct {
+	now func() time.Time
+
+	mutex     sync.Mutex
+	states    map[string]*memoryState
+	lastSweep time.Time
+}
+
+type memoryState struct {
+	// token bucket
+	tokens float64
+	last   time.Time
+	// sliding window
+	window   time.Time
+	previous int
+	current  int
+
+	expires time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{now: time.Now, states: make(map[string]*memoryState), lastSweep: time.Now()}
+}
+
+func (store *MemoryStore) Allow(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	if err := limit.validate(); err != nil {
+		return Result{}, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	now := store.now()
+	store.sweep(now)
+
+	state, ok := store.states[key]
+	if !ok {
+		state = &memoryState{tokens: float64(limit.burst()), last: now}
+		store.states[key] = state
+	}
+	state.expires = now.Add(2 * limit.Period)
+
+	if limit.Algorithm == TokenBucket {
+		var result Result
+		result, state.tokens = takeTokens(limit, state.tokens, state.last, now, n)
+		state.last = now
+		return result, nil
+	}
+
+	window := now.Truncate(limit.Period)
+	switch {
+	case window.Equal(state.window):
+	case window.Equal(state.window.Add(limit.Period)):
+		state.window, state.previous, state.current = window, state.current, 0
+	default:
+		state.window, state.previous, state.current = window, 0, 0
+	}
+	elapsed := now.Sub(window)
+	count := slidingWindowCount(limit, state.previous, state.current, elapsed)
+	if count+float64(n) <= float64(limit.Rate) {
+		state.current += n
+		return Result{Allowed: true, Remaining: int(float64(limit.Rate) - count - float64(n))}, nil
+	}
+	return Result{RetryAfter: slidingWindowRetry(limit, state.previous, state.current, elapsed, n)}, nil
+}
+
+// sweep removes idle keys at most once a minute, the mutex must be held
+func (store *MemoryStore) sweep(now time.Time) {
+	if now.Sub(store.lastSweep) < time.Minute {
+		return
+	}
+	store.lastSweep = now
+	for key, state := range store.states {
+		if now.After(state.expires) {
+			delete(store.states, key)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package ratelimitutil
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// results of rate limited requests
+const (
+	resultAllowed = "allowed"
+	resultLimited = "limited"
+	resultError   = "error"
+)
+
+var rateLimitRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "rate_limit_requests_total",
+	Help: "The total number of rate limited requests by limiter and result",
+}, []string{"limiter", "result"})
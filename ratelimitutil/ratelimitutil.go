@@ -0,0 +1,154 @@
+// Package ratelimitutil provides rate limiters keyed by arbitrary strings like
+// tenants or API keys, with state kept in process memory or in Redis
+package ratelimitutil
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+var logger = apputil.Named("ratelimitutil")
+
+// Algorithm selects how requests are counted against a Limit
+type Algorithm int
+
+const (
+	// TokenBucket allows bursts of up to Limit.Burst requests and refills
+	// Limit.Rate tokens per Limit.Period
+	TokenBucket Algorithm = iota
+	// SlidingWindow allows Limit.Rate requests in any Limit.Period, approximated
+	// by weighting the count of the previous fixed window
+	SlidingWindow
+)
+
+// Limit defines the allowed rate of requests per key
+type Limit struct {
+	Rate      int
+	Period    time.Duration
+	Burst     int // capacity of the token bucket, default Rate
+	Algorithm Algorithm
+}
+
+// PerSecond returns a token bucket limit of rate requests per second
+func PerSecond(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Second}
+}
+
+// PerMinute returns a token bucket limit of rate requests per minute
+func PerMinute(rate int) Limit {
+	return Limit{Rate: rate, Period: time.Minute}
+}
+
+func (limit Limit) burst() int {
+	if limit.Burst > 0 {
+		return limit.Burst
+	}
+	return limit.Rate
+}
+
+func (limit Limit) validate() error {
+	if limit.Rate <= 0 || limit.Period <= 0 {
+		return fmt.Errorf("invalid limit of %d per [%v]", limit.Rate, limit.Period)
+	}
+	return nil
+}
+
+// Result is the outcome of a rate limited request
+type Result struct {
+	Allowed    bool
+	Remaining  int           // requests still allowed right now
+	RetryAfter time.Duration // time until the request would be allowed, 0 if allowed
+}
+
+// Store keeps the state of rate limits
+type Store interface {
+	// Allow takes n requests for key from limit if allowed
+	Allow(ctx context.Context, key string, limit Limit, n int) (Result, error)
+}
+
+// Limiter applies a Limit to keys, e.g. per tenant
+type Limiter struct {
+	name  string
+	store Store
+	limit Limit
+}
+
+// NewLimiter creates a Limiter reported as name in the metrics. The name is
+// also prepended to keys, so limiters may share a store.
+func NewLimiter(name string, store Store, limit Limit) (*Limiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	return &Limiter{name: name, store: store, limit: limit}, nil
+}
+
+// Allow takes a request for key if allowed
+func (limiter *Limiter) Allow(ctx context.Context, key string) (Result, error) {
+	return limiter.AllowN(ctx, key, 1)
+}
+
+// AllowN takes n requests for key if allowed
+func (limiter *Limiter) AllowN(ctx context.Context, key string, n int) (Result, error) {
+	result, err := limiter.store.Allow(ctx, limiter.name+":"+key, limiter.limit, n)
+	if err != nil {
+		rateLimitRequests.WithLabelValues(limiter.name, resultError).Inc()
+		return result, fmt.Errorf("failed to check rate limit [%s] of [%s] [%w]", limiter.name, key, err)
+	}
+	if result.Allowed {
+		rateLimitRequests.WithLabelValues(limiter.name, resultAllowed).Inc()
+	} else {
+		rateLimitRequests.WithLabelValues(limiter.name, resultLimited).Inc()
+	}
+	return result, nil
+}
+
+// Wait blocks until a request for key is allowed or ctx is done, e.g. to
+// throttle calls of external APIs in background workers
+func (limiter *Limiter) Wait(ctx context.Context, key string) error {
+	for {
+		result, err := limiter.Allow(ctx, key)
+		if err != nil {
+			return err
+		}
+		if result.Allowed {
+			return nil
+		}
+		timer := time.NewTimer(max(result.RetryAfter, time.Millisecond))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// takeTokens applies n requests to a token bucket holding tokens at last and returns the new token count
+func takeTokens(limit Limit, tokens float64, last time.Time, now time.Time, n int) (Result, float64) {
+	perNanosecond := float64(limit.Rate) / float64(limit.Period)
+	tokens = min(float64(limit.burst()), tokens+float64(now.Sub(last))*perNanosecond)
+	if tokens >= float64(n) {
+		tokens -= float64(n)
+		return Result{Allowed: true, Remaining: int(tokens)}, tokens
+	}
+	return Result{Remaining: int(tokens), RetryAfter: time.Duration(math.Ceil((float64(n) - tokens) / perNanosecond))}, tokens
+}
+
+// slidingWindowCount returns the weighted count of requests in the period before now
+func slidingWindowCount(limit Limit, previous int, current int, elapsed time.Duration) float64 {
+	return float64(previous)*float64(limit.Period-elapsed)/float64(limit.Period) + float64(current)
+}
+
+// slidingWindowRetry returns the time until n requests would be allowed
+func slidingWindowRetry(limit Limit, previous int, current int, elapsed time.Duration, n int) time.Duration {
+	free := limit.Rate - current - n
+	if previous == 0 || free < 0 {
+		return limit.Period - elapsed
+	}
+	retry := time.Duration(float64(limit.Period)*(1-float64(free)/float64(previous))) - elapsed
+	return max(retry, time.Millisecond)
+}
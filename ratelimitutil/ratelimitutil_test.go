@@ -0,0 +1,101 @@
+package ratelimitutil
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/cacheutil"
+
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestStore() (*MemoryStore, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	return store, &now
+}
+
+func TestTokenBucket(t *testing.T) {
+	store, now := newTestStore()
+	limiter, _ := NewLimiter("test", store, Limit{Rate: 2, Period: time.Second, Burst: 3})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if result, _ := limiter.Allow(ctx, "tenant"); !result.Allowed {
+			t.Fatalf("expected request %d of burst to be allowed", i)
+		}
+	}
+	result, _ := limiter.Allow(ctx, "tenant")
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected request to be limited for 500ms, got %+v", result)
+	}
+	if result, _ := limiter.Allow(ctx, "other"); !result.Allowed {
+		t.Error("expected other key to be allowed")
+	}
+	*now = now.Add(500 * time.Millisecond)
+	if result, _ := limiter.Allow(ctx, "tenant"); !result.Allowed {
+		t.Error("expected request to be allowed after refill")
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	store, now := newTestStore()
+	limiter, _ := NewLimiter("test", store, Limit{Rate: 4, Period: time.Minute, Algorithm: SlidingWindow})
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if result, _ := limiter.Allow(ctx, "key"); !result.Allowed {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+	if result, _ := limiter.Allow(ctx, "key"); result.Allowed || result.RetryAfter != time.Minute {
+		t.Errorf("expected request to be limited until the next window, got %+v", result)
+	}
+	// half of the previous window still counts
+	*now = now.Add(90 * time.Second)
+	for i := 0; i < 2; i++ {
+		if result, _ := limiter.Allow(ctx, "key"); !result.Allowed {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+	if result, _ := limiter.Allow(ctx, "key"); result.Allowed {
+		t.Error("expected request to be limited by the weighted previous window")
+	}
+}
+
+func TestWaitHonorsContext(t *testing.T) {
+	limiter, _ := NewLimiter("test", NewMemoryStore(), PerMinute(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := limiter.Wait(ctx, "api"); err != nil {
+		t.Fatal(err)
+	}
+	if err := limiter.Wait(ctx, "api"); err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	limiter, _ := NewLimiter("test", NewMemoryStore(), PerMinute(1))
+	interceptor := UnaryServerInterceptor(limiter, nil)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Call"}
+	if _, err := interceptor(context.Background(), nil, info, handler); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := interceptor(context.Background(), nil, info, handler); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+}
+
+func TestRedisStoreUnavailable(t *testing.T) {
+	cache := cacheutil.NewRedisCache(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1}, nil)
+	defer cache.Close()
+	limiter, _ := NewLimiter("test", NewRedisStore(cache), PerSecond(1))
+	if _, err := limiter.Allow(context.Background(), "key"); err == nil {
+		t.Error("expected connection error")
+	}
+}
@@ -0,0 +1,94 @@
+package ratelimitutil
+
+import (
+	"context"
+	"time"
+
+	"github.com/science-computing/service-common-golang/cacheutil"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scripts applying a request atomically, both return {allowed, remaining, retry after in ms}
+var (
+	tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local capacity = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local ttl = tonumber(ARGV[4])
+local time = redis.call("time")
+local now = time[1] * 1000 + time[2] / 1000
+local state = redis.call("hmget", KEYS[1], "tokens", "last")
+local tokens = tonumber(state[1]) or capacity
+local last = tonumber(state[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+local allowed, retry = 0, 0
+if tokens >= n then
+  tokens = tokens - n
+  allowed = 1
+else
+  retry = math.ceil((n - tokens) / rate)
+end
+redis.call("hset", KEYS[1], "tokens", tostring(tokens), "last", tostring(now))
+redis.call("pexpire", KEYS[1], ttl)
+return {allowed, math.floor(tokens), retry}`)
+
+	slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local n = tonumber(ARGV[3])
+local time = redis.call("time")
+local now = time[1] * 1000 + math.floor(time[2] / 1000)
+local window = math.floor(now / period)
+local elapsed = now - window * period
+local currentKey = KEYS[1] .. ":" .. window
+local previous = tonumber(redis.call("get", KEYS[1] .. ":" .. (window - 1))) or 0
+local current = tonumber(redis.call("get", currentKey)) or 0
+local count = previous * (period - elapsed) / period + current
+if count + n <= limit then
+  redis.call("incrby", currentKey, n)
+  redis.call("pexpire", currentKey, 2 * period)
+  return {1, math.floor(limit - count - n), 0}
+end
+local free = limit - current - n
+if previous == 0 or free < 0 then
+  return {0, 0, period - elapsed}
+end
+return {0, 0, math.max(1, math.ceil(period * (1 - free / previous) - elapsed))}`)
+)
+
+// RedisStore keeps rate limits in Redis, so limits apply across instances.
+// Keys are prefixed with "ratelimit:".
+type RedisStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisStore creates a RedisStore using the client of cache
+func NewRedisStore(cache *cacheutil.RedisCache) *RedisStore {
+	return &RedisStore{client: cache.Client(), prefix: "ratelimit:"}
+}
+
+func (store *RedisStore) Allow(ctx context.Context, key string, limit Limit, n int) (Result, error) {
+	if err := limit.validate(); err != nil {
+		return Result{}, err
+	}
+	var values []int64
+	var err error
+	if limit.Algorithm == TokenBucket {
+		perMillisecond := float64(limit.Rate) / float64(limit.Period.Milliseconds())
+		values, err = tokenBucketScript.Run(ctx, store.client, []string{store.prefix + key},
+			perMillisecond, limit.burst(), n, (2 * limit.Period).Milliseconds()).Int64Slice()
+	} else {
+		values, err = slidingWindowScript.Run(ctx, store.client, []string{store.prefix + key},
+			limit.Rate, limit.Period.Milliseconds(), n).Int64Slice()
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	return Result{
+		Allowed:    values[0] == 1,
+		Remaining:  int(values[1]),
+		RetryAfter: time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
@@ -0,0 +1,136 @@
+package retryutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for calls rejected by an open circuit breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// State is the state of a CircuitBreaker
+type State int
+
+const (
+	StateClosed   State = iota // calls are let through
+	StateOpen                  // calls are rejected
+	StateHalfOpen              // a single trial call is let through
+)
+
+func (state State) String() string {
+	switch state {
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerOptions configures a CircuitBreaker. Zero values select the defaults.
+type CircuitBreakerOptions struct {
+	// Failures is the number of consecutive failed calls opening the circuit, default 5
+	Failures int
+	// OpenDuration is the time calls are rejected before a single trial call
+	// is let through, which closes the circuit if it succeeds, default 30s
+	OpenDuration time.Duration
+}
+
+// CircuitBreaker rejects calls to a failing dependency for a while, so it
+// may recover and callers fail fast. It is safe for concurrent use.
+type CircuitBreaker struct {
+	name    string
+	options CircuitBreakerOptions
+	now     func() time.Time
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // a trial call of a half open breaker is running
+}
+
+// NewCircuitBreaker creates a closed CircuitBreaker, name is used in log messages
+func NewCircuitBreaker(name string, options CircuitBreakerOptions) *CircuitBreaker {
+	if options.Failures <= 0 {
+		options.Failures = 5
+	}
+	if options.OpenDuration <= 0 {
+		options.OpenDuration = 30 * time.Second
+	}
+	return &CircuitBreaker{name: name, options: options, now: time.Now}
+}
+
+// Allow returns ErrCircuitOpen if a call must be rejected. Each allowed call
+// must be followed by Record or Release.
+func (breaker *CircuitBreaker) Allow() error {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if breaker.failures < breaker.options.Failures {
+		return nil
+	}
+	if breaker.now().Before(breaker.openUntil) || breaker.trial {
+		return ErrCircuitOpen
+	}
+	breaker.trial = true
+	return nil
+}
+
+// Record records the result of an allowed call
+func (breaker *CircuitBreaker) Record(failed bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.trial = false
+	if !failed {
+		if breaker.failures >= breaker.options.Failures {
+			logger.Infof("Closing circuit breaker [%s]", breaker.name)
+		}
+		breaker.failures = 0
+		return
+	}
+	breaker.failures++
+	if breaker.failures >= breaker.options.Failures {
+		if breaker.failures == breaker.options.Failures {
+			logger.Warnf("Opening circuit breaker [%s] after %d failures", breaker.name, breaker.failures)
+		}
+		breaker.openUntil = breaker.now().Add(breaker.options.OpenDuration)
+	}
+}
+
+// Release ends an allowed call without result, e.g. if it was canceled
+func (breaker *CircuitBreaker) Release() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.trial = false
+}
+
+// State returns the current state
+func (breaker *CircuitBreaker) State() State {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	switch {
+	case breaker.failures < breaker.options.Failures:
+		return StateClosed
+	case breaker.now().Before(breaker.openUntil):
+		return StateOpen
+	default:
+		return StateHalfOpen
+	}
+}
+
+// Execute calls fn if allowed and records whether it returned an error.
+// Errors caused by canceling ctx are not recorded.
+func (breaker *CircuitBreaker) Execute(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := breaker.Allow(); err != nil {
+		return err
+	}
+	err := fn(ctx)
+	if err != nil && ctx.Err() != nil {
+		breaker.Release()
+	} else {
+		breaker.Record(err != nil)
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+// Package retryutil provides retries with exponential backoff and circuit breakers
+package retryutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+var logger = apputil.Named("retryutil")
+
+// Policy configures Do. Zero values select the defaults.
+type Policy struct {
+	Name           string        // name of the operation used in log messages
+	MaxAttempts    int           // attempts including the first one, default 3, negative for unlimited attempts
+	MaxElapsed     time.Duration // no retry is started after this time since the first attempt, unlimited if 0
+	InitialBackoff time.Duration // delay before the first retry, default 100ms
+	MaxBackoff     time.Duration // default 10s
+	Multiplier     float64       // factor the delay grows by with each retry, default 2
+	// Jitter is the fraction of the delay which is randomized, e.g. 0.5 for
+	// delays between half and the full delay, default 0.5, negative disables jitter
+	Jitter float64
+	// Retryable reports whether an error is transient, default retries all
+	// errors except permanent (see Permanent) and context errors
+	Retryable func(err error) bool
+	// OnRetry is called before waiting for a retry, e.g. to reset a connection
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+func (policy *Policy) setDefaults() {
+	if policy.Name == "" {
+		policy.Name = "operation"
+	}
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = 100 * time.Millisecond
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = 10 * time.Second
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = 0.5
+	}
+	if policy.Retryable == nil {
+		policy.Retryable = func(error) bool { return true }
+	}
+}
+
+// Backoff returns the delay before the given retry, starting with 0 for the first retry
+func (policy Policy) Backoff(retry int) time.Duration {
+	policy.setDefaults()
+	delay := float64(policy.InitialBackoff)
+	for i := 0; i < retry && delay < float64(policy.MaxBackoff); i++ {
+		delay *= policy.Multiplier
+	}
+	delay = min(delay, float64(policy.MaxBackoff))
+	if policy.Jitter > 0 {
+		jitter := min(policy.Jitter, 1) * delay
+		delay = delay - jitter + rand.Float64()*jitter
+	}
+	return time.Duration(delay)
+}
+
+// permanentError marks an error as not retryable
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as not retryable, Do returns the wrapped error
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// Do calls fn until it succeeds, returns a permanent or not retryable error, the
+// attempts or elapsed time of policy are exhausted, or ctx is done. The last
+// error of fn is returned.
+func Do(ctx context.Context, fn func(ctx context.Context) error, policy Policy) error {
+	_, err := DoValue(ctx, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	}, policy)
+	return err
+}
+
+// DoValue is Do for functions returning a value
+func DoValue[T any](ctx context.Context, fn func(ctx context.Context) (T, error), policy Policy) (T, error) {
+	policy.setDefaults()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		value, err := fn(ctx)
+		if err == nil {
+			return value, nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) {
+			return value, permanent.err
+		}
+		if ctx.Err() != nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || !policy.Retryable(err) {
+			return value, err
+		}
+		if policy.MaxAttempts > 0 && attempt >= policy.MaxAttempts {
+			return value, fmt.Errorf("%s failed after %d attempts [%w]", policy.Name, attempt, err)
+		}
+		delay := policy.Backoff(attempt - 1)
+		if policy.MaxElapsed > 0 && time.Since(start)+delay > policy.MaxElapsed {
+			return value, fmt.Errorf("%s failed within [%v] [%w]", policy.Name, policy.MaxElapsed, err)
+		}
+
+		logger.Debugf("Retrying %s in %v after attempt %d failed: %v", policy.Name, delay, attempt, err)
+		if policy.OnRetry != nil {
+			policy.OnRetry(attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return value, ctx.Err()
+		}
+	}
+}
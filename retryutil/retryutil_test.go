@@ -0,0 +1,101 @@
+package retryutil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errTransient = errors.New("transient")
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	attempts := 0
+	value, err := DoValue(context.Background(), func(context.Context) (int, error) {
+		attempts++
+		if attempts < 3 {
+			return 0, errTransient
+		}
+		return 42, nil
+	}, Policy{InitialBackoff: time.Millisecond})
+	if err != nil || value != 42 || attempts != 3 {
+		t.Errorf("expected 42 after 3 attempts, got %d %v after %d attempts", value, err, attempts)
+	}
+}
+
+func TestDoStops(t *testing.T) {
+	attempts := 0
+	err := Do(context.Background(), func(context.Context) error {
+		attempts++
+		return errTransient
+	}, Policy{MaxAttempts: 2, InitialBackoff: time.Millisecond})
+	if !errors.Is(err, errTransient) || attempts != 2 {
+		t.Errorf("expected transient error after 2 attempts, got %v after %d attempts", err, attempts)
+	}
+
+	attempts = 0
+	err = Do(context.Background(), func(context.Context) error {
+		attempts++
+		return Permanent(errTransient)
+	}, Policy{})
+	if err != errTransient || attempts != 1 {
+		t.Errorf("expected unwrapped permanent error after 1 attempt, got %v after %d attempts", err, attempts)
+	}
+
+	err = Do(context.Background(), func(context.Context) error {
+		return errTransient
+	}, Policy{MaxAttempts: -1, InitialBackoff: time.Second, MaxElapsed: 100 * time.Millisecond})
+	if !errors.Is(err, errTransient) {
+		t.Errorf("expected transient error after max elapsed time, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = Do(ctx, func(context.Context) error {
+		return errTransient
+	}, Policy{MaxAttempts: -1, InitialBackoff: time.Second})
+	if err != context.DeadlineExceeded {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Jitter: -1}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for retry, delay := range expected {
+		if backoff := policy.Backoff(retry); backoff != delay {
+			t.Errorf("expected backoff %v for retry %d, got %v", delay, retry, backoff)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if backoff := policy.Backoff(1); backoff < 100*time.Millisecond || backoff > 200*time.Millisecond {
+			t.Fatalf("expected jittered backoff between 100ms and 200ms, got %v", backoff)
+		}
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker("test", CircuitBreakerOptions{Failures: 2, OpenDuration: time.Minute})
+	breaker.now = func() time.Time { return now }
+	fail := func(context.Context) error { return errTransient }
+
+	breaker.Execute(context.Background(), fail)
+	breaker.Execute(context.Background(), fail)
+	if err := breaker.Execute(context.Background(), fail); err != ErrCircuitOpen || breaker.State() != StateOpen {
+		t.Fatalf("expected open circuit, got %v in state %v", err, breaker.State())
+	}
+
+	now = now.Add(time.Minute)
+	if breaker.State() != StateHalfOpen || breaker.Allow() != nil {
+		t.Fatal("expected trial call to be allowed")
+	}
+	if breaker.Allow() != ErrCircuitOpen {
+		t.Error("expected concurrent call to be rejected during trial")
+	}
+	breaker.Record(false)
+	if breaker.State() != StateClosed {
+		t.Errorf("expected closed circuit after successful trial, got %v", breaker.State())
+	}
+}
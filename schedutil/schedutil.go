@@ -0,0 +1,227 @@
+// Package schedutil runs periodic jobs on cron schedules or intervals
+package schedutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/lockutil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/robfig/cron/v3"
+)
+
+// results of job runs
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultPanic   = "panic"
+	resultSkipped = "skipped" // still running or another replica holds the lock
+)
+
+var (
+	logger = apputil.Named("schedutil")
+
+	parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+	jobRuns = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scheduled_job_runs_total",
+		Help: "The total number of scheduled job runs by job and result",
+	}, []string{"job", "result"})
+	jobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "scheduled_job_duration_seconds",
+		Help:    "The duration of scheduled job runs",
+		Buckets: []float64{.01, .1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+	}, []string{"job"})
+	jobLastSuccess = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scheduled_job_last_success_timestamp_seconds",
+		Help: "The time of the last successful run of scheduled jobs",
+	}, []string{"job"})
+)
+
+// Job is a periodic job
+type Job struct {
+	Name string
+	// Schedule is a cron expression with five fields, e.g. "0 3 * * *", a
+	// descriptor like "@hourly" or an interval like "@every 5m"
+	Schedule string
+	// Timeout cancels the context of a run, no timeout if 0
+	Timeout time.Duration
+	// Singleton runs the job on one replica at a time using the Locker of the Scheduler
+	Singleton bool
+	Run       func(ctx context.Context) error
+}
+
+// Scheduler runs jobs. A run is skipped if the previous run of the job is still running.
+type Scheduler struct {
+	locker lockutil.Locker
+	jobs   []*scheduledJob
+
+	mutex   sync.Mutex
+	started bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+type scheduledJob struct {
+	Job
+	schedule cron.Schedule
+	running  atomic.Bool
+}
+
+// NewScheduler creates a Scheduler. locker is used for Singleton jobs and may be nil otherwise.
+func NewScheduler(locker lockutil.Locker) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{locker: locker, ctx: ctx, cancel: cancel}
+}
+
+// Add adds a job, which is scheduled on Start or immediately if already started
+func (scheduler *Scheduler) Add(job Job) error {
+	if job.Name == "" || job.Run == nil {
+		return errors.New("job name and run function are required")
+	}
+	if job.Singleton && scheduler.locker == nil {
+		return fmt.Errorf("job [%s] is a singleton, but the scheduler has no locker", job.Name)
+	}
+	schedule, err := parser.Parse(job.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule [%s] of job [%s] [%w]", job.Schedule, job.Name, err)
+	}
+
+	scheduled := &scheduledJob{Job: job, schedule: schedule}
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	scheduler.jobs = append(scheduler.jobs, scheduled)
+	if scheduler.started {
+		scheduler.schedule(scheduled)
+	}
+	return nil
+}
+
+// Start starts scheduling the jobs
+func (scheduler *Scheduler) Start() {
+	scheduler.mutex.Lock()
+	defer scheduler.mutex.Unlock()
+	if scheduler.started {
+		return
+	}
+	scheduler.started = true
+	for _, job := range scheduler.jobs {
+		scheduler.schedule(job)
+	}
+	logger.Infof("Started scheduler with %d jobs", len(scheduler.jobs))
+}
+
+// Stop stops scheduling, cancels the contexts of running jobs and waits until they returned or ctx is done
+func (scheduler *Scheduler) Stop(ctx context.Context) error {
+	scheduler.cancel()
+	done := make(chan struct{})
+	go func() {
+		scheduler.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// schedule starts the timer loop of a job, the mutex must be held
+func (scheduler *Scheduler) schedule(job *scheduledJob) {
+	scheduler.wg.Add(1)
+	go func() {
+		defer scheduler.wg.Done()
+		for {
+			now := time.Now()
+			timer := time.NewTimer(job.schedule.Next(now).Sub(now))
+			select {
+			case <-scheduler.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if !job.running.CompareAndSwap(false, true) {
+				logger.Warnf("Skipping job [%s], previous run is still running", job.Name)
+				jobRuns.WithLabelValues(job.Name, resultSkipped).Inc()
+				continue
+			}
+			scheduler.wg.Add(1)
+			go func() {
+				defer scheduler.wg.Done()
+				defer job.running.Store(false)
+				scheduler.run(job)
+			}()
+		}
+	}()
+}
+
+// run runs a job once, holding its lock if it is a singleton
+func (scheduler *Scheduler) run(job *scheduledJob) {
+	ctx := scheduler.ctx
+	if job.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, job.Timeout)
+		defer cancel()
+	}
+
+	if job.Singleton {
+		lock, err := scheduler.locker.TryAcquire(ctx, "schedutil:"+job.Name)
+		if errors.Is(err, lockutil.ErrNotAcquired) {
+			logger.Debugf("Skipping job [%s], it runs on another replica", job.Name)
+			jobRuns.WithLabelValues(job.Name, resultSkipped).Inc()
+			return
+		}
+		if err != nil {
+			logger.Errorf("Cannot acquire lock of job [%s]: %v", job.Name, err)
+			jobRuns.WithLabelValues(job.Name, resultError).Inc()
+			return
+		}
+		defer func() {
+			if err := lock.Release(context.Background()); err != nil {
+				logger.Warnf("Failed to release lock of job [%s]: %v", job.Name, err)
+			}
+		}()
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-lock.Lost():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	start := time.Now()
+	result := runRecovering(ctx, job)
+	jobDuration.WithLabelValues(job.Name).Observe(time.Since(start).Seconds())
+	jobRuns.WithLabelValues(job.Name, result).Inc()
+	if result == resultSuccess {
+		jobLastSuccess.WithLabelValues(job.Name).SetToCurrentTime()
+	}
+}
+
+func runRecovering(ctx context.Context, job *scheduledJob) (result string) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Errorf("Job [%s] panicked: %v", job.Name, recovered)
+			result = resultPanic
+		}
+	}()
+	logger.Debugf("Running job [%s]", job.Name)
+	if err := job.Run(ctx); err != nil {
+		logger.Errorf("Job [%s] failed: %v", job.Name, err)
+		return resultError
+	}
+	return resultSuccess
+}
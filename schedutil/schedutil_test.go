@@ -0,0 +1,73 @@
+package schedutil
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/science-computing/service-common-golang/lockutil"
+)
+
+// heldLocker never acquires a lock, as if another replica held it
+type heldLocker struct{}
+
+func (heldLocker) TryAcquire(ctx context.Context, name string) (lockutil.Lock, error) {
+	return nil, lockutil.ErrNotAcquired
+}
+
+func TestAddValidatesJobs(t *testing.T) {
+	scheduler := NewScheduler(nil)
+	run := func(ctx context.Context) error { return nil }
+	if err := scheduler.Add(Job{Name: "bad", Schedule: "every minute", Run: run}); err == nil {
+		t.Error("expected invalid schedule error")
+	}
+	if err := scheduler.Add(Job{Name: "single", Schedule: "@hourly", Singleton: true, Run: run}); err == nil {
+		t.Error("expected error for singleton without locker")
+	}
+	if err := scheduler.Add(Job{Name: "nightly", Schedule: "0 3 * * *", Run: run}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	var runs, singletonRuns atomic.Int32
+	scheduler := NewScheduler(heldLocker{})
+	scheduler.Add(Job{Name: "count", Schedule: "@every 1s", Run: func(ctx context.Context) error {
+		runs.Add(1)
+		panic("recovered")
+	}})
+	scheduler.Add(Job{Name: "singleton", Schedule: "@every 1s", Singleton: true, Run: func(ctx context.Context) error {
+		singletonRuns.Add(1)
+		return nil
+	}})
+	scheduler.Start()
+	time.Sleep(1500 * time.Millisecond)
+	if err := scheduler.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if runs.Load() == 0 {
+		t.Error("expected job to run despite panic")
+	}
+	if singletonRuns.Load() != 0 {
+		t.Errorf("expected singleton to be skipped, got %d runs", singletonRuns.Load())
+	}
+}
+
+func TestRunCancelsOnTimeout(t *testing.T) {
+	scheduler := NewScheduler(nil)
+	job := &scheduledJob{Job: Job{Name: "slow", Timeout: 10 * time.Millisecond, Run: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}}
+	done := make(chan struct{})
+	go func() {
+		scheduler.run(job)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected run to be canceled after timeout")
+	}
+}
@@ -0,0 +1,234 @@
+// Package secretutil watches secrets like mounted files for rotation and
+// passes new values on to their consumers
+package secretutil
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	logger = apputil.Named("secretutil")
+
+	secretRotations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_rotations_total",
+		Help: "The total number of detected secret changes",
+	}, []string{"secret"})
+	secretReadErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "secret_read_errors_total",
+		Help: "The total number of failed secret reads, the previous value is kept",
+	}, []string{"secret"})
+)
+
+// Source reads the current value of a secret
+type Source interface {
+	Read() ([]byte, error)
+}
+
+// FileSource reads a secret from a file, e.g. mounted from a Kubernetes
+// secret, without a trailing line break
+type FileSource string
+
+func (source FileSource) Read() ([]byte, error) {
+	value, err := os.ReadFile(string(source))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(value, "\r\n"), nil
+}
+
+// EnvSource reads a secret from the environment variable of the given name or,
+// if <name>_FILE is set, from the file it points to, so the secret can be
+// rotated by replacing the file
+type EnvSource string
+
+func (source EnvSource) Read() ([]byte, error) {
+	if file := os.Getenv(string(source) + "_FILE"); file != "" {
+		return FileSource(file).Read()
+	}
+	value, ok := os.LookupEnv(string(source))
+	if !ok {
+		return nil, fmt.Errorf("environment variable [%s] not set", source)
+	}
+	return []byte(value), nil
+}
+
+// Secret holds the current value of a watched secret. It is safe for concurrent use.
+type Secret struct {
+	name   string
+	source Source
+	value  atomic.Pointer[[]byte]
+
+	mutex     sync.Mutex
+	consumers []func(value []byte)
+}
+
+// Name returns the name the secret was watched as
+func (secret *Secret) Name() string {
+	return secret.name
+}
+
+// Get returns the current value, which must not be modified
+func (secret *Secret) Get() []byte {
+	return *secret.value.Load()
+}
+
+// GetString returns the current value as string
+func (secret *Secret) GetString() string {
+	return string(secret.Get())
+}
+
+// String hides the value, so secrets can be logged safely
+func (secret *Secret) String() string {
+	return fmt.Sprintf("secret [%s]", secret.name)
+}
+
+// OnChange registers a consumer called with the new value whenever the secret
+// changes, e.g. DbConnectionURLConsumer. Consumers are called sequentially by
+// the watcher and should return quickly.
+func (secret *Secret) OnChange(consumer func(value []byte)) {
+	secret.mutex.Lock()
+	defer secret.mutex.Unlock()
+	secret.consumers = append(secret.consumers, consumer)
+}
+
+// refresh reads the source and notifies the consumers if the value changed
+func (secret *Secret) refresh() {
+	value, err := secret.source.Read()
+	if err != nil {
+		secretReadErrors.WithLabelValues(secret.name).Inc()
+		logger.Warnf("Cannot read secret [%s], keeping previous value: %v", secret.name, err)
+		return
+	}
+	if bytes.Equal(value, secret.Get()) {
+		return
+	}
+	secret.value.Store(&value)
+	secretRotations.WithLabelValues(secret.name).Inc()
+	logger.Infof("Secret [%s] changed, notifying consumers", secret.name)
+
+	secret.mutex.Lock()
+	consumers := append([]func(value []byte){}, secret.consumers...)
+	secret.mutex.Unlock()
+	for _, consumer := range consumers {
+		notify(secret.name, consumer, value)
+	}
+}
+
+func notify(name string, consumer func(value []byte), value []byte) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			logger.Errorf("Consumer of secret [%s] panicked: %v", name, recovered)
+		}
+	}()
+	consumer(value)
+}
+
+// Watcher checks its secrets for changes periodically. Polling works for
+// Kubernetes secret volumes, which are updated by swapping a symlink.
+type Watcher struct {
+	interval time.Duration
+
+	mutex   sync.Mutex
+	secrets []*Secret
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewWatcher creates a Watcher checking secrets every interval, default 30s
+func NewWatcher(interval time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &Watcher{interval: interval}
+}
+
+// Watch reads the secret from source and watches it for changes. It fails if
+// the secret cannot be read initially.
+func (watcher *Watcher) Watch(name string, source Source) (*Secret, error) {
+	value, err := source.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret [%s] [%w]", name, err)
+	}
+	secret := &Secret{name: name, source: source}
+	secret.value.Store(&value)
+
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	watcher.secrets = append(watcher.secrets, secret)
+	return secret, nil
+}
+
+// Refresh checks all secrets for changes immediately
+func (watcher *Watcher) Refresh() {
+	watcher.mutex.Lock()
+	secrets := append([]*Secret{}, watcher.secrets...)
+	watcher.mutex.Unlock()
+	for _, secret := range secrets {
+		secret.refresh()
+	}
+}
+
+// Start checks the secrets in the background until Stop is called
+func (watcher *Watcher) Start() {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+	if watcher.done != nil {
+		return
+	}
+	watcher.done = make(chan struct{})
+	watcher.stopped = make(chan struct{})
+	go func(done chan struct{}, stopped chan struct{}) {
+		defer close(stopped)
+		defer apputil.HandlePanics()
+		ticker := time.NewTicker(watcher.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				watcher.Refresh()
+			}
+		}
+	}(watcher.done, watcher.stopped)
+}
+
+// Stop stops checking the secrets
+func (watcher *Watcher) Stop() {
+	watcher.mutex.Lock()
+	done, stopped := watcher.done, watcher.stopped
+	watcher.done, watcher.stopped = nil, nil
+	watcher.mutex.Unlock()
+	if done != nil {
+		close(done)
+		<-stopped
+	}
+}
+
+// DbConnectionURLConsumer returns a consumer of a secret holding the connection
+// URL of helper, so new DB contexts use the rotated credentials
+func DbConnectionURLConsumer(helper *dbutil.DbConnectionHelper) func(value []byte) {
+	return func(value []byte) {
+		helper.SetConnectionURL(string(value))
+	}
+}
+
+// AmqpConnectionURLConsumer returns a consumer of a secret holding the connection
+// URL of helper, so new AMQP contexts use the rotated credentials
+func AmqpConnectionURLConsumer(helper *amqputil.AmqpConnectionHelper) func(value []byte) {
+	return func(value []byte) {
+		helper.SetConnectionURL(string(value))
+	}
+}
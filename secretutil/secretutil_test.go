@@ -0,0 +1,74 @@
+package secretutil
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, value string) {
+	if err := os.WriteFile(path, []byte(value), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherNotifiesOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+	writeFile(t, path, "first\n")
+
+	watcher := NewWatcher(0)
+	secret, err := watcher.Watch("password", FileSource(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.GetString() != "first" || secret.String() != "secret [password]" {
+		t.Errorf("unexpected secret %s with value [%s]", secret, secret.GetString())
+	}
+
+	var received []string
+	secret.OnChange(func(value []byte) { received = append(received, string(value)) })
+	secret.OnChange(func([]byte) { panic("consumer failed") })
+
+	watcher.Refresh()
+	if len(received) != 0 {
+		t.Errorf("expected no notification for unchanged secret, got %v", received)
+	}
+
+	writeFile(t, path, "second\n")
+	watcher.Refresh()
+	if secret.GetString() != "second" || !reflect.DeepEqual(received, []string{"second"}) {
+		t.Errorf("expected rotated value, got [%s] and notifications %v", secret.GetString(), received)
+	}
+
+	// a failed read keeps the previous value
+	os.Remove(path)
+	watcher.Refresh()
+	if secret.GetString() != "second" {
+		t.Errorf("expected previous value to be kept, got [%s]", secret.GetString())
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("SECRETUTIL_TEST", "fromenv")
+	if value, err := EnvSource("SECRETUTIL_TEST").Read(); err != nil || string(value) != "fromenv" {
+		t.Errorf("expected value from environment, got [%s] %v", value, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "secret")
+	writeFile(t, path, "fromfile")
+	t.Setenv("SECRETUTIL_TEST_FILE", path)
+	if value, err := EnvSource("SECRETUTIL_TEST").Read(); err != nil || string(value) != "fromfile" {
+		t.Errorf("expected value from file, got [%s] %v", value, err)
+	}
+
+	if _, err := EnvSource("SECRETUTIL_TEST_MISSING").Read(); err == nil {
+		t.Error("expected error for missing variable")
+	}
+}
+
+func TestWatchFailsForMissingSecret(t *testing.T) {
+	if _, err := NewWatcher(0).Watch("missing", FileSource(filepath.Join(t.TempDir(), "missing"))); err == nil {
+		t.Error("expected error for missing secret")
+	}
+}
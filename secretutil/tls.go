@@ -0,0 +1,69 @@
+package secretutil
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+)
+
+// CertificateReloader provides the current certificate of a key pair held by
+// two secrets. A rotated pair is only used once both secrets match.
+type CertificateReloader struct {
+	cert        *Secret
+	key         *Secret
+	certificate atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateReloader parses the PEM encoded key pair of cert and key and reloads it when they change
+func NewCertificateReloader(cert *Secret, key *Secret) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{cert: cert, key: key}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	cert.OnChange(func([]byte) { reloader.tryReload() })
+	key.OnChange(func([]byte) { reloader.tryReload() })
+	return reloader, nil
+}
+
+func (reloader *CertificateReloader) reload() error {
+	certificate, err := tls.X509KeyPair(reloader.cert.Get(), reloader.key.Get())
+	if err != nil {
+		return fmt.Errorf("failed to parse key pair of [%s] and [%s] [%w]", reloader.cert.Name(), reloader.key.Name(), err)
+	}
+	reloader.certificate.Store(&certificate)
+	return nil
+}
+
+// tryReload keeps the previous certificate if only one secret of the pair was rotated yet
+func (reloader *CertificateReloader) tryReload() {
+	if err := reloader.reload(); err != nil {
+		logger.Debugf("Keeping previous certificate: %v", err)
+		return
+	}
+	logger.Infof("Reloaded certificate of [%s]", reloader.cert.Name())
+}
+
+// Certificate returns the current certificate
+func (reloader *CertificateReloader) Certificate() *tls.Certificate {
+	return reloader.certificate.Load()
+}
+
+// ServerConfig returns a TLS config for servers presenting the current certificate
+func (reloader *CertificateReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return reloader.Certificate(), nil
+		},
+	}
+}
+
+// ClientConfig returns a TLS config for clients presenting the current certificate
+func (reloader *CertificateReloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return reloader.Certificate(), nil
+		},
+	}
+}
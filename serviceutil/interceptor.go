@@ -0,0 +1,27 @@
+package serviceutil
+
+import (
+	"context"
+
+	"github.com/science-computing/service-common-golang/grpcutil"
+
+	"google.golang.org/grpc"
+)
+
+// metadata keys used for request correlation
+const (
+	RequestIDMetadataKey     = grpcutil.RequestIDMetadataKey
+	TraceParentMetadataKey   = grpcutil.TraceParentMetadataKey
+	CallerServiceMetadataKey = grpcutil.CallerServiceMetadataKey
+)
+
+// RequestIDUnaryInterceptor stores a logger with request_id and trace_id fields
+// in the request context, see grpcutil.RequestID
+func RequestIDUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	return handler(grpcutil.WithRequestLogger(ctx), req)
+}
+
+// RequestIDStreamInterceptor is the stream variant of RequestIDUnaryInterceptor
+func RequestIDStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return grpcutil.RequestID().Stream(srv, stream, info, handler)
+}
@@ -3,19 +3,32 @@ package serviceutil
 
 import (
 	"context"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/grpcutil"
+	"github.com/science-computing/service-common-golang/healthutil"
+	"github.com/science-computing/service-common-golang/metricsutil"
+	"github.com/science-computing/service-common-golang/shutdownutil"
 
 	"github.com/apex/log"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	"github.com/pkg/errors"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 )
@@ -23,6 +36,9 @@ import (
 const metricsPublishPort string = "8080"
 const restPublishPort string = "8081"
 const grpcPublishPort string = "8090"
+const readinessTimeout = 5 * time.Second
+const healthCheckInterval = 10 * time.Second
+const shutdownTimeout = 10 * time.Second
 
 // ErrInvalidArgument indicates, that one or more provided arguments are invalid, e.g. required data is missing
 var ErrInvalidArgument = errors.New("One ore more request arguments are invalid")
@@ -42,6 +58,24 @@ type Service struct {
 	Service            interface{}
 	ServeHTTP          bool // enables REST endpoints
 	SwaggerJsonPath    string
+	LogLevelToken      string // bearer token for PUT /loglevel on the metrics port, endpoint is disabled if empty
+	// ReadinessChecks are registered as critical checks of HealthRegistry on
+	// Start, e.g. cacheutil.RedisCache.HealthCheck
+	ReadinessChecks map[string]func(ctx context.Context) error
+	// HealthRegistry drives the gRPC health service and GET /readyz on the
+	// metrics port, which fails with 503 if a critical check fails. GET /ready
+	// is an alias of /readyz. Default is healthutil.DefaultRegistry, which serves
+	// the checks registered via healthutil.Register. Set a private registry to
+	// isolate the checks of the Service.
+	HealthRegistry *healthutil.Registry
+	// HealthCheckInterval is the interval the gRPC health status is updated in, default 10s
+	HealthCheckInterval time.Duration
+	// ShutdownTimeout limits draining in-flight requests on Stop, default 10s
+	ShutdownTimeout time.Duration
+
+	serversLock sync.Mutex
+	grpcServer  *grpc.Server
+	restServer  *http.Server
 }
 
 // Start runs service with GRPC and REST service endpoints.
@@ -56,21 +90,44 @@ func (service *Service) Start() {
 	if service.GrpcPublishPort == "" {
 		service.GrpcPublishPort = grpcPublishPort
 	}
+	if service.HealthRegistry == nil {
+		service.HealthRegistry = healthutil.DefaultRegistry
+	}
+	if service.HealthCheckInterval == 0 {
+		service.HealthCheckInterval = healthCheckInterval
+	}
+	if service.ShutdownTimeout == 0 {
+		service.ShutdownTimeout = shutdownTimeout
+	}
+	for name, check := range service.ReadinessChecks {
+		service.HealthRegistry.Register(name, healthutil.Critical, check)
+	}
+	shutdownutil.Register("service "+service.Name, shutdownutil.PhaseServers, service.ShutdownTimeout, service.Stop)
 
 	//TODO check service config
 
 	// start http metrics server
 	go func() {
+		defer apputil.HandlePanics()
 		http.Handle("/metrics", promhttp.HandlerFor(
-			prometheus.DefaultGatherer,
+			metricsutil.Gatherer,
 			promhttp.HandlerOpts{},
 		))
+		if service.LogLevelToken != "" {
+			http.HandleFunc("/loglevel", service.handleLogLevel)
+		}
+		http.HandleFunc("/ready", service.handleReadyz)
+		http.HandleFunc("/readyz", service.handleReadyz)
 		http.ListenAndServe(":"+service.MetricsPort, nil)
 	}()
 
+	// toggle debug log level on SIGHUP
+	apputil.WatchLevelSignal()
+
 	// start grpc server
 	service.WaitGroup.Add(1)
 	go func() {
+		defer apputil.HandlePanics()
 		if err := service.startGRPC(); err != nil {
 			log.Fatal(err.Error())
 		}
@@ -81,6 +138,7 @@ func (service *Service) Start() {
 	if service.ServeHTTP {
 		service.WaitGroup.Add(1)
 		go func() {
+			defer apputil.HandlePanics()
 			if err := service.startREST(); err != nil {
 				log.Fatal(err.Error())
 			}
@@ -90,6 +148,72 @@ func (service *Service) Start() {
 	log.Infof("Service [%v] started", service.Name)
 }
 
+// handleLogLevel returns the current log level on GET and sets the log level
+// given as plain text body on PUT, e.g. curl -X PUT -H "Authorization: Bearer $TOKEN" -d debug
+func (service *Service) handleLogLevel(writer http.ResponseWriter, request *http.Request) {
+	token, bearer := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+	if !bearer || subtle.ConstantTimeCompare([]byte(token), []byte(service.LogLevelToken)) != 1 {
+		http.Error(writer, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(request.Body, 64))
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		level, err := log.ParseLevel(strings.TrimSpace(string(body)))
+		if err != nil {
+			http.Error(writer, fmt.Sprintf("invalid log level [%s]", body), http.StatusBadRequest)
+			return
+		}
+		apputil.SetLevel(level)
+		log.Infof("Log level set to [%v] via HTTP", level)
+	default:
+		writer.Header().Set("Allow", "GET, PUT")
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	fmt.Fprintln(writer, apputil.GetLevel())
+}
+
+// handleReadyz runs all health checks and responds with the healthutil.Report
+// as JSON, with status 503 if a critical check fails
+func (service *Service) handleReadyz(writer http.ResponseWriter, request *http.Request) {
+	ctx, cancel := context.WithTimeout(request.Context(), readinessTimeout)
+	defer cancel()
+
+	report := service.HealthRegistry.Run(ctx)
+	writer.Header().Set("Content-Type", "application/json")
+	if report.Status == healthutil.StatusDown {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(writer).Encode(report)
+}
+
+// watchHealth updates the status of the gRPC health service from the health checks
+func (service *Service) watchHealth(healthServer *health.Server) {
+	update := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		defer cancel()
+		status := healthpb.HealthCheckResponse_SERVING
+		if service.HealthRegistry.Run(ctx).Status == healthutil.StatusDown {
+			status = healthpb.HealthCheckResponse_NOT_SERVING
+		}
+		healthServer.SetServingStatus("", status)
+		healthServer.SetServingStatus(service.Name, status)
+	}
+	update()
+	ticker := time.NewTicker(service.HealthCheckInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		update()
+	}
+}
+
 func (service *Service) startREST() error {
 	// create top level context
 	ctx := context.Background()
@@ -132,8 +256,16 @@ func (service *Service) startREST() error {
 	fs := http.FileServer(http.Dir("web"))
 	mux.Handle("/swagger-ui/", http.StripPrefix("/swagger-ui", fs))
 
+	server := &http.Server{Addr: "0.0.0.0:" + service.RestPort, Handler: mux}
+	service.serversLock.Lock()
+	service.restServer = server
+	service.serversLock.Unlock()
+
 	log.Infof("HTTP server start listening on port %v", service.RestPort)
-	return http.ListenAndServe("0.0.0.0:"+service.RestPort, mux)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
 func (service *Service) startGRPC() error {
@@ -143,17 +275,72 @@ func (service *Service) startGRPC() error {
 		return fmt.Errorf("failed to create Listen for GRPC service [%w]", err)
 	}
 
-	// create new grpc server
-	server := grpc.NewServer(service.GrpcOptions...)
+	server, healthServer := service.newGrpcServer()
+	service.serversLock.Lock()
+	service.grpcServer = server
+	service.serversLock.Unlock()
+	go func() {
+		defer apputil.HandlePanics()
+		service.watchHealth(healthServer)
+	}()
+	grpc.EnableTracing = true
+
+	log.Infof("GRPC server start listening on port %v", service.GrpcPublishPort)
+	return server.Serve(listen)
+}
+
+// Stop stops accepting requests and waits for in-flight requests until ctx is
+// done, then closes the remaining connections. Start registers it as closer of
+// shutdownutil.PhaseServers, so it runs on apputil.Exit.
+func (service *Service) Stop(ctx context.Context) error {
+	service.serversLock.Lock()
+	grpcServer, restServer := service.grpcServer, service.restServer
+	service.serversLock.Unlock()
+
+	var err error
+	if restServer != nil {
+		if err = restServer.Shutdown(ctx); err != nil {
+			restServer.Close()
+		}
+	}
+	if grpcServer != nil {
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+			err = ctx.Err()
+		}
+	}
+	log.Infof("Service [%v] stopped", service.Name)
+	return err
+}
+
+// NewGrpcServer creates the GRPC server Start serves, with the interceptors of
+// grpcutil.StandardServerInterceptors, reflection, the health service and the registered service, e.g. to
+// serve it on a custom listener in tests. The health status is not updated
+// from the health checks.
+func (service *Service) NewGrpcServer() *grpc.Server {
+	server, _ := service.newGrpcServer()
+	return server
+}
+
+func (service *Service) newGrpcServer() (*grpc.Server, *health.Server) {
+	// create new grpc server with the standard interceptors, e.g. request scoped loggers
+	options := append(grpcutil.Chain(grpcutil.StandardServerInterceptors()...), service.GrpcOptions...)
+	server := grpc.NewServer(options...)
 
 	reflection.Register(server)
-	grpc.EnableTracing = true
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
 
 	// register service
 	service.RegisterServerFunc(server, service.Service)
-
-	log.Infof("GRPC server start listening on port %v", service.GrpcPublishPort)
-	return server.Serve(listen)
+	return server, healthServer
 }
 
 // GetServiceConnection establishes connection to GRPC service at given URL.
@@ -201,6 +388,32 @@ func AsGrpcError(err error, message string, messageArgs ...interface{}) error {
 	return grpcErr
 }
 
-// CloseContexts is deprecated
+// FieldViolation describes why a field of a request is invalid
+type FieldViolation struct {
+	Field       string
+	Description string
+}
+
+// InvalidArgumentError returns a codes.InvalidArgument error with the given
+// violations attached as google.rpc.BadRequest details
+func InvalidArgumentError(message string, violations ...FieldViolation) error {
+	badRequest := &errdetails.BadRequest{}
+	for _, violation := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       violation.Field,
+			Description: violation.Description,
+		})
+	}
+	grpcStatus, err := status.New(codes.InvalidArgument, message).WithDetails(badRequest)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, message)
+	}
+	return grpcStatus.Err()
+}
+
+// CloseContexts runs the closers registered with shutdownutil.
+//
+// Deprecated: use shutdownutil.Shutdown
 func CloseContexts() {
+	shutdownutil.Shutdown(context.Background())
 }
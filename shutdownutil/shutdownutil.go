@@ -0,0 +1,200 @@
+// Package shutdownutil releases the resources of a service in a defined order
+// when it stops, e.g. servers before consumers before DB connections
+package shutdownutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+)
+
+// DefaultTimeout limits a closer registered with a timeout of 0
+const DefaultTimeout = 5 * time.Second
+
+// Phase orders closers, all closers of a phase run concurrently after the
+// closers of the previous phases finished
+type Phase int
+
+const (
+	// PhaseServers stops accepting requests and drains in-flight ones
+	PhaseServers Phase = iota
+	// PhaseConsumers stops consuming messages
+	PhaseConsumers
+	// PhaseWorkers drains background work like worker pools and schedulers
+	PhaseWorkers
+	// PhaseConnections closes DB, AMQP and cache connections
+	PhaseConnections
+	// PhaseTelemetry flushes audit events, traces and logs
+	PhaseTelemetry
+)
+
+var logger = apputil.Named("shutdownutil")
+
+type closer struct {
+	name    string
+	phase   Phase
+	timeout time.Duration
+	close   func(ctx context.Context) error
+}
+
+// Manager runs registered closers once on Shutdown
+type Manager struct {
+	mutex    sync.Mutex
+	closers  []closer
+	once     sync.Once
+	err      error
+	shutdown chan struct{}
+}
+
+// NewManager creates an empty Manager
+func NewManager() *Manager {
+	return &Manager{shutdown: make(chan struct{})}
+}
+
+// Register adds a closer run in phase on Shutdown, with a context done after
+// timeout (default DefaultTimeout). Closers of a phase run in parallel.
+func (manager *Manager) Register(name string, phase Phase, timeout time.Duration, close func(ctx context.Context) error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+	manager.closers = append(manager.closers, closer{name: name, phase: phase, timeout: timeout, close: close})
+}
+
+// Shutdown runs all closers phase by phase and returns their joined errors.
+// Closers only run once, further calls wait for the first one and return its result.
+func (manager *Manager) Shutdown(ctx context.Context) error {
+	manager.once.Do(func() {
+		defer close(manager.shutdown)
+		manager.mutex.Lock()
+		closers := append([]closer{}, manager.closers...)
+		manager.mutex.Unlock()
+		sort.SliceStable(closers, func(i, j int) bool { return closers[i].phase < closers[j].phase })
+
+		var errs []error
+		for start := 0; start < len(closers); {
+			end := start
+			for end < len(closers) && closers[end].phase == closers[start].phase {
+				end++
+			}
+			errs = append(errs, runPhase(ctx, closers[start:end])...)
+			start = end
+		}
+		manager.err = errors.Join(errs...)
+	})
+	<-manager.shutdown
+	return manager.err
+}
+
+// Done is closed when Shutdown finished
+func (manager *Manager) Done() <-chan struct{} {
+	return manager.shutdown
+}
+
+func runPhase(ctx context.Context, closers []closer) []error {
+	errs := make([]error, len(closers))
+	var wg sync.WaitGroup
+	for index := range closers {
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			errs[index] = run(ctx, closers[index])
+		}(index)
+	}
+	wg.Wait()
+	return errs
+}
+
+func run(ctx context.Context, closer closer) (err error) {
+	ctx, cancel := context.WithTimeout(ctx, closer.timeout)
+	defer cancel()
+	start := time.Now()
+	defer func() {
+		if err != nil {
+			err = fmt.Errorf("failed to close [%s] [%w]", closer.name, err)
+			logger.Errorf("%v after %v", err, time.Since(start))
+			return
+		}
+		logger.Debugf("Closed [%s] in %v", closer.name, time.Since(start))
+	}()
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("closer panicked: %v", recovered)
+			}
+		}()
+		done <- closer.close(ctx)
+	}()
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
+
+var (
+	// Default is the Manager run on apputil.Exit once a closer was registered
+	Default   = NewManager()
+	hookOnce  sync.Once
+	signalsOn sync.Once
+)
+
+// Register adds a closer to Default, see Manager.Register. Default is shut
+// down by an apputil exit hook, i.e. on apputil.Exit, fatal log entries and
+// the SIGTERM handling of HandleSignals or k8sutil.HandleShutdown. The logs
+// are flushed in PhaseTelemetry. Packages register their resources
+// themselves, e.g. dbutil.DbConnectionHelper.RegisterShutdown,
+// auditutil.RegisterShutdown and traceutil.RegisterShutdown.
+func Register(name string, phase Phase, timeout time.Duration, close func(ctx context.Context) error) {
+	hookOnce.Do(func() {
+		apputil.RegisterExitHook("shutdownutil", func(ctx context.Context) {
+			Default.Shutdown(ctx)
+		})
+		Default.Register("logs", PhaseTelemetry, 0, func(ctx context.Context) error {
+			apputil.FlushLogs()
+			return nil
+		})
+	})
+	Default.Register(name, phase, timeout, close)
+}
+
+// Shutdown runs the closers of Default
+func Shutdown(ctx context.Context) error {
+	return Default.Shutdown(ctx)
+}
+
+// HandleSignals exits via apputil.Exit on SIGINT or SIGTERM, which shuts down
+// Default. Use k8sutil.HandleShutdown instead in Kubernetes.
+func HandleSignals() {
+	signalsOn.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			defer apputil.HandlePanics()
+			received := <-signals
+			logger.Infof("Received %v, shutting down", received)
+			apputil.Exit(0)
+		}()
+	})
+}
+
+// Closer adapts io.Closer like an AMQP context, a Redis cache or a messaging
+// consumer to a closer function
+func Closer(closer io.Closer) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return closer.Close()
+	}
+}
@@ -0,0 +1,60 @@
+package shutdownutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownRunsPhasesInOrder(t *testing.T) {
+	manager := NewManager()
+	var mutex sync.Mutex
+	var order []string
+	record := func(name string, err error) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			order = append(order, name)
+			return err
+		}
+	}
+	failure := errors.New("close failed")
+	manager.Register("logs", PhaseTelemetry, 0, record("logs", nil))
+	manager.Register("db", PhaseConnections, 0, record("db", failure))
+	manager.Register("grpc", PhaseServers, 0, record("grpc", nil))
+	manager.Register("panicking", PhaseWorkers, 0, func(ctx context.Context) error { panic("broken") })
+
+	err := manager.Shutdown(context.Background())
+	if !errors.Is(err, failure) {
+		t.Errorf("expected close error, got %v", err)
+	}
+	if len(order) != 3 || order[0] != "grpc" || order[1] != "db" || order[2] != "logs" {
+		t.Errorf("unexpected order %v", order)
+	}
+
+	// closers run only once
+	if second := manager.Shutdown(context.Background()); second != err || len(order) != 3 {
+		t.Errorf("expected same result without running closers again, got %v and %v", second, order)
+	}
+}
+
+func TestShutdownTimesOutSlowCloser(t *testing.T) {
+	manager := NewManager()
+	manager.Register("slow", PhaseWorkers, 10*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second)
+		return nil
+	})
+	closed := false
+	manager.Register("db", PhaseConnections, 0, func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	start := time.Now()
+	err := manager.Shutdown(context.Background())
+	if !errors.Is(err, context.DeadlineExceeded) || !closed || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("expected slow closer to time out and next phase to run, got %v after %v", err, time.Since(start))
+	}
+}
@@ -0,0 +1,196 @@
+package testutil
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// FakeAmqp is an in-memory amqputil.AmqpAccessor. Published messages are JSON
+// encoded like by amqputil.AmqpContext and queued until received. Receiving
+// from an empty queue fails immediately with amqputil.ErrNoMessage.
+type FakeAmqp struct {
+	// PublishError is returned by PublishMessage if set
+	PublishError error
+
+	mutex   sync.Mutex
+	queues  map[string][]amqp.Delivery
+	err     error
+	closed  bool
+	channel *fakeChannel
+}
+
+// NewFakeAmqp creates an empty FakeAmqp
+func NewFakeAmqp() *FakeAmqp {
+	fake := &FakeAmqp{queues: make(map[string][]amqp.Delivery)}
+	fake.channel = &fakeChannel{fake: fake}
+	return fake
+}
+
+func (fake *FakeAmqp) PublishMessage(queueName string, message interface{}, options ...amqputil.QueueOptions) error {
+	return fake.PublishMessageCtx(context.Background(), queueName, message, options...)
+}
+
+func (fake *FakeAmqp) PublishMessageCtx(ctx context.Context, queueName string, message interface{}, options ...amqputil.QueueOptions) error {
+	if err := ctx.Err(); err != nil {
+		fake.SetLastError(err)
+		return err
+	}
+	if fake.PublishError != nil {
+		fake.SetLastError(fake.PublishError)
+		return fake.PublishError
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		fake.SetLastError(err)
+		return err
+	}
+	fake.publish(queueName, amqp.Publishing{ContentType: "application/json", Body: body})
+	return nil
+}
+
+func (fake *FakeAmqp) ReceiveMessage(queueName string, message interface{}) (*amqp.Delivery, error) {
+	return fake.ReceiveMessageCtx(context.Background(), queueName, message)
+}
+
+func (fake *FakeAmqp) ReceiveMessageCtx(ctx context.Context, queueName string, message interface{}) (*amqp.Delivery, error) {
+	fake.mutex.Lock()
+	queue := fake.queues[queueName]
+	if len(queue) == 0 {
+		fake.err = amqputil.ErrNoMessage
+		fake.mutex.Unlock()
+		return nil, amqputil.ErrNoMessage
+	}
+	delivery := queue[0]
+	fake.queues[queueName] = queue[1:]
+	fake.mutex.Unlock()
+
+	if err := json.Unmarshal(delivery.Body, message); err != nil {
+		fake.SetLastError(err)
+		return &delivery, err
+	}
+	return &delivery, nil
+}
+
+// Messages returns the bodies of the messages queued in queueName
+func (fake *FakeAmqp) Messages(queueName string) [][]byte {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	var bodies [][]byte
+	for _, delivery := range fake.queues[queueName] {
+		bodies = append(bodies, delivery.Body)
+	}
+	return bodies
+}
+
+// Closed returns true if Close was called
+func (fake *FakeAmqp) Closed() bool {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return fake.closed
+}
+
+func (fake *FakeAmqp) Channel() amqputil.ChannelAccessor {
+	return fake.channel
+}
+
+// Ping fails after Close was called
+func (fake *FakeAmqp) Ping(ctx context.Context) error {
+	if fake.Closed() {
+		return amqputil.ErrConnectionLost
+	}
+	return nil
+}
+
+func (fake *FakeAmqp) Close() error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.closed = true
+	return nil
+}
+
+func (fake *FakeAmqp) Reset() error {
+	fake.ResetError()
+	return nil
+}
+
+func (fake *FakeAmqp) LastError() error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return fake.err
+}
+
+func (fake *FakeAmqp) SetLastError(err error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.err = err
+}
+
+func (fake *FakeAmqp) ResetError() {
+	fake.SetLastError(nil)
+}
+
+func (fake *FakeAmqp) publish(queueName string, publishing amqp.Publishing) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.queues[queueName] = append(fake.queues[queueName], amqp.Delivery{
+		ContentType: publishing.ContentType,
+		Headers:     publishing.Headers,
+		MessageId:   publishing.MessageId,
+		RoutingKey:  queueName,
+		Body:        publishing.Body,
+	})
+}
+
+// fakeChannel queues messages published to the default exchange in the queues of its FakeAmqp
+type fakeChannel struct {
+	fake *FakeAmqp
+}
+
+func (channel *fakeChannel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	return nil
+}
+
+func (channel *fakeChannel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	return channel.QueueInspect(name)
+}
+
+func (channel *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if exchange != "" {
+		return fmt.Errorf("exchange [%s] is not supported by FakeAmqp", exchange)
+	}
+	channel.fake.publish(key, msg)
+	return nil
+}
+
+func (channel *fakeChannel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	return nil, errors.New("consuming is not supported by FakeAmqp, use ReceiveMessage")
+}
+
+func (channel *fakeChannel) Close() error {
+	return nil
+}
+
+func (channel *fakeChannel) Cancel(consumer string, noWait bool) error {
+	return nil
+}
+
+func (channel *fakeChannel) QueueDelete(name string, ifUnused, ifEmpty, noWait bool) (int, error) {
+	channel.fake.mutex.Lock()
+	defer channel.fake.mutex.Unlock()
+	count := len(channel.fake.queues[name])
+	delete(channel.fake.queues, name)
+	return count, nil
+}
+
+func (channel *fakeChannel) QueueInspect(name string) (amqp.Queue, error) {
+	channel.fake.mutex.Lock()
+	defer channel.fake.mutex.Unlock()
+	return amqp.Queue{Name: name, Messages: len(channel.fake.queues[name])}, nil
+}
@@ -0,0 +1,180 @@
+package testutil
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/science-computing/service-common-golang/dbutil"
+)
+
+// FakeDb is a dbutil.DbAccessor recording executed statements. Queries are
+// answered by the configured functions, QueryRow is not supported as
+// sql.Row cannot be created outside of database/sql.
+type FakeDb struct {
+	// ExecuteFunc is called by Execute if set
+	ExecuteFunc func(query string, args ...interface{}) error
+	// QueryFunc is called by Query, default returns no rows
+	QueryFunc func(query string, args ...interface{}) (dbutil.RowsAccessor, error)
+	// ScanQueryRowFunc is called by ScanQueryRow, default returns sql.ErrNoRows
+	ScanQueryRowFunc func(query dbutil.Query, destination []interface{}) error
+
+	mutex        sync.Mutex
+	executed     []dbutil.Query
+	commits      int
+	rollbacks    int
+	err          error
+	errorHandler func(err error)
+}
+
+// Executed returns the statements passed to Execute
+func (fake *FakeDb) Executed() []dbutil.Query {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return append([]dbutil.Query(nil), fake.executed...)
+}
+
+// Commits returns the number of Commit calls
+func (fake *FakeDb) Commits() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return fake.commits
+}
+
+// Rollbacks returns the number of Rollback calls
+func (fake *FakeDb) Rollbacks() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return fake.rollbacks
+}
+
+func (fake *FakeDb) RegisterErrorHandler(errorHandler func(err error)) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.errorHandler = errorHandler
+}
+
+func (fake *FakeDb) QueryRow(query string, args ...interface{}) (*sql.Row, error) {
+	return nil, fake.fail(errors.New("QueryRow is not supported by FakeDb, use ScanQueryRow"))
+}
+
+func (fake *FakeDb) ScanQueryRow(supressErrNoRows bool, query dbutil.Query, destination []interface{}) error {
+	err := sql.ErrNoRows
+	if fake.ScanQueryRowFunc != nil {
+		err = fake.ScanQueryRowFunc(query, destination)
+	}
+	if err == sql.ErrNoRows && supressErrNoRows {
+		return nil
+	}
+	return fake.fail(err)
+}
+
+func (fake *FakeDb) Query(query string, args ...interface{}) (dbutil.RowsAccessor, error) {
+	if fake.QueryFunc == nil {
+		return &FakeRows{}, nil
+	}
+	rows, err := fake.QueryFunc(query, args...)
+	return rows, fake.fail(err)
+}
+
+func (fake *FakeDb) Execute(query string, args ...interface{}) error {
+	fake.mutex.Lock()
+	fake.executed = append(fake.executed, dbutil.Query{Query: query, Args: args})
+	fake.mutex.Unlock()
+	if fake.ExecuteFunc == nil {
+		return nil
+	}
+	return fake.fail(fake.ExecuteFunc(query, args...))
+}
+
+func (fake *FakeDb) Commit(restartTx bool) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.commits++
+	return nil
+}
+
+func (fake *FakeDb) Rollback(restartTx bool) error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.rollbacks++
+	return nil
+}
+
+func (fake *FakeDb) Close() error {
+	return nil
+}
+
+func (fake *FakeDb) LastError() error {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return fake.err
+}
+
+func (fake *FakeDb) SetLastError(err error) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.err = err
+}
+
+func (fake *FakeDb) ResetError() {
+	fake.SetLastError(nil)
+}
+
+// fail records err as last error and passes it to the error handler
+func (fake *FakeDb) fail(err error) error {
+	if err == nil {
+		return nil
+	}
+	fake.mutex.Lock()
+	fake.err = err
+	errorHandler := fake.errorHandler
+	fake.mutex.Unlock()
+	if errorHandler != nil {
+		errorHandler(err)
+	}
+	return err
+}
+
+// FakeRows is a dbutil.RowsAccessor over fixed rows, e.g. returned by FakeDb.QueryFunc
+type FakeRows struct {
+	Rows    [][]interface{}
+	current int
+}
+
+func (rows *FakeRows) Next() bool {
+	if rows.current >= len(rows.Rows) {
+		return false
+	}
+	rows.current++
+	return true
+}
+
+// Scan assigns the values of the current row to dest, which must be pointers
+// to the types of the values
+func (rows *FakeRows) Scan(dest ...interface{}) error {
+	if rows.current == 0 {
+		return errors.New("Scan called without Next")
+	}
+	row := rows.Rows[rows.current-1]
+	if len(row) != len(dest) {
+		return errors.New("number of destinations does not match the number of columns")
+	}
+	for i, value := range row {
+		destination := reflect.ValueOf(dest[i])
+		if destination.Kind() != reflect.Pointer {
+			return fmt.Errorf("cannot scan into non-pointer [%T]", dest[i])
+		}
+		if value == nil {
+			destination.Elem().SetZero()
+			continue
+		}
+		if !reflect.ValueOf(value).Type().AssignableTo(destination.Elem().Type()) {
+			return fmt.Errorf("cannot scan [%T] into [%T]", value, dest[i])
+		}
+		destination.Elem().Set(reflect.ValueOf(value))
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package testutil
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/apex/log"
+)
+
+// LogCapture records the log entries written while a test runs
+type LogCapture struct {
+	mutex   sync.Mutex
+	entries []*log.Entry
+}
+
+// CaptureLogs replaces the apputil output handler by a LogCapture until the test
+// finishes. Level filtering and masking still apply. Tests capturing logs must
+// not run in parallel.
+func CaptureLogs(t testing.TB) *LogCapture {
+	capture := &LogCapture{}
+	previous := apputil.SetOutputHandler(capture)
+	t.Cleanup(func() { apputil.SetOutputHandler(previous) })
+	return capture
+}
+
+func (capture *LogCapture) HandleLog(entry *log.Entry) error {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	capture.entries = append(capture.entries, entry)
+	return nil
+}
+
+// Entries returns the captured entries
+func (capture *LogCapture) Entries() []*log.Entry {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	return append([]*log.Entry(nil), capture.entries...)
+}
+
+// Contains returns true if an entry of at least level contains message
+func (capture *LogCapture) Contains(level log.Level, message string) bool {
+	for _, entry := range capture.Entries() {
+		if entry.Level >= level && strings.Contains(entry.Message, message) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset removes the captured entries
+func (capture *LogCapture) Reset() {
+	capture.mutex.Lock()
+	defer capture.mutex.Unlock()
+	capture.entries = nil
+}
@@ -0,0 +1,63 @@
+// Package testutil provides an in-process harness for service tests with
+// fake AMQP and DB accessors and log capture
+package testutil
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/serviceutil"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const bufferSize = 1024 * 1024
+
+// StartService serves the GRPC server of service (see serviceutil.Service.NewGrpcServer)
+// on an in-memory connection and returns a client connection to it. Server and
+// connection are stopped when the test finishes, e.g.
+//
+//	conn := testutil.StartService(t, &serviceutil.Service{Service: server, RegisterServerFunc: register})
+//	client := pb.NewOrderServiceClient(conn)
+func StartService(t testing.TB, service *serviceutil.Service) *grpc.ClientConn {
+	t.Helper()
+	listener := bufconn.Listen(bufferSize)
+	dialer := func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}
+	serve(t, service, listener)
+	return dial(t, "passthrough:///bufnet", grpc.WithContextDialer(dialer))
+}
+
+// StartServiceTCP is like StartService, but serves on an ephemeral port of the
+// loopback interface and also returns its address, e.g. for tests of clients
+// not accepting a grpc.ClientConn
+func StartServiceTCP(t testing.TB, service *serviceutil.Service) (*grpc.ClientConn, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen on ephemeral port [%v]", err)
+	}
+	serve(t, service, listener)
+	address := listener.Addr().String()
+	return dial(t, address), address
+}
+
+func serve(t testing.TB, service *serviceutil.Service, listener net.Listener) {
+	server := service.NewGrpcServer()
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+}
+
+func dial(t testing.TB, target string, options ...grpc.DialOption) *grpc.ClientConn {
+	options = append(options, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient(target, options...)
+	if err != nil {
+		t.Fatalf("failed to connect to [%s] [%v]", target, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
@@ -0,0 +1,82 @@
+package testutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/amqputil"
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/dbutil"
+	"github.com/science-computing/service-common-golang/serviceutil"
+
+	"github.com/apex/log"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	_ amqputil.AmqpAccessor = (*FakeAmqp)(nil)
+	_ dbutil.DbAccessor     = (*FakeDb)(nil)
+)
+
+func TestStartService(t *testing.T) {
+	service := &serviceutil.Service{Name: "test", RegisterServerFunc: func(*grpc.Server, interface{}) {}}
+	conn := StartService(t, service)
+	response, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+	if err != nil || response.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("expected serving health status, got %v %v", response, err)
+	}
+
+	conn, address := StartServiceTCP(t, service)
+	if address == "" {
+		t.Error("expected address")
+	}
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Errorf("health check via TCP failed [%v]", err)
+	}
+}
+
+func TestFakeAmqp(t *testing.T) {
+	fake := NewFakeAmqp()
+	if err := fake.PublishMessage("orders", map[string]string{"id": "1"}); err != nil {
+		t.Fatal(err)
+	}
+	var message map[string]string
+	if _, err := fake.ReceiveMessage("orders", &message); err != nil || message["id"] != "1" {
+		t.Errorf("unexpected message %v %v", message, err)
+	}
+	if _, err := fake.ReceiveMessage("orders", &message); err != amqputil.ErrNoMessage {
+		t.Errorf("expected ErrNoMessage, got %v", err)
+	}
+}
+
+func TestFakeDb(t *testing.T) {
+	fake := &FakeDb{QueryFunc: func(query string, args ...interface{}) (dbutil.RowsAccessor, error) {
+		return &FakeRows{Rows: [][]interface{}{{"a", 1}, {"b", nil}}}, nil
+	}}
+	fake.Execute("DELETE FROM orders WHERE id = $1", 1)
+	if executed := fake.Executed(); len(executed) != 1 || executed[0].Args[0] != 1 {
+		t.Errorf("unexpected executed statements %v", executed)
+	}
+	rows, _ := fake.Query("SELECT name, count FROM orders")
+	var names []string
+	for rows.Next() {
+		var name string
+		var count int
+		if err := rows.Scan(&name, &count); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if len(names) != 2 {
+		t.Errorf("expected 2 rows, got %v", names)
+	}
+}
+
+func TestCaptureLogs(t *testing.T) {
+	capture := CaptureLogs(t)
+	apputil.Named("testutil").Warnf("order [%d] rejected", 42)
+	if !capture.Contains(log.WarnLevel, "order [42] rejected") {
+		t.Errorf("expected captured entry, got %v", capture.Entries())
+	}
+}
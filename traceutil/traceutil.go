@@ -0,0 +1,159 @@
+// Package traceutil initializes OpenTelemetry tracing from config
+package traceutil
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/science-computing/service-common-golang/apputil"
+	"github.com/science-computing/service-common-golang/shutdownutil"
+
+	"github.com/spf13/viper"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	endpointConfigKey    = "tracing.endpoint"
+	insecureConfigKey    = "tracing.insecure"
+	sampleRatioConfigKey = "tracing.sampleratio"
+	attributesConfigKey  = "tracing.attributes"
+	defaultSampleRatio   = 1.0
+)
+
+func init() {
+	apputil.RegisterConfigKeys("traceutil",
+		apputil.ConfigKey{Key: endpointConfigKey, Type: "string", Description: "OTLP gRPC endpoint traces are exported to, tracing is disabled if empty"},
+		apputil.ConfigKey{Key: insecureConfigKey, Type: "bool", Default: "false", Description: "connect to the endpoint without TLS"},
+		apputil.ConfigKey{Key: sampleRatioConfigKey, Type: "float", Default: "1.0", Description: "ratio of sampled root spans"},
+		apputil.ConfigKey{Key: attributesConfigKey + ".*", Type: "string", Description: "additional resource attributes"},
+	)
+}
+
+var (
+	logger = apputil.Named("traceutil")
+
+	providerLock sync.Mutex
+	provider     *sdktrace.TracerProvider
+	exitHookOnce sync.Once
+
+	resourceAttributes []attribute.KeyValue
+)
+
+// Init sets the global tracer provider exporting spans via OTLP/gRPC to
+// tracing.endpoint, e.g. otel-collector:4317, using TLS unless tracing.insecure.
+// Root spans are sampled with tracing.sampleratio (default 1), child spans
+// follow their parent. Spans carry the resource attributes service.name,
+// service.version (apputil.GetVersion), those added by AddResourceAttributes
+// and the map tracing.attributes.
+// Without endpoint tracing stays disabled. Buffered spans are flushed by an
+// exit hook, see apputil.Exit, or by Shutdown.
+func Init(serviceName string) error {
+	endpoint := viper.GetString(endpointConfigKey)
+	if endpoint == "" {
+		logger.Debugf("Tracing disabled, [%s] not set", endpointConfigKey)
+		return nil
+	}
+
+	options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+	if viper.GetBool(insecureConfigKey) {
+		options = append(options, otlptracegrpc.WithInsecure())
+	}
+	exporter, err := otlptracegrpc.New(context.Background(), options...)
+	if err != nil {
+		return fmt.Errorf("failed to create OTLP exporter for [%s] [%w]", endpoint, err)
+	}
+
+	sampleRatio := defaultSampleRatio
+	if viper.IsSet(sampleRatioConfigKey) {
+		sampleRatio = viper.GetFloat64(sampleRatioConfigKey)
+	}
+	newProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(newResource(serviceName)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	SetTracerProvider(newProvider)
+	logger.Infof("Exporting traces to [%s] with sample ratio %v", endpoint, sampleRatio)
+	return nil
+}
+
+// SetTracerProvider sets the global tracer provider and the W3C trace context
+// propagator. A previously set provider is shut down.
+func SetTracerProvider(newProvider *sdktrace.TracerProvider) {
+	otel.SetTracerProvider(newProvider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	providerLock.Lock()
+	previous := provider
+	provider = newProvider
+	providerLock.Unlock()
+	if previous != nil {
+		previous.Shutdown(context.Background())
+	}
+
+	exitHookOnce.Do(func() {
+		apputil.RegisterExitHook("traceutil", func(ctx context.Context) {
+			if err := Shutdown(ctx); err != nil {
+				logger.Errorf("Failed to flush traces: %v", err)
+			}
+		})
+	})
+}
+
+// Shutdown exports the buffered spans and stops the tracer provider set by Init
+func Shutdown(ctx context.Context) error {
+	providerLock.Lock()
+	current := provider
+	provider = nil
+	providerLock.Unlock()
+	if current == nil {
+		return nil
+	}
+	return current.Shutdown(ctx)
+}
+
+// Tracer returns a tracer of the global tracer provider, e.g. Tracer("dbutil")
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// AddResourceAttributes adds attributes to the resource of the tracer provider
+// created by Init, e.g. k8s.pod.name. It must be called before Init.
+func AddResourceAttributes(attributes ...attribute.KeyValue) {
+	providerLock.Lock()
+	defer providerLock.Unlock()
+	resourceAttributes = append(resourceAttributes, attributes...)
+}
+
+func newResource(serviceName string) *resource.Resource {
+	attributes := []attribute.KeyValue{semconv.ServiceName(serviceName)}
+	if version := apputil.GetVersion(); version != "" {
+		attributes = append(attributes, semconv.ServiceVersion(version))
+	}
+	providerLock.Lock()
+	attributes = append(attributes, resourceAttributes...)
+	providerLock.Unlock()
+	for key, value := range viper.GetStringMapString(attributesConfigKey) {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	merged, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, attributes...))
+	if err != nil {
+		// schema URLs conflict, prefer the configured attributes
+		return resource.NewWithAttributes(semconv.SchemaURL, attributes...)
+	}
+	return merged
+}
+
+// RegisterShutdown exports the buffered spans and stops the tracer provider in
+// shutdownutil.PhaseTelemetry
+func RegisterShutdown() {
+	shutdownutil.Register("traces", shutdownutil.PhaseTelemetry, 0, Shutdown)
+}
@@ -0,0 +1,50 @@
+package traceutil
+
+import (
+	"context"
+	"testing"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/spf13/viper"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInitWithoutEndpoint(t *testing.T) {
+	viper.Set(endpointConfigKey, "")
+	if err := Init("test"); err != nil {
+		t.Fatal(err)
+	}
+	if provider != nil {
+		t.Error("expected tracing to stay disabled")
+	}
+}
+
+func TestSpansCarryResourceAndCorrelate(t *testing.T) {
+	viper.Set(attributesConfigKey, map[string]string{"deployment.environment": "test"})
+	defer viper.Set(attributesConfigKey, nil)
+
+	exporter := tracetest.NewInMemoryExporter()
+	SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter), sdktrace.WithResource(newResource("tester"))))
+	defer Shutdown(context.Background())
+
+	ctx, span := Tracer("test").Start(context.Background(), "operation")
+	correlation := apputil.CorrelationFromContext(ctx)
+	span.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	if correlation.TraceID != spans[0].SpanContext.TraceID().String() {
+		t.Errorf("expected trace ID in correlation, got %q", correlation.TraceID)
+	}
+	attributes := map[string]string{}
+	for _, attribute := range spans[0].Resource.Attributes() {
+		attributes[string(attribute.Key)] = attribute.Value.Emit()
+	}
+	if attributes["service.name"] != "tester" || attributes["deployment.environment"] != "test" {
+		t.Errorf("unexpected resource attributes %v", attributes)
+	}
+}
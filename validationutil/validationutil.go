@@ -0,0 +1,151 @@
+// Package validationutil provides composable validators for request fields,
+// which accumulate violations into a codes.InvalidArgument error
+package validationutil
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/science-computing/service-common-golang/serviceutil"
+
+	"github.com/google/uuid"
+)
+
+// Rule validates a value and returns a description of the violation or "" if the value is valid
+type Rule[T any] func(value T) string
+
+// Validator accumulates the field violations of a request, e.g.
+//
+//	validator := validationutil.New()
+//	validationutil.Field(validator, "name", request.Name, validationutil.Required[string](), validationutil.Length(1, 64))
+//	validationutil.Field(validator, "id", request.Id, validationutil.UUID())
+//	if err := validator.Err(); err != nil {
+//		return nil, err
+//	}
+type Validator struct {
+	violations []serviceutil.FieldViolation
+}
+
+// New creates an empty Validator
+func New() *Validator {
+	return &Validator{}
+}
+
+// Field checks value against the rules in order and records the first violation for field
+func Field[T any](validator *Validator, field string, value T, rules ...Rule[T]) {
+	for _, rule := range rules {
+		if description := rule(value); description != "" {
+			validator.Add(field, description)
+			return
+		}
+	}
+}
+
+// Add records a violation for field, e.g. of checks spanning several fields
+func (validator *Validator) Add(field string, description string) {
+	validator.violations = append(validator.violations, serviceutil.FieldViolation{Field: field, Description: description})
+}
+
+// Valid returns true if no violation was recorded
+func (validator *Validator) Valid() bool {
+	return len(validator.violations) == 0
+}
+
+// Violations returns the recorded violations
+func (validator *Validator) Violations() []serviceutil.FieldViolation {
+	return validator.violations
+}
+
+// Err returns nil if no violation was recorded, else a codes.InvalidArgument
+// error with the violations as BadRequest details
+func (validator *Validator) Err() error {
+	if validator.Valid() {
+		return nil
+	}
+	return serviceutil.InvalidArgumentError("one or more request arguments are invalid", validator.violations...)
+}
+
+// Required rejects the zero value
+func Required[T comparable]() Rule[T] {
+	return func(value T) string {
+		var zero T
+		if value == zero {
+			return "is required"
+		}
+		return ""
+	}
+}
+
+// UUID rejects strings which are not a UUID
+func UUID() Rule[string] {
+	return func(value string) string {
+		if _, err := uuid.Parse(value); err != nil {
+			return "must be a UUID"
+		}
+		return ""
+	}
+}
+
+// Length rejects strings with less than min or more than max characters, max is ignored if 0
+func Length(min int, max int) Rule[string] {
+	return func(value string) string {
+		length := utf8.RuneCountInString(value)
+		if length < min {
+			return fmt.Sprintf("must have at least %d characters", min)
+		}
+		if max > 0 && length > max {
+			return fmt.Sprintf("must have at most %d characters", max)
+		}
+		return ""
+	}
+}
+
+// Range rejects values less than min or greater than max
+func Range[T cmp.Ordered](min T, max T) Rule[T] {
+	return func(value T) string {
+		if value < min || value > max {
+			return fmt.Sprintf("must be between %v and %v", min, max)
+		}
+		return ""
+	}
+}
+
+// Regex rejects strings not matching pattern, it panics if pattern does not compile
+func Regex(pattern string) Rule[string] {
+	expression := regexp.MustCompile(pattern)
+	return func(value string) string {
+		if !expression.MatchString(value) {
+			return fmt.Sprintf("must match %s", pattern)
+		}
+		return ""
+	}
+}
+
+// Enum rejects values not in allowed
+func Enum[T comparable](allowed ...T) Rule[T] {
+	return func(value T) string {
+		if !slices.Contains(allowed, value) {
+			return fmt.Sprintf("must be one of %v", allowed)
+		}
+		return ""
+	}
+}
+
+// Optional applies rules only to non-zero values
+func Optional[T comparable](rules ...Rule[T]) Rule[T] {
+	return func(value T) string {
+		var zero T
+		if value == zero {
+			return ""
+		}
+		for _, rule := range rules {
+			if description := rule(value); description != "" {
+				return description
+			}
+		}
+		return ""
+	}
+}
@@ -0,0 +1,51 @@
+package validationutil
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidatorAccumulatesViolations(t *testing.T) {
+	validator := New()
+	Field(validator, "name", "", Required[string](), Length(1, 64))
+	Field(validator, "id", "not-a-uuid", UUID())
+	Field(validator, "count", 0, Range(1, 100))
+	Field(validator, "state", "open", Enum("open", "closed"))
+	Field(validator, "code", "ab1", Regex(`^[a-z]+$`))
+	Field(validator, "comment", "", Optional(Length(3, 0)))
+
+	err := validator.Err()
+	grpcStatus, _ := status.FromError(err)
+	if grpcStatus.Code() != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+	details := grpcStatus.Details()
+	if len(details) != 1 {
+		t.Fatalf("expected BadRequest details, got %v", details)
+	}
+	violations := details[0].(*errdetails.BadRequest).FieldViolations
+	fields := []string{"name", "id", "count", "code"}
+	if len(violations) != len(fields) {
+		t.Fatalf("expected %d violations, got %v", len(fields), violations)
+	}
+	for i, field := range fields {
+		if violations[i].Field != field {
+			t.Errorf("expected violation of [%s], got [%s]", field, violations[i].Field)
+		}
+	}
+	if violations[0].Description != "is required" {
+		t.Errorf("expected only the first violation per field, got [%s]", violations[0].Description)
+	}
+}
+
+func TestValidatorWithoutViolations(t *testing.T) {
+	validator := New()
+	Field(validator, "id", "3f1c7a1e-8d4b-4b8e-9a5e-2f6b8c1d0e7a", Required[string](), UUID())
+	Field(validator, "name", "äöü", Length(3, 3))
+	if err := validator.Err(); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+// Package workerutil provides a bounded worker pool
+package workerutil
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/science-computing/service-common-golang/apputil"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// results of tasks
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultPanic   = "panic"
+)
+
+// ErrPoolClosed is returned by Submit after Shutdown was called
+var ErrPoolClosed = errors.New("worker pool is closed")
+
+// ErrPoolFull is returned by TrySubmit if the queue is full
+var ErrPoolFull = errors.New("worker pool queue is full")
+
+var (
+	logger = apputil.Named("workerutil")
+
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_pool_queue_depth",
+		Help: "The number of tasks waiting for a worker",
+	}, []string{"pool"})
+	activeWorkers = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "worker_pool_active_workers",
+		Help: "The number of workers processing a task",
+	}, []string{"pool"})
+	taskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "worker_pool_task_duration_seconds",
+		Help:    "The processing duration of tasks",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"pool"})
+	tasks = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "worker_pool_tasks_total",
+		Help: "The total number of processed tasks by pool and result",
+	}, []string{"pool", "result"})
+)
+
+// Task is processed by a worker. ctx is the context given to Submit without
+// its cancellation, which is canceled if Shutdown times out.
+type Task func(ctx context.Context) error
+
+type queuedTask struct {
+	ctx  context.Context
+	task Task
+}
+
+// Pool processes submitted tasks with a fixed number of workers. A panicking
+// task is recovered and does not affect other tasks.
+type Pool struct {
+	name  string
+	queue chan queuedTask
+
+	mutex     sync.RWMutex
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewPool starts a pool named name for metrics with the given number of workers
+// and a queue for queueSize tasks waiting for a worker
+func NewPool(name string, workers, queueSize int) *Pool {
+	if workers <= 0 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := &Pool{name: name, queue: make(chan queuedTask, queueSize), closing: make(chan struct{}), ctx: ctx, cancel: cancel}
+	pool.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go pool.work()
+	}
+	return pool
+}
+
+// Submit queues the task and blocks while the queue is full until ctx is done
+func (pool *Pool) Submit(ctx context.Context, task Task) error {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	if pool.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case pool.queue <- queuedTask{ctx: context.WithoutCancel(ctx), task: task}:
+		queueDepth.WithLabelValues(pool.name).Inc()
+		return nil
+	case <-pool.closing:
+		return ErrPoolClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySubmit queues the task or returns ErrPoolFull without blocking
+func (pool *Pool) TrySubmit(ctx context.Context, task Task) error {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	if pool.closed {
+		return ErrPoolClosed
+	}
+	select {
+	case pool.queue <- queuedTask{ctx: context.WithoutCancel(ctx), task: task}:
+		queueDepth.WithLabelValues(pool.name).Inc()
+		return nil
+	default:
+		return ErrPoolFull
+	}
+}
+
+// Shutdown stops accepting tasks and waits until the queued tasks are processed.
+// If ctx is done before, the contexts of running tasks are canceled, remaining
+// tasks are discarded and ctx.Err() is returned.
+func (pool *Pool) Shutdown(ctx context.Context) error {
+	pool.closeOnce.Do(func() { close(pool.closing) })
+	pool.mutex.Lock()
+	if !pool.closed {
+		pool.closed = true
+		close(pool.queue)
+	}
+	pool.mutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		pool.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		logger.Warnf("Canceling tasks of worker pool [%s], shutdown timed out", pool.name)
+		pool.cancel()
+		return ctx.Err()
+	}
+}
+
+func (pool *Pool) work() {
+	defer pool.wg.Done()
+	for queued := range pool.queue {
+		queueDepth.WithLabelValues(pool.name).Dec()
+		if pool.ctx.Err() != nil {
+			continue
+		}
+		pool.process(queued)
+	}
+}
+
+func (pool *Pool) process(queued queuedTask) {
+	ctx, cancel := context.WithCancel(queued.ctx)
+	defer cancel()
+	stop := context.AfterFunc(pool.ctx, cancel)
+	defer stop()
+
+	activeWorkers.WithLabelValues(pool.name).Inc()
+	defer activeWorkers.WithLabelValues(pool.name).Dec()
+	start := time.Now()
+	result := resultSuccess
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			apputil.FromContext(ctx).Errorf("Task of worker pool [%s] panicked: %v", pool.name, recovered)
+			result = resultPanic
+		}
+		taskDuration.WithLabelValues(pool.name).Observe(time.Since(start).Seconds())
+		tasks.WithLabelValues(pool.name, result).Inc()
+	}()
+
+	if err := queued.task(ctx); err != nil {
+		apputil.FromContext(ctx).Errorf("Task of worker pool [%s] failed: %v", pool.name, err)
+		result = resultError
+	}
+}
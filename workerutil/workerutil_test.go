@@ -0,0 +1,58 @@
+package workerutil
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolProcessesAndDrains(t *testing.T) {
+	pool := NewPool("test", 2, 10)
+	var processed atomic.Int32
+	for i := 0; i < 10; i++ {
+		err := pool.Submit(context.Background(), func(ctx context.Context) error {
+			time.Sleep(time.Millisecond)
+			if processed.Add(1) == 1 {
+				panic("isolated")
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if processed.Load() != 10 {
+		t.Errorf("expected 10 processed tasks, got %d", processed.Load())
+	}
+	if err := pool.Submit(context.Background(), func(ctx context.Context) error { return nil }); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("expected closed pool, got %v", err)
+	}
+}
+
+func TestPoolFullAndShutdownTimeout(t *testing.T) {
+	pool := NewPool("test", 1, 1)
+	block := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	pool.Submit(context.Background(), block)
+	time.Sleep(10 * time.Millisecond)
+	pool.Submit(context.Background(), block)
+	if err := pool.TrySubmit(context.Background(), block); !errors.Is(err, ErrPoolFull) {
+		t.Errorf("expected full pool, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pool.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected shutdown timeout, got %v", err)
+	}
+	if err := pool.Shutdown(context.Background()); err != nil {
+		t.Errorf("expected canceled tasks to finish, got %v", err)
+	}
+}